@@ -0,0 +1,3 @@
+// Package aptomi-plugin-example is a reference external plugin for Aptomi (pkg/plugin/external/example). Put it into
+// the external plugins dir of Aptomi server to make "example" cluster and code types available.
+package main
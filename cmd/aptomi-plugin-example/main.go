@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/Aptomi/aptomi/pkg/plugin/external/example"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	if err := example.Serve(); err != nil {
+		logrus.Fatalf("%s", err)
+	}
+}
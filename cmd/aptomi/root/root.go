@@ -48,8 +48,18 @@ func init() {
 	common.AddBoolFlag(Command, "ui.enable", "ui", "", true, envPrefix+"_UI", "Enable server to serve UI")
 	common.AddDurationFlag(Command, "enforcer.interval", "enforcer-interval", "", 60*time.Second, envPrefix+"_ENFORCER_INTERVAL", "Desired state enforcer interval")
 	common.AddIntFlag(Command, "enforcer.maxConcurrentActions", "enforcer-max-concurrent-actions", "", 30, envPrefix+"_ENFORCER_MAX_CONCURRENT_ACTIONS", "Desired state enforcer max concurrent actions")
+	common.AddDurationFlag(Command, "enforcer.cancelDeadline", "enforcer-cancel-deadline", "", 60*time.Second, envPrefix+"_ENFORCER_CANCEL_DEADLINE", "Desired state enforcer max time to wait for in-progress actions when revision is cancelled")
+	common.AddDurationFlag(Command, "enforcer.blueGreenReadinessTimeout", "enforcer-blue-green-readiness-timeout", "", 10*time.Minute, envPrefix+"_ENFORCER_BLUE_GREEN_READINESS_TIMEOUT", "Desired state enforcer max time to wait for the new deployment to become ready during blue/green updates")
+	common.AddIntFlag(Command, "enforcer.maxConcurrentActionsPerCluster", "enforcer-max-concurrent-actions-per-cluster", "", 0, envPrefix+"_ENFORCER_MAX_CONCURRENT_ACTIONS_PER_CLUSTER", "Desired state enforcer max concurrent actions per cluster (0 = no limit)")
 	common.AddDurationFlag(Command, "updater.interval", "updater-interval", "", 60*time.Second, envPrefix+"_UPDATER_INTERVAL", "Actual state updater interval")
 	common.AddIntFlag(Command, "updater.maxConcurrentActions", "updater-max-concurrent-actions", "", 30, envPrefix+"_UPDATER_MAX_CONCURRENT_ACTIONS", "Actual state updater max concurrent actions")
+	common.AddBoolFlag(Command, "updater.driftCheck", "updater-drift-check", "", true, envPrefix+"_UPDATER_DRIFT_CHECK", "Actual state updater checks deployed components for drift")
+	common.AddBoolFlag(Command, "updater.driftReapply", "updater-drift-reapply", "", false, envPrefix+"_UPDATER_DRIFT_REAPPLY", "Actual state updater triggers re-apply of drifted components")
+	common.AddIntFlag(Command, "history.snapshotEvery", "history-snapshot-every", "", 100, envPrefix+"_HISTORY_SNAPSHOT_EVERY", "Actual state history takes snapshot of actual state every N changes")
+	common.AddDurationFlag(Command, "history.maxAge", "history-max-age", "", 30*24*time.Hour, envPrefix+"_HISTORY_MAX_AGE", "Actual state history max age (0 = no limit)")
+	common.AddIntFlag(Command, "history.maxChanges", "history-max-changes", "", 0, envPrefix+"_HISTORY_MAX_CHANGES", "Actual state history max number of recorded changes (0 = no limit)")
+	common.AddStringFlag(Command, "plugins.kustomize.basesDir", "kustomize-bases-dir", "", "", envPrefix+"_KUSTOMIZE_BASES_DIR", "Directory with bases, which could be referenced by base param of kustomize code")
+	common.AddStringFlag(Command, "plugins.terraform.workDir", "terraform-work-dir", "", "", envPrefix+"_TERRAFORM_WORK_DIR", "Directory where Terraform commands of all deployments are run (state is kept in Aptomi store)")
 	common.AddStringFlag(Command, "profile.cpu", "cpuprofile", "", "", envPrefix+"_CPU_PROFILE", "File to write debug CPU profiling information using Go runtime/pprof")
 	common.AddStringFlag(Command, "profile.trace", "traceprofile", "", "", envPrefix+"_TRACE_PROFILE", "File to write debug tracing information using Go runtime/trace")
 
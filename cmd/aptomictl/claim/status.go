@@ -2,6 +2,7 @@ package claim
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Aptomi/aptomi/cmd/aptomictl/io"
@@ -115,6 +116,13 @@ func printStatusOfClaims(cfg *config.Client, claims []*lang.Claim, waitFlag api.
 		}
 	}
 	fmt.Fprint(writer, table, "\n")
+
+	// print conflicts, which prevent claims from being deployed
+	for _, dKey := range util.GetSortedStringKeys(result.Status) {
+		for _, conflict := range result.Status[dKey].Conflicts {
+			fmt.Fprintf(writer, "Claim %s can't be deployed:\n  %s\n", dKey, strings.Join(conflict.Describe(), "\n  "))
+		}
+	}
 	return keepWaiting, err
 }
 
@@ -174,6 +182,10 @@ func shouldKeepWaiting(cs *api.ClaimStatus, waitFlag api.ClaimQueryFlag) (bool,
 		// if claim has not been found, it does NOT make sense to continue waiting
 		return false, fmt.Errorf("claim has not been found")
 	}
+	if len(cs.Conflicts) > 0 {
+		// if claim has conflicting params, it will not get deployed until policy is changed
+		return false, fmt.Errorf("claim has conflicting params")
+	}
 	if !cs.Deployed {
 		// if claim has not been deployed (i.e. still has pending actions), we should continue waiting
 		return true, fmt.Errorf("claim is not in deployed state")
@@ -0,0 +1,39 @@
+package revision
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newCancelCommand(cfg *config.Client) *cobra.Command {
+	var gen uint64
+
+	cmd := &cobra.Command{
+		Use:   "cancel",
+		Short: "revision cancel",
+		Long:  "revision cancel long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if gen == 0 {
+				log.Fatalf("revision generation must be specified")
+			}
+
+			result, err := rest.New(cfg, http.NewClient(cfg)).Revision().Cancel(runtime.Generation(gen))
+			if err != nil {
+				log.Fatalf("error while cancelling revision: %s", err)
+			}
+
+			fmt.Printf("Revision %d is being cancelled (status: %s)\n", result.GetGeneration(), result.Status)
+		},
+	}
+
+	cmd.Flags().Uint64VarP(&gen, "generation", "g", 0, "Revision generation")
+
+	return cmd
+}
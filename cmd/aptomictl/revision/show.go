@@ -11,8 +11,14 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const (
+	graphFormatDOT  = "dot"
+	graphFormatJSON = "json"
+)
+
 func newShowCommand(cfg *config.Client) *cobra.Command {
 	var gen uint64
+	var graph string
 
 	cmd := &cobra.Command{
 		Use:   "show",
@@ -20,6 +26,11 @@ func newShowCommand(cfg *config.Client) *cobra.Command {
 		Long:  "revision show long",
 
 		Run: func(cmd *cobra.Command, args []string) {
+			if len(graph) > 0 {
+				showGraph(cfg, runtime.Generation(gen), graph)
+				return
+			}
+
 			result, err := rest.New(cfg, http.NewClient(cfg)).Revision().Show(runtime.Generation(gen))
 
 			if err != nil {
@@ -32,6 +43,24 @@ func newShowCommand(cfg *config.Client) *cobra.Command {
 	}
 
 	cmd.Flags().Uint64VarP(&gen, "generation", "g", 0, "Revision generation")
+	cmd.Flags().StringVar(&graph, "graph", "", fmt.Sprintf("Show action plan of the revision as a graph instead (%s or %s)", graphFormatDOT, graphFormatJSON))
+	cmd.Flags().Lookup("graph").NoOptDefVal = graphFormatDOT
 
 	return cmd
 }
+
+func showGraph(cfg *config.Client, gen runtime.Generation, format string) {
+	result, err := rest.New(cfg, http.NewClient(cfg)).Revision().Graph(gen)
+	if err != nil {
+		log.Fatalf("error while getting revision graph: %s", err)
+	}
+
+	switch format {
+	case graphFormatDOT:
+		fmt.Print(result.DOT)
+	case graphFormatJSON:
+		fmt.Println(result.JSON)
+	default:
+		log.Fatalf("unknown graph format: %s", format)
+	}
+}
@@ -0,0 +1,55 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Aptomi/aptomi/cmd/common"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newAdoptCommand(cfg *config.Client) *cobra.Command {
+	var noop bool
+	var mappings []string
+
+	cmd := &cobra.Command{
+		Use:   "adopt",
+		Short: "state adopt",
+		Long:  "state adopt long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			mapping := make(map[string]string)
+			for _, m := range mappings {
+				parts := strings.SplitN(m, "=", 2)
+				if len(parts) != 2 || len(parts[0]) <= 0 || len(parts[1]) <= 0 {
+					log.Fatalf("invalid mapping '%s', expected <component instance key>=<deploy name>", m)
+				}
+				mapping[parts[0]] = parts[1]
+			}
+
+			result, err := rest.New(cfg, http.NewClient(cfg)).State().Adopt(mapping, noop)
+			if err != nil {
+				log.Fatalf("error while adopting existing deployments: %s", err)
+			}
+
+			data, err := common.Format(cfg.Output, false, result)
+			if err != nil {
+				panic(fmt.Sprintf("error while formating adopted component instances: %s", err))
+			}
+			fmt.Println(string(data))
+
+			if cfg.Output == common.Text && result.PlanAsText != nil {
+				fmt.Println(result.PlanAsText.String())
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&noop, "noop", false, "Look for existing deployments and show what would be adopted, but do not change the state")
+	cmd.Flags().StringSliceVar(&mappings, "map", make([]string, 0), "Explicit mapping from component instance key to the name of existing deployment (<key>=<deploy name>)")
+
+	return cmd
+}
@@ -15,6 +15,13 @@ func NewCommand(cfg *config.Client) *cobra.Command {
 
 	cmd.AddCommand(
 		newEnforceCommand(cfg),
+		newDriftCommand(cfg),
+		newRetainedCommand(cfg),
+		newPurgeCommand(cfg),
+		newAdoptCommand(cfg),
+		newOrphansCommand(cfg),
+		newShowCommand(cfg),
+		newDiffCommand(cfg),
 	)
 
 	return cmd
@@ -0,0 +1,44 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/cmd/common"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newDiffCommand(cfg *config.Client) *cobra.Command {
+	var from, to string
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "state diff",
+		Long:  "state diff long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(from) <= 0 {
+				log.Fatalf("point in time to calculate the difference from should be specified")
+			}
+
+			result, err := rest.New(cfg, http.NewClient(cfg)).State().Diff(from, to)
+			if err != nil {
+				log.Fatalf("error while getting actual state diff: %s", err)
+			}
+
+			data, err := common.Format(cfg.Output, false, result)
+			if err != nil {
+				panic(fmt.Sprintf("error while formating actual state diff: %s", err))
+			}
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Point in time to calculate the difference from (RFC3339 time, revision generation or 'now')")
+	cmd.Flags().StringVar(&to, "to", "now", "Point in time to calculate the difference to (RFC3339 time, revision generation or 'now')")
+
+	return cmd
+}
@@ -0,0 +1,35 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/cmd/common"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newDriftCommand(cfg *config.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "state drift",
+		Long:  "state drift long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			result, err := rest.New(cfg, http.NewClient(cfg)).State().Drift()
+			if err != nil {
+				log.Fatalf("error while getting state drift: %s", err)
+			}
+
+			data, err := common.Format(cfg.Output, false, result)
+			if err != nil {
+				panic(fmt.Sprintf("error while formating state drift: %s", err))
+			}
+			fmt.Println(string(data))
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,66 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/cmd/common"
+	"github.com/Aptomi/aptomi/pkg/api"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newOrphansCommand(cfg *config.Client) *cobra.Command {
+	var destroy bool
+
+	cmd := &cobra.Command{
+		Use:   "orphans",
+		Short: "state orphans",
+		Long:  "state orphans long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if !destroy && len(args) > 0 {
+				log.Fatalf("deploy names can only be specified together with --destroy")
+			}
+
+			stateClient := rest.New(cfg, http.NewClient(cfg)).State()
+
+			results := []*api.StateOrphans{}
+			if !destroy {
+				result, err := stateClient.Orphans()
+				if err != nil {
+					log.Fatalf("error while looking for orphaned deployments: %s", err)
+				}
+				results = append(results, result)
+			} else {
+				deployNames := args
+				if len(deployNames) <= 0 {
+					// empty deploy name means all orphaned deployments
+					deployNames = []string{""}
+				}
+
+				for _, deployName := range deployNames {
+					result, err := stateClient.DestroyOrphans(deployName)
+					if err != nil {
+						log.Fatalf("error while destroying orphaned deployments: %s", err)
+					}
+					results = append(results, result)
+				}
+			}
+
+			for _, result := range results {
+				data, err := common.Format(cfg.Output, false, result)
+				if err != nil {
+					panic(fmt.Sprintf("error while formating orphaned deployments: %s", err))
+				}
+				fmt.Println(string(data))
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&destroy, "destroy", false, "Destroy orphaned deployments with the given deploy names (or all of them, if none specified)")
+
+	return cmd
+}
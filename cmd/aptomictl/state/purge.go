@@ -0,0 +1,51 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/cmd/common"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newPurgeCommand(cfg *config.Client) *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "state purge",
+		Long:  "state purge long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if all == (len(args) > 0) {
+				log.Fatalf("either keys of retained component instances or --all should be specified")
+			}
+
+			keys := args
+			if all {
+				// empty key means all retained component instances
+				keys = []string{""}
+			}
+
+			for _, key := range keys {
+				result, err := rest.New(cfg, http.NewClient(cfg)).State().Purge(key)
+				if err != nil {
+					log.Fatalf("error while purging retained component instances: %s", err)
+				}
+
+				data, err := common.Format(cfg.Output, false, result)
+				if err != nil {
+					panic(fmt.Sprintf("error while formating purged component instances: %s", err))
+				}
+				fmt.Println(string(data))
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Purge all retained component instances")
+
+	return cmd
+}
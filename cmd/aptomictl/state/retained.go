@@ -0,0 +1,35 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/cmd/common"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newRetainedCommand(cfg *config.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retained",
+		Short: "state retained",
+		Long:  "state retained long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			result, err := rest.New(cfg, http.NewClient(cfg)).State().Retained()
+			if err != nil {
+				log.Fatalf("error while getting retained component instances: %s", err)
+			}
+
+			data, err := common.Format(cfg.Output, false, result)
+			if err != nil {
+				panic(fmt.Sprintf("error while formating retained component instances: %s", err))
+			}
+			fmt.Println(string(data))
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,39 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/cmd/common"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newShowCommand(cfg *config.Client) *cobra.Command {
+	var at string
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "state show",
+		Long:  "state show long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			result, err := rest.New(cfg, http.NewClient(cfg)).State().At(at)
+			if err != nil {
+				log.Fatalf("error while getting actual state: %s", err)
+			}
+
+			data, err := common.Format(cfg.Output, false, result)
+			if err != nil {
+				panic(fmt.Sprintf("error while formating actual state: %s", err))
+			}
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().StringVar(&at, "at", "now", "Point in time to show actual state at (RFC3339 time, revision generation or 'now')")
+
+	return cmd
+}
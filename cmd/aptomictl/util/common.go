@@ -56,8 +56,8 @@ func WaitForRevisionActionsToFinish(maxTime time.Duration, interval time.Duratio
 			}
 		}
 
-		// exit when revision is in completed or error status
-		return rev.Status == engine.RevisionStatusCompleted || rev.Status == engine.RevisionStatusError
+		// exit when revision is in completed, cancelled or error status
+		return rev.Status == engine.RevisionStatusCompleted || rev.Status == engine.RevisionStatusCancelled || rev.Status == engine.RevisionStatusError
 	})
 
 	// stop progress bar
@@ -74,6 +74,8 @@ func WaitForRevisionActionsToFinish(maxTime time.Duration, interval time.Duratio
 		} else {
 			fmt.Printf("Revision %d completed\n", rev.GetGeneration())
 		}
+	} else if rev.Status == engine.RevisionStatusCancelled {
+		log.Fatalf("Revision %d cancelled. Actions: %d succeeded, %d failed, %d skipped\n", rev.GetGeneration(), rev.Result.Success, rev.Result.Failed, rev.Result.Skipped)
 	} else if rev.Status == engine.RevisionStatusError {
 		log.Fatalf("Revision %d failed\n", rev.GetGeneration())
 	} else {
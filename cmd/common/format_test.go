@@ -21,7 +21,7 @@ func TestFormat_Text(t *testing.T) {
 		result := makePolicyUpdateResult(true)
 		data, err := Format(cfg.Output, true, result)
 		assert.Nil(t, err, "Format should work without error")
-		expected := "Policy Generation\tAction Plan                                                            \n41 -> 42         \tUpdate Instances                                                       \n                 \t  [*] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tCreate Instances                                                       \n                 \t  [+] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tDestroy Instances                                                      \n                 \t  [-] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tRemove Consumers                                                       \n                 \t  [<] #cluster#k8ns#ns#service#context#keysresolved#component = claimId\n                 \tAdd Consumers                                                          \n                 \t  [>] #cluster#k8ns#ns#service#context#keysresolved#component = claimId\n                 \t                                                                       "
+		expected := "Policy Generation\tAction Plan                                                            \n41 -> 42         \tUpdate Instances                                                       \n                 \t  [*] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \t      ~ /params/name: valuePrev -> value                               \n                 \tCreate Instances                                                       \n                 \t  [+] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tDestroy Instances                                                      \n                 \t  [-] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tRemove Consumers                                                       \n                 \t  [<] #cluster#k8ns#ns#service#context#keysresolved#component = claimId\n                 \tAdd Consumers                                                          \n                 \t  [>] #cluster#k8ns#ns#service#context#keysresolved#component = claimId\n                 \t                                                                       "
 		if !assert.Equal(t, expected, string(data), "Format should return expected table") {
 			t.Log("Expected:\n", expected)
 			t.Log("Found:\n", string(data))
@@ -33,7 +33,7 @@ func TestFormat_Text(t *testing.T) {
 		result := makePolicyUpdateResult(false)
 		data, err := Format(cfg.Output, true, result)
 		assert.Nil(t, err, "Format should work without error")
-		expected := "Policy Generation\tAction Plan                                                            \n42               \tUpdate Instances                                                       \n                 \t  [*] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tCreate Instances                                                       \n                 \t  [+] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tDestroy Instances                                                      \n                 \t  [-] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tRemove Consumers                                                       \n                 \t  [<] #cluster#k8ns#ns#service#context#keysresolved#component = claimId\n                 \tAdd Consumers                                                          \n                 \t  [>] #cluster#k8ns#ns#service#context#keysresolved#component = claimId\n                 \t                                                                       "
+		expected := "Policy Generation\tAction Plan                                                            \n42               \tUpdate Instances                                                       \n                 \t  [*] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \t      ~ /params/name: valuePrev -> value                               \n                 \tCreate Instances                                                       \n                 \t  [+] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tDestroy Instances                                                      \n                 \t  [-] #cluster#k8ns#ns#service#context#keysresolved#component          \n                 \tRemove Consumers                                                       \n                 \t  [<] #cluster#k8ns#ns#service#context#keysresolved#component = claimId\n                 \tAdd Consumers                                                          \n                 \t  [>] #cluster#k8ns#ns#service#context#keysresolved#component = claimId\n                 \t                                                                       "
 		if !assert.Equal(t, expected, string(data), "Format should return expected table") {
 			t.Log("Expected:\n", expected)
 			t.Log("Found:\n", string(data))
@@ -77,8 +77,8 @@ func makePolicyUpdateResult(policyChanged bool) *api.PolicyUpdateResult {
 		PolicyChanged:    policyChanged,
 		PlanAsText: &action.PlanAsText{
 			Actions: []util.NestedParameterMap{
-				component.NewCreateAction(key.GetKey(), params).DescribeChanges(),
-				component.NewUpdateAction(key.GetKey(), paramsPrev, params).DescribeChanges(),
+				component.NewCreateAction(key.GetKey(), params, nil).DescribeChanges(),
+				component.NewUpdateAction(key.GetKey(), paramsPrev, params, lang.UpdateStrategyInPlace, paramsPrev.Changes(params, "/params"), nil).DescribeChanges(),
 				component.NewDeleteAction(key.GetKey(), paramsPrev).DescribeChanges(),
 				component.NewAttachClaimAction(key.GetKey(), "claimId", 0).DescribeChanges(),
 				component.NewDetachClaimAction(key.GetKey(), "claimId").DescribeChanges(),
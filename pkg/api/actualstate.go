@@ -3,7 +3,10 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
 	"github.com/Aptomi/aptomi/pkg/engine/diff"
@@ -55,9 +58,10 @@ func (api *coreAPI) handleStateEnforce(writer http.ResponseWriter, request *http
 		noop = false
 	}
 
-	// See that would happen if we reset the actual state, calculate resolution log and action plan
+	// See that would happen if we reset the actual state, calculate resolution log and action plan. As actual state
+	// gets reset, all code instances get deployed under their default names
 	resolveLog := event.NewLog(logrus.InfoLevel, "api-state-enforce").AddConsoleHook(api.logLevel)
-	desiredState := resolve.NewPolicyResolver(policy, api.externalData, resolveLog).ResolveAllClaims()
+	desiredState := api.newPolicyResolver(policy, resolveLog).ActualState(resolve.NewPolicyResolution()).ResolveAllClaims()
 	actionPlan := diff.NewPolicyResolutionDiff(desiredState, resolve.NewPolicyResolution()).ActionPlan
 
 	// If we are in noop mode, just return expected changes in a form of an action plan
@@ -107,3 +111,170 @@ func (api *coreAPI) createStateEnforceRevision(policyGen runtime.Generation, des
 
 	return revisionGen
 }
+
+// TypeStateDrift is an informational data structure with Kind and Constructor for StateDrift
+var TypeStateDrift = &runtime.TypeInfo{
+	Kind:        "state-drift",
+	Constructor: func() runtime.Object { return &StateDrift{} },
+}
+
+// StateDrift represents the list of component instances, which have drifted from their params
+type StateDrift struct {
+	runtime.TypeKind `yaml:",inline"`
+	Instances        []*resolve.ComponentInstance
+}
+
+// GetDefaultColumns returns default set of columns to be displayed
+func (drift *StateDrift) GetDefaultColumns() []string {
+	return []string{"Drifted Component Instances"}
+}
+
+// AsColumns returns StateDrift representation as columns
+func (drift *StateDrift) AsColumns() map[string]string {
+	lines := []string{}
+	for _, instance := range drift.Instances {
+		lines = append(lines, fmt.Sprintf("%s:\n%s", instance.GetKey(), instance.Drift))
+	}
+	if len(lines) <= 0 {
+		lines = append(lines, "(none)")
+	}
+	return map[string]string{
+		"Drifted Component Instances": strings.Join(lines, "\n"),
+	}
+}
+
+func (api *coreAPI) handleStateDriftGet(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	actualState, err := api.registry.GetActualState()
+	if err != nil {
+		panic(fmt.Sprintf("error while loading actual state: %s", err))
+	}
+
+	result := &StateDrift{
+		TypeKind:  TypeStateDrift.GetTypeKind(),
+		Instances: []*resolve.ComponentInstance{},
+	}
+	for _, instance := range actualState.ComponentInstanceMap {
+		if instance.Drifted {
+			result.Instances = append(result.Instances, instance)
+		}
+	}
+	sort.Slice(result.Instances, func(i, j int) bool {
+		return result.Instances[i].GetKey() < result.Instances[j].GetKey()
+	})
+
+	api.contentType.WriteOne(writer, request, result)
+}
+
+// TypeStateRetained is an informational data structure with Kind and Constructor for StateRetained
+var TypeStateRetained = &runtime.TypeInfo{
+	Kind:        "state-retained",
+	Constructor: func() runtime.Object { return &StateRetained{} },
+}
+
+// StateRetained represents the list of component instances, which have no claims left, but have been retained
+type StateRetained struct {
+	runtime.TypeKind `yaml:",inline"`
+	Instances        []*resolve.ComponentInstance
+}
+
+// GetDefaultColumns returns default set of columns to be displayed
+func (retained *StateRetained) GetDefaultColumns() []string {
+	return []string{"Retained Component Instances", "Retention", "Retained At", "Purge Requested"}
+}
+
+// AsColumns returns StateRetained representation as columns
+func (retained *StateRetained) AsColumns() map[string]string {
+	keys, retentions, times, purges := []string{}, []string{}, []string{}, []string{}
+	for _, instance := range retained.Instances {
+		keys = append(keys, instance.GetKey())
+		retentions = append(retentions, instance.Retention)
+		times = append(times, instance.RetainedAt.Format(time.RFC3339))
+		purges = append(purges, strconv.FormatBool(instance.PurgeRequested))
+	}
+	if len(keys) <= 0 {
+		keys = append(keys, "(none)")
+	}
+	return map[string]string{
+		"Retained Component Instances": strings.Join(keys, "\n"),
+		"Retention":                    strings.Join(retentions, "\n"),
+		"Retained At":                  strings.Join(times, "\n"),
+		"Purge Requested":              strings.Join(purges, "\n"),
+	}
+}
+
+// retainedComponentInstances returns all retained component instances from the given actual state, sorted by key
+func retainedComponentInstances(actualState *resolve.PolicyResolution) []*resolve.ComponentInstance {
+	result := []*resolve.ComponentInstance{}
+	for _, instance := range actualState.ComponentInstanceMap {
+		if instance.IsRetained() {
+			result = append(result, instance)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetKey() < result[j].GetKey()
+	})
+	return result
+}
+
+func (api *coreAPI) handleStateRetainedGet(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	actualState, err := api.registry.GetActualState()
+	if err != nil {
+		panic(fmt.Sprintf("error while loading actual state: %s", err))
+	}
+
+	api.contentType.WriteOne(writer, request, &StateRetained{
+		TypeKind:  TypeStateRetained.GetTypeKind(),
+		Instances: retainedComponentInstances(actualState),
+	})
+}
+
+func (api *coreAPI) handleStateRetainedPurge(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	// Load current policy
+	policy, _, err := api.registry.GetPolicy(runtime.LastOrEmptyGen)
+	if err != nil {
+		panic(fmt.Sprintf("error while loading latest policy: %s", err))
+	}
+
+	// check that user is a domain admin
+	user := api.getUserRequired(request)
+	if !isDomainAdmin(user, policy) {
+		panic(fmt.Sprintf("user is not allowed to purge retained component instances"))
+	}
+
+	// empty key means that all retained component instances should be purged
+	key := strings.TrimPrefix(params.ByName("key"), "/")
+
+	actualState, err := api.registry.GetActualState()
+	if err != nil {
+		panic(fmt.Sprintf("error while loading actual state: %s", err))
+	}
+	updater := api.registry.NewActualStateUpdater(actualState)
+
+	result := &StateRetained{
+		TypeKind:  TypeStateRetained.GetTypeKind(),
+		Instances: []*resolve.ComponentInstance{},
+	}
+	for _, instance := range retainedComponentInstances(actualState) {
+		if len(key) > 0 && instance.GetKey() != key {
+			continue
+		}
+		updateErr := updater.UpdateComponentInstance(instance.GetKey(), func(obj *resolve.ComponentInstance) {
+			obj.PurgeRequested = true
+		})
+		if updateErr != nil {
+			panic(fmt.Sprintf("error while requesting purge of component instance %s: %s", instance.GetKey(), updateErr))
+		}
+		result.Instances = append(result.Instances, updater.GetComponentInstance(instance.GetKey()))
+	}
+
+	if len(key) > 0 && len(result.Instances) <= 0 {
+		panic(fmt.Sprintf("retained component instance not found: %s", key))
+	}
+
+	api.contentType.WriteOne(writer, request, result)
+
+	// signal to the channel that actual state has changed, that will trigger the enforcement right away
+	if len(result.Instances) > 0 {
+		api.runDesiredStateEnforcement <- true
+	}
+}
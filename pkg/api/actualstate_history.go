@@ -0,0 +1,197 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/engine/diff"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/julienschmidt/httprouter"
+)
+
+// TypeStateSnapshot is an informational data structure with Kind and Constructor for StateSnapshot
+var TypeStateSnapshot = &runtime.TypeInfo{
+	Kind:        "state-snapshot",
+	Constructor: func() runtime.Object { return &StateSnapshot{} },
+}
+
+// StateSnapshot represents actual state as it was at the given point in time
+type StateSnapshot struct {
+	runtime.TypeKind `yaml:",inline"`
+	At               time.Time
+	Instances        []*resolve.ComponentInstance
+}
+
+// GetDefaultColumns returns default set of columns to be displayed
+func (snapshot *StateSnapshot) GetDefaultColumns() []string {
+	return []string{"Component Instances", "Created At", "Updated At"}
+}
+
+// AsColumns returns StateSnapshot representation as columns
+func (snapshot *StateSnapshot) AsColumns() map[string]string {
+	keys, created, updated := []string{}, []string{}, []string{}
+	for _, instance := range snapshot.Instances {
+		keys = append(keys, instance.GetKey())
+		created = append(created, instance.CreatedAt.Format(time.RFC3339))
+		updated = append(updated, instance.UpdatedAt.Format(time.RFC3339))
+	}
+	if len(keys) <= 0 {
+		keys = append(keys, "(none)")
+	}
+	return map[string]string{
+		"Component Instances": strings.Join(keys, "\n"),
+		"Created At":          strings.Join(created, "\n"),
+		"Updated At":          strings.Join(updated, "\n"),
+	}
+}
+
+// TypeStateDiff is an informational data structure with Kind and Constructor for StateDiff
+var TypeStateDiff = &runtime.TypeInfo{
+	Kind:        "state-diff",
+	Constructor: func() runtime.Object { return &StateDiff{} },
+}
+
+// StateDiff represents the difference in actual state between two points in time
+type StateDiff struct {
+	runtime.TypeKind `yaml:",inline"`
+	From             time.Time
+	To               time.Time
+
+	// Created is a list of keys of component instances, which have been created
+	Created []string
+
+	// Deleted is a list of keys of component instances, which have been deleted
+	Deleted []string
+
+	// Updated is a map from component instance key to the list of field-level changes of its parameters
+	Updated map[string][]*util.ParameterChange
+}
+
+// GetDefaultColumns returns default set of columns to be displayed
+func (stateDiff *StateDiff) GetDefaultColumns() []string {
+	return []string{"Changes"}
+}
+
+// AsColumns returns StateDiff representation as columns
+func (stateDiff *StateDiff) AsColumns() map[string]string {
+	lines := []string{}
+	for _, key := range stateDiff.Created {
+		lines = append(lines, fmt.Sprintf("[+] %s", key))
+	}
+	for _, key := range stateDiff.Deleted {
+		lines = append(lines, fmt.Sprintf("[-] %s", key))
+	}
+	updatedKeys := []string{}
+	for key := range stateDiff.Updated {
+		updatedKeys = append(updatedKeys, key)
+	}
+	sort.Strings(updatedKeys)
+	for _, key := range updatedKeys {
+		lines = append(lines, fmt.Sprintf("[*] %s", key))
+		for _, change := range stateDiff.Updated[key] {
+			lines = append(lines, "      "+change.String())
+		}
+	}
+	if len(lines) <= 0 {
+		lines = append(lines, "(none)")
+	}
+	return map[string]string{
+		"Changes": strings.Join(lines, "\n"),
+	}
+}
+
+// parseStatePoint converts point in time, specified either as RFC3339 time, revision generation (state right after
+// the revision has been applied) or "now", into time
+func (api *coreAPI) parseStatePoint(point string) time.Time {
+	if len(point) <= 0 || point == "now" {
+		return time.Now()
+	}
+
+	if gen, err := strconv.ParseUint(point, 10, 64); err == nil {
+		revision, revErr := api.registry.GetRevision(runtime.Generation(gen))
+		if revErr != nil {
+			panic(fmt.Sprintf("error while loading revision %d: %s", gen, revErr))
+		}
+		if revision == nil {
+			panic(fmt.Sprintf("revision %d not found", gen))
+		}
+		if revision.AppliedAt.IsZero() {
+			panic(fmt.Sprintf("revision %d hasn't been applied yet", gen))
+		}
+		return revision.AppliedAt
+	}
+
+	at, err := time.Parse(time.RFC3339, point)
+	if err != nil {
+		panic(fmt.Sprintf("point in time should be either RFC3339 time, revision generation or 'now', but found: %s", point))
+	}
+	return at
+}
+
+func (api *coreAPI) getActualStateAt(at time.Time) *resolve.PolicyResolution {
+	actualState, err := api.registry.GetActualStateAt(at)
+	if err != nil {
+		panic(fmt.Sprintf("error while loading actual state at %s: %s", at.Format(time.RFC3339), err))
+	}
+	return actualState
+}
+
+func (api *coreAPI) handleStateAtGet(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	at := api.parseStatePoint(params.ByName("point"))
+	actualState := api.getActualStateAt(at)
+
+	result := &StateSnapshot{
+		TypeKind:  TypeStateSnapshot.GetTypeKind(),
+		At:        at,
+		Instances: []*resolve.ComponentInstance{},
+	}
+	for _, instance := range actualState.ComponentInstanceMap {
+		result.Instances = append(result.Instances, instance)
+	}
+	sort.Slice(result.Instances, func(i, j int) bool {
+		return result.Instances[i].GetKey() < result.Instances[j].GetKey()
+	})
+
+	api.contentType.WriteOne(writer, request, result)
+}
+
+func (api *coreAPI) handleStateDiffGet(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	from := api.parseStatePoint(params.ByName("from"))
+	to := api.parseStatePoint(params.ByName("to"))
+	fromState := api.getActualStateAt(from)
+	toState := api.getActualStateAt(to)
+
+	result := &StateDiff{
+		TypeKind: TypeStateDiff.GetTypeKind(),
+		From:     from,
+		To:       to,
+		Created:  []string{},
+		Deleted:  []string{},
+		Updated:  make(map[string][]*util.ParameterChange),
+	}
+	for key, instance := range toState.ComponentInstanceMap {
+		prevInstance, found := fromState.ComponentInstanceMap[key]
+		if !found {
+			result.Created = append(result.Created, key)
+			continue
+		}
+		if changes := diff.GetParameterChanges(prevInstance, instance); len(changes) > 0 {
+			result.Updated[key] = changes
+		}
+	}
+	for key := range fromState.ComponentInstanceMap {
+		if _, found := toState.ComponentInstanceMap[key]; !found {
+			result.Deleted = append(result.Deleted, key)
+		}
+	}
+	sort.Strings(result.Created)
+	sort.Strings(result.Deleted)
+
+	api.contentType.WriteOne(writer, request, result)
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/diff"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeStateAdoptRequest is an informational data structure with Kind and Constructor for StateAdoptRequest
+var TypeStateAdoptRequest = &runtime.TypeInfo{
+	Kind:        "state-adopt-request",
+	Constructor: func() runtime.Object { return &StateAdoptRequest{} },
+}
+
+// StateAdoptRequest represents request to adopt deployments, which exist in the cloud, but haven't been created by Aptomi
+type StateAdoptRequest struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// Mapping is an explicit mapping from component instance key to the name of the existing deployment. Component
+	// instances which are not listed here will be looked up by their default deploy names
+	Mapping map[string]string
+}
+
+// TypeStateAdopted is an informational data structure with Kind and Constructor for StateAdopted
+var TypeStateAdopted = &runtime.TypeInfo{
+	Kind:        "state-adopted",
+	Constructor: func() runtime.Object { return &StateAdopted{} },
+}
+
+// StateAdopted represents the list of component instances, which have been adopted (or would be adopted in noop mode)
+type StateAdopted struct {
+	runtime.TypeKind `yaml:",inline"`
+	Noop             bool
+	Instances        []*AdoptedComponentInstance
+	WaitForRevision  runtime.Generation
+	PlanAsText       *action.PlanAsText
+}
+
+// AdoptedComponentInstance represents a single component instance, for which existing deployment has been found
+type AdoptedComponentInstance struct {
+	Key         string
+	DeployName  string
+	NeedsUpdate bool
+	Error       string
+}
+
+// GetDefaultColumns returns default set of columns to be displayed
+func (adopted *StateAdopted) GetDefaultColumns() []string {
+	return []string{"Adopted Component Instances", "Deploy Name", "Needs Update", "Error"}
+}
+
+// AsColumns returns StateAdopted representation as columns
+func (adopted *StateAdopted) AsColumns() map[string]string {
+	keys, deployNames, updates, errors := []string{}, []string{}, []string{}, []string{}
+	for _, instance := range adopted.Instances {
+		keys = append(keys, instance.Key)
+		deployNames = append(deployNames, instance.DeployName)
+		updates = append(updates, strconv.FormatBool(instance.NeedsUpdate))
+		errors = append(errors, instance.Error)
+	}
+
+	return map[string]string{
+		"Adopted Component Instances": strings.Join(keys, "\n"),
+		"Deploy Name":                 strings.Join(deployNames, "\n"),
+		"Needs Update":                strings.Join(updates, "\n"),
+		"Error":                       strings.Join(errors, "\n"),
+	}
+}
+
+func (api *coreAPI) handleStateAdopt(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	// Load current policy
+	policy, policyGen, err := api.registry.GetPolicy(runtime.LastOrEmptyGen)
+	if err != nil {
+		panic(fmt.Sprintf("error while loading latest policy: %s", err))
+	}
+
+	// check that user is a domain admin
+	user := api.getUserRequired(request)
+	if !isDomainAdmin(user, policy) {
+		panic(fmt.Sprintf("user is not allowed to adopt existing deployments"))
+	}
+
+	// See if noop flag is set
+	noop, noopErr := strconv.ParseBool(params.ByName("noop"))
+	if noopErr != nil {
+		noop = false
+	}
+
+	adoptReq, ok := api.contentType.ReadOne(request).(*StateAdoptRequest)
+	if !ok {
+		panic(fmt.Sprintf("Unexpected object received: %v", adoptReq))
+	}
+
+	// Resolve the current policy and load actual state
+	resolveLog := event.NewLog(logrus.InfoLevel, "api-state-adopt").AddConsoleHook(api.logLevel)
+	candidatesLog := event.NewLog(logrus.InfoLevel, "api-state-adopt")
+	desiredState := api.resolveDesiredState(policy, candidatesLog, (*resolve.PolicyResolver).ResolveAllClaims)
+	actualState, err := api.registry.GetActualState()
+	if err != nil {
+		panic(fmt.Sprintf("error while loading actual state: %s", err))
+	}
+
+	// mapping can only refer to component instances which need to be deployed
+	for key := range adoptReq.Mapping {
+		if !isAdoptionCandidate(desiredState, actualState, key) {
+			panic(fmt.Sprintf("component instance is not present in desired state or already exists in actual state: %s", key))
+		}
+	}
+
+	// Look for existing deployments and record the ones we have found in desired state, so they get adopted by the
+	// enforcer as a part of the next revision instead of being created
+	result := &StateAdopted{
+		TypeKind:        TypeStateAdopted.GetTypeKind(),
+		Noop:            noop,
+		Instances:       []*AdoptedComponentInstance{},
+		WaitForRevision: runtime.MaxGeneration,
+	}
+	plugins := api.pluginRegistryFactory()
+	for _, key := range sortedComponentInstanceKeys(desiredState) {
+		if !isAdoptionCandidate(desiredState, actualState, key) {
+			continue
+		}
+
+		instance := desiredState.ComponentInstanceMap[key]
+		deployName := instance.GetDeployName()
+		if mapped, found := adoptReq.Mapping[key]; found {
+			deployName = mapped
+		}
+
+		adopted, upToDate, adoptErr := findExistingDeployment(instance, deployName, policy, plugins)
+		if adoptErr != nil {
+			result.Instances = append(result.Instances, &AdoptedComponentInstance{Key: key, DeployName: deployName, Error: adoptErr.Error()})
+			continue
+		}
+		if !adopted {
+			continue
+		}
+
+		result.Instances = append(result.Instances, &AdoptedComponentInstance{Key: key, DeployName: deployName, NeedsUpdate: !upToDate})
+		desiredState.RecordAdoption(key, deployName, upToDate)
+	}
+
+	// Adopted deployments may be running under names different from the default ones, so desired state gets resolved
+	// once again with adoptions recorded, for dependents to discover adopted deployments under their names
+	if len(desiredState.Adoptions) > 0 {
+		adoptions := desiredState.Adoptions
+		desiredState = api.resolveDesiredState(policy, resolveLog, func(resolver *resolve.PolicyResolver) *resolve.PolicyResolution {
+			result := resolver.ResolveAllClaims()
+			result.Adoptions = adoptions
+			return result
+		})
+	} else {
+		resolveLog.Append(candidatesLog)
+	}
+
+	// Adoption, followed by attaching claims and updating params
+	actionPlan := diff.NewPolicyResolutionDiff(desiredState, actualState).ActionPlan
+	result.PlanAsText = actionPlan.AsText()
+
+	// If we are in noop mode, just return what would be adopted
+	if noop || len(desiredState.Adoptions) <= 0 {
+		api.contentType.WriteOne(writer, request, result)
+		return
+	}
+
+	// Create a new revision, so that the enforcer adopts deployments, attaches claims and updates params
+	result.WaitForRevision = api.createStateAdoptRevision(policyGen, desiredState, actionPlan)
+
+	api.contentType.WriteOne(writer, request, result)
+
+	// signal to the channel that actual state has changed, that will trigger the enforcement right away
+	api.runDesiredStateEnforcement <- true
+}
+
+func (api *coreAPI) createStateAdoptRevision(policyGen runtime.Generation, desiredState *resolve.PolicyResolution, actionPlan *action.Plan) runtime.Generation {
+	// Here we need to take mutex to handle policy and revision updates
+	api.policyAndRevisionUpdateMutex.Lock()
+	defer api.policyAndRevisionUpdateMutex.Unlock()
+
+	var revisionGen = runtime.MaxGeneration
+	if actionPlan.NumberOfActions() > 0 {
+		newRevision, newRevisionErr := api.registry.NewRevision(policyGen, desiredState, false)
+		if newRevisionErr != nil {
+			panic(fmt.Errorf("unable to create new revision for policy gen %d", policyGen))
+		}
+		revisionGen = newRevision.GetGeneration()
+	}
+
+	return revisionGen
+}
+
+// isAdoptionCandidate returns true if component instance is a code component which needs to be deployed (i.e. it is
+// claimed in desired state, but is not present in actual state)
+func isAdoptionCandidate(desiredState *resolve.PolicyResolution, actualState *resolve.PolicyResolution, key string) bool {
+	instance := desiredState.ComponentInstanceMap[key]
+	return instance != nil && instance.IsCode && len(instance.ClaimKeys) > 0 && actualState.ComponentInstanceMap[key] == nil
+}
+
+func sortedComponentInstanceKeys(resolution *resolve.PolicyResolution) []string {
+	result := []string{}
+	for key := range resolution.ComponentInstanceMap {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// findExistingDeployment asks code plugin whether the deployment with the given name already exists in the cloud and,
+// if it does, whether it matches code params of the component instance
+func findExistingDeployment(instance *resolve.ComponentInstance, deployName string, policy *lang.Policy, plugins plugin.Registry) (exists bool, upToDate bool, err error) {
+	codePlugin, err := pluginForComponentInstance(instance, policy, plugins)
+	if err != nil || codePlugin == nil {
+		return false, false, err
+	}
+
+	invocation := &plugin.CodePluginInvocationParams{
+		DeployName:   deployName,
+		Params:       instance.CalculatedCodeParams,
+		PluginParams: map[string]string{plugin.ParamTargetSuffix: instance.Metadata.Key.TargetSuffix},
+		EventLog:     event.NewLog(logrus.WarnLevel, "adopt"),
+	}
+
+	exists, err = codePlugin.Exists(invocation)
+	if err != nil || !exists {
+		return false, false, err
+	}
+
+	// if drift can't be calculated, deployment will be updated to match code params
+	drift, driftErr := codePlugin.Drift(invocation)
+	return true, driftErr == nil && len(drift) <= 0, nil
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/lang/builder"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/fake"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveAgainstActualStateAdoption(t *testing.T) {
+	// dependent bundle consumes a service, which code component gets adopted
+	b := builder.NewPolicyBuilder()
+	upstreamBundle := b.AddBundle()
+	upstream := b.AddBundleComponent(upstreamBundle, b.CodeComponent(nil, util.NestedParameterMap{"url": "http://{{ .Discovery.Instance }}"}))
+	upstreamService := b.AddService(upstreamBundle, b.CriteriaTrue())
+	bundle := b.AddBundle()
+	upstreamClaim := b.AddBundleComponent(bundle, b.ServiceComponent(upstreamService))
+	dependent := b.AddBundleComponent(bundle, b.CodeComponent(util.NestedParameterMap{"upstream": "{{ .Discovery." + upstreamClaim.Name + "." + upstream.Name + ".url }}"}, nil))
+	b.AddComponentClaim(dependent, upstreamClaim)
+	service := b.AddService(bundle, b.CriteriaTrue())
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelTarget, cluster.Name)))
+	b.AddClaim(b.AddUser(), service)
+
+	plugins := &orphansRegistry{plugins: map[string]plugin.CodePlugin{"helm": fake.NewNoOpCodePlugin(0)}}
+	eventLog := event.NewLog(logrus.WarnLevel, "test-adopt")
+	actualState := resolve.NewPolicyResolution()
+
+	// nothing is running yet, so upstream gets discovered under its default name
+	desiredState := resolveAgainstActualState(b.Policy(), actualState, plugins, eventLog, func(actualState *resolve.PolicyResolution, eventLog *event.Log) *resolve.PolicyResolution {
+		return resolve.NewPolicyResolver(b.Policy(), b.External(), eventLog).ActualState(actualState).ResolveAllClaims()
+	})
+	instance := findInstance(t, desiredState, upstream)
+	assert.Equal(t, "http://"+util.EscapeName(instance.GetDeployName()), findInstance(t, desiredState, dependent).CalculatedCodeParams["upstream"], "Dependent should discover upstream under its default name")
+
+	// existing deployment gets adopted by upstream, so dependent has to discover it under its name
+	desiredState.RecordAdoption(instance.GetKey(), "existing-deployment", false)
+	adoptions := desiredState.Adoptions
+	desiredState = resolveAgainstActualState(b.Policy(), actualState, plugins, eventLog, func(actualState *resolve.PolicyResolution, eventLog *event.Log) *resolve.PolicyResolution {
+		result := resolve.NewPolicyResolver(b.Policy(), b.External(), eventLog).ActualState(actualState).ResolveAllClaims()
+		result.Adoptions = adoptions
+		return result
+	})
+	assert.Equal(t, "existing-deployment", findInstance(t, desiredState, upstream).ResolvedDeployName, "Upstream should be resolved against adopted deployment")
+	assert.Equal(t, "http://existing-deployment", findInstance(t, desiredState, dependent).CalculatedCodeParams["upstream"], "Dependent should discover adopted deployment under its name")
+	assert.Len(t, desiredState.Adoptions, 1, "Adoption should be recorded in desired state")
+}
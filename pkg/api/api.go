@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"github.com/Aptomi/aptomi/pkg/api/codec"
+	"github.com/Aptomi/aptomi/pkg/config"
 	"github.com/Aptomi/aptomi/pkg/external"
 	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/runtime"
@@ -21,11 +22,13 @@ type coreAPI struct {
 	secret                       string
 	logLevel                     logrus.Level
 	runDesiredStateEnforcement   chan bool
+	cancelRevision               chan runtime.Generation
+	resolverCfg                  config.PolicyResolver
 	policyAndRevisionUpdateMutex sync.Mutex
 }
 
 // Serve initializes everything needed by REST API and registers all API endpoints in the provided http router
-func Serve(router *httprouter.Router, registry registry.Interface, externalData *external.Data, pluginRegistryFactory plugin.RegistryFactory, secret string, logLevel logrus.Level, runDesiredStateEnforcement chan bool) {
+func Serve(router *httprouter.Router, registry registry.Interface, externalData *external.Data, pluginRegistryFactory plugin.RegistryFactory, secret string, logLevel logrus.Level, runDesiredStateEnforcement chan bool, cancelRevision chan runtime.Generation, resolverCfg config.PolicyResolver) {
 	contentTypeHandler := codec.NewContentTypeHandler(runtime.NewTypes().Append(Types...))
 	api := &coreAPI{
 		contentType:                contentTypeHandler,
@@ -35,6 +38,8 @@ func Serve(router *httprouter.Router, registry registry.Interface, externalData
 		secret:                     secret,
 		logLevel:                   logLevel,
 		runDesiredStateEnforcement: runDesiredStateEnforcement,
+		cancelRevision:             cancelRevision,
+		resolverCfg:                resolverCfg,
 	}
 	api.serve(router)
 }
@@ -79,11 +84,36 @@ func (api *coreAPI) serve(router *httprouter.Router) {
 	router.GET("/api/v1/revision", auth(api.handleRevisionGet))
 	router.GET("/api/v1/revision/gen/:gen", auth(api.handleRevisionGet))
 
+	// retrieve action plan of a revision as a graph (latest + by a given generation)
+	router.GET("/api/v1/revision/graph", auth(api.handleRevisionGraphGet))
+	router.GET("/api/v1/revision/graph/gen/:gen", auth(api.handleRevisionGraphGet))
+
+	// cancel revision which is waiting or in progress
+	router.POST("/api/v1/revision/cancel/gen/:gen", auth(api.handleRevisionCancel))
+
 	// retrieve revision(s) (for a given policy)
 	router.GET("/api/v1/revisions/policy/:policy", auth(api.handleRevisionsGetByPolicy))
 
 	router.POST("/api/v1/state/enforce/noop/:noop", auth(api.handleStateEnforce))
 
+	// retrieve component instances which have drifted from their params
+	router.GET("/api/v1/state/drift", auth(api.handleStateDriftGet))
+
+	// retrieve retained component instances (which have no claims left) and request them to be destroyed
+	router.GET("/api/v1/state/retained", auth(api.handleStateRetainedGet))
+	router.POST("/api/v1/state/retained/purge/*key", auth(api.handleStateRetainedPurge))
+
+	// adopt deployments which exist in the cloud, but haven't been created by Aptomi
+	router.POST("/api/v1/state/adopt/noop/:noop", auth(api.handleStateAdopt))
+
+	// retrieve deployments created by Aptomi, which are not tracked in actual state anymore, and destroy them
+	router.GET("/api/v1/state/orphans", auth(api.handleStateOrphansGet))
+	router.POST("/api/v1/state/orphans/destroy/*deployName", auth(api.handleStateOrphansDestroy))
+
+	// retrieve actual state at the given point in time (time, revision or "now") and the difference between two of them
+	router.GET("/api/v1/state/at/:point", auth(api.handleStateAtGet))
+	router.GET("/api/v1/state/diff/:from/:to", auth(api.handleStateDiffGet))
+
 	// return aptomi version
 	router.GET("/version", api.handleVersion)
 	router.GET("/api/v1/version", api.handleVersion)
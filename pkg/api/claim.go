@@ -50,6 +50,9 @@ type ClaimStatus struct {
 	Deployed  bool
 	Ready     bool
 	Endpoints map[string]map[string]string
+
+	// Conflicts is a list of params conflicts, which prevent claim from being deployed
+	Conflicts []*resolve.ParamsConflict
 }
 
 func (api *coreAPI) handleClaimStatusGet(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -101,12 +104,13 @@ func (api *coreAPI) handleClaimStatusGet(writer http.ResponseWriter, request *ht
 		}
 
 		claim := cObj.(*lang.Claim) // nolint: errcheck
-		resolved := desiredState.GetClaimResolution(claim).Resolved
+		claimResolution := desiredState.GetClaimResolution(claim)
 		result.Status[runtime.KeyForStorable(claim)] = &ClaimStatus{
 			Found:     true,
-			Deployed:  resolved,
-			Ready:     resolved,
+			Deployed:  claimResolution.Resolved,
+			Ready:     claimResolution.Resolved,
 			Endpoints: make(map[string]map[string]string),
+			Conflicts: claimResolution.Conflicts,
 		}
 	}
 
@@ -180,6 +184,7 @@ func fetchDeploymentStatusForClaims(result *ClaimsStatus, actualState *resolve.P
 			return nil
 		}),
 		action.NewApplyResultUpdaterImpl(),
+		nil,
 	)
 
 	for _, instance := range actualState.ComponentInstanceMap {
@@ -12,6 +12,14 @@ var (
 	Types = runtime.AppendAllTypes([]*runtime.TypeInfo{
 		TypeClaimsStatus,
 		TypePolicyUpdateResult,
+		TypeStateDrift,
+		TypeStateRetained,
+		TypeRevisionGraph,
+		TypeStateAdoptRequest,
+		TypeStateAdopted,
+		TypeStateOrphans,
+		TypeStateSnapshot,
+		TypeStateDiff,
 		TypeAuthSuccess,
 		TypeAuthRequest,
 		TypeServerError,
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/engine/actual"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeStateOrphans is an informational data structure with Kind and Constructor for StateOrphans
+var TypeStateOrphans = &runtime.TypeInfo{
+	Kind:        "state-orphans",
+	Constructor: func() runtime.Object { return &StateOrphans{} },
+}
+
+// StateOrphans represents the list of deployments, which have been created by Aptomi, but are not tracked in actual
+// state anymore (e.g. left behind by failed deletes or manual experiments)
+type StateOrphans struct {
+	runtime.TypeKind `yaml:",inline"`
+	Destroyed        bool
+	Orphans          []*OrphanDeployment
+}
+
+// OrphanDeployment represents a single orphaned deployment found in the cluster. If the cluster couldn't be scanned
+// or the deployment couldn't be destroyed, Error will be set
+type OrphanDeployment struct {
+	Cluster      string
+	CodeType     string
+	DeployName   string
+	TargetSuffix string
+	Error        string
+
+	cluster    *lang.Cluster
+	deployment *plugin.Deployment
+}
+
+// GetDefaultColumns returns default set of columns to be displayed
+func (orphans *StateOrphans) GetDefaultColumns() []string {
+	return []string{"Orphaned Deployments", "Cluster", "Code Type", "Target", "Error"}
+}
+
+// AsColumns returns StateOrphans representation as columns
+func (orphans *StateOrphans) AsColumns() map[string]string {
+	names, clusters, codeTypes, targets, errors := []string{}, []string{}, []string{}, []string{}, []string{}
+	for _, orphan := range orphans.Orphans {
+		names = append(names, orphan.DeployName)
+		clusters = append(clusters, orphan.Cluster)
+		codeTypes = append(codeTypes, orphan.CodeType)
+		targets = append(targets, orphan.TargetSuffix)
+		errors = append(errors, orphan.Error)
+	}
+	if len(names) <= 0 {
+		names = append(names, "(none)")
+	}
+	return map[string]string{
+		"Orphaned Deployments": strings.Join(names, "\n"),
+		"Cluster":              strings.Join(clusters, "\n"),
+		"Code Type":            strings.Join(codeTypes, "\n"),
+		"Target":               strings.Join(targets, "\n"),
+		"Error":                strings.Join(errors, "\n"),
+	}
+}
+
+func (api *coreAPI) handleStateOrphansGet(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	policy, _, err := api.registry.GetPolicy(runtime.LastOrEmptyGen)
+	if err != nil {
+		panic(fmt.Sprintf("error while loading latest policy: %s", err))
+	}
+
+	// check that user is a domain admin, as scanning clusters exposes all deployments in them
+	user := api.getUserRequired(request)
+	if !isDomainAdmin(user, policy) {
+		panic(fmt.Sprintf("user is not allowed to list orphaned deployments"))
+	}
+
+	eventLog := event.NewLog(logrus.InfoLevel, "api-state-orphans").AddConsoleHook(api.logLevel)
+	api.contentType.WriteOne(writer, request, &StateOrphans{
+		TypeKind: TypeStateOrphans.GetTypeKind(),
+		Orphans:  api.findOrphans(policy, api.pluginRegistryFactory(), eventLog),
+	})
+}
+
+func (api *coreAPI) handleStateOrphansDestroy(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	policy, _, err := api.registry.GetPolicy(runtime.LastOrEmptyGen)
+	if err != nil {
+		panic(fmt.Sprintf("error while loading latest policy: %s", err))
+	}
+
+	// check that user is a domain admin
+	user := api.getUserRequired(request)
+	if !isDomainAdmin(user, policy) {
+		panic(fmt.Sprintf("user is not allowed to destroy orphaned deployments"))
+	}
+
+	// empty deploy name means that all orphaned deployments should be destroyed
+	deployName := strings.TrimPrefix(params.ByName("deployName"), "/")
+
+	eventLog := event.NewLog(logrus.InfoLevel, "api-state-orphans").AddConsoleHook(api.logLevel)
+	plugins := api.pluginRegistryFactory()
+
+	result := &StateOrphans{
+		TypeKind:  TypeStateOrphans.GetTypeKind(),
+		Destroyed: true,
+		Orphans:   []*OrphanDeployment{},
+	}
+
+	// orphans are destroyed through the regular action plan, one graph node per deployment
+	actionPlan := action.NewPlan()
+	actionOrphans := make(map[string]*OrphanDeployment)
+	for _, orphan := range api.findOrphans(policy, plugins, eventLog) {
+		if len(deployName) > 0 && orphan.DeployName != deployName {
+			continue
+		}
+		result.Orphans = append(result.Orphans, orphan)
+		if orphan.deployment == nil {
+			// cluster scan failed, nothing to destroy
+			continue
+		}
+
+		act := component.NewOrphanDeleteAction(orphan.cluster, orphan.CodeType, orphan.deployment)
+		actionPlan.GetActionGraphNode(act.GetName()).AddAction(act, nil, false)
+		actionOrphans[act.GetName()] = orphan
+	}
+
+	if len(deployName) > 0 && len(actionOrphans) <= 0 {
+		panic(fmt.Sprintf("orphaned deployment not found: %s", deployName))
+	}
+
+	// orphans are not a part of actual state, so actions don't need to update it
+	context := action.NewContext(
+		policy,
+		resolve.NewPolicyResolution(),
+		actual.NewNoOpActionStateUpdater(resolve.NewPolicyResolution()),
+		api.externalData,
+		plugins,
+		eventLog,
+	)
+
+	actionPlan.Apply(action.WrapSequential(func(act action.Interface) error {
+		applyErr := act.Apply(context)
+		if applyErr != nil {
+			eventLog.NewEntry().Errorf("error while applying action '%s': %s", act, applyErr)
+			actionOrphans[act.GetName()].Error = applyErr.Error()
+		}
+		return applyErr
+	}), action.NewApplyResultUpdaterImpl(), nil)
+
+	api.contentType.WriteOne(writer, request, result)
+}
+
+// findOrphans scans all clusters from the policy using all supported code plugins and returns deployments, which
+// look like they have been created by Aptomi, but are present neither in actual state nor in desired state. Desired
+// state is taken into account, so deployments which are being created right now don't get reported as orphans
+func (api *coreAPI) findOrphans(policy *lang.Policy, plugins plugin.Registry, eventLog *event.Log) []*OrphanDeployment {
+	actualState, err := api.registry.GetActualState()
+	if err != nil {
+		panic(fmt.Sprintf("error while loading actual state: %s", err))
+	}
+	desiredState := api.newPolicyResolver(policy, eventLog).ResolveAllClaims()
+
+	return findOrphanDeployments(policy, plugins, []*resolve.PolicyResolution{actualState, desiredState}, eventLog)
+}
+
+// findOrphanDeployments scans all clusters from the policy using all supported code plugins and returns deployments,
+// which look like they have been created by Aptomi, but don't belong to code component instances from given states
+func findOrphanDeployments(policy *lang.Policy, plugins plugin.Registry, states []*resolve.PolicyResolution, eventLog *event.Log) []*OrphanDeployment {
+	knownDeployNames := make(map[string]bool)
+	for _, state := range states {
+		for _, instance := range state.ComponentInstanceMap {
+			if !instance.IsCode {
+				continue
+			}
+			// deployments of both colors may exist while blue/green update is in progress
+			for _, color := range []string{"", resolve.ColorBlue, resolve.ColorGreen} {
+				knownDeployNames[instance.GetDeployNameForColor(color)] = true
+			}
+		}
+	}
+
+	result := []*OrphanDeployment{}
+	for _, clusterObj := range policy.GetObjectsByKind(lang.TypeCluster.Kind) {
+		cluster := clusterObj.(*lang.Cluster) // nolint: errcheck
+		clusterName := cluster.Namespace + runtime.KeySeparator + cluster.Name
+		for _, codeType := range plugins.CodeTypes(cluster) {
+			codePlugin, pluginErr := plugins.ForCodeType(cluster, codeType)
+			if pluginErr != nil {
+				result = append(result, &OrphanDeployment{Cluster: clusterName, CodeType: codeType, Error: pluginErr.Error()})
+				continue
+			}
+
+			deployments, listErr := codePlugin.Deployments(eventLog)
+			if listErr != nil {
+				result = append(result, &OrphanDeployment{Cluster: clusterName, CodeType: codeType, Error: listErr.Error()})
+				continue
+			}
+
+			for _, deployment := range deployments {
+				if !resolve.IsDeployName(deployment.DeployName) || knownDeployNames[deployment.DeployName] {
+					continue
+				}
+				if len(deployment.Error) > 0 {
+					// plugin doesn't know enough about the deployment to destroy it safely
+					result = append(result, &OrphanDeployment{
+						Cluster:      clusterName,
+						CodeType:     codeType,
+						DeployName:   deployment.DeployName,
+						TargetSuffix: deployment.TargetSuffix,
+						Error:        deployment.Error,
+					})
+					continue
+				}
+				result = append(result, &OrphanDeployment{
+					Cluster:      clusterName,
+					CodeType:     codeType,
+					DeployName:   deployment.DeployName,
+					TargetSuffix: deployment.TargetSuffix,
+					cluster:      cluster,
+					deployment:   deployment,
+				})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cluster != result[j].Cluster {
+			return result[i].Cluster < result[j].Cluster
+		}
+		if result[i].CodeType != result[j].CodeType {
+			return result[i].CodeType < result[j].CodeType
+		}
+		return result[i].DeployName < result[j].DeployName
+	})
+
+	return result
+}
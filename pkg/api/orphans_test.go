@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/fake"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindOrphanDeployments(t *testing.T) {
+	cluster := &lang.Cluster{
+		TypeKind: lang.TypeCluster.GetTypeKind(),
+		Metadata: lang.Metadata{Namespace: "system", Name: "cluster-test"},
+		Type:     "kubernetes",
+	}
+	policy := lang.NewPolicy()
+	if !assert.NoError(t, policy.AddObject(cluster), "Cluster should be added to policy") {
+		t.FailNow()
+	}
+
+	// one code component is in actual state, another one is being created and is only in desired state
+	actualState := resolve.NewPolicyResolution()
+	actualName := makeCodeInstance(actualState, cluster, "actual").GetDeployNameForColor("")
+	desiredState := resolve.NewPolicyResolution()
+	desiredName := makeCodeInstance(desiredState, cluster, "desired").GetDeployNameForColor(resolve.ColorBlue)
+
+	orphanName := makeCodeInstance(resolve.NewPolicyResolution(), cluster, "orphan").GetDeployNameForColor("")
+	unknownName := makeCodeInstance(resolve.NewPolicyResolution(), cluster, "unknown").GetDeployNameForColor(resolve.ColorGreen)
+
+	plugins := &orphansRegistry{plugins: map[string]plugin.CodePlugin{
+		"helm": &orphansCodePlugin{
+			CodePlugin: fake.NewNoOpCodePlugin(0),
+			deployments: []*plugin.Deployment{
+				{DeployName: actualName, TargetSuffix: "ns"},
+				{DeployName: desiredName, TargetSuffix: "ns"},
+				{DeployName: orphanName, TargetSuffix: "ns"},
+				{DeployName: "created-manually", TargetSuffix: "ns"},
+			},
+		},
+		"raw": &orphansCodePlugin{
+			CodePlugin: fake.NewNoOpCodePlugin(0),
+			deployments: []*plugin.Deployment{
+				{DeployName: unknownName, Error: "namespace is unknown"},
+			},
+		},
+		"kustomize": &orphansCodePlugin{
+			CodePlugin: fake.NewNoOpCodePlugin(0),
+			err:        fmt.Errorf("cluster is unreachable"),
+		},
+	}}
+
+	eventLog := event.NewLog(logrus.WarnLevel, "test-orphans")
+	orphans := findOrphanDeployments(policy, plugins, []*resolve.PolicyResolution{actualState, desiredState}, eventLog)
+	if !assert.Len(t, orphans, 3, "Only orphaned deployments and errors should be reported") {
+		t.FailNow()
+	}
+
+	// orphans are sorted by cluster, code type and deploy name
+	assert.Equal(t, "helm", orphans[0].CodeType, "Orphaned deployment should be reported")
+	assert.Equal(t, orphanName, orphans[0].DeployName, "Orphaned deployment should be reported")
+	assert.Equal(t, "system/cluster-test", orphans[0].Cluster, "Orphaned deployment should be reported with its cluster")
+	assert.Empty(t, orphans[0].Error, "Orphaned deployment should be reported without an error")
+	assert.NotNil(t, orphans[0].deployment, "Orphaned deployment should be destroyable")
+
+	assert.Equal(t, "kustomize", orphans[1].CodeType, "Cluster scan error should be reported")
+	assert.Empty(t, orphans[1].DeployName, "Cluster scan error should be reported without deploy name")
+	assert.Equal(t, "cluster is unreachable", orphans[1].Error, "Cluster scan error should be reported")
+	assert.Nil(t, orphans[1].deployment, "Nothing should be destroyed if cluster scan failed")
+
+	assert.Equal(t, "raw", orphans[2].CodeType, "Orphaned deployment with an error should be reported")
+	assert.Equal(t, unknownName, orphans[2].DeployName, "Orphaned deployment with an error should be reported")
+	assert.Equal(t, "namespace is unknown", orphans[2].Error, "Orphaned deployment should be reported with plugin error")
+	assert.Nil(t, orphans[2].deployment, "Orphaned deployment, which plugin can't destroy safely, should not be destroyable")
+}
+
+func makeCodeInstance(state *resolve.PolicyResolution, cluster *lang.Cluster, name string) *resolve.ComponentInstance {
+	service := &lang.Service{Metadata: lang.Metadata{Namespace: "main", Name: "service-" + name}}
+	context := &lang.Context{Name: "context"}
+	bundle := &lang.Bundle{Metadata: lang.Metadata{Namespace: "main", Name: "bundle-" + name}}
+	component := &lang.BundleComponent{Name: "component"}
+
+	instance := state.GetComponentInstanceEntry(resolve.NewComponentInstanceKey(cluster, "ns", service, context, nil, bundle, component))
+	instance.IsCode = true
+	return instance
+}
+
+// orphansRegistry is a plugin registry, which returns given code plugins for every cluster
+type orphansRegistry struct {
+	plugins map[string]plugin.CodePlugin
+}
+
+func (registry *orphansRegistry) ForCluster(cluster *lang.Cluster) (plugin.ClusterPlugin, error) {
+	return fake.NewNoOpClusterPlugin(0), nil
+}
+
+func (registry *orphansRegistry) ForCodeType(cluster *lang.Cluster, codeType string) (plugin.CodePlugin, error) {
+	return registry.plugins[codeType], nil
+}
+
+func (registry *orphansRegistry) CodeTypes(cluster *lang.Cluster) []string {
+	return []string{"helm", "raw", "kustomize"}
+}
+
+// orphansCodePlugin is a code plugin, which returns given list of deployments found in the cluster
+type orphansCodePlugin struct {
+	plugin.CodePlugin
+	deployments []*plugin.Deployment
+	err         error
+}
+
+func (p *orphansCodePlugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	return p.deployments, p.err
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
@@ -133,7 +134,7 @@ func (api *coreAPI) handlePolicyUpdate(writer http.ResponseWriter, request *http
 	user := api.getUserRequired(request)
 
 	// Load the latest policy
-	_, policyGen, err := api.registry.GetPolicy(runtime.LastOrEmptyGen)
+	policy, policyGen, err := api.registry.GetPolicy(runtime.LastOrEmptyGen)
 	if err != nil {
 		panic(fmt.Sprintf("error while loading current policy: %s", err))
 	}
@@ -207,7 +208,7 @@ func (api *coreAPI) handlePolicyUpdate(writer http.ResponseWriter, request *http
 
 	// Process policy changes, calculate resolution log and action plan
 	eventLog := event.NewLog(logLevel, "api-policy-update").AddConsoleHook(api.logLevel)
-	desiredStateUpdated := resolve.NewPolicyResolver(policyUpdated, api.externalData, eventLog).ResolveAllClaims()
+	desiredStateUpdated := api.resolvePolicyChange(policy, policyUpdated, desiredState, eventLog)
 	err = desiredStateUpdated.Validate(policyUpdated)
 	if err != nil {
 		panic(fmt.Sprintf("policy change cannon be made: %s", err))
@@ -253,7 +254,7 @@ func (api *coreAPI) handlePolicyDelete(writer http.ResponseWriter, request *http
 	user := api.getUserRequired(request)
 
 	// Load the latest policy gen
-	_, policyGen, err := api.registry.GetPolicy(runtime.LastOrEmptyGen)
+	policy, policyGen, err := api.registry.GetPolicy(runtime.LastOrEmptyGen)
 	if err != nil {
 		panic(fmt.Sprintf("error while loading current policy: %s", err))
 	}
@@ -305,7 +306,7 @@ func (api *coreAPI) handlePolicyDelete(writer http.ResponseWriter, request *http
 
 	// Process policy changes, calculate and return resolution log + action plan
 	eventLog := event.NewLog(logLevel, "api-policy-delete").AddConsoleHook(api.logLevel)
-	desiredStateUpdated := resolve.NewPolicyResolver(policyUpdated, api.externalData, eventLog).ResolveAllClaims()
+	desiredStateUpdated := api.resolvePolicyChange(policy, policyUpdated, desiredState, eventLog)
 	err = desiredStateUpdated.Validate(policyUpdated)
 	if err != nil {
 		panic(fmt.Sprintf("policy change cannon be made: %s", err))
@@ -374,3 +375,98 @@ func (api *coreAPI) changePolicy(objects []lang.Base, user *lang.User, desiredSt
 	}
 	return changed, policyData.GetGeneration(), revisionGen
 }
+
+// newPolicyResolver creates a new policy resolver configured according to the server config. It's given the current
+// actual state, so dependents get resolved against the deployments which are actually running
+func (api *coreAPI) newPolicyResolver(policy *lang.Policy, eventLog *event.Log) *resolve.PolicyResolver {
+	actualState, err := api.registry.GetActualState()
+	if err != nil {
+		panic(fmt.Sprintf("error while loading actual state: %s", err))
+	}
+	return resolve.NewPolicyResolver(policy, api.externalData, eventLog).FailConflictingClaims(api.resolverCfg.FailConflictingClaims).ActualState(actualState)
+}
+
+// resolvePolicyChange calculates desired state for the updated policy. Unless full resolution is enabled in the
+// server config, only claims affected by the change get resolved, while the rest are taken from the current desired state
+func (api *coreAPI) resolvePolicyChange(policy *lang.Policy, policyUpdated *lang.Policy, desiredState *resolve.PolicyResolution, eventLog *event.Log) *resolve.PolicyResolution {
+	return api.resolveDesiredState(policyUpdated, eventLog, func(resolver *resolve.PolicyResolver) *resolve.PolicyResolution {
+		if api.resolverCfg.FullResolution {
+			return resolver.ResolveAllClaims()
+		}
+		return resolver.ResolveChangedClaims(desiredState, resolve.NewPolicyChanges(policy, policyUpdated))
+	})
+}
+
+// resolveDesiredState calculates desired state for the policy with the given resolve function against the current
+// actual state (see resolveAgainstActualState)
+func (api *coreAPI) resolveDesiredState(policy *lang.Policy, eventLog *event.Log, resolveFunc func(resolver *resolve.PolicyResolver) *resolve.PolicyResolution) *resolve.PolicyResolution {
+	actualState, err := api.registry.GetActualState()
+	if err != nil {
+		panic(fmt.Sprintf("error while loading actual state: %s", err))
+	}
+	return resolveAgainstActualState(policy, actualState, api.pluginRegistryFactory(), eventLog, func(actualState *resolve.PolicyResolution, eventLog *event.Log) *resolve.PolicyResolution {
+		return resolveFunc(api.newPolicyResolver(policy, eventLog).ActualState(actualState))
+	})
+}
+
+// resolveAgainstActualState calculates desired state with the given resolve function, so that dependents discover
+// the deployments which are going to be running once it gets applied. Existing deployments, which are going to be
+// taken over by code instances (see projectActualState), may be running under names different from the ones resolver
+// derives from actual state. If there are any, desired state gets calculated once again against actual state as it's
+// going to look like after they have been taken over
+func resolveAgainstActualState(policy *lang.Policy, actualState *resolve.PolicyResolution, plugins plugin.Registry, eventLog *event.Log, resolveFunc func(actualState *resolve.PolicyResolution, eventLog *event.Log) *resolve.PolicyResolution) *resolve.PolicyResolution {
+	resolveLog := event.NewLog(eventLog.GetLevel(), eventLog.GetScope())
+	desiredState := resolveFunc(actualState, resolveLog)
+	if projectedState, projected := projectActualState(policy, desiredState, actualState, plugins); projected {
+		resolveLog = event.NewLog(eventLog.GetLevel(), eventLog.GetScope())
+		desiredState = resolveFunc(projectedState, resolveLog)
+	}
+	eventLog.Append(resolveLog)
+	return desiredState
+}
+
+// projectActualState returns actual state as it's going to look like once existing deployments get taken over by
+// code instances from desired state, i.e. adopted deployments (see PolicyResolution.Adoptions) and deployments moved
+// over from previous keys by adoption (see plugin.MoveByAdoption). It returns false if no deployments are going to be
+// taken over
+func projectActualState(policy *lang.Policy, desiredState *resolve.PolicyResolution, actualState *resolve.PolicyResolution, plugins plugin.Registry) (*resolve.PolicyResolution, bool) {
+	result := resolve.NewPolicyResolution()
+	for key, instance := range actualState.ComponentInstanceMap {
+		result.ComponentInstanceMap[key] = instance
+	}
+	projected := false
+
+	// adopted deployments stay under their names
+	for key, adoption := range desiredState.Adoptions {
+		instance := desiredState.ComponentInstanceMap[key]
+		if instance != nil && actualState.ComponentInstanceMap[key] == nil {
+			result.ComponentInstanceMap[key] = instance.MakeAdopted(adoption.DeployName, adoption.UpToDate)
+			projected = true
+		}
+	}
+
+	// deployments moved by adoption stay under their previous names and colors (see component.MoveAction)
+	for key, prevKey := range desiredState.GetMoves(actualState) {
+		instance := desiredState.ComponentInstanceMap[key]
+		if !instance.IsCode {
+			continue
+		}
+		codePlugin, err := pluginForComponentInstance(instance, policy, plugins)
+		if err != nil || codePlugin == nil {
+			continue
+		}
+		if adopter, ok := codePlugin.(plugin.MoveByAdoption); !ok || !adopter.MovesByAdoption() {
+			continue
+		}
+
+		prevInstance := actualState.ComponentInstanceMap[prevKey]
+		moved := *prevInstance
+		moved.Metadata = &resolve.ComponentInstanceMetadata{Key: instance.Metadata.Key}
+		moved.AdoptedDeployName = prevInstance.GetDeployNameForColor("")
+		result.ComponentInstanceMap[key] = &moved
+		delete(result.ComponentInstanceMap, prevKey)
+		projected = true
+	}
+
+	return result, projected
+}
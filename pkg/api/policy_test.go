@@ -0,0 +1,91 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/lang/builder"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/fake"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveAgainstActualStateMoveByAdoption(t *testing.T) {
+	// dependent component discovers its upstream by instance name
+	b := builder.NewPolicyBuilder()
+	bundle := b.AddBundle()
+	upstream := b.AddBundleComponent(bundle, b.CodeComponent(nil, nil))
+	dependent := b.AddBundleComponent(bundle, b.CodeComponent(util.NestedParameterMap{"upstream": "{{ .Discovery." + upstream.Name + ".instance }}"}, nil))
+	b.AddComponentClaim(dependent, upstream)
+	service := b.AddService(bundle, b.CriteriaTrue())
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelTarget, cluster.Name)))
+	b.AddClaim(b.AddUser(), service)
+
+	resolveFunc := func(actualState *resolve.PolicyResolution, eventLog *event.Log) *resolve.PolicyResolution {
+		return resolve.NewPolicyResolver(b.Policy(), b.External(), eventLog).ActualState(actualState).ResolveAllClaims()
+	}
+	eventLog := event.NewLog(logrus.WarnLevel, "test-resolve")
+
+	// deploy the bundle, upstream has been updated with blue/green once
+	actualState := resolveFunc(resolve.NewPolicyResolution(), eventLog)
+	prevUpstream := findInstance(t, actualState, upstream)
+	prevUpstream.Color = resolve.ColorGreen
+
+	// rename the context, so bundle gets moved over to the new keys
+	context := service.Contexts[0]
+	context.Previous = []*lang.ContextPrevious{{Name: context.Name}}
+	context.Name = "renamed"
+
+	tests := []struct {
+		moveByAdoption bool
+		deployName     string
+	}{
+		// deployment moved by adoption stays under its previous name and color
+		{true, prevUpstream.GetDeployName()},
+		// deployment moved by plugin gets the default name of the new key
+		{false, ""},
+	}
+	for _, test := range tests {
+		plugins := &orphansRegistry{plugins: map[string]plugin.CodePlugin{
+			"helm": &movingCodePlugin{CodePlugin: fake.NewNoOpCodePlugin(0), moveByAdoption: test.moveByAdoption},
+		}}
+		desiredState := resolveAgainstActualState(b.Policy(), actualState, plugins, eventLog, resolveFunc)
+		nextUpstream := findInstance(t, desiredState, upstream)
+		if !assert.Equal(t, prevUpstream.GetKey(), desiredState.GetMoves(actualState)[nextUpstream.GetKey()], "Upstream should be moved over to the new key") {
+			t.FailNow()
+		}
+
+		deployName := test.deployName
+		if len(deployName) <= 0 {
+			deployName = nextUpstream.GetDeployName()
+		}
+		assert.Equal(t, deployName, nextUpstream.ResolvedDeployName, "Upstream should be resolved against the deployment it's going to run under (move by adoption: %t)", test.moveByAdoption)
+		assert.Equal(t, util.EscapeName(deployName), findInstance(t, desiredState, dependent).CalculatedCodeParams["upstream"], "Dependent should discover the deployment upstream is going to run under (move by adoption: %t)", test.moveByAdoption)
+	}
+}
+
+func findInstance(t *testing.T, resolution *resolve.PolicyResolution, component *lang.BundleComponent) *resolve.ComponentInstance {
+	t.Helper()
+	for _, instance := range resolution.ComponentInstanceMap {
+		if instance.Metadata.Key.ComponentName == component.Name {
+			return instance
+		}
+	}
+	t.Fatalf("component instance not found: %s", component.Name)
+	return nil
+}
+
+// movingCodePlugin is a code plugin, which may move deployments by adoption
+type movingCodePlugin struct {
+	plugin.CodePlugin
+	moveByAdoption bool
+}
+
+func (p *movingCodePlugin) MovesByAdoption() bool {
+	return p.moveByAdoption
+}
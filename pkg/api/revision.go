@@ -5,10 +5,30 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/diff"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/visualization"
 	"github.com/julienschmidt/httprouter"
 )
 
+// TypeRevisionGraph is an informational data structure with Kind and Constructor for RevisionGraph
+var TypeRevisionGraph = &runtime.TypeInfo{
+	Kind:        "revision-graph",
+	Constructor: func() runtime.Object { return &RevisionGraph{} },
+}
+
+// RevisionGraph represents the action plan of a revision as a graph, in Graphviz DOT format and in JSON format
+// which can be fed directly into vis.js
+type RevisionGraph struct {
+	runtime.TypeKind `yaml:",inline"`
+	Generation       runtime.Generation
+	DOT              string
+	JSON             string
+}
+
 func (api *coreAPI) handleRevisionGet(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 	gen := params.ByName("gen")
 
@@ -28,6 +48,53 @@ func (api *coreAPI) handleRevisionGet(writer http.ResponseWriter, request *http.
 	}
 }
 
+func (api *coreAPI) handleRevisionCancel(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	// Load current policy
+	policy, _, err := api.registry.GetPolicy(runtime.LastOrEmptyGen)
+	if err != nil {
+		panic(fmt.Sprintf("error while loading latest policy: %s", err))
+	}
+
+	// check that user is a domain admin
+	user := api.getUserRequired(request)
+	if !isDomainAdmin(user, policy) {
+		panic(fmt.Sprintf("user is not allowed to cancel revisions"))
+	}
+
+	// Here we need to take mutex to handle policy and revision updates
+	api.policyAndRevisionUpdateMutex.Lock()
+	defer api.policyAndRevisionUpdateMutex.Unlock()
+
+	gen := runtime.ParseGeneration(params.ByName("gen"))
+	revision, err := api.registry.GetRevision(gen)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting requested revision: %s", err))
+	}
+
+	if revision == nil {
+		api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+		return
+	}
+
+	if revision.Status != engine.RevisionStatusWaiting && revision.Status != engine.RevisionStatusInProgress {
+		panic(fmt.Sprintf("revision %d can't be cancelled, as it's in '%s' status", revision.GetGeneration(), revision.Status))
+	}
+
+	// revision which is waiting can be marked as cancelled right away, so the enforcer will never pick it up
+	if revision.Status == engine.RevisionStatusWaiting {
+		revision.Status = engine.RevisionStatusCancelled
+		updateErr := api.registry.UpdateRevision(revision)
+		if updateErr != nil {
+			panic(fmt.Sprintf("error while cancelling revision %d: %s", revision.GetGeneration(), updateErr))
+		}
+	}
+
+	// signal to the enforcer that revision needs to be cancelled, in case it's being applied right now
+	api.cancelRevision <- revision.GetGeneration()
+
+	api.contentType.WriteOne(writer, request, revision)
+}
+
 type revisionsWrapper struct {
 	Data interface{}
 }
@@ -54,3 +121,59 @@ func (api *coreAPI) handleRevisionsGetByPolicy(writer http.ResponseWriter, reque
 		api.contentType.WriteOne(writer, request, &revisionsWrapper{Data: revisions})
 	}
 }
+
+func (api *coreAPI) handleRevisionGraphGet(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	gen := params.ByName("gen")
+
+	if len(gen) == 0 {
+		gen = strconv.Itoa(int(runtime.LastOrEmptyGen))
+	}
+
+	revision, err := api.registry.GetRevision(runtime.ParseGeneration(gen))
+	if err != nil {
+		panic(fmt.Sprintf("error while getting requested revision: %s", err))
+	}
+
+	if revision == nil {
+		api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+		return
+	}
+
+	plan, err := api.getRevisionActionPlan(revision)
+	if err != nil {
+		api.contentType.WriteOne(writer, request, NewServerError(err.Error()))
+		return
+	}
+
+	graph := visualization.NewActionPlanGraph(plan)
+	api.contentType.WriteOne(writer, request, &RevisionGraph{
+		TypeKind:   TypeRevisionGraph.GetTypeKind(),
+		Generation: revision.GetGeneration(),
+		DOT:        string(graph.GetDataDOT()),
+		JSON:       string(graph.GetDataJSON()),
+	})
+}
+
+// getRevisionActionPlan rebuilds the action plan of a revision against the snapshot of actual state, which apply of
+// the revision has been started with. If there is no such snapshot (e.g. revision is still waiting to be applied), the
+// plan is unavailable, as calculating it against the current actual state would produce a different plan
+func (api *coreAPI) getRevisionActionPlan(revision *engine.Revision) (*action.Plan, error) {
+	desiredState, err := api.registry.GetDesiredState(revision)
+	if err != nil {
+		panic(fmt.Sprintf("can't load desired state from revision: %s", err))
+	}
+
+	if revision.RecalculateAll {
+		return diff.NewPolicyResolutionDiff(desiredState, resolve.NewPolicyResolution()).ActionPlan, nil
+	}
+
+	initialState, _, err := api.registry.GetRevisionApplyState(revision)
+	if err != nil {
+		panic(fmt.Sprintf("error while loading apply state of revision: %s", err))
+	}
+	if initialState == nil {
+		return nil, fmt.Errorf("action plan of revision %d is unavailable, as there is no snapshot of actual state it has been applied against (revision status: %s)", revision.GetGeneration(), revision.Status)
+	}
+
+	return diff.NewPolicyResolutionDiff(desiredState, initialState).ActionPlan, nil
+}
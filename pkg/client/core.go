@@ -34,11 +34,21 @@ type Claim interface {
 // Revision is the interface for getting Revisions
 type Revision interface {
 	Show(gen runtime.Generation) (*engine.Revision, error)
+	Cancel(gen runtime.Generation) (*engine.Revision, error)
+	Graph(gen runtime.Generation) (*api.RevisionGraph, error)
 }
 
 // State is the interface for resetting Actual State
 type State interface {
 	Reset(bool) (*api.PolicyUpdateResult, error)
+	Drift() (*api.StateDrift, error)
+	Retained() (*api.StateRetained, error)
+	Purge(key string) (*api.StateRetained, error)
+	Adopt(mapping map[string]string, noop bool) (*api.StateAdopted, error)
+	Orphans() (*api.StateOrphans, error)
+	DestroyOrphans(deployName string) (*api.StateOrphans, error)
+	At(point string) (*api.StateSnapshot, error)
+	Diff(from string, to string) (*api.StateDiff, error)
 }
 
 // User is the interface for auth and user management
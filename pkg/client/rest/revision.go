@@ -28,3 +28,29 @@ func (client *revisionClient) Show(gen runtime.Generation) (*engine.Revision, er
 
 	return response.(*engine.Revision), nil
 }
+
+func (client *revisionClient) Cancel(gen runtime.Generation) (*engine.Revision, error) {
+	response, err := client.httpClient.POST(fmt.Sprintf("/revision/cancel/gen/%d", gen), engine.TypeRevision, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*engine.Revision), nil
+}
+
+func (client *revisionClient) Graph(gen runtime.Generation) (*api.RevisionGraph, error) {
+	response, err := client.httpClient.GET(fmt.Sprintf("/revision/graph/gen/%d", gen), api.TypeRevisionGraph)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.RevisionGraph), nil
+}
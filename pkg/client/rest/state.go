@@ -2,6 +2,7 @@ package rest
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/Aptomi/aptomi/pkg/api"
 	"github.com/Aptomi/aptomi/pkg/client/rest/http"
@@ -29,3 +30,111 @@ func (client *stateClient) Reset(noop bool) (*api.PolicyUpdateResult, error) {
 
 	return revision.(*api.PolicyUpdateResult), nil
 }
+
+func (client *stateClient) Drift() (*api.StateDrift, error) {
+	response, err := client.httpClient.GET("/state/drift", api.TypeStateDrift)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.StateDrift), nil
+}
+
+func (client *stateClient) Retained() (*api.StateRetained, error) {
+	response, err := client.httpClient.GET("/state/retained", api.TypeStateRetained)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.StateRetained), nil
+}
+
+func (client *stateClient) Purge(key string) (*api.StateRetained, error) {
+	response, err := client.httpClient.POST(fmt.Sprintf("/state/retained/purge/%s", url.PathEscape(key)), api.TypeStateRetained, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.StateRetained), nil
+}
+
+func (client *stateClient) Adopt(mapping map[string]string, noop bool) (*api.StateAdopted, error) {
+	adoptReq := &api.StateAdoptRequest{
+		TypeKind: api.TypeStateAdoptRequest.GetTypeKind(),
+		Mapping:  mapping,
+	}
+	response, err := client.httpClient.POST(fmt.Sprintf("/state/adopt/noop/%t", noop), api.TypeStateAdopted, adoptReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.StateAdopted), nil
+}
+
+func (client *stateClient) Orphans() (*api.StateOrphans, error) {
+	response, err := client.httpClient.GET("/state/orphans", api.TypeStateOrphans)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.StateOrphans), nil
+}
+
+func (client *stateClient) DestroyOrphans(deployName string) (*api.StateOrphans, error) {
+	response, err := client.httpClient.POST(fmt.Sprintf("/state/orphans/destroy/%s", url.PathEscape(deployName)), api.TypeStateOrphans, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.StateOrphans), nil
+}
+
+func (client *stateClient) At(point string) (*api.StateSnapshot, error) {
+	response, err := client.httpClient.GET(fmt.Sprintf("/state/at/%s", url.PathEscape(point)), api.TypeStateSnapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.StateSnapshot), nil
+}
+
+func (client *stateClient) Diff(from string, to string) (*api.StateDiff, error) {
+	response, err := client.httpClient.GET(fmt.Sprintf("/state/diff/%s/%s", url.PathEscape(from), url.PathEscape(to)), api.TypeStateDiff)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.StateDiff), nil
+}
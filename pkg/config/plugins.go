@@ -4,9 +4,16 @@ import "time"
 
 // Plugins represents configs for all plugins
 type Plugins struct {
-	K8s    K8s
-	K8sRaw K8sRaw
-	Helm   Helm
+	K8s       K8s
+	K8sRaw    K8sRaw
+	Helm      Helm
+	Kustomize Kustomize
+	Local     Local
+
+	Terraform Terraform
+
+	External  External
+	Simulated Simulated
 }
 
 // K8s represents config for Kubernetes cluster plugin
@@ -22,4 +29,92 @@ type K8sRaw struct {
 // Helm represents configs for Helm code plugin
 type Helm struct {
 	Timeout time.Duration
+
+	// Tillerless enables Helm code plugin, which renders charts on Aptomi side and keeps releases in cluster Secrets
+	// instead of installing Tiller. Releases created by Tiller (with either ConfigMaps or Secrets storage driver) are
+	// migrated when they get updated for the first time
+	Tillerless bool
+
+	// ChartsDir is a directory on Aptomi server with charts, which could be referenced by chartPath param or by
+	// chartName param without chartRepo. Charts can be kept there as directories or as tarballs
+	ChartsDir string
+
+	// CacheDir is a directory where charts downloaded from chart repositories are cached by digest. Default is
+	// "aptomi-helm-charts" in the system temp dir
+	CacheDir string
+
+	// Repositories is a list of private chart repositories, which need credentials
+	Repositories []HelmRepository
+}
+
+// HelmRepository represents private Helm chart repository
+type HelmRepository struct {
+	// URL is a URL of the chart repository, the same as in chartRepo param
+	URL string
+
+	// Credentials is a name of the secrets entry, which contains credentials for the repository. Secrets can have
+	// "username" and "password" for basic auth, as well as PEM encoded "cert", "key" and "ca" for TLS client auth
+	Credentials string
+}
+
+// Kustomize represents config for Kustomize code plugin
+type Kustomize struct {
+	// BasesDir is a directory on Aptomi server with bases, which could be referenced by base param. Base can't point
+	// outside of it and can't be used at all if it isn't configured
+	BasesDir string
+}
+
+// Local represents config for local cluster plugin and process code plugin
+type Local struct {
+	// StopTimeout is how long to wait for a process to exit after it's been asked to terminate, before killing it
+	StopTimeout time.Duration
+}
+
+// Terraform represents config for Terraform code plugin
+type Terraform struct {
+	// Binary is a path to terraform executable. Default is "terraform", which is looked up in PATH
+	Binary string
+
+	// WorkDir is a directory where Terraform commands of all deployments are run. Terraform state is kept in Aptomi
+	// store and only written into it for the time of commands, so it only caches modules and providers downloaded by
+	// terraform init. Default is a dir in the system temp dir
+	WorkDir string
+
+	// Timeout is a max duration of a single terraform command. Default is 30 minutes
+	Timeout time.Duration
+}
+
+// External represents config for out-of-process plugins
+type External struct {
+	// Dir is a directory with plugin executables. Every executable in it gets started on server start and registers
+	// cluster and code types it supports. No external plugins are loaded if it's empty
+	Dir string
+
+	// Timeout is a max duration of a single call to the external plugin. Plugin process gets killed and restarted if
+	// the call takes longer
+	Timeout time.Duration
+}
+
+// Simulated represents config for simulated plugins, which pretend to deploy components by keeping them in memory or
+// in a local file. They are used instead of real plugins when enforcer or updater run in simulated mode
+type Simulated struct {
+	// StateFile is a file where deployed components are kept, so they survive server restarts. Deployed components
+	// are kept in memory only if it's empty
+	StateFile string
+
+	// ActionSleep is how long every create, update, move and destroy action takes
+	ActionSleep time.Duration
+
+	// ReadyDelay is how long it takes for created or updated component to become ready
+	ReadyDelay time.Duration
+
+	// FailRate is a probability (from 0 to 1) of every action to fail
+	FailRate float64
+
+	// FailPattern is a regular expression. Actions fail for all components which deploy names match it
+	FailPattern string
+
+	// FailActions is a list of actions failures get injected into (create, update, move, destroy). All actions are
+	// subject to failures if it's empty
+	FailActions []string
 }
@@ -18,7 +18,9 @@ type Server struct {
 	SecretsDir           string               `validate:"omitempty,dir"` // secrets is not a first-class citizen yet, so it's not required
 	Enforcer             DesiredStateEnforcer `validate:"required"`
 	Updater              ActualStateUpdater   `validate:"required"`
+	History              ActualStateHistory   `validate:"-"`
 	DomainAdminOverrides map[string]bool      `validate:"-"`
+	Resolver             PolicyResolver       `validate:"-"`
 	Auth                 ServerAuth           `validate:"-"`
 	Profile              Profile              `validate:"-"`
 }
@@ -49,11 +51,32 @@ type DB = etcd.Config
 // DesiredStateEnforcer represents config for desired state enforcer background process that periodically gets latest policy, calculating
 // difference between it and actual state and then applying calculated actions
 type DesiredStateEnforcer struct {
-	Disabled             bool          `validate:"-"`
-	Interval             time.Duration `validate:"-"`
-	Noop                 bool          `validate:"-"`
-	NoopSleep            time.Duration `validate:"-"`
-	MaxConcurrentActions int           `validate:"-"`
+	Disabled                        bool           `validate:"-"`
+	Interval                        time.Duration  `validate:"-"`
+	Noop                            bool           `validate:"-"`
+	NoopSleep                       time.Duration  `validate:"-"`
+	Simulated                       bool           `validate:"-"` // use simulated plugins (see Plugins.Simulated) instead of real ones
+	MaxConcurrentActions            int            `validate:"-"`
+	MaxConcurrentActionsPerCluster  int            `validate:"-"` // max concurrent actions for every cluster (0 = no limit)
+	MaxConcurrentActionsPerCodeType map[string]int `validate:"-"` // max concurrent actions for specific code types, e.g. helm (0 = no limit)
+	CancelDeadline                  time.Duration  `validate:"-"` // how long to wait for in-progress actions when revision is cancelled (0 = wait until they finish)
+	BlueGreenReadinessTimeout       time.Duration  `validate:"-"` // how long blue/green updates wait for the new deployment to become ready
+}
+
+// PolicyResolver represents config for policy resolution, which happens every time policy gets changed
+type PolicyResolver struct {
+	FullResolution        bool `validate:"-"` // resolve all claims on every policy change instead of only the affected ones
+	FailConflictingClaims bool `validate:"-"` // fail only claims with conflicting params instead of the whole component instances
+}
+
+// ActualStateHistory represents config for the history of actual state changes. Every SnapshotEvery changes a snapshot of
+// actual state is taken, so actual state at any point in time is reconstructed by replaying changes on top of the nearest
+// snapshot. The oldest history gets pruned snapshot by snapshot, once it's older than MaxAge or there are more than
+// MaxChanges changes recorded (0 = no limit)
+type ActualStateHistory struct {
+	SnapshotEvery int           `validate:"-"`
+	MaxAge        time.Duration `validate:"-"`
+	MaxChanges    int           `validate:"-"`
 }
 
 // ActualStateUpdater represents config for actual state updater background process that periodically refreshes actual state
@@ -63,7 +86,10 @@ type ActualStateUpdater struct {
 	Interval             time.Duration `validate:"-"`
 	Noop                 bool          `validate:"-"`
 	NoopSleep            time.Duration `validate:"-"`
+	Simulated            bool          `validate:"-"` // use simulated plugins (see Plugins.Simulated) instead of real ones
 	MaxConcurrentActions int           `validate:"-"`
+	DriftCheck           bool          `validate:"-"` // check deployed component instances for drift from their params
+	DriftReapply         bool          `validate:"-"` // re-apply drifted component instances right away (otherwise they get re-applied with the next revision)
 }
 
 // ServerAuth represents server auth config
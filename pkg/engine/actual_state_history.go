@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+)
+
+const (
+	// ActualStateChangeCreate represents creation of a component instance in actual state
+	ActualStateChangeCreate = "create"
+	// ActualStateChangeUpdate represents update of an existing component instance in actual state
+	ActualStateChangeUpdate = "update"
+	// ActualStateChangeDelete represents deletion of a component instance from actual state
+	ActualStateChangeDelete = "delete"
+)
+
+// TypeActualStateChange is an informational data structure with Kind and Constructor for ActualStateChange
+var TypeActualStateChange = &runtime.TypeInfo{
+	Kind:        "actual-state-change",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &ActualStateChange{} },
+}
+
+// ActualStateChange is a record of a single change made to a component instance in actual state. Records are stored
+// for every create/update/delete, so actual state can be reconstructed for any point in time by replaying them on top
+// of the snapshot their epoch has started with
+type ActualStateChange struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	Epoch        uint64
+	ChangedAt    time.Time
+	Op           string
+	ComponentKey string
+
+	// Previous is a component instance before the change (nil for create)
+	Previous *resolve.ComponentInstance
+
+	// Instance is a component instance after the change (nil for delete)
+	Instance *resolve.ComponentInstance
+}
+
+// NewActualStateChange creates new ActualStateChange for the component instance
+func NewActualStateChange(op string, componentKey string, previous *resolve.ComponentInstance, instance *resolve.ComponentInstance) *ActualStateChange {
+	return &ActualStateChange{
+		TypeKind:     TypeActualStateChange.GetTypeKind(),
+		ChangedAt:    time.Now(),
+		Op:           op,
+		ComponentKey: componentKey,
+		Previous:     previous,
+		Instance:     instance,
+	}
+}
+
+// GetName returns name of the ActualStateChange. Names start with the epoch, so all changes of an epoch could be
+// found by key prefix, and are ordered by time of the change within the epoch
+func (change *ActualStateChange) GetName() string {
+	return fmt.Sprintf("%s%019d-%s", ActualStateEpochPrefix(change.Epoch), change.ChangedAt.UnixNano(), change.ComponentKey)
+}
+
+// GetNamespace returns namespace of the ActualStateChange
+func (change *ActualStateChange) GetNamespace() string {
+	return runtime.SystemNS
+}
+
+// ActualStateEpochPrefix returns prefix of names of all changes recorded in the given epoch
+func ActualStateEpochPrefix(epoch uint64) string {
+	return fmt.Sprintf("%019d-", epoch)
+}
+
+// TypeActualStateSnapshot is an informational data structure with Kind and Constructor for ActualStateSnapshot
+var TypeActualStateSnapshot = &runtime.TypeInfo{
+	Kind:        "actual-state-snapshot",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &ActualStateSnapshot{} },
+}
+
+// ActualStateSnapshot is a full copy of actual state taken at the start of an epoch. Actual state at any point in time
+// within the epoch is reconstructed by replaying changes of the epoch on top of it
+type ActualStateSnapshot struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	Epoch     uint64
+	TakenAt   time.Time
+	Instances map[string]*resolve.ComponentInstance
+}
+
+// NewActualStateSnapshot creates new ActualStateSnapshot of the given actual state
+func NewActualStateSnapshot(epoch uint64, actualState *resolve.PolicyResolution) *ActualStateSnapshot {
+	return &ActualStateSnapshot{
+		TypeKind:  TypeActualStateSnapshot.GetTypeKind(),
+		Epoch:     epoch,
+		TakenAt:   time.Now(),
+		Instances: actualState.ComponentInstanceMap,
+	}
+}
+
+// ActualStateSnapshotKey returns key of the ActualStateSnapshot for the given epoch
+func ActualStateSnapshotKey(epoch uint64) runtime.Key {
+	return runtime.KeyFromParts(runtime.SystemNS, TypeActualStateSnapshot.Kind, fmt.Sprintf("%019d", epoch))
+}
+
+// GetName returns name of the ActualStateSnapshot
+func (snapshot *ActualStateSnapshot) GetName() string {
+	return fmt.Sprintf("%019d", snapshot.Epoch)
+}
+
+// GetNamespace returns namespace of the ActualStateSnapshot
+func (snapshot *ActualStateSnapshot) GetNamespace() string {
+	return runtime.SystemNS
+}
+
+// TypeActualStateHistory is an informational data structure with Kind and Constructor for ActualStateHistory
+var TypeActualStateHistory = &runtime.TypeInfo{
+	Kind:        "actual-state-history",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &ActualStateHistory{} },
+}
+
+// ActualStateHistoryKey is the key for the ActualStateHistory object (there is only one history object)
+var ActualStateHistoryKey = runtime.KeyFromParts(runtime.SystemNS, TypeActualStateHistory.Kind, runtime.EmptyName)
+
+// ActualStateHistory is an index of the retained history of actual state. History is split into epochs, every epoch
+// starts with a snapshot of actual state, which is followed by the changes recorded during the epoch
+type ActualStateHistory struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// Epochs is a list of retained epochs, sorted by time
+	Epochs []*ActualStateEpoch
+}
+
+// ActualStateEpoch represents a single epoch of actual state history
+type ActualStateEpoch struct {
+	Epoch     uint64
+	StartedAt time.Time
+	Changes   int
+}
+
+// NewActualStateHistory creates new empty ActualStateHistory
+func NewActualStateHistory() *ActualStateHistory {
+	return &ActualStateHistory{
+		TypeKind: TypeActualStateHistory.GetTypeKind(),
+		Epochs:   []*ActualStateEpoch{},
+	}
+}
+
+// GetName returns name of the ActualStateHistory
+func (history *ActualStateHistory) GetName() string {
+	return runtime.EmptyName
+}
+
+// GetNamespace returns namespace of the ActualStateHistory
+func (history *ActualStateHistory) GetNamespace() string {
+	return runtime.SystemNS
+}
+
+// Current returns the current epoch, which changes should be recorded in, or nil if history is empty
+func (history *ActualStateHistory) Current() *ActualStateEpoch {
+	if len(history.Epochs) <= 0 {
+		return nil
+	}
+	return history.Epochs[len(history.Epochs)-1]
+}
+
+// StartEpoch starts a new epoch and returns it
+func (history *ActualStateHistory) StartEpoch(startedAt time.Time) *ActualStateEpoch {
+	epoch := &ActualStateEpoch{Epoch: 1, StartedAt: startedAt}
+	if current := history.Current(); current != nil {
+		epoch.Epoch = current.Epoch + 1
+	}
+	history.Epochs = append(history.Epochs, epoch)
+	return epoch
+}
+
+// EpochAt returns the epoch, which the given point in time belongs to, or nil if it's before the oldest retained epoch
+func (history *ActualStateHistory) EpochAt(at time.Time) *ActualStateEpoch {
+	idx := sort.Search(len(history.Epochs), func(i int) bool {
+		return history.Epochs[i].StartedAt.After(at)
+	})
+	if idx <= 0 {
+		return nil
+	}
+	return history.Epochs[idx-1]
+}
+
+// Prune removes the oldest epochs, which are beyond retention limits, and returns them. Epochs older than maxAge are
+// removed as long as the next epoch has started before that, so the history still covers the whole maxAge period.
+// Epochs are also removed while the total number of changes exceeds maxChanges. Zero limit means no limit. The current
+// epoch is always retained
+func (history *ActualStateHistory) Prune(maxAge time.Duration, maxChanges int, now time.Time) []*ActualStateEpoch {
+	total := 0
+	for _, epoch := range history.Epochs {
+		total += epoch.Changes
+	}
+
+	pruned := []*ActualStateEpoch{}
+	for len(history.Epochs) > 1 {
+		tooOld := maxAge > 0 && history.Epochs[1].StartedAt.Before(now.Add(-maxAge))
+		tooMany := maxChanges > 0 && total > maxChanges
+		if !tooOld && !tooMany {
+			break
+		}
+		total -= history.Epochs[0].Changes
+		pruned = append(pruned, history.Epochs[0])
+		history.Epochs = history.Epochs[1:]
+	}
+	return pruned
+}
+
+// ActualStateAt reconstructs actual state at the given point in time by replaying changes made after the snapshot had
+// been taken and before the given time on top of the snapshot
+func ActualStateAt(snapshot *ActualStateSnapshot, changes []*ActualStateChange, at time.Time) *resolve.PolicyResolution {
+	sorted := make([]*ActualStateChange, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ChangedAt.Before(sorted[j].ChangedAt)
+	})
+
+	result := resolve.NewPolicyResolution()
+	for key, instance := range snapshot.Instances {
+		result.ComponentInstanceMap[key] = instance
+	}
+
+	for _, change := range sorted {
+		if !change.ChangedAt.After(snapshot.TakenAt) {
+			// change is already a part of the snapshot
+			continue
+		}
+		if change.ChangedAt.After(at) {
+			break
+		}
+		if change.Instance != nil {
+			result.ComponentInstanceMap[change.ComponentKey] = change.Instance
+		} else {
+			delete(result.ComponentInstanceMap, change.ComponentKey)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/lang/builder"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActualStateAt(t *testing.T) {
+	start := time.Now().Add(-10 * time.Hour)
+	hour := func(n int) time.Time {
+		return start.Add(time.Duration(n) * time.Hour)
+	}
+
+	// "a" and "b" are in the snapshot taken at 1h, "a" hasn't been changed since then
+	a := makeInstance("a", hour(0), nil)
+
+	// "b" got updated at 2h and deleted at 4h
+	b1 := makeInstance("b", hour(0), util.NestedParameterMap{"param": "value1"})
+	b2 := makeInstance("b", hour(0), util.NestedParameterMap{"param": "value2"})
+
+	// "c" got created at 3h
+	c := makeInstance("c", hour(3), nil)
+
+	snapshot := &ActualStateSnapshot{
+		Epoch:     1,
+		TakenAt:   hour(1),
+		Instances: map[string]*resolve.ComponentInstance{a.GetKey(): a, b1.GetKey(): b1},
+	}
+
+	// change made before the snapshot has been taken is already a part of it
+	changes := []*ActualStateChange{
+		makeChange(ActualStateChangeDelete, b2.GetKey(), hour(4), b2, nil),
+		makeChange(ActualStateChangeUpdate, b1.GetKey(), hour(2), b1, b2),
+		makeChange(ActualStateChangeCreate, c.GetKey(), hour(3), nil, c),
+		makeChange(ActualStateChangeCreate, b1.GetKey(), hour(0), nil, b1),
+	}
+
+	verify := func(at time.Time, expected map[string]*resolve.ComponentInstance) {
+		t.Helper()
+		state := ActualStateAt(snapshot, changes, at)
+		assert.Equal(t, len(expected), len(state.ComponentInstanceMap), "Number of component instances at %s", at)
+		for key, instance := range expected {
+			assert.Equal(t, instance, state.ComponentInstanceMap[key], "Component instance %s at %s", key, at)
+		}
+	}
+
+	verify(hour(1), map[string]*resolve.ComponentInstance{a.GetKey(): a, b1.GetKey(): b1})
+	verify(hour(2), map[string]*resolve.ComponentInstance{a.GetKey(): a, b2.GetKey(): b2})
+	verify(hour(3), map[string]*resolve.ComponentInstance{a.GetKey(): a, b2.GetKey(): b2, c.GetKey(): c})
+	verify(hour(5), map[string]*resolve.ComponentInstance{a.GetKey(): a, c.GetKey(): c})
+}
+
+func TestActualStateHistoryEpochs(t *testing.T) {
+	start := time.Now().Add(-10 * time.Hour)
+	hour := func(n int) time.Time {
+		return start.Add(time.Duration(n) * time.Hour)
+	}
+
+	history := NewActualStateHistory()
+	assert.Nil(t, history.Current(), "Empty history should have no current epoch")
+	assert.Nil(t, history.EpochAt(hour(0)), "Empty history should have no epochs")
+
+	for i := 1; i <= 4; i++ {
+		history.StartEpoch(hour(2 * i)).Changes = 10
+	}
+	assert.Equal(t, uint64(4), history.Current().Epoch, "Epochs should be numbered sequentially")
+
+	// epochs started at 2h, 4h, 6h and 8h
+	assert.Nil(t, history.EpochAt(hour(1)), "Time before the first epoch should not be covered by history")
+	assert.Equal(t, uint64(1), history.EpochAt(hour(2)).Epoch, "Epoch should be found by its start time")
+	assert.Equal(t, uint64(2), history.EpochAt(hour(5)).Epoch, "Epoch should be found by time within it")
+	assert.Equal(t, uint64(4), history.EpochAt(hour(20)).Epoch, "Time after the last epoch has started should belong to it")
+
+	// no limits
+	assert.Empty(t, history.Prune(0, 0, hour(10)), "Nothing should be pruned without limits")
+
+	// 5h is still covered by the 2nd epoch, so only the 1st one gets pruned
+	pruned := history.Prune(5*time.Hour, 0, hour(10))
+	if !assert.Len(t, pruned, 1, "Epochs older than max age should be pruned") {
+		t.FailNow()
+	}
+	assert.Equal(t, uint64(1), pruned[0].Epoch, "The oldest epoch should be pruned")
+
+	// 30 changes are retained in total
+	pruned = history.Prune(0, 20, hour(10))
+	assert.Len(t, pruned, 1, "Epochs should be pruned while there are more changes than allowed")
+	assert.Len(t, history.Epochs, 2, "Epochs within limits should be retained")
+
+	// current epoch is always retained
+	pruned = history.Prune(time.Nanosecond, 1, hour(10))
+	assert.Len(t, pruned, 1, "All epochs except the current one should be pruned")
+	assert.Equal(t, uint64(4), history.Current().Epoch, "Current epoch should be retained")
+}
+
+func makeInstance(name string, createdAt time.Time, params util.NestedParameterMap) *resolve.ComponentInstance {
+	b := builder.NewPolicyBuilder()
+	bundle := b.AddBundle()
+	service := b.AddService(bundle, b.CriteriaTrue())
+	key := resolve.NewComponentInstanceKey(b.AddCluster(), name, service, service.Contexts[0], nil, bundle, nil)
+
+	instance := resolve.NewPolicyResolution().GetComponentInstanceEntry(key)
+	instance.CalculatedCodeParams = params
+	instance.CreatedAt = createdAt
+	instance.UpdatedAt = createdAt
+	return instance
+}
+
+func makeChange(op string, key string, changedAt time.Time, previous *resolve.ComponentInstance, instance *resolve.ComponentInstance) *ActualStateChange {
+	change := NewActualStateChange(op, key, previous, instance)
+	change.ChangedAt = changedAt
+	return change
+}
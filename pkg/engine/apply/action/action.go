@@ -11,3 +11,16 @@ type Interface interface {
 	Apply(*Context) error
 	DescribeChanges() util.NestedParameterMap
 }
+
+// ComponentInterface is an interface for actions which are performed on a specific component instance
+type ComponentInterface interface {
+	Interface
+	GetComponentKey() string
+}
+
+// ParameterChangesInterface is an interface for actions which change parameters of a specific component instance and
+// can describe those changes field by field
+type ParameterChangesInterface interface {
+	ComponentInterface
+	GetParameterChanges() []*util.ParameterChange
+}
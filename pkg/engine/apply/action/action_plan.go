@@ -1,22 +1,43 @@
 package action
 
 import (
+	"errors"
 	"fmt"
 	"runtime/debug"
 	"sync"
+
+	"github.com/Aptomi/aptomi/pkg/util"
 )
 
+// errPlanCancelled is used to mark graph nodes as failed when plan gets cancelled, so the rest of the actions get skipped
+var errPlanCancelled = errors.New("action plan has been cancelled")
+
 // Plan is a plan of actions
 type Plan struct {
 	// NodeMap is a map from key to a graph of actions, which must to be executed in order to get from actual state to
 	// desired state. Key in the map corresponds to the key of the GraphNode
 	NodeMap map[string]*GraphNode
+
+	// completed is a set of keys of graph nodes, which have already been completed (e.g. before the server restart)
+	// and therefore should not be executed again
+	completed map[string]bool
 }
 
 // NewPlan creates a new Plan
 func NewPlan() *Plan {
 	return &Plan{
-		NodeMap: make(map[string]*GraphNode),
+		NodeMap:   make(map[string]*GraphNode),
+		completed: make(map[string]bool),
+	}
+}
+
+// MarkCompleted marks graph nodes with given keys as completed. Actions of completed nodes will not be executed and
+// will not be counted when the plan gets applied
+func (plan *Plan) MarkCompleted(keys map[string]bool) {
+	for key, completed := range keys {
+		if completed {
+			plan.completed[key] = true
+		}
 	}
 }
 
@@ -30,8 +51,10 @@ func (plan *Plan) GetActionGraphNode(key string) *GraphNode {
 	return result
 }
 
-// Apply applies the action plan. It may call fn in multiple go routines, executing the plan in parallel
-func (plan *Plan) Apply(fn ApplyFunction, resultUpdater ApplyResultUpdater) *ApplyResult {
+// Apply applies the action plan. It may call fn in multiple go routines, executing the plan in parallel.
+// If cancel channel gets closed while the plan is being applied, no new actions will be started and all remaining
+// actions will be counted as skipped. A nil cancel channel means that the plan can't be cancelled
+func (plan *Plan) Apply(fn ApplyFunction, resultUpdater ApplyResultUpdater, cancel <-chan struct{}) *ApplyResult {
 	// make sure we are converting panics into errors
 	fnModified := func(act Interface) (errResult error) {
 		defer func() {
@@ -46,14 +69,14 @@ func (plan *Plan) Apply(fn ApplyFunction, resultUpdater ApplyResultUpdater) *App
 	resultUpdater.SetTotal(plan.NumberOfActions())
 
 	// apply the plan and calculate result (success/failed/skipped actions)
-	plan.applyInternal(fnModified, resultUpdater)
+	plan.applyInternal(fnModified, resultUpdater, cancel)
 
 	// tell results updater that we are done and return the results
-	return resultUpdater.Done()
+	return resultUpdater.Done(isCancelled(cancel))
 }
 
 // Apply applies the action plan. It may call fn in multiple go routines, executing the plan in parallel
-func (plan *Plan) applyInternal(fn ApplyFunction, resultUpdater ApplyResultUpdater) {
+func (plan *Plan) applyInternal(fn ApplyFunction, resultUpdater ApplyResultUpdater, cancel <-chan struct{}) {
 	deg := make(map[string]int)
 	wasError := make(map[string]error)
 	queue := make(chan string, len(plan.NodeMap))
@@ -78,7 +101,7 @@ func (plan *Plan) applyInternal(fn ApplyFunction, resultUpdater ApplyResultUpdat
 			// Take element off the queue, apply the block of actions and put into queue 0-degree nodes which are waiting on us
 			go func(key string) {
 				defer wg.Done()
-				plan.applyActions(key, fn, queue, deg, wasError, mutex, resultUpdater)
+				plan.applyActions(key, fn, queue, deg, wasError, mutex, resultUpdater, cancel)
 			}(key)
 		}
 		done.Done()
@@ -95,7 +118,7 @@ func (plan *Plan) applyInternal(fn ApplyFunction, resultUpdater ApplyResultUpdat
 }
 
 // This function applies a block of actions and updates nodes which are waiting on this node
-func (plan *Plan) applyActions(key string, fn ApplyFunction, queue chan string, deg map[string]int, wasError map[string]error, mutex *sync.RWMutex, resultUpdater ApplyResultUpdater) {
+func (plan *Plan) applyActions(key string, fn ApplyFunction, queue chan string, deg map[string]int, wasError map[string]error, mutex *sync.RWMutex, resultUpdater ApplyResultUpdater, cancel <-chan struct{}) {
 	// locate the node
 	node := plan.NodeMap[key]
 
@@ -105,13 +128,27 @@ func (plan *Plan) applyActions(key string, fn ApplyFunction, queue chan string,
 	foundErr := wasError[key]
 	mutex.RUnlock()
 	for _, action := range node.Actions {
+		// if node has already been completed before, there is nothing to do
+		if plan.completed[key] {
+			break
+		}
+
+		// if plan has been cancelled, this action and all subsequent actions are getting marked as skipped
+		if foundErr == nil && isCancelled(cancel) {
+			foundErr = errPlanCancelled
+		}
+
 		// if an error happened before, all subsequent actions are getting marked as skipped
 		if foundErr != nil {
 			resultUpdater.AddSkipped()
 		} else {
-			// Otherwise, let's run the action and see if it failed or not
+			// Otherwise, let's run the action and see if it failed or not. It gets skipped if the plan has been cancelled
+			// while the action was waiting to be started
 			err := fn(action)
-			if err != nil {
+			if err == errPlanCancelled {
+				resultUpdater.AddSkipped()
+				foundErr = err
+			} else if err != nil {
 				resultUpdater.AddFailed()
 				foundErr = err
 			} else {
@@ -120,11 +157,13 @@ func (plan *Plan) applyActions(key string, fn ApplyFunction, queue chan string,
 		}
 	}
 
-	// mark our node as failed, if we encountered an error
+	// mark our node as failed, if we encountered an error. otherwise, record that it has been completed
 	if foundErr != nil {
 		mutex.Lock()
 		wasError[key] = foundErr
 		mutex.Unlock()
+	} else if !plan.completed[key] {
+		resultUpdater.NodeCompleted(key)
 	}
 
 	// decrement degrees of nodes which are waiting on us
@@ -153,7 +192,7 @@ func (plan *Plan) NumberOfActions() uint32 {
 	resultUpdater := NewApplyResultUpdaterImpl()
 
 	// apply the plan and calculate result (success/failed/skipped actions)
-	plan.applyInternal(Noop(), resultUpdater)
+	plan.applyInternal(Noop(), resultUpdater, nil)
 
 	// return the number of success actions (all of them will be success due to Noop() action)
 	return resultUpdater.Result.Success
@@ -167,7 +206,31 @@ func (plan *Plan) AsText() *PlanAsText {
 	plan.applyInternal(WrapSequential(func(act Interface) error {
 		result.Actions = append(result.Actions, act.DescribeChanges())
 		return nil
-	}), NewApplyResultUpdaterImpl())
+	}), NewApplyResultUpdaterImpl(), nil)
 
 	return result
 }
+
+// ParameterChanges returns field-level changes for all component instances, which get their parameters changed by
+// the action plan. Key in the map is a component instance key
+func (plan *Plan) ParameterChanges() map[string][]*util.ParameterChange {
+	result := make(map[string][]*util.ParameterChange)
+	for _, node := range plan.NodeMap {
+		for _, act := range node.Actions {
+			if changesAct, ok := act.(ParameterChangesInterface); ok && len(changesAct.GetParameterChanges()) > 0 {
+				result[changesAct.GetComponentKey()] = changesAct.GetParameterChanges()
+			}
+		}
+	}
+	return result
+}
+
+// isCancelled returns true if cancel channel has been closed. It never blocks and always returns false for nil channel
+func isCancelled(cancel <-chan struct{}) bool {
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
@@ -28,6 +28,18 @@ func WrapParallelWithLimit(maxConcurrentGoRoutines int, fn ApplyFunction) ApplyF
 	}
 }
 
+// WrapSkipIfCancelled wraps apply function, so that it doesn't get called once cancel channel is closed and the action
+// gets counted as skipped instead. It's supposed to be wrapped into all concurrency limits, so cancellation gets checked
+// once again after the action has been waiting for a free slot
+func WrapSkipIfCancelled(cancel <-chan struct{}, fn ApplyFunction) ApplyFunction {
+	return func(act Interface) error {
+		if isCancelled(cancel) {
+			return errPlanCancelled
+		}
+		return fn(act)
+	}
+}
+
 // Noop returns a function that does nothing and returns nil
 func Noop() ApplyFunction {
 	return func(Interface) error { return nil }
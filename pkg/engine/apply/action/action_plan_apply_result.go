@@ -19,7 +19,8 @@ type ApplyResultUpdater interface {
 	AddSuccess()
 	AddFailed()
 	AddSkipped()
-	Done() *ApplyResult
+	NodeCompleted(key string)
+	Done(cancelled bool) *ApplyResult
 }
 
 // ApplyResultUpdaterImpl is a default thread-safe implementation of ApplyResultUpdater
@@ -54,8 +55,12 @@ func (updater *ApplyResultUpdaterImpl) AddSkipped() {
 	atomic.AddUint32(&updater.Result.Skipped, 1)
 }
 
+// NodeCompleted does nothing for default implementation
+func (updater *ApplyResultUpdaterImpl) NodeCompleted(key string) {
+}
+
 // Done does nothing except doing an integrity check for default implementation
-func (updater *ApplyResultUpdaterImpl) Done() *ApplyResult {
+func (updater *ApplyResultUpdaterImpl) Done(cancelled bool) *ApplyResult {
 	if updater.Result.Success+updater.Result.Failed+updater.Result.Skipped != updater.Result.Total {
 		panic(fmt.Sprintf("error while applying actions: %d (success) + %d (failed) + %d (skipped) != %d (total)", updater.Result.Success, updater.Result.Failed, updater.Result.Skipped, updater.Result.Total))
 	}
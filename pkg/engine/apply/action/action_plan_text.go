@@ -47,6 +47,9 @@ func (t *PlanAsText) String() string {
 		"[>]": "Add Consumers",
 		"[<]": "Remove Consumers",
 		"[@]": "Query Endpoints",
+		"[^]": "Move Instances",
+		"[=]": "Retain Instances",
+		"[x]": "Clean Up Instances",
 	}
 
 	// combine actions into a string
@@ -0,0 +1,72 @@
+package component
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// AdoptAction is a action which gets called when component instance has to adopt an existing deployment, which hasn't
+// been created by Aptomi. It only records component instance in actual state and doesn't touch anything in the cloud.
+// Claims get attached and code params get updated by the actions which follow it
+type AdoptAction struct {
+	*action.Metadata
+	ComponentKey string
+	DeployName   string
+	UpToDate     bool
+}
+
+// NewAdoptAction creates new AdoptAction
+func NewAdoptAction(componentKey string, deployName string, upToDate bool) *AdoptAction {
+	return &AdoptAction{
+		Metadata:     action.NewMetadata("action-component-adopt", componentKey),
+		ComponentKey: componentKey,
+		DeployName:   deployName,
+		UpToDate:     upToDate,
+	}
+}
+
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *AdoptAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
+// Apply applies the action
+func (a *AdoptAction) Apply(context *action.Context) (errResult error) {
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			errResult = fmt.Errorf("panic: %s\n%s", err, string(debug.Stack()))
+		}
+
+		action.CollectMetricsFor(a, start, errResult)
+	}()
+
+	context.EventLog.NewEntry().Debugf("Adopting existing deployment '%s' by component instance: %s", a.DeployName, a.ComponentKey)
+
+	instance := context.DesiredState.ComponentInstanceMap[a.ComponentKey]
+	if instance == nil {
+		panic(fmt.Sprintf("component instance not found in desired state: %s", a.ComponentKey))
+	}
+
+	// deployment may have been created in the meantime, in which case there is nothing to adopt anymore
+	if context.ActualStateUpdater.GetComponentInstance(a.ComponentKey) != nil {
+		return fmt.Errorf("unable to adopt deployment '%s', component instance already exists in actual state: %s", a.DeployName, a.ComponentKey)
+	}
+
+	return context.ActualStateUpdater.CreateComponentInstance(instance.MakeAdopted(a.DeployName, a.UpToDate))
+}
+
+// DescribeChanges returns text-based description of changes that will be applied
+func (a *AdoptAction) DescribeChanges() util.NestedParameterMap {
+	return util.NestedParameterMap{
+		"kind":       a.Kind,
+		"key":        a.ComponentKey,
+		"deployName": a.DeployName,
+		"upToDate":   a.UpToDate,
+		"pretty":     fmt.Sprintf("[&] %s (%s)", a.ComponentKey, a.DeployName),
+	}
+}
@@ -28,6 +28,11 @@ func NewAttachClaimAction(componentKey string, claimKey string, depth int) *Atta
 	}
 }
 
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *AttachClaimAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *AttachClaimAction) Apply(context *action.Context) (errResult error) {
 	start := time.Now()
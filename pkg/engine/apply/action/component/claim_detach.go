@@ -26,6 +26,11 @@ func NewDetachClaimAction(componentKey string, claimKey string) *DetachClaimActi
 	}
 }
 
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *DetachClaimAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *DetachClaimAction) Apply(context *action.Context) (errResult error) {
 	start := time.Now()
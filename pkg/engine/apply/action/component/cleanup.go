@@ -0,0 +1,128 @@
+package component
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// CleanupAction is a action which gets called after blue/green update of a component instance, once all component
+// instances depending on it have been switched over to the new deployment. It destroys the previous deployment, which
+// has been kept running until then. If it fails or gets skipped, it will be attempted again by the next revision
+type CleanupAction struct {
+	*action.Metadata
+	ComponentKey string
+	DeployName   string
+}
+
+// NewCleanupAction creates new CleanupAction. Deploy name of the previous deployment is only used to describe the
+// action, while the one recorded in actual state gets destroyed
+func NewCleanupAction(componentKey string, deployName string) *CleanupAction {
+	return &CleanupAction{
+		Metadata:     action.NewMetadata("action-component-cleanup", componentKey),
+		ComponentKey: componentKey,
+		DeployName:   deployName,
+	}
+}
+
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *CleanupAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
+// Apply applies the action
+func (a *CleanupAction) Apply(context *action.Context) (errResult error) {
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			errResult = fmt.Errorf("panic: %s\n%s", err, string(debug.Stack()))
+		}
+
+		action.CollectMetricsFor(a, start, errResult)
+	}()
+
+	context.EventLog.NewEntry().Debugf("Cleaning up previous deployment of component instance: %s", a.ComponentKey)
+
+	err := a.processDeployment(context)
+	if err != nil {
+		return fmt.Errorf("unable to clean up previous deployment of component instance '%s': %s", a.ComponentKey, err)
+	}
+
+	return nil
+}
+
+// DescribeChanges returns text-based description of changes that will be applied
+func (a *CleanupAction) DescribeChanges() util.NestedParameterMap {
+	return util.NestedParameterMap{
+		"kind":       a.Kind,
+		"key":        a.ComponentKey,
+		"deployName": a.DeployName,
+		"pretty":     fmt.Sprintf("[x] %s (%s)", a.ComponentKey, a.DeployName),
+	}
+}
+
+func (a *CleanupAction) processDeployment(context *action.Context) error {
+	instance := context.ActualStateUpdater.GetComponentInstance(a.ComponentKey)
+	if instance == nil || len(instance.InactiveDeployName) <= 0 {
+		// previous deployment has already been destroyed
+		return nil
+	}
+
+	bundleObj, err := context.DesiredPolicy.GetObject(lang.TypeBundle.Kind, instance.Metadata.Key.BundleName, instance.Metadata.Key.Namespace)
+	if err != nil {
+		return err
+	}
+	if bundleObj == nil {
+		return fmt.Errorf("bundle '%s/%s' in not present in policy", instance.Metadata.Key.Namespace, instance.Metadata.Key.BundleName)
+	}
+	component := bundleObj.(*lang.Bundle).GetComponentsMap()[instance.Metadata.Key.ComponentName] // nolint: errcheck
+	if component == nil || component.Code == nil {
+		return fmt.Errorf("code component '%s' in not present in bundle '%s/%s'", instance.Metadata.Key.ComponentName, instance.Metadata.Key.Namespace, instance.Metadata.Key.BundleName)
+	}
+
+	clusterObj, err := context.DesiredPolicy.GetObject(lang.TypeCluster.Kind, instance.Metadata.Key.ClusterName, instance.Metadata.Key.ClusterNameSpace)
+	if err != nil {
+		return err
+	}
+	if clusterObj == nil {
+		return fmt.Errorf("cluster '%s/%s' in not present in policy", instance.Metadata.Key.ClusterNameSpace, instance.Metadata.Key.ClusterName)
+	}
+	cluster := clusterObj.(*lang.Cluster) // nolint: errcheck
+
+	p, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
+	if err != nil {
+		return err
+	}
+
+	return destroyInactive(context, p, instance)
+}
+
+// destroyInactive destroys the previous deployment of component instance, which has been kept running after blue/green
+// update, and removes it from actual state
+func destroyInactive(context *action.Context, p plugin.CodePlugin, instance *resolve.ComponentInstance) error {
+	context.EventLog.NewEntry().Infof("Destroying previous deployment '%s' of component instance: %s", instance.InactiveDeployName, instance.GetKey())
+
+	err := p.Destroy(
+		&plugin.CodePluginInvocationParams{
+			DeployName:   instance.InactiveDeployName,
+			Params:       instance.InactiveCodeParams,
+			PluginParams: pluginParams(instance, instance.DataForPlugins),
+			EventLog:     context.EventLog,
+			Cancel:       context.Cancel,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return context.ActualStateUpdater.UpdateComponentInstance(instance.GetKey(), func(obj *resolve.ComponentInstance) {
+		obj.InactiveDeployName = ""
+		obj.InactiveCodeParams = nil
+	})
+}
@@ -17,17 +17,25 @@ type CreateAction struct {
 	*action.Metadata
 	ComponentKey string
 	Params       util.NestedParameterMap
+	Ingress      *Ingress
 }
 
-// NewCreateAction creates new CreateAction
-func NewCreateAction(componentKey string, params util.NestedParameterMap) *CreateAction {
+// NewCreateAction creates new CreateAction. Ingress is a set of ingress settings of the component instance, which can
+// be nil if it isn't a code component
+func NewCreateAction(componentKey string, params util.NestedParameterMap, ingress *Ingress) *CreateAction {
 	return &CreateAction{
 		Metadata:     action.NewMetadata("action-component-create", componentKey),
 		ComponentKey: componentKey,
 		Params:       params,
+		Ingress:      ingress,
 	}
 }
 
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *CreateAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *CreateAction) Apply(context *action.Context) (errResult error) {
 	start := time.Now()
@@ -47,8 +55,10 @@ func (a *CreateAction) Apply(context *action.Context) (errResult error) {
 		return fmt.Errorf("unable to deploy component instance '%s': %s", a.ComponentKey, err)
 	}
 
-	// update actual state
-	return context.ActualStateUpdater.CreateComponentInstance(instance)
+	// update actual state. ingress settings are recorded into a copy of the instance, so desired state doesn't change
+	created := *instance
+	created.DataForPlugins = a.Ingress.dataForPlugins(instance)
+	return context.ActualStateUpdater.CreateComponentInstance(&created)
 }
 
 // DescribeChanges returns text-based description of changes that will be applied
@@ -56,7 +66,7 @@ func (a *CreateAction) DescribeChanges() util.NestedParameterMap {
 	return util.NestedParameterMap{
 		"kind":   a.Kind,
 		"key":    a.ComponentKey,
-		"params": a.Params,
+		"params": a.Params.Masked(),
 		"pretty": fmt.Sprintf("[+] %s", a.ComponentKey),
 	}
 }
@@ -104,8 +114,9 @@ func (a *CreateAction) processDeployment(context *action.Context) (*resolve.Comp
 		&plugin.CodePluginInvocationParams{
 			DeployName:   instance.GetDeployName(),
 			Params:       instance.CalculatedCodeParams,
-			PluginParams: map[string]string{plugin.ParamTargetSuffix: instance.Metadata.Key.TargetSuffix},
+			PluginParams: pluginParams(instance, a.Ingress.dataForPlugins(instance)),
 			EventLog:     context.EventLog,
+			Cancel:       context.Cancel,
 		},
 	)
 }
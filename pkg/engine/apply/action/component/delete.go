@@ -28,6 +28,11 @@ func NewDeleteAction(componentKey string, params util.NestedParameterMap) *Delet
 	}
 }
 
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *DeleteAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *DeleteAction) Apply(context *action.Context) (errResult error) {
 	start := time.Now()
@@ -56,7 +61,7 @@ func (a *DeleteAction) DescribeChanges() util.NestedParameterMap {
 	return util.NestedParameterMap{
 		"kind":   a.Kind,
 		"key":    a.ComponentKey,
-		"params": a.Params,
+		"params": a.Params.Masked(),
 		"pretty": fmt.Sprintf("[-] %s", a.ComponentKey),
 	}
 }
@@ -99,13 +104,28 @@ func (a *DeleteAction) processDeployment(context *action.Context) (*resolve.Comp
 		return nil, err
 	}
 
-	return instance, p.Destroy(
-		&plugin.CodePluginInvocationParams{
-			DeployName:   instance.GetDeployName(),
-			Params:       instance.CalculatedCodeParams,
-			PluginParams: map[string]string{plugin.ParamTargetSuffix: instance.Metadata.Key.TargetSuffix},
-			EventLog:     context.EventLog,
-		},
-	)
+	// code destroyed by recreate update, which failed to create it again, doesn't exist anymore
+	if !instance.CodeDestroyed {
+		err = p.Destroy(
+			&plugin.CodePluginInvocationParams{
+				DeployName:   instance.GetDeployName(),
+				Params:       instance.CalculatedCodeParams,
+				PluginParams: pluginParams(instance, instance.DataForPlugins),
+				EventLog:     context.EventLog,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// previous deployment kept running after blue/green update has to be destroyed as well
+	if len(instance.InactiveDeployName) > 0 {
+		err = destroyInactive(context, p, instance)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	return instance, nil
 }
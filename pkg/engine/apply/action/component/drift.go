@@ -0,0 +1,128 @@
+package component
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// DriftAction is a action which gets called periodically to check whether deployed component instance still matches its code params
+type DriftAction struct {
+	*action.Metadata
+	ComponentKey string
+}
+
+// NewDriftAction creates new DriftAction
+func NewDriftAction(componentKey string) *DriftAction {
+	return &DriftAction{
+		Metadata:     action.NewMetadata("action-component-drift", componentKey),
+		ComponentKey: componentKey,
+	}
+}
+
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *DriftAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
+// Apply applies the action
+func (a *DriftAction) Apply(context *action.Context) (errResult error) {
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			errResult = fmt.Errorf("panic: %s\n%s", err, string(debug.Stack()))
+		}
+
+		action.CollectMetricsFor(a, start, errResult)
+	}()
+
+	context.EventLog.NewEntry().Debugf("Checking drift for component instance: %s", a.ComponentKey)
+
+	// compare deployed component with its params
+	instance, drift, err := a.processDrift(context)
+	if err != nil {
+		return fmt.Errorf("unable to check drift for component instance '%s': %s", a.ComponentKey, err)
+	}
+
+	drifted := len(drift) > 0
+	if drifted && !instance.Drifted {
+		context.EventLog.NewEntry().Warningf("Component instance '%s' has drifted from its params: %s", a.ComponentKey, drift)
+	} else if !drifted && instance.Drifted {
+		context.EventLog.NewEntry().Infof("Component instance '%s' is not drifted anymore", a.ComponentKey)
+	}
+
+	// update drift status in actual state
+	return context.ActualStateUpdater.UpdateComponentInstance(instance.GetKey(), func(obj *resolve.ComponentInstance) {
+		obj.Drifted = drifted
+		obj.Drift = drift
+	})
+}
+
+// DescribeChanges returns text-based description of changes that will be applied
+func (a *DriftAction) DescribeChanges() util.NestedParameterMap {
+	return util.NestedParameterMap{
+		"kind":       a.Kind,
+		"key":        a.ComponentKey,
+		"pretty":     fmt.Sprintf("[~] %s", a.ComponentKey),
+		"prettyOmit": "true", // do not print drift lines in pretty output
+	}
+}
+
+func (a *DriftAction) processDrift(context *action.Context) (*resolve.ComponentInstance, string, error) {
+	instance := context.ActualStateUpdater.GetComponentInstance(a.ComponentKey)
+	if instance == nil {
+		return nil, "", fmt.Errorf("component instance not found in actual state: %s", a.ComponentKey)
+	}
+
+	bundleObj, err := context.DesiredPolicy.GetObject(lang.TypeBundle.Kind, instance.Metadata.Key.BundleName, instance.Metadata.Key.Namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	if bundleObj == nil {
+		return nil, "", fmt.Errorf("bundle '%s/%s' in not present in policy", instance.Metadata.Key.Namespace, instance.Metadata.Key.BundleName)
+	}
+	component := bundleObj.(*lang.Bundle).GetComponentsMap()[instance.Metadata.Key.ComponentName] // nolint: errcheck
+
+	if component == nil {
+		return nil, "", fmt.Errorf("checking drift for bundle instance is not supported")
+	}
+
+	// drift could be checked only for components with code
+	if component.Code == nil {
+		return nil, "", fmt.Errorf("checking drift for non-code components is not supported")
+	}
+
+	clusterObj, err := context.DesiredPolicy.GetObject(lang.TypeCluster.Kind, instance.Metadata.Key.ClusterName, instance.Metadata.Key.ClusterNameSpace)
+	if err != nil {
+		return nil, "", err
+	}
+	if clusterObj == nil {
+		return nil, "", fmt.Errorf("cluster '%s/%s' in not present in policy", instance.Metadata.Key.ClusterNameSpace, instance.Metadata.Key.ClusterName)
+	}
+	cluster := clusterObj.(*lang.Cluster) // nolint: errcheck
+
+	p, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
+	if err != nil {
+		return nil, "", err
+	}
+
+	drift, err := p.Drift(
+		&plugin.CodePluginInvocationParams{
+			DeployName:   instance.GetDeployName(),
+			Params:       instance.CalculatedCodeParams,
+			PluginParams: pluginParams(instance, instance.DataForPlugins),
+			EventLog:     context.EventLog,
+		},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return instance, drift, nil
+}
@@ -26,6 +26,11 @@ func NewEndpointsAction(componentKey string) *EndpointsAction {
 	}
 }
 
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *EndpointsAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *EndpointsAction) Apply(context *action.Context) (errResult error) {
 	start := time.Now()
@@ -101,7 +106,7 @@ func (a *EndpointsAction) processEndpoints(context *action.Context) (*resolve.Co
 		&plugin.CodePluginInvocationParams{
 			DeployName:   instance.GetDeployName(),
 			Params:       instance.CalculatedCodeParams,
-			PluginParams: map[string]string{plugin.ParamTargetSuffix: instance.Metadata.Key.TargetSuffix},
+			PluginParams: pluginParams(instance, instance.DataForPlugins),
 			EventLog:     context.EventLog,
 		},
 	)
@@ -0,0 +1,167 @@
+package component
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// MoveAction is a action which gets called when key of an existing component instance changes (e.g. context got
+// renamed, but it lists the old name in its previous keys). Instead of destroying the existing instance and creating a
+// new one, it lets the plugin adopt the existing deployment and carries actual state over to the new key
+type MoveAction struct {
+	*action.Metadata
+	PrevComponentKey string
+	ComponentKey     string
+	Params           util.NestedParameterMap
+	Ingress          *Ingress
+}
+
+// NewMoveAction creates new MoveAction. Ingress is a set of ingress settings of the component instance under the new
+// key, which can be nil if it isn't a code component
+func NewMoveAction(prevComponentKey string, componentKey string, params util.NestedParameterMap, ingress *Ingress) *MoveAction {
+	return &MoveAction{
+		Metadata:         action.NewMetadata("action-component-move", componentKey),
+		PrevComponentKey: prevComponentKey,
+		ComponentKey:     componentKey,
+		Params:           params,
+		Ingress:          ingress,
+	}
+}
+
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *MoveAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
+// Apply applies the action
+func (a *MoveAction) Apply(context *action.Context) (errResult error) {
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			errResult = fmt.Errorf("panic: %s\n%s", err, string(debug.Stack()))
+		}
+
+		action.CollectMetricsFor(a, start, errResult)
+	}()
+
+	context.EventLog.NewEntry().Debugf("Moving component instance: %s -> %s", a.PrevComponentKey, a.ComponentKey)
+
+	// move in the cloud
+	prevInstance, instance, adopted, err := a.processDeployment(context)
+	if err != nil {
+		return fmt.Errorf("unable to move component instance '%s' to '%s': %s", a.PrevComponentKey, a.ComponentKey, err)
+	}
+
+	// carry actual state over to the new key. claims and code params stay the same, they will be changed by the
+	// subsequent actions if needed
+	moved := *prevInstance
+	moved.Metadata = &resolve.ComponentInstanceMetadata{Key: instance.Metadata.Key}
+	moved.EndpointsUpToDate = false
+	if adopted {
+		// deployment stays under the previous deploy name (and color), which gets adopted by the new key
+		moved.AdoptedDeployName = prevInstance.GetDeployNameForColor("")
+	} else {
+		moved.Color = "" // plugin has moved the active deployment over to the default deploy name
+		moved.AdoptedDeployName = ""
+	}
+	moved.DataForPlugins = a.Ingress.dataForPlugins(instance)
+	err = context.ActualStateUpdater.CreateComponentInstance(&moved)
+	if err != nil {
+		return err
+	}
+
+	// keep original creation time
+	err = context.ActualStateUpdater.UpdateComponentInstance(moved.GetKey(), func(obj *resolve.ComponentInstance) {
+		obj.CreatedAt = prevInstance.CreatedAt
+	})
+	if err != nil {
+		return err
+	}
+
+	return context.ActualStateUpdater.DeleteComponentInstance(prevInstance.GetKey())
+}
+
+// DescribeChanges returns text-based description of changes that will be applied
+func (a *MoveAction) DescribeChanges() util.NestedParameterMap {
+	return util.NestedParameterMap{
+		"kind":    a.Kind,
+		"key":     a.ComponentKey,
+		"prevKey": a.PrevComponentKey,
+		"params":  a.Params.Masked(),
+		"pretty":  fmt.Sprintf("[^] %s -> %s", a.PrevComponentKey, a.ComponentKey),
+	}
+}
+
+func (a *MoveAction) processDeployment(context *action.Context) (*resolve.ComponentInstance, *resolve.ComponentInstance, bool, error) {
+	prevInstance := context.ActualStateUpdater.GetComponentInstance(a.PrevComponentKey)
+	if prevInstance == nil {
+		panic(fmt.Sprintf("component instance not found in actual state: %s", a.PrevComponentKey))
+	}
+
+	instance := context.DesiredState.ComponentInstanceMap[a.ComponentKey]
+	if instance == nil {
+		panic(fmt.Sprintf("component instance not found in desired state: %s", a.ComponentKey))
+	}
+
+	bundleObj, err := context.DesiredPolicy.GetObject(lang.TypeBundle.Kind, instance.Metadata.Key.BundleName, instance.Metadata.Key.Namespace)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	component := bundleObj.(*lang.Bundle).GetComponentsMap()[instance.Metadata.Key.ComponentName] // nolint: errcheck
+
+	if component == nil {
+		// This is a bundle instance. Do nothing and proceed with moving the object
+		return prevInstance, instance, false, nil
+	}
+
+	if component.Code == nil {
+		// This is a non-code component. Do nothing and proceed with moving the object
+		return prevInstance, instance, false, nil
+	}
+
+	prevKey, key := prevInstance.Metadata.Key, instance.Metadata.Key
+	if prevKey.ClusterNameSpace != key.ClusterNameSpace || prevKey.ClusterName != key.ClusterName {
+		return nil, nil, false, fmt.Errorf("running code can't be moved from cluster '%s/%s' to '%s/%s'", prevKey.ClusterNameSpace, prevKey.ClusterName, key.ClusterNameSpace, key.ClusterName)
+	}
+
+	context.EventLog.NewEntry().Infof("Moving a running component instance: %s -> %s", prevInstance.GetKey(), instance.GetKey())
+
+	clusterObj, err := context.DesiredPolicy.GetObject(lang.TypeCluster.Kind, key.ClusterName, key.ClusterNameSpace)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if clusterObj == nil {
+		return nil, nil, false, fmt.Errorf("cluster '%s/%s' in not present in policy", key.ClusterNameSpace, key.ClusterName)
+	}
+	cluster := clusterObj.(*lang.Cluster) // nolint: errcheck
+
+	p, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	adopter, ok := p.(plugin.MoveByAdoption)
+	adopted := ok && adopter.MovesByAdoption()
+
+	return prevInstance, instance, adopted, p.Move(
+		&plugin.CodePluginInvocationParams{
+			DeployName:   prevInstance.GetDeployName(),
+			Params:       prevInstance.CalculatedCodeParams,
+			PluginParams: pluginParams(prevInstance, prevInstance.DataForPlugins),
+			EventLog:     context.EventLog,
+		},
+		&plugin.CodePluginInvocationParams{
+			DeployName:   instance.GetDeployName(),
+			Params:       prevInstance.CalculatedCodeParams,
+			PluginParams: pluginParams(instance, a.Ingress.dataForPlugins(instance)),
+			EventLog:     context.EventLog,
+		},
+	)
+}
@@ -0,0 +1,89 @@
+package component
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// OrphanDeleteAction is a action which gets called when an orphaned deployment needs to be destroyed (i.e. deployment
+// which exists in the cloud and has been created by Aptomi, but is not tracked in actual state anymore)
+type OrphanDeleteAction struct {
+	*action.Metadata
+	ClusterNamespace string
+	ClusterName      string
+	CodeType         string
+	DeployName       string
+	TargetSuffix     string
+	Params           util.NestedParameterMap
+}
+
+// NewOrphanDeleteAction creates new OrphanDeleteAction
+func NewOrphanDeleteAction(cluster *lang.Cluster, codeType string, deployment *plugin.Deployment) *OrphanDeleteAction {
+	return &OrphanDeleteAction{
+		Metadata:         action.NewMetadata("action-component-orphan-delete", cluster.Namespace, cluster.Name, codeType, deployment.DeployName),
+		ClusterNamespace: cluster.Namespace,
+		ClusterName:      cluster.Name,
+		CodeType:         codeType,
+		DeployName:       deployment.DeployName,
+		TargetSuffix:     deployment.TargetSuffix,
+		Params:           deployment.Params,
+	}
+}
+
+// Apply applies the action
+func (a *OrphanDeleteAction) Apply(context *action.Context) (errResult error) {
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			errResult = fmt.Errorf("panic: %s\n%s", err, string(debug.Stack()))
+		}
+
+		action.CollectMetricsFor(a, start, errResult)
+	}()
+
+	context.EventLog.NewEntry().Infof("Destructing orphaned deployment '%s' (cluster '%s/%s', code type '%s')", a.DeployName, a.ClusterNamespace, a.ClusterName, a.CodeType)
+
+	clusterObj, err := context.DesiredPolicy.GetObject(lang.TypeCluster.Kind, a.ClusterName, a.ClusterNamespace)
+	if err != nil {
+		return err
+	}
+	if clusterObj == nil {
+		return fmt.Errorf("cluster '%s/%s' in not present in policy", a.ClusterNamespace, a.ClusterName)
+	}
+	cluster := clusterObj.(*lang.Cluster) // nolint: errcheck
+
+	p, err := context.Plugins.ForCodeType(cluster, a.CodeType)
+	if err != nil {
+		return err
+	}
+
+	err = p.Destroy(
+		&plugin.CodePluginInvocationParams{
+			DeployName:   a.DeployName,
+			Params:       a.Params,
+			PluginParams: map[string]string{plugin.ParamTargetSuffix: a.TargetSuffix},
+			EventLog:     context.EventLog,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to delete orphaned deployment '%s': %s", a.DeployName, err)
+	}
+
+	return nil
+}
+
+// DescribeChanges returns text-based description of changes that will be applied
+func (a *OrphanDeleteAction) DescribeChanges() util.NestedParameterMap {
+	return util.NestedParameterMap{
+		"kind":   a.Kind,
+		"key":    a.DeployName,
+		"params": a.Params.Masked(),
+		"pretty": fmt.Sprintf("[-] orphan %s (cluster %s/%s, %s)", a.DeployName, a.ClusterNamespace, a.ClusterName, a.CodeType),
+	}
+}
@@ -0,0 +1,57 @@
+package component
+
+import (
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+)
+
+// Ingress represents ingress settings of the component instance, which are calculated by the diff for the whole
+// desired state. They get passed to the code plugin and recorded into DataForPlugins of the component instance in
+// actual state, so the diff could detect when they change
+type Ingress struct {
+	// AllowFrom is the list of code component instances allowed to send ingress traffic to the component instance
+	// (in resolve.AllowIngressFrom format), if ingress traffic is not allowed for it
+	AllowFrom string
+
+	// LabelPods is true if pods of the component instance are selected by network policies
+	LabelPods bool
+}
+
+// dataForPlugins returns a copy of DataForPlugins of the component instance with the ingress settings. Desired state
+// is never changed, as actions are applied in parallel
+func (ingress *Ingress) dataForPlugins(instance *resolve.ComponentInstance) map[string]string {
+	result := make(map[string]string, len(instance.DataForPlugins)+2)
+	for key, value := range instance.DataForPlugins {
+		result[key] = value
+	}
+	delete(result, resolve.AllowIngressFrom)
+	delete(result, resolve.LabelPods)
+
+	if ingress == nil {
+		return result
+	}
+	if !instance.IsIngressAllowed() {
+		result[resolve.AllowIngressFrom] = ingress.AllowFrom
+	}
+	if ingress.LabelPods {
+		result[resolve.LabelPods] = "true"
+	}
+	return result
+}
+
+// pluginParams returns plugin params for the code instance of the given component instance with the given data for
+// plugins
+func pluginParams(instance *resolve.ComponentInstance, data map[string]string) map[string]string {
+	params := map[string]string{
+		plugin.ParamTargetSuffix: instance.Metadata.Key.TargetSuffix,
+		plugin.ParamComponent:    instance.Metadata.Key.GetDeployName(),
+	}
+	if data[resolve.AllowIngres] == "false" {
+		params[plugin.ParamAllowIngress] = "false"
+		params[plugin.ParamAllowIngressFrom] = data[resolve.AllowIngressFrom]
+	}
+	if data[resolve.LabelPods] == "true" {
+		params[plugin.ParamLabelPods] = "true"
+	}
+	return params
+}
@@ -0,0 +1,75 @@
+package component
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// RetentionAction is a action which gets called when component instance with retention loses its last claim (so it gets
+// retained instead of being destroyed), when retained component instance gets claimed again, or when retention of
+// component instance changes. It only changes actual state and doesn't touch anything in the cloud
+type RetentionAction struct {
+	*action.Metadata
+	ComponentKey string
+	Retention    string
+	Retained     bool
+}
+
+// NewRetentionAction creates new RetentionAction
+func NewRetentionAction(componentKey string, retention string, retained bool) *RetentionAction {
+	return &RetentionAction{
+		Metadata:     action.NewMetadata("action-component-retention", componentKey),
+		ComponentKey: componentKey,
+		Retention:    retention,
+		Retained:     retained,
+	}
+}
+
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *RetentionAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
+// Apply applies the action
+func (a *RetentionAction) Apply(context *action.Context) (errResult error) {
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			errResult = fmt.Errorf("panic: %s\n%s", err, string(debug.Stack()))
+		}
+
+		action.CollectMetricsFor(a, start, errResult)
+	}()
+
+	context.EventLog.NewEntry().Debugf("Updating retention of component instance: %s (retention = %s, retained = %t)", a.ComponentKey, a.Retention, a.Retained)
+
+	return context.ActualStateUpdater.UpdateComponentInstance(a.ComponentKey, func(obj *resolve.ComponentInstance) {
+		obj.Retention = a.Retention
+		if !a.Retained {
+			obj.RetainedAt = time.Time{}
+			obj.PurgeRequested = false
+		} else if obj.RetainedAt.IsZero() {
+			obj.RetainedAt = time.Now()
+		}
+	})
+}
+
+// DescribeChanges returns text-based description of changes that will be applied
+func (a *RetentionAction) DescribeChanges() util.NestedParameterMap {
+	result := util.NestedParameterMap{
+		"kind":      a.Kind,
+		"key":       a.ComponentKey,
+		"retention": a.Retention,
+		"retained":  a.Retained,
+		"pretty":    fmt.Sprintf("[=] %s (%s)", a.ComponentKey, a.Retention),
+	}
+	if !a.Retained {
+		result["prettyOmit"] = "true" // only print component instances which get retained
+	}
+	return result
+}
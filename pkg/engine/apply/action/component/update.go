@@ -12,24 +12,46 @@ import (
 	"github.com/Aptomi/aptomi/pkg/util"
 )
 
-// UpdateAction is a action which gets called when an existing component needs to be updated (i.e. parameters of a running code instance need to be changed in the cloud)
+// DefaultBlueGreenReadinessTimeout is how long blue/green update waits for the new deployment to become ready, unless
+// it's set in the action context
+const DefaultBlueGreenReadinessTimeout = 10 * time.Minute
+
+// BlueGreenReadinessCheckInterval is how often blue/green update checks readiness of the new deployment
+var BlueGreenReadinessCheckInterval = 5 * time.Second
+
+// UpdateAction is a action which gets called when an existing component needs to be updated (i.e. parameters of a running code instance need to be changed in the cloud).
+// Running code instance gets updated according to the update strategy of the component. Since dependent component instances
+// always get processed after the component instance they depend on, they will only be updated once the update is complete
 type UpdateAction struct {
 	*action.Metadata
 	ComponentKey string
 	ParamsBefore util.NestedParameterMap
 	Params       util.NestedParameterMap
+	Strategy     string
+	Changes      []*util.ParameterChange
+	Ingress      *Ingress
 }
 
-// NewUpdateAction creates new UpdateAction
-func NewUpdateAction(componentKey string, paramsBefore util.NestedParameterMap, params util.NestedParameterMap) *UpdateAction {
+// NewUpdateAction creates new UpdateAction. Changes is a list of field-level changes of the component instance
+// (code params, discovery and labels), which is only used to describe the action. Ingress is a set of ingress
+// settings of the component instance, which can be nil if it isn't a code component
+func NewUpdateAction(componentKey string, paramsBefore util.NestedParameterMap, params util.NestedParameterMap, strategy string, changes []*util.ParameterChange, ingress *Ingress) *UpdateAction {
 	return &UpdateAction{
 		Metadata:     action.NewMetadata("action-component-update", componentKey),
 		ComponentKey: componentKey,
 		ParamsBefore: paramsBefore,
 		Params:       params,
+		Strategy:     strategy,
+		Changes:      changes,
+		Ingress:      ingress,
 	}
 }
 
+// GetComponentKey returns key of the component instance, which action is performed on
+func (a *UpdateAction) GetComponentKey() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *UpdateAction) Apply(context *action.Context) (errResult error) {
 	start := time.Now()
@@ -46,6 +68,9 @@ func (a *UpdateAction) Apply(context *action.Context) (errResult error) {
 	// update in the cloud
 	instance, err := a.processDeployment(context)
 	if err != nil {
+		if rolledBack, ok := err.(*plugin.RolledBackError); ok {
+			a.recordRollback(context, rolledBack)
+		}
 		return fmt.Errorf("unable to update component instance '%s': %s", a.ComponentKey, err)
 	}
 
@@ -54,21 +79,59 @@ func (a *UpdateAction) Apply(context *action.Context) (errResult error) {
 		return context.ActualStateUpdater.UpdateComponentInstance(instance.GetKey(), func(obj *resolve.ComponentInstance) {
 			obj.EndpointsUpToDate = false // invalidate endpoints, so we retrieve them again later
 			obj.CalculatedCodeParams = instance.CalculatedCodeParams
+			obj.DataForPlugins = a.Ingress.dataForPlugins(instance)
+			obj.CodeDestroyed = false
+			obj.Drifted = false // code params have just been re-applied, drift will be checked again later
+			obj.Drift = ""
+			obj.RolledBack = ""
+			obj.RolledBackAt = time.Time{}
+			obj.RolledBackParams = nil
 		})
 	}
 
 	return nil
 }
 
+// recordRollback records in actual state that the update has been rolled back by code plugin. Code params in actual
+// state are left as is, since the deployment keeps running with them, while the rolled back params are recorded, so
+// the same update doesn't get attempted again
+func (a *UpdateAction) recordRollback(context *action.Context, rolledBack *plugin.RolledBackError) {
+	context.EventLog.NewEntry().Warnf("Update of component instance %s has been rolled back to revision %s: %s", a.ComponentKey, rolledBack.Revision, rolledBack.Reason)
+
+	err := context.ActualStateUpdater.UpdateComponentInstance(a.ComponentKey, func(obj *resolve.ComponentInstance) {
+		obj.EndpointsUpToDate = false
+		obj.RolledBack = rolledBack.Error()
+		obj.RolledBackAt = time.Now()
+		obj.RolledBackParams = a.Params
+	})
+	if err != nil {
+		context.EventLog.NewEntry().Warnf("Unable to record rollback of component instance %s: %s", a.ComponentKey, err)
+	}
+}
+
+// GetParameterChanges returns field-level changes of the component instance
+func (a *UpdateAction) GetParameterChanges() []*util.ParameterChange {
+	return a.Changes
+}
+
 // DescribeChanges returns text-based description of changes that will be applied
 func (a *UpdateAction) DescribeChanges() util.NestedParameterMap {
+	changes := []util.NestedParameterMap{}
+	pretty := fmt.Sprintf("[*] %s", a.ComponentKey)
+	for _, change := range a.Changes {
+		changes = append(changes, change.AsMap())
+		pretty += "\n      " + change.String()
+	}
+
 	return util.NestedParameterMap{
 		"kind":         a.Kind,
 		"key":          a.ComponentKey,
-		"paramsBefore": a.ParamsBefore,
-		"params":       a.Params,
-		"paramsDiff":   a.ParamsBefore.Diff(a.Params),
-		"pretty":       fmt.Sprintf("[*] %s", a.ComponentKey),
+		"paramsBefore": a.ParamsBefore.Masked(),
+		"params":       a.Params.Masked(),
+		"paramsDiff":   a.ParamsBefore.Masked().Diff(a.Params.Masked()),
+		"changes":      changes,
+		"strategy":     a.Strategy,
+		"pretty":       pretty,
 	}
 }
 
@@ -110,12 +173,132 @@ func (a *UpdateAction) processDeployment(context *action.Context) (*resolve.Comp
 		return nil, err
 	}
 
-	return instance, p.Update(
-		&plugin.CodePluginInvocationParams{
-			DeployName:   instance.GetDeployName(),
-			Params:       instance.CalculatedCodeParams,
-			PluginParams: map[string]string{plugin.ParamTargetSuffix: instance.Metadata.Key.TargetSuffix},
-			EventLog:     context.EventLog,
-		},
-	)
+	// deploy name of the running code instance is taken from actual state, as it may have been changed by blue/green update
+	current := context.ActualStateUpdater.GetComponentInstance(a.ComponentKey)
+	if current == nil {
+		return nil, fmt.Errorf("component instance not found in actual state: %s", a.ComponentKey)
+	}
+
+	// code destroyed by recreate update, which failed to create it again, can only be created
+	if current.CodeDestroyed {
+		return instance, a.recreate(context, p, current, instance)
+	}
+
+	switch a.Strategy {
+	case lang.UpdateStrategyRecreate:
+		return instance, a.recreate(context, p, current, instance)
+	case lang.UpdateStrategyBlueGreen:
+		if current.CalculatedCodeParams.DeepEqual(instance.CalculatedCodeParams) {
+			// new deployment is only created when code params change, as that's what dependents get resolved against
+			return instance, p.Update(a.invocationParams(context, instance, current.GetDeployName(), instance.CalculatedCodeParams))
+		}
+		return instance, a.blueGreen(context, p, current, instance)
+	default:
+		return instance, p.Update(a.invocationParams(context, instance, current.GetDeployName(), instance.CalculatedCodeParams))
+	}
+}
+
+// recreate destroys running code instance and creates it again with the new params under the same deploy name. It's
+// recorded in actual state once code has been destroyed, so if creation fails, it doesn't get destroyed again on retry
+func (a *UpdateAction) recreate(context *action.Context, p plugin.CodePlugin, current *resolve.ComponentInstance, instance *resolve.ComponentInstance) error {
+	context.EventLog.NewEntry().Infof("Re-creating a running component instance: %s", instance.GetKey())
+
+	if !current.CodeDestroyed {
+		err := p.Destroy(a.invocationParams(context, instance, current.GetDeployName(), current.CalculatedCodeParams))
+		if err != nil {
+			return err
+		}
+
+		err = context.ActualStateUpdater.UpdateComponentInstance(current.GetKey(), func(obj *resolve.ComponentInstance) {
+			obj.CodeDestroyed = true
+			obj.EndpointsUpToDate = false
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.Create(a.invocationParams(context, instance, current.GetDeployName(), instance.CalculatedCodeParams))
+}
+
+// blueGreen creates code instance with the new params under the deploy name of the next color, waits for it to become
+// ready and switches actual state over to it. The previous deployment keeps running, as dependents still use it until
+// they get updated. It gets destroyed later by CleanupAction
+func (a *UpdateAction) blueGreen(context *action.Context, p plugin.CodePlugin, current *resolve.ComponentInstance, instance *resolve.ComponentInstance) error {
+	color := current.GetNextColor()
+	deployName := current.GetDeployNameForColor(color)
+
+	// only one inactive deployment is kept, so the one left from the previous update (if its cleanup failed) has to go
+	if len(current.InactiveDeployName) > 0 {
+		err := destroyInactive(context, p, current)
+		if err != nil {
+			return err
+		}
+	}
+
+	context.EventLog.NewEntry().Infof("Deploying %s version of a running component instance: %s", color, instance.GetKey())
+
+	next := a.invocationParams(context, instance, deployName, instance.CalculatedCodeParams)
+	err := p.Create(next)
+	if err != nil {
+		return err
+	}
+
+	err = waitForReadiness(p, next, context.BlueGreenReadinessTimeout)
+	if err != nil {
+		// keep the previous version running and clean up the new one
+		if errDestroy := p.Destroy(next); errDestroy != nil {
+			context.EventLog.NewEntry().Warnf("Unable to destroy %s version of component instance %s: %s", color, instance.GetKey(), errDestroy)
+		}
+		return err
+	}
+
+	// switch over to the new version together with its code params, so endpoints get retrieved from it and actual
+	// state always matches the active deployment
+	context.EventLog.NewEntry().Infof("Switched to %s version of component instance %s, previous one will be destroyed once dependents are updated", color, instance.GetKey())
+
+	prevDeployName, prevParams := current.GetDeployName(), current.CalculatedCodeParams
+	return context.ActualStateUpdater.UpdateComponentInstance(current.GetKey(), func(obj *resolve.ComponentInstance) {
+		obj.Color = color
+		obj.CalculatedCodeParams = instance.CalculatedCodeParams
+		obj.DataForPlugins = a.Ingress.dataForPlugins(instance)
+		obj.InactiveDeployName = prevDeployName
+		obj.InactiveCodeParams = prevParams
+		obj.EndpointsUpToDate = false
+	})
+}
+
+func (a *UpdateAction) invocationParams(context *action.Context, instance *resolve.ComponentInstance, deployName string, params util.NestedParameterMap) *plugin.CodePluginInvocationParams {
+	return &plugin.CodePluginInvocationParams{
+		DeployName:   deployName,
+		Params:       params,
+		PluginParams: pluginParams(instance, a.Ingress.dataForPlugins(instance)),
+		EventLog:     context.EventLog,
+		Cancel:       context.Cancel,
+	}
+}
+
+// waitForReadiness waits until the deployed code instance becomes ready, timeout expires or apply gets cancelled
+func waitForReadiness(p plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultBlueGreenReadinessTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		ready, err := p.Status(invocation)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("deployment '%s' didn't become ready within %s", invocation.DeployName, timeout)
+		}
+		select {
+		case <-invocation.Cancel:
+			return fmt.Errorf("waiting for deployment '%s' to become ready has been cancelled", invocation.DeployName)
+		case <-time.After(BlueGreenReadinessCheckInterval):
+		}
+	}
 }
@@ -1,6 +1,8 @@
 package action
 
 import (
+	"time"
+
 	"github.com/Aptomi/aptomi/pkg/engine/actual"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
@@ -18,6 +20,13 @@ type Context struct {
 	ExternalData       *external.Data
 	Plugins            plugin.Registry
 	EventLog           *event.Log
+
+	// BlueGreenReadinessTimeout is how long blue/green updates wait for the new deployment to become ready (0 means
+	// default timeout)
+	BlueGreenReadinessTimeout time.Duration
+
+	// Cancel is closed when the apply process gets cancelled. It's nil if apply can't be cancelled
+	Cancel <-chan struct{}
 }
 
 // NewContext creates a new instance of Context
@@ -1,6 +1,11 @@
 package apply
 
 import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
 	"github.com/Aptomi/aptomi/pkg/engine/actual"
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
@@ -27,6 +32,17 @@ type EngineApply struct {
 
 	// Result/progress updater
 	updater action.ApplyResultUpdater
+
+	// Cancellation of the apply process
+	cancel         chan struct{}
+	cancelOnce     sync.Once
+	cancelDeadline time.Duration
+
+	// Per-cluster and per-code type concurrency limits (nil means no limits)
+	limiter *concurrencyLimiter
+
+	// How long blue/green updates wait for the new deployment to become ready (0 means default timeout)
+	blueGreenReadinessTimeout time.Duration
 }
 
 // NewEngineApply creates an instance of EngineApply
@@ -42,6 +58,7 @@ func NewEngineApply(desiredPolicy *lang.Policy, desiredState *resolve.PolicyReso
 		actionPlan:         actionPlan,
 		eventLog:           eventLog,
 		updater:            updater,
+		cancel:             make(chan struct{}),
 	}
 }
 
@@ -62,16 +79,81 @@ func (apply *EngineApply) Apply(maxConcurrentActions int) (*resolve.PolicyResolu
 		apply.plugins,
 		apply.eventLog,
 	)
+	context.BlueGreenReadinessTimeout = apply.blueGreenReadinessTimeout
+	context.Cancel = apply.cancel
 
 	// Note that the action plan will call function in different go routines by apply
-	result := apply.actionPlan.Apply(action.WrapParallelWithLimit(maxConcurrentActions, func(act action.Interface) error {
+	result := apply.actionPlan.Apply(apply.wrapApply(maxConcurrentActions, func(act action.Interface) error {
 		err := act.Apply(context)
 		if err != nil {
 			context.EventLog.NewEntry().Errorf("error while applying action '%s': %s", act, err)
 		}
 		return err
-	}), apply.updater)
+	}), apply.updater, apply.cancel)
 
 	// No errors occurred
 	return apply.actualStateUpdater.GetUpdatedActualState(), result
 }
+
+// SetBlueGreenReadinessTimeout sets how long blue/green updates wait for the new deployment to become ready
+func (apply *EngineApply) SetBlueGreenReadinessTimeout(timeout time.Duration) {
+	apply.blueGreenReadinessTimeout = timeout
+}
+
+// Cancel cancels the apply process. Actions which haven't been started yet will not be executed and will be counted
+// as skipped. Actions which are currently in progress are given the specified amount of time to complete, after which
+// they get counted as failed. If deadline is zero, in-progress actions will always be waited for. It's safe to call
+// Cancel multiple times and from multiple go routines, only the first call takes effect
+func (apply *EngineApply) Cancel(deadline time.Duration) {
+	apply.cancelOnce.Do(func() {
+		apply.eventLog.NewEntry().Warningf("Cancelling apply (deadline for in-progress actions: %s)", deadline)
+		apply.cancelDeadline = deadline
+		close(apply.cancel)
+	})
+}
+
+// wrapApply wraps apply function with all concurrency limits and cancellation handling. Cancellation is checked right
+// before the action gets started, after it has acquired all concurrency slots, so actions waiting for a free slot get
+// skipped once apply is cancelled
+func (apply *EngineApply) wrapApply(maxConcurrentActions int, fn action.ApplyFunction) action.ApplyFunction {
+	return apply.wrapConcurrencyLimits(action.WrapParallelWithLimit(maxConcurrentActions, action.WrapSkipIfCancelled(apply.cancel, apply.wrapCancel(fn))))
+}
+
+// wrapCancel wraps apply function, so that it will stop waiting for the action once apply is cancelled and the
+// cancellation deadline is exceeded. Note that the action itself will continue running in background, as there is no
+// way to interrupt an in-flight plugin call
+func (apply *EngineApply) wrapCancel(fn action.ApplyFunction) action.ApplyFunction {
+	return func(act action.Interface) error {
+		result := make(chan error, 1)
+		go func() {
+			defer func() {
+				if err := recover(); err != nil {
+					result <- fmt.Errorf("panic: %s\n%s", err, string(debug.Stack()))
+				}
+			}()
+			result <- fn(act)
+		}()
+
+		// wait for the action to finish or for apply to get cancelled
+		select {
+		case err := <-result:
+			return err
+		case <-apply.cancel:
+		}
+
+		// apply got cancelled, so give the action a chance to complete before deadline
+		if apply.cancelDeadline <= 0 {
+			return <-result
+		}
+		timer := time.NewTimer(apply.cancelDeadline)
+		defer timer.Stop()
+		select {
+		case err := <-result:
+			return err
+		case <-timer.C:
+			err := fmt.Errorf("action '%s' has not completed within %s after apply was cancelled", act, apply.cancelDeadline)
+			apply.eventLog.NewEntry().Errorf("%s", err)
+			return err
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package apply
+
+import (
+	"sync"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+)
+
+// concurrencyLimiter limits the number of actions, which could be executed concurrently for every cluster and for
+// every code type. Semaphores get created lazily, when the first action for a given cluster/code type arrives
+type concurrencyLimiter struct {
+	perCluster  int
+	perCodeType map[string]int
+
+	mutex      sync.Mutex
+	semaphores map[string]chan struct{}
+}
+
+// LimitConcurrency sets limits on the number of actions which could be executed concurrently for every cluster and
+// for every code type (e.g. helm). Zero or negative limit means no limit. Limits are applied on top of the global limit
+// passed to Apply and don't affect the order in which actions are executed
+func (apply *EngineApply) LimitConcurrency(perCluster int, perCodeType map[string]int) {
+	apply.limiter = &concurrencyLimiter{
+		perCluster:  perCluster,
+		perCodeType: perCodeType,
+		semaphores:  make(map[string]chan struct{}),
+	}
+}
+
+// wrapConcurrencyLimits wraps apply function, so that it will wait for a free slot in both cluster and code type
+// semaphores before calling fn. Slots are always taken in the same order (cluster first, code type second), so actions
+// can't deadlock each other. This wrapper must be applied on top of the global limit, so that actions waiting for
+// their cluster/code type don't hold global slots
+func (apply *EngineApply) wrapConcurrencyLimits(fn action.ApplyFunction) action.ApplyFunction {
+	if apply.limiter == nil {
+		return fn
+	}
+	return func(act action.Interface) error {
+		cluster, codeType := apply.getClusterAndCodeType(act)
+
+		if cluster != "" && apply.limiter.perCluster > 0 {
+			semaphore := apply.limiter.semaphore("cluster"+runtime.KeySeparator+cluster, apply.limiter.perCluster)
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+		}
+
+		if limit := apply.limiter.perCodeType[codeType]; codeType != "" && limit > 0 {
+			semaphore := apply.limiter.semaphore("code"+runtime.KeySeparator+codeType, limit)
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+		}
+
+		return fn(act)
+	}
+}
+
+// semaphore returns semaphore for the given key, creating it if it doesn't exist yet
+func (limiter *concurrencyLimiter) semaphore(key string, limit int) chan struct{} {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	result, ok := limiter.semaphores[key]
+	if !ok {
+		result = make(chan struct{}, limit)
+		limiter.semaphores[key] = result
+	}
+	return result
+}
+
+// getClusterAndCodeType returns cluster and code type of the component instance, which action is performed on.
+// It returns empty strings if action is not related to a code component (e.g. bundle instance) or if they can't be
+// determined. In the latter case the action itself will report a proper error
+func (apply *EngineApply) getClusterAndCodeType(act action.Interface) (string, string) {
+	componentAct, ok := act.(action.ComponentInterface)
+	if !ok {
+		return "", ""
+	}
+
+	// component instance may be present in desired state or only in actual state (e.g. when it gets deleted)
+	instance := apply.desiredState.ComponentInstanceMap[componentAct.GetComponentKey()]
+	if instance == nil {
+		instance = apply.actualStateUpdater.GetComponentInstance(componentAct.GetComponentKey())
+	}
+	if instance == nil || !instance.IsCode {
+		return "", ""
+	}
+
+	bundleObj, err := apply.desiredPolicy.GetObject(lang.TypeBundle.Kind, instance.Metadata.Key.BundleName, instance.Metadata.Key.Namespace)
+	if err != nil || bundleObj == nil {
+		return "", ""
+	}
+	component := bundleObj.(*lang.Bundle).GetComponentsMap()[instance.Metadata.Key.ComponentName] // nolint: errcheck
+	if component == nil || component.Code == nil {
+		return "", ""
+	}
+
+	return instance.Metadata.Key.ClusterNameSpace + runtime.KeySeparator + instance.Metadata.Key.ClusterName, component.Code.Type
+}
@@ -1,12 +1,16 @@
 package apply
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/Aptomi/aptomi/pkg/config"
 	"github.com/Aptomi/aptomi/pkg/engine/actual"
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
 	"github.com/Aptomi/aptomi/pkg/engine/diff"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
@@ -87,6 +91,183 @@ func checkApplyComponentCreateFail(t *testing.T, failAsPanic bool) {
 	assert.Equal(t, 0, len(actualState.ComponentInstanceMap), "Actual state should not be touched by apply()")
 }
 
+func TestApplyCancelled(t *testing.T) {
+	// resolve empty policy
+	empty := newTestData(t, builder.NewPolicyBuilder())
+	actualState := empty.resolution()
+
+	// resolve full policy
+	desired := newTestData(t, makePolicyBuilder())
+
+	// apply changes
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desired.external(),
+		mockRegistry(true, false),
+		diff.NewPolicyResolutionDiff(desired.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+
+	// cancel apply before it started (calling it twice should be safe)
+	applier.Cancel(time.Second)
+	applier.Cancel(time.Second)
+
+	// check that all actions got skipped
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 0, Failed: 0, Skipped: 4})
+
+	// check that actual state didn't get updated
+	assert.Equal(t, 0, len(actualState.ComponentInstanceMap), "Actual state should not be touched by cancelled apply()")
+}
+
+func TestApplyCancelledWhileWaitingForSlot(t *testing.T) {
+	desired := newTestData(t, makePolicyBuilder())
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actual.NewNoOpActionStateUpdater(desired.resolution()),
+		desired.external(),
+		mockRegistry(true, false),
+		action.NewPlan(),
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+
+	// several independent actions, which are all queued at once
+	plan := action.NewPlan()
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("component-%d", i)
+		plan.GetActionGraphNode(key).AddAction(component.NewCreateAction(key, nil, nil), nil, false)
+	}
+
+	// the first action blocks until apply gets cancelled, while the rest are waiting for the only slot
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var executed int32
+	fn := applier.wrapApply(1, func(act action.Interface) error {
+		if atomic.AddInt32(&executed, 1) == 1 {
+			close(started)
+			<-release
+		}
+		return nil
+	})
+
+	done := make(chan *action.ApplyResult)
+	go func() {
+		done <- plan.Apply(fn, action.NewApplyResultUpdaterImpl(), applier.cancel)
+	}()
+
+	<-started
+	applier.Cancel(0)
+	close(release)
+	result := <-done
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&executed), "Only the action which has been started before cancellation should be executed")
+	assert.Equal(t, uint32(1), result.Success, "Started action should succeed")
+	assert.Equal(t, uint32(0), result.Failed, "No actions should fail")
+	assert.Equal(t, uint32(4), result.Skipped, "Actions waiting for a slot should be skipped")
+}
+
+func TestApplyResumed(t *testing.T) {
+	// resolve empty policy
+	empty := newTestData(t, builder.NewPolicyBuilder())
+	actualState := empty.resolution()
+
+	// resolve full policy
+	desired := newTestData(t, makePolicyBuilder())
+
+	// mark code component as already completed, so only bundle actions remain
+	plan := diff.NewPolicyResolutionDiff(desired.resolution(), actualState).ActionPlan
+	completed := make(map[string]bool)
+	for key, instance := range desired.resolution().ComponentInstanceMap {
+		if instance.IsCode {
+			completed[key] = true
+		}
+	}
+	plan.MarkCompleted(completed)
+
+	// apply changes
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desired.external(),
+		mockRegistry(true, false),
+		plan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+
+	// check that actions for completed nodes didn't get executed
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 2, Failed: 0, Skipped: 0})
+
+	// check that actual state got updated for remaining nodes only
+	assert.Equal(t, 1, len(actualState.ComponentInstanceMap), "Actual state should contain only instances from non-completed nodes")
+}
+
+func TestApplyConcurrencyLimits(t *testing.T) {
+	// resolve empty policy
+	empty := newTestData(t, builder.NewPolicyBuilder())
+	actualState := empty.resolution()
+
+	// resolve full policy
+	desired := newTestData(t, makePolicyBuilder())
+
+	// limit helm actions to one at a time
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desired.external(),
+		mockRegistry(true, false),
+		diff.NewPolicyResolutionDiff(desired.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	applier.LimitConcurrency(0, map[string]int{"helm": 1})
+
+	// find code component
+	var codeKey string
+	for key, instance := range desired.resolution().ComponentInstanceMap {
+		if instance.IsCode {
+			codeKey = key
+		}
+	}
+	_, codeType := applier.getClusterAndCodeType(component.NewCreateAction(codeKey, nil, nil))
+	assert.Equal(t, "helm", codeType, "Code type should be determined for code component")
+
+	// run several actions in parallel and make sure only one of them is running at a time
+	var running, maxRunning int32
+	fn := applier.wrapConcurrencyLimits(func(act action.Interface) error {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			prev := atomic.LoadInt32(&maxRunning)
+			if current <= prev || atomic.CompareAndSwapInt32(&maxRunning, prev, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = fn(component.NewCreateAction(codeKey, nil, nil))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), maxRunning, "Only one helm action should be running at a time")
+
+	// check that policy apply finished with expected results
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 4, Failed: 0, Skipped: 0})
+	assert.Equal(t, 2, len(actualState.ComponentInstanceMap), "Actual state should not be empty after apply()")
+}
+
 func TestDiffHasUpdatedComponentsAndCheckTimes(t *testing.T) {
 	/*
 		Step 1: actual = empty, desired = test policy, check = claim update/create times
@@ -211,6 +392,356 @@ func TestDiffHasUpdatedComponentsAndCheckTimes(t *testing.T) {
 	assert.True(t, bundleTimesUpdated.updated.After(bundleTimes.updated), "Update time for parent bundle should be changed (because component code param is changed)")
 }
 
+func TestApplyBlueGreenUpdate(t *testing.T) {
+	empty := newTestData(t, builder.NewPolicyBuilder())
+	actualState := empty.resolution()
+
+	// make component updates blue/green
+	b := makePolicyBuilder()
+	bundle := b.Policy().GetObjectsByKind(lang.TypeBundle.Kind)[0].(*lang.Bundle) // nolint: errcheck
+	bundle.Components[0].UpdateStrategy = lang.UpdateStrategyBlueGreen
+
+	// initial deployment shouldn't have any color
+	desired := newTestData(t, b)
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desired.external(),
+		mockRegistry(true, false),
+		diff.NewPolicyResolutionDiff(desired.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 4, Failed: 0, Skipped: 0})
+
+	var key string
+	for _, instance := range desired.resolution().ComponentInstanceMap {
+		if instance.IsCode {
+			key = instance.GetKey()
+		}
+	}
+	assert.Equal(t, "", getInstanceInternal(t, key, actualState).Color, "Initial deployment should not have color")
+
+	// every update should switch color
+	for _, color := range []string{resolve.ColorGreen, resolve.ColorBlue, resolve.ColorGreen} {
+		for _, claim := range b.Policy().GetObjectsByKind(lang.TypeClaim.Kind) {
+			claim.(*lang.Claim).Labels["param"] = "value-" + color
+		}
+
+		desiredNext := newTestData(t, b)
+		applier = NewEngineApply(
+			desiredNext.policy(),
+			desiredNext.resolution(),
+			actual.NewNoOpActionStateUpdater(actualState),
+			desiredNext.external(),
+			mockRegistry(true, false),
+			diff.NewPolicyResolutionDiff(desiredNext.resolution(), actualState).ActionPlan,
+			event.NewLog(logrus.DebugLevel, "test-apply"),
+			action.NewApplyResultUpdaterImpl(),
+		)
+		actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 3, Failed: 0, Skipped: 0})
+
+		instance := getInstanceInternal(t, key, actualState)
+		assert.Equal(t, color, instance.Color, "Blue/green update should switch deployment color")
+		assert.Equal(t, "value-"+color, instance.CalculatedCodeParams["param"], "Blue/green update should update code params")
+		assert.Equal(t, "", instance.InactiveDeployName, "Previous deployment should be cleaned up after blue/green update")
+	}
+}
+
+func TestApplyBlueGreenUpdateDependents(t *testing.T) {
+	actualState := resolve.NewPolicyResolution()
+
+	// dependent component discovers blue/green component by its instance name
+	b := builder.NewPolicyBuilder()
+	bundle := b.AddBundle()
+	upstream := b.AddBundleComponent(bundle, b.CodeComponent(util.NestedParameterMap{"param": "{{ .Labels.param }}"}, nil))
+	upstream.UpdateStrategy = lang.UpdateStrategyBlueGreen
+	dependent := b.AddBundleComponent(bundle, b.CodeComponent(util.NestedParameterMap{"upstream": "{{ .Discovery." + upstream.Name + ".instance }}"}, nil))
+	b.AddComponentClaim(dependent, upstream)
+	service := b.AddService(bundle, b.CriteriaTrue())
+	clusterObj := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelTarget, clusterObj.Name)))
+	claim := b.AddClaim(b.AddUser(), service)
+
+	p := newRecordingCodePlugin()
+	prevDeployName := ""
+	for _, param := range []string{"value1", "value2", "value3", "value3"} {
+		claim.Labels["param"] = param
+
+		desired := resolve.NewPolicyResolver(b.Policy(), b.External(), event.NewLog(logrus.DebugLevel, "test-resolve")).ActualState(actualState).ResolveAllClaims()
+		applier := NewEngineApply(
+			b.Policy(),
+			desired,
+			actual.NewNoOpActionStateUpdater(actualState),
+			b.External(),
+			mockPluginRegistry(p),
+			diff.NewPolicyResolutionDiff(desired, actualState).ActionPlan,
+			event.NewLog(logrus.DebugLevel, "test-apply"),
+			action.NewApplyResultUpdaterImpl(),
+		)
+		calls := len(p.getCalls())
+		actualState, _ = applier.Apply(10)
+
+		// dependent should always point to the active deployment of the blue/green component
+		var upstreamInstance, dependentInstance *resolve.ComponentInstance
+		for _, instance := range actualState.ComponentInstanceMap {
+			switch instance.Metadata.Key.ComponentName {
+			case upstream.Name:
+				upstreamInstance = instance
+			case dependent.Name:
+				dependentInstance = instance
+			}
+		}
+		if !assert.NotNil(t, upstreamInstance, "Blue/green component should be deployed") || !assert.NotNil(t, dependentInstance, "Dependent component should be deployed") {
+			t.FailNow()
+		}
+		assert.Equal(t, param, upstreamInstance.CalculatedCodeParams["param"], "Blue/green component should be updated")
+		assert.Equal(t, util.EscapeName(upstreamInstance.GetDeployName()), dependentInstance.CalculatedCodeParams["upstream"], "Dependent should discover active deployment of the blue/green component (color: '%s')", upstreamInstance.Color)
+		assert.Equal(t, map[string]bool{upstreamInstance.GetDeployName(): true, dependentInstance.GetDeployName(): true}, p.getDeployments(), "Only active deployments should be left running")
+
+		// previous deployment should only be destroyed once dependent has been switched over to the new one
+		if len(prevDeployName) > 0 && prevDeployName != upstreamInstance.GetDeployName() {
+			newCalls := p.getCalls()[calls:]
+			if !assert.Equal(t, 3, len(newCalls), "Blue/green component should be created, dependent updated and previous deployment destroyed: %v", newCalls) {
+				t.FailNow()
+			}
+			assert.Equal(t, "create "+upstreamInstance.GetDeployName(), newCalls[0], "New deployment should be created first")
+			assert.Equal(t, "update "+dependentInstance.GetDeployName(), newCalls[1], "Dependent should be updated after the switch")
+			assert.Equal(t, "destroy "+prevDeployName, newCalls[2], "Previous deployment should be destroyed after dependent has been updated")
+		}
+		prevDeployName = upstreamInstance.GetDeployName()
+	}
+}
+
+func TestApplyBlueGreenCleanupFailure(t *testing.T) {
+	empty := newTestData(t, builder.NewPolicyBuilder())
+	actualState := empty.resolution()
+
+	b := makePolicyBuilder()
+	bundle := b.Policy().GetObjectsByKind(lang.TypeBundle.Kind)[0].(*lang.Bundle) // nolint: errcheck
+	bundle.Components[0].UpdateStrategy = lang.UpdateStrategyBlueGreen
+
+	p := newRecordingCodePlugin()
+	desired := newTestData(t, b)
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desired.external(),
+		mockPluginRegistry(p),
+		diff.NewPolicyResolutionDiff(desired.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 4, Failed: 0, Skipped: 0})
+
+	var key string
+	for _, instance := range desired.resolution().ComponentInstanceMap {
+		if instance.IsCode {
+			key = instance.GetKey()
+		}
+	}
+
+	// failure to destroy previous deployment doesn't fail the update
+	for _, claim := range b.Policy().GetObjectsByKind(lang.TypeClaim.Kind) {
+		claim.(*lang.Claim).Labels["param"] = "value2"
+	}
+	p.failDestroy = true
+	desiredNext := newTestData(t, b)
+	applier = NewEngineApply(
+		desiredNext.policy(),
+		desiredNext.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desiredNext.external(),
+		mockPluginRegistry(p),
+		diff.NewPolicyResolutionDiff(desiredNext.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 2, Failed: 1, Skipped: 0})
+
+	instance := getInstanceInternal(t, key, actualState)
+	assert.Equal(t, resolve.ColorGreen, instance.Color, "Blue/green update should switch deployment color")
+	assert.Equal(t, "value2", instance.CalculatedCodeParams["param"], "Code params should be switched together with deployment color")
+	assert.Equal(t, instance.GetDeployNameForColor(""), instance.InactiveDeployName, "Previous deployment should be recorded for cleanup")
+	assert.Equal(t, "value1", instance.InactiveCodeParams["param"], "Code params of previous deployment should be recorded for cleanup")
+
+	// cleanup is retried by the next revision without updating anything again
+	p.failDestroy = false
+	applier = NewEngineApply(
+		desiredNext.policy(),
+		desiredNext.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desiredNext.external(),
+		mockPluginRegistry(p),
+		diff.NewPolicyResolutionDiff(desiredNext.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 1, Failed: 0, Skipped: 0})
+
+	instance = getInstanceInternal(t, key, actualState)
+	assert.Equal(t, "", instance.InactiveDeployName, "Previous deployment should be cleaned up")
+	assert.Equal(t, map[string]bool{instance.GetDeployName(): true}, p.getDeployments(), "Only active deployment should be left running")
+}
+
+func TestApplyRecreateCreateFailure(t *testing.T) {
+	empty := newTestData(t, builder.NewPolicyBuilder())
+	actualState := empty.resolution()
+
+	b := makePolicyBuilder()
+	bundle := b.Policy().GetObjectsByKind(lang.TypeBundle.Kind)[0].(*lang.Bundle) // nolint: errcheck
+	bundle.Components[0].UpdateStrategy = lang.UpdateStrategyRecreate
+
+	p := newRecordingCodePlugin()
+	desired := newTestData(t, b)
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desired.external(),
+		mockPluginRegistry(p),
+		diff.NewPolicyResolutionDiff(desired.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 4, Failed: 0, Skipped: 0})
+
+	var key string
+	for _, instance := range desired.resolution().ComponentInstanceMap {
+		if instance.IsCode {
+			key = instance.GetKey()
+		}
+	}
+
+	// code gets destroyed, but creation fails
+	for _, claim := range b.Policy().GetObjectsByKind(lang.TypeClaim.Kind) {
+		claim.(*lang.Claim).Labels["param"] = "value2"
+	}
+	p.failCreate = true
+	desiredNext := newTestData(t, b)
+	applier = NewEngineApply(
+		desiredNext.policy(),
+		desiredNext.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desiredNext.external(),
+		mockPluginRegistry(p),
+		diff.NewPolicyResolutionDiff(desiredNext.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 0, Failed: 1, Skipped: 1})
+
+	instance := getInstanceInternal(t, key, actualState)
+	assert.True(t, instance.CodeDestroyed, "Destroyed code should be recorded in actual state")
+	assert.Empty(t, p.getDeployments(), "Code should be destroyed")
+
+	// retry only creates code, as destroying missing code would fail
+	p.failCreate = false
+	applier = NewEngineApply(
+		desiredNext.policy(),
+		desiredNext.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desiredNext.external(),
+		mockPluginRegistry(p),
+		diff.NewPolicyResolutionDiff(desiredNext.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 2, Failed: 0, Skipped: 0})
+
+	instance = getInstanceInternal(t, key, actualState)
+	assert.False(t, instance.CodeDestroyed, "Code should be created again")
+	assert.Equal(t, "value2", instance.CalculatedCodeParams["param"], "Code params should be updated")
+	assert.Equal(t, map[string]bool{instance.GetDeployName(): true}, p.getDeployments(), "Code should be running")
+}
+
+func TestApplyUpdateRolledBack(t *testing.T) {
+	empty := newTestData(t, builder.NewPolicyBuilder())
+	actualState := empty.resolution()
+
+	b := makePolicyBuilder()
+	desired := newTestData(t, b)
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desired.external(),
+		mockRegistry(true, false),
+		diff.NewPolicyResolutionDiff(desired.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 4, Failed: 0, Skipped: 0})
+
+	var key string
+	for _, instance := range desired.resolution().ComponentInstanceMap {
+		if instance.IsCode {
+			key = instance.GetKey()
+		}
+	}
+
+	// update gets rolled back by plugin
+	for _, claim := range b.Policy().GetObjectsByKind(lang.TypeClaim.Kind) {
+		claim.(*lang.Claim).Labels["param"] = "value2"
+	}
+	desiredNext := newTestData(t, b)
+	applier = NewEngineApply(
+		desiredNext.policy(),
+		desiredNext.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desiredNext.external(),
+		mockRollbackRegistry(),
+		diff.NewPolicyResolutionDiff(desiredNext.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 0, Failed: 1, Skipped: 1})
+
+	instance := getInstanceInternal(t, key, actualState)
+	assert.Contains(t, instance.RolledBack, "rolled back to revision 1", "Rollback should be recorded in actual state")
+	assert.False(t, instance.RolledBackAt.IsZero(), "Rollback time should be recorded in actual state")
+	assert.Equal(t, "value1", instance.CalculatedCodeParams["param"], "Code params should stay the same after rollback")
+
+	assert.Equal(t, "value2", instance.RolledBackParams["param"], "Rolled back code params should be recorded in actual state")
+
+	// update with the same params isn't attempted again
+	applier = NewEngineApply(
+		desiredNext.policy(),
+		desiredNext.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desiredNext.external(),
+		mockRollbackRegistry(),
+		diff.NewPolicyResolutionDiff(desiredNext.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 0, Failed: 0, Skipped: 0})
+
+	// successful update with changed params clears rollback
+	for _, claim := range b.Policy().GetObjectsByKind(lang.TypeClaim.Kind) {
+		claim.(*lang.Claim).Labels["param"] = "value3"
+	}
+	desiredNext = newTestData(t, b)
+	applier = NewEngineApply(
+		desiredNext.policy(),
+		desiredNext.resolution(),
+		actual.NewNoOpActionStateUpdater(actualState),
+		desiredNext.external(),
+		mockRegistry(true, false),
+		diff.NewPolicyResolutionDiff(desiredNext.resolution(), actualState).ActionPlan,
+		event.NewLog(logrus.DebugLevel, "test-apply"),
+		action.NewApplyResultUpdaterImpl(),
+	)
+	actualState = applyAndCheck(t, applier, action.ApplyResult{Success: 2, Failed: 0, Skipped: 0})
+
+	instance = getInstanceInternal(t, key, actualState)
+	assert.Equal(t, "", instance.RolledBack, "Rollback should be cleared after successful update")
+	assert.Nil(t, instance.RolledBackParams, "Rolled back code params should be cleared after successful update")
+	assert.Equal(t, "value3", instance.CalculatedCodeParams["param"], "Code params should be updated")
+}
+
 func TestDeletePolicyObjectsWhileComponentInstancesAreStillRunningFails(t *testing.T) {
 	// Start with empty actual state & empty policy
 	empty := newTestData(t, builder.NewPolicyBuilder())
@@ -393,3 +924,115 @@ func mockRegistry(applySuccess, failAsPanic bool) plugin.Registry {
 
 	return plugin.NewRegistry(config.Plugins{}, clusterTypes, codeTypes)
 }
+
+// rollbackCodePlugin is a code plugin, which rolls back all updates
+type rollbackCodePlugin struct {
+	plugin.CodePlugin
+}
+
+func (p *rollbackCodePlugin) Update(invocation *plugin.CodePluginInvocationParams) error {
+	return &plugin.RolledBackError{Reason: fmt.Errorf("deployment didn't become ready"), Revision: "1"}
+}
+
+func mockRollbackRegistry() plugin.Registry {
+	clusterTypes := make(map[string]plugin.ClusterPluginConstructor)
+	codeTypes := make(map[string]map[string]plugin.CodePluginConstructor)
+
+	clusterTypes["kubernetes"] = func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+		return fake.NewNoOpClusterPlugin(0), nil
+	}
+
+	codeTypes["kubernetes"] = make(map[string]plugin.CodePluginConstructor)
+	codeTypes["kubernetes"]["helm"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+		return &rollbackCodePlugin{fake.NewNoOpCodePlugin(0)}, nil
+	}
+
+	return plugin.NewRegistry(config.Plugins{}, clusterTypes, codeTypes)
+}
+
+// recordingCodePlugin is a code plugin, which keeps track of running deployments and records calls made to it.
+// Destroying a missing deployment fails the same way as for Helm releases
+type recordingCodePlugin struct {
+	plugin.CodePlugin
+
+	mutex       sync.Mutex
+	calls       []string
+	deployments map[string]bool
+	failCreate  bool
+	failDestroy bool
+}
+
+func newRecordingCodePlugin() *recordingCodePlugin {
+	return &recordingCodePlugin{
+		CodePlugin:  fake.NewNoOpCodePlugin(0),
+		deployments: make(map[string]bool),
+	}
+}
+
+func (p *recordingCodePlugin) Create(invocation *plugin.CodePluginInvocationParams) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.calls = append(p.calls, "create "+invocation.DeployName)
+	if p.failCreate {
+		return fmt.Errorf("unable to create %s", invocation.DeployName)
+	}
+	if p.deployments[invocation.DeployName] {
+		return fmt.Errorf("%s already exists", invocation.DeployName)
+	}
+	p.deployments[invocation.DeployName] = true
+	return nil
+}
+
+func (p *recordingCodePlugin) Update(invocation *plugin.CodePluginInvocationParams) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.calls = append(p.calls, "update "+invocation.DeployName)
+	p.deployments[invocation.DeployName] = true
+	return nil
+}
+
+func (p *recordingCodePlugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.calls = append(p.calls, "destroy "+invocation.DeployName)
+	if p.failDestroy {
+		return fmt.Errorf("unable to destroy %s", invocation.DeployName)
+	}
+	if !p.deployments[invocation.DeployName] {
+		return fmt.Errorf("%s not found", invocation.DeployName)
+	}
+	delete(p.deployments, invocation.DeployName)
+	return nil
+}
+
+func (p *recordingCodePlugin) getCalls() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]string{}, p.calls...)
+}
+
+func (p *recordingCodePlugin) getDeployments() map[string]bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	result := make(map[string]bool)
+	for deployName := range p.deployments {
+		result[deployName] = true
+	}
+	return result
+}
+
+func mockPluginRegistry(p plugin.CodePlugin) plugin.Registry {
+	clusterTypes := make(map[string]plugin.ClusterPluginConstructor)
+	codeTypes := make(map[string]map[string]plugin.CodePluginConstructor)
+
+	clusterTypes["kubernetes"] = func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+		return fake.NewNoOpClusterPlugin(0), nil
+	}
+
+	codeTypes["kubernetes"] = make(map[string]plugin.CodePluginConstructor)
+	codeTypes["kubernetes"]["helm"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+		return p, nil
+	}
+
+	return plugin.NewRegistry(config.Plugins{}, clusterTypes, codeTypes)
+}
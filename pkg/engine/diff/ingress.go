@@ -0,0 +1,57 @@
+package diff
+
+import (
+	"strconv"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// getIngress returns ingress settings of the component instance with the given key in desired state, which get passed
+// to the code plugin by the actions
+func (diff *PolicyResolutionDiff) getIngress(key string) *component.Ingress {
+	return &component.Ingress{
+		AllowFrom: diff.ingress.GetAllowIngressFrom(key),
+		LabelPods: diff.ingress.IsLabelPods(key),
+	}
+}
+
+// getIngressChanges returns changes of ingress settings of the component instance, which require its code to be
+// updated, so code plugins could adjust network policies and pod labels. The list of code instances allowed to send
+// ingress traffic is only compared when ingress traffic is not allowed
+func getIngressChanges(prev *resolve.ComponentInstance, next *resolve.ComponentInstance, ingress *component.Ingress) []*util.ParameterChange {
+	result := []*util.ParameterChange{}
+	if prev.IsIngressAllowed() != next.IsIngressAllowed() {
+		result = append(result, &util.ParameterChange{
+			Op:       util.ChangeOpReplace,
+			Path:     "/ingress/allow",
+			OldValue: strconv.FormatBool(prev.IsIngressAllowed()),
+			Value:    strconv.FormatBool(next.IsIngressAllowed()),
+		})
+	}
+
+	if !next.IsIngressAllowed() {
+		prevFrom := prev.DataForPlugins[resolve.AllowIngressFrom]
+		if prevFrom != ingress.AllowFrom {
+			result = append(result, &util.ParameterChange{
+				Op:       util.ChangeOpReplace,
+				Path:     "/ingress/from",
+				OldValue: prevFrom,
+				Value:    ingress.AllowFrom,
+			})
+		}
+	}
+
+	prevLabelPods := prev.DataForPlugins[resolve.LabelPods] == "true"
+	if prevLabelPods != ingress.LabelPods {
+		result = append(result, &util.ParameterChange{
+			Op:       util.ChangeOpReplace,
+			Path:     "/ingress/labelPods",
+			OldValue: strconv.FormatBool(prevLabelPods),
+			Value:    strconv.FormatBool(ingress.LabelPods),
+		})
+	}
+
+	return result
+}
@@ -1,9 +1,13 @@
 package diff
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/util"
 )
 
@@ -17,6 +21,9 @@ type PolicyResolutionDiff struct {
 
 	// Plan is a plan of actions to transform Prev to Next
 	ActionPlan *action.Plan
+
+	// ingress is an index of ingress settings of component instances in Next, which is built once per diff
+	ingress *resolve.IngressIndex
 }
 
 // NewPolicyResolutionDiff calculates difference between prev and next policy resolution structs (actual and desired states).
@@ -30,6 +37,7 @@ func NewPolicyResolutionDiff(next *resolve.PolicyResolution, prev *resolve.Polic
 		Prev:       prev,
 		Next:       next,
 		ActionPlan: action.NewPlan(),
+		ingress:    next.GetIngressIndex(),
 	}
 	result.compareAndProduceActions()
 	return result
@@ -46,9 +54,17 @@ func (diff *PolicyResolutionDiff) compareAndProduceActions() {
 		allCompInstances[keyNext] = true
 	}
 
+	// Find component instances, which have to be moved over to the new keys instead of being re-created
+	movedFrom := diff.Next.GetMoves(diff.Prev)
+	movedTo := make(map[string]string)
+	for key, prevKey := range movedFrom {
+		movedTo[prevKey] = key
+	}
+
 	// Build a flat list of actions for every component instance
+	cleanups := make(map[string]*action.GraphNode)
 	for key := range allCompInstances {
-		diff.buildActions(key)
+		diff.buildActions(key, movedFrom, movedTo, cleanups)
 	}
 
 	// Generate dependencies between actions
@@ -64,16 +80,65 @@ func (diff *PolicyResolutionDiff) compareAndProduceActions() {
 			diff.ActionPlan.GetActionGraphNode(key).AddBefore(diff.ActionPlan.GetActionGraphNode(keyOut))
 		}
 	}
+
+	// Node for the previous key of a moved component instance has to wait until the move is done
+	for prevKey, key := range movedTo {
+		diff.ActionPlan.GetActionGraphNode(prevKey).AddBefore(diff.ActionPlan.GetActionGraphNode(key))
+	}
+
+	// Previous deployment kept running after blue/green update can only be destroyed once the component instance itself
+	// and all component instances depending on it are done, so none of them uses it anymore
+	for key, cleanupNode := range cleanups {
+		cleanupNode.AddBefore(diff.ActionPlan.GetActionGraphNode(key))
+		for dependentKey := range diff.getDependents(key) {
+			cleanupNode.AddBefore(diff.ActionPlan.GetActionGraphNode(dependentKey))
+		}
+	}
+}
+
+// getDependents returns keys of all component instances in next, which directly or indirectly depend on the given one
+func (diff *PolicyResolutionDiff) getDependents(key string) map[string]bool {
+	edgesIn := make(map[string][]string)
+	for keyFrom, instance := range diff.Next.ComponentInstanceMap {
+		for keyTo := range instance.EdgesOut {
+			edgesIn[keyTo] = append(edgesIn[keyTo], keyFrom)
+		}
+	}
+
+	result := make(map[string]bool)
+	queue := []string{key}
+	for len(queue) > 0 {
+		for _, keyFrom := range edgesIn[queue[0]] {
+			if !result[keyFrom] && keyFrom != key {
+				result[keyFrom] = true
+				queue = append(queue, keyFrom)
+			}
+		}
+		queue = queue[1:]
+	}
+	return result
 }
 
 // Traverse a graph for a given component instance
-func (diff *PolicyResolutionDiff) buildActions(key string) { // nolint: gocyclo
+func (diff *PolicyResolutionDiff) buildActions(key string, movedFrom map[string]string, movedTo map[string]string, cleanups map[string]*action.GraphNode) { // nolint: gocyclo
 	// Get action graph node for a given component key
 	node := diff.ActionPlan.GetActionGraphNode(key)
 
+	// If component instance gets moved over to a new key, all actions will be performed there
+	if _, moved := movedTo[key]; moved {
+		return
+	}
+
 	// Get previous claim keys
 	var claimKeysPrev map[string]int
 	prevInstance := diff.Prev.ComponentInstanceMap[key]
+
+	// If component instance gets moved over from a previous key, move it first and then compare it with the previous instance
+	if prevKey, moved := movedFrom[key]; moved {
+		prevInstance = diff.Prev.ComponentInstanceMap[prevKey]
+		node.AddAction(component.NewMoveAction(prevKey, key, prevInstance.CalculatedCodeParams, diff.getIngress(key)), diff.Prev, true)
+	}
+
 	if prevInstance != nil {
 		claimKeysPrev = prevInstance.ClaimKeys
 	}
@@ -85,6 +150,12 @@ func (diff *PolicyResolutionDiff) buildActions(key string) { // nolint: gocyclo
 		claimKeysNext = nextInstance.ClaimKeys
 	}
 
+	// If component instance has to adopt an existing deployment, adopt it first and then compare it with the adopted instance
+	if adoption, found := diff.Next.Adoptions[key]; found && prevInstance == nil && len(claimKeysNext) > 0 {
+		node.AddAction(component.NewAdoptAction(key, adoption.DeployName, adoption.UpToDate), diff.Prev, true)
+		prevInstance = nextInstance.MakeAdopted(adoption.DeployName, adoption.UpToDate)
+	}
+
 	/*
 		First of all, let's see if a component needs to be destructed. If so, destruct it and don't proceed to any further actions.
 	*/
@@ -96,9 +167,22 @@ func (diff *PolicyResolutionDiff) buildActions(key string) { // nolint: gocyclo
 		}
 	}
 
-	// See if a component needs to be destructed
+	// See if a component needs to be destructed. If it has retention, it will be retained instead
 	if len(claimKeysPrev) > 0 && len(claimKeysNext) <= 0 {
-		node.AddAction(component.NewDeleteAction(key, prevInstance.CalculatedCodeParams), diff.Prev, true)
+		if len(prevInstance.Retention) > 0 {
+			node.AddAction(component.NewRetentionAction(key, prevInstance.Retention, true), diff.Prev, true)
+		} else {
+			node.AddAction(component.NewDeleteAction(key, prevInstance.CalculatedCodeParams), diff.Prev, true)
+		}
+		return // exit right away
+	}
+
+	// See if a retained component needs to be destructed (its grace period has expired or purge has been requested)
+	retainedPrev := prevInstance != nil && prevInstance.IsRetained()
+	if retainedPrev && len(claimKeysNext) <= 0 {
+		if prevInstance.IsRetentionExpired(time.Now()) {
+			node.AddAction(component.NewDeleteAction(key, prevInstance.CalculatedCodeParams), diff.Prev, true)
+		}
 		return // exit right away
 	}
 
@@ -109,23 +193,51 @@ func (diff *PolicyResolutionDiff) buildActions(key string) { // nolint: gocyclo
 	// See if it's a bundle or component
 	isCodeComponent := (prevInstance != nil && prevInstance.IsCode) || (nextInstance != nil && nextInstance.IsCode)
 
-	// See if a component needs to be instantiated
+	// See if a component needs to be instantiated. If it has been retained, it will be reused instead. If it has been
+	// adopted, it already exists in the cloud
+	adoptedPrev := prevInstance != nil && prevInstance.IsAdopted()
 	if len(claimKeysPrev) <= 0 && len(claimKeysNext) > 0 {
-		node.AddAction(component.NewCreateAction(key, nextInstance.CalculatedCodeParams), diff.Prev, true)
+		if retainedPrev {
+			node.AddAction(component.NewRetentionAction(key, nextInstance.Retention, false), diff.Prev, true)
+		} else if !adoptedPrev {
+			node.AddAction(component.NewCreateAction(key, nextInstance.CalculatedCodeParams, diff.getIngress(key)), diff.Prev, true)
+		}
+	}
+
+	// See if retention of a component needs to be updated
+	if len(claimKeysPrev) > 0 && len(claimKeysNext) > 0 && prevInstance.Retention != nextInstance.Retention {
+		node.AddAction(component.NewRetentionAction(key, nextInstance.Retention, false), diff.Prev, true)
 	}
 
 	// See if a component needs to be updated
-	if isCodeComponent && len(claimKeysPrev) > 0 && len(claimKeysNext) > 0 {
+	if isCodeComponent && (len(claimKeysPrev) > 0 || retainedPrev || adoptedPrev) && len(claimKeysNext) > 0 {
+		// component instance which drifted away from its params needs to be re-applied as well, same as the one which
+		// ingress settings have changed (so code plugins could adjust network policies)
+		// update which has been rolled back by code plugin isn't attempted again until code params change
+		// code destroyed by recreate update, which failed to create it again, always needs to be updated
 		sameParams := prevInstance.CalculatedCodeParams.DeepEqual(nextInstance.CalculatedCodeParams)
-		if !sameParams {
-			node.AddAction(component.NewUpdateAction(key, prevInstance.CalculatedCodeParams, nextInstance.CalculatedCodeParams), diff.Prev, true)
+		rolledBackParams := prevInstance.RolledBackParams != nil && prevInstance.RolledBackParams.DeepEqual(nextInstance.CalculatedCodeParams)
+		ingress := diff.getIngress(key)
+		ingressChanges := getIngressChanges(prevInstance, nextInstance, ingress)
+		if prevInstance.CodeDestroyed || !rolledBackParams && (!sameParams || prevInstance.Drifted || len(ingressChanges) > 0) {
+			node.AddAction(component.NewUpdateAction(key, prevInstance.CalculatedCodeParams, nextInstance.CalculatedCodeParams, nextInstance.UpdateStrategy, append(GetParameterChanges(prevInstance, nextInstance), ingressChanges...), ingress), diff.Prev, true)
 
 			// indicate that a parent bundle component instance gets updated as well
 			// this is required for adjusting update/creation times of a bundle with changed component
 			// this may produce duplicate "update" actions for the parent bundle
 			bundleKey := nextInstance.Metadata.Key.GetParentBundleKey().GetKey()
 			bundleNode := diff.ActionPlan.GetActionGraphNode(bundleKey)
-			bundleNode.AddAction(component.NewUpdateAction(bundleKey, util.NestedParameterMap{}, util.NestedParameterMap{}), diff.Prev, true)
+			bundleNode.AddAction(component.NewUpdateAction(bundleKey, util.NestedParameterMap{}, util.NestedParameterMap{}, "", nil, nil), diff.Prev, true)
+
+			// blue/green update keeps the previous deployment running, so it has to be cleaned up afterwards
+			if nextInstance.UpdateStrategy == lang.UpdateStrategyBlueGreen && !sameParams && !prevInstance.CodeDestroyed {
+				diff.addCleanup(key, prevInstance.GetDeployName(), cleanups)
+			}
+		}
+
+		// previous deployment, which failed to get cleaned up after blue/green update before, is cleaned up again
+		if len(prevInstance.InactiveDeployName) > 0 && cleanups[key] == nil {
+			diff.addCleanup(key, prevInstance.InactiveDeployName, cleanups)
 		}
 	}
 
@@ -136,3 +248,69 @@ func (diff *PolicyResolutionDiff) buildActions(key string) { // nolint: gocyclo
 		}
 	}
 }
+
+// addCleanup adds a separate graph node with the action destroying previous deployment of component instance after
+// blue/green update. It gets ordered after the component instance and all its dependents later
+func (diff *PolicyResolutionDiff) addCleanup(key string, deployName string, cleanups map[string]*action.GraphNode) {
+	cleanup := component.NewCleanupAction(key, deployName)
+	cleanups[key] = diff.ActionPlan.GetActionGraphNode(cleanup.GetName())
+	cleanups[key].AddAction(cleanup, diff.Prev, true)
+}
+
+// ValidateProgress checks that partially applied action plan still matches the given actual state, so that it's safe
+// to resume applying it. Component instances for all completed nodes must match desired state, while component
+// instances for the rest of the nodes must remain the same as in the initial actual state (i.e. the one which was
+// captured when applying the plan has been started)
+func (diff *PolicyResolutionDiff) ValidateProgress(initial *resolve.PolicyResolution, actual *resolve.PolicyResolution, completed map[string]bool) error {
+	for key := range diff.ActionPlan.NodeMap {
+		expected := initial.ComponentInstanceMap[key]
+		if completed[key] {
+			expected = diff.Next.ComponentInstanceMap[key]
+		}
+		if !sameInstanceState(expected, actual.ComponentInstanceMap[key]) {
+			return fmt.Errorf("component instance '%s' in actual state doesn't match the progress of action plan (completed: %t)", key, completed[key])
+		}
+	}
+	return nil
+}
+
+// sameInstanceState returns true if two component instances have the same set of claims and the same code params.
+// Instances without claims are considered to be equal to non-existing instances
+func sameInstanceState(expected *resolve.ComponentInstance, actual *resolve.ComponentInstance) bool {
+	var claimKeysExpected, claimKeysActual map[string]int
+	if expected != nil {
+		claimKeysExpected = expected.ClaimKeys
+	}
+	if actual != nil {
+		claimKeysActual = actual.ClaimKeys
+	}
+
+	if len(claimKeysExpected) != len(claimKeysActual) {
+		return false
+	}
+	for claimKey := range claimKeysExpected {
+		if _, found := claimKeysActual[claimKey]; !found {
+			return false
+		}
+	}
+	if len(claimKeysExpected) <= 0 {
+		return true
+	}
+
+	return expected.CalculatedCodeParams.DeepEqual(actual.CalculatedCodeParams)
+}
+
+// GetParameterChanges returns field-level changes of code params, discovery params and labels between two instances
+func GetParameterChanges(prev *resolve.ComponentInstance, next *resolve.ComponentInstance) []*util.ParameterChange {
+	result := prev.CalculatedCodeParams.Changes(next.CalculatedCodeParams, "/params")
+	result = append(result, prev.CalculatedDiscovery.Changes(next.CalculatedDiscovery, "/discovery")...)
+	result = append(result, util.LabelChanges(getLabels(prev), getLabels(next), "/labels")...)
+	return result
+}
+
+func getLabels(instance *resolve.ComponentInstance) map[string]string {
+	if instance.CalculatedLabels == nil {
+		return nil
+	}
+	return instance.CalculatedLabels.Labels
+}
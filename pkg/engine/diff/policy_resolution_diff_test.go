@@ -3,7 +3,9 @@ package diff
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
@@ -71,6 +73,135 @@ func TestDiffComponentUpdate(t *testing.T) {
 	verifyDiff(t, diffAgain, 0, 0, 2, 0, 0)
 }
 
+func TestDiffComponentUpdateChanges(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+	bundle := b.AddBundle()
+	b.AddBundleComponent(bundle,
+		b.CodeComponent(
+			util.NestedParameterMap{
+				"param": "{{ .Labels.param }}",
+				"db": util.NestedParameterMap{
+					"password": "{{ .Labels.param }}",
+				},
+			},
+			nil,
+		),
+	)
+	b.AddService(bundle, b.CriteriaTrue())
+	clusterObj := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelTarget, clusterObj.Name)))
+
+	c1 := b.AddClaim(b.AddUser(), b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service))
+	c1.Labels["param"] = "value1"
+	resolvedPrev := resolvePolicy(t, b)
+
+	c1.Labels["param"] = "value2"
+	resolvedNext := resolvePolicy(t, b)
+
+	// update of the code component should describe which fields have changed, masking secret-looking values
+	diff := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	changes := diff.ActionPlan.ParameterChanges()
+	if !assert.Equal(t, 1, len(changes), "Diff: one component instance with changed parameters") {
+		return
+	}
+	for _, instanceChanges := range changes {
+		paramChanges := []*util.ParameterChange{}
+		for _, change := range instanceChanges {
+			if strings.HasPrefix(change.Path, "/params/") {
+				paramChanges = append(paramChanges, change)
+			}
+		}
+		assert.Equal(t, []*util.ParameterChange{
+			{Op: util.ChangeOpReplace, Path: "/params/db/password", OldValue: util.MaskedValue, Value: util.MaskedValue},
+			{Op: util.ChangeOpReplace, Path: "/params/param", OldValue: "value1", Value: "value2"},
+		}, paramChanges, "Diff: changes of code params")
+	}
+}
+
+func TestDiffComponentDrifted(t *testing.T) {
+	b := makePolicyBuilder()
+
+	// add claim
+	c1 := b.AddClaim(b.AddUser(), b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service))
+	c1.Labels["param"] = "value1"
+	resolvedPrev := resolvePolicy(t, b)
+	resolvedNext := resolvePolicy(t, b)
+
+	// diff should be empty
+	diff := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diff, 0, 0, 0, 0, 0)
+
+	// mark code component as drifted
+	for _, instance := range resolvedPrev.ComponentInstanceMap {
+		if instance.IsCode {
+			instance.Drifted = true
+		}
+	}
+
+	// drifted component should be updated
+	diffAgain := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diffAgain, 0, 0, 2, 0, 0)
+}
+
+func TestDiffComponentIngress(t *testing.T) {
+	b := makePolicyBuilder()
+
+	// add claim
+	c1 := b.AddClaim(b.AddUser(), b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service))
+	c1.Labels["param"] = "value1"
+	resolvedPrev := resolvePolicy(t, b)
+	resolvedNext := resolvePolicy(t, b)
+
+	// reject ingress traffic for code component
+	for _, instance := range resolvedNext.ComponentInstanceMap {
+		if instance.IsCode {
+			instance.DataForPlugins[resolve.AllowIngres] = "false"
+		}
+	}
+
+	// component with changed ingress settings should be updated
+	diff := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diff, 0, 0, 2, 0, 0)
+
+	// record the same ingress settings in previous state
+	index := resolvedNext.GetIngressIndex()
+	for key, instance := range resolvedPrev.ComponentInstanceMap {
+		if instance.IsCode {
+			instance.DataForPlugins[resolve.AllowIngres] = "false"
+			instance.DataForPlugins[resolve.AllowIngressFrom] = index.GetAllowIngressFrom(key)
+			instance.DataForPlugins[resolve.LabelPods] = "true"
+		}
+	}
+
+	// diff should be empty
+	diffAgain := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diffAgain, 0, 0, 0, 0, 0)
+
+	// component should be updated when the list of instances allowed to send ingress traffic changes
+	for _, instance := range resolvedPrev.ComponentInstanceMap {
+		if instance.IsCode {
+			instance.DataForPlugins[resolve.AllowIngressFrom] = "main/a-unknown"
+		}
+	}
+	diffFrom := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diffFrom, 0, 0, 2, 0, 0)
+
+	// component should be updated when its pods don't need to be labelled anymore
+	for _, instance := range resolvedNext.ComponentInstanceMap {
+		if instance.IsCode {
+			delete(instance.DataForPlugins, resolve.AllowIngres)
+		}
+	}
+	for _, instance := range resolvedPrev.ComponentInstanceMap {
+		if instance.IsCode {
+			delete(instance.DataForPlugins, resolve.AllowIngres)
+			delete(instance.DataForPlugins, resolve.AllowIngressFrom)
+		}
+	}
+	diffLabels := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diffLabels, 0, 0, 2, 0, 0)
+}
+
 func TestDiffComponentDelete(t *testing.T) {
 	b := makePolicyBuilder()
 	resolvedPrev := resolvePolicy(t, b)
@@ -102,6 +233,183 @@ func TestDiffComponentWithBundleSharing(t *testing.T) {
 	verifyDiff(t, diff, 7, 0, 0, 9, 0)
 }
 
+func TestDiffComponentMove(t *testing.T) {
+	b := makePolicyBuilder()
+
+	// add claim
+	c1 := b.AddClaim(b.AddUser(), b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service))
+	c1.Labels["param"] = "value1"
+	resolvedPrev := resolvePolicy(t, b)
+
+	// rename context
+	context := b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service).Contexts[0]
+	prevName := context.Name
+	context.Name = prevName + "renamed"
+	resolvedNext := resolvePolicy(t, b)
+
+	// without previous keys, component should be re-created
+	diff := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diff, 2, 2, 0, 2, 2)
+	assert.Equal(t, 0, countActions(diff, "action-component-move"), "Diff: component moves")
+
+	// with previous keys, component should be moved
+	context.Previous = []*lang.ContextPrevious{{Name: prevName}}
+	resolvedNextAgain := resolvePolicy(t, b)
+	diffAgain := NewPolicyResolutionDiff(resolvedNextAgain, resolvedPrev)
+	verifyDiff(t, diffAgain, 0, 0, 0, 0, 0)
+	assert.Equal(t, 2, countActions(diffAgain, "action-component-move"), "Diff: component moves")
+
+	// moved component with changed params should be moved and then updated
+	c1.Labels["param"] = "value2"
+	resolvedNextChanged := resolvePolicy(t, b)
+	diffChanged := NewPolicyResolutionDiff(resolvedNextChanged, resolvedPrev)
+	verifyDiff(t, diffChanged, 0, 0, 2, 0, 0)
+	assert.Equal(t, 2, countActions(diffChanged, "action-component-move"), "Diff: component moves")
+}
+
+func TestDiffComponentMoveAcrossTargets(t *testing.T) {
+	b := makePolicyBuilder()
+
+	// add claim
+	c1 := b.AddClaim(b.AddUser(), b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service))
+	c1.Labels["param"] = "value1"
+	resolvedPrev := resolvePolicy(t, b)
+
+	// rename context and change target namespace, listing the previous identity
+	context := b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service).Contexts[0]
+	cluster := b.Policy().GetObjectsByKind(lang.TypeCluster.Kind)[0].(*lang.Cluster)
+	rule := b.Policy().GetObjectsByKind(lang.TypeRule.Kind)[0].(*lang.Rule)
+	context.Previous = []*lang.ContextPrevious{{Name: context.Name, Target: cluster.Name}}
+	context.Name = context.Name + "renamed"
+	rule.Actions.ChangeLabels = lang.NewLabelOperationsSetSingleLabel(lang.LabelTarget, cluster.Name+".other")
+	resolvedNext := resolvePolicy(t, b)
+
+	// code can't be moved to another namespace, so component should be re-created
+	diff := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diff, 2, 2, 0, 2, 2)
+	assert.Equal(t, 0, countActions(diff, "action-component-move"), "Diff: component moves")
+}
+
+func TestDiffComponentRetention(t *testing.T) {
+	b := makePolicyBuilder()
+	bundle := b.Policy().GetObjectsByKind(lang.TypeBundle.Kind)[0].(*lang.Bundle) // nolint: errcheck
+	bundle.Retention = lang.RetentionRetain
+
+	// add claim
+	c1 := b.AddClaim(b.AddUser(), b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service))
+	c1.Labels["param"] = "value1"
+	resolvedPrev := resolvePolicy(t, b)
+	resolvedEmpty := resolvePolicy(t, builder.NewPolicyBuilder())
+
+	// once claim is gone, component should be retained instead of being destructed
+	diff := NewPolicyResolutionDiff(resolvedEmpty, resolvedPrev)
+	verifyDiff(t, diff, 0, 0, 0, 0, 2)
+	assert.Equal(t, 2, countActions(diff, "action-component-retention"), "Diff: component retentions")
+
+	// retained component should stay as is
+	resolvedRetained := resolvePolicy(t, b)
+	for _, instance := range resolvedRetained.ComponentInstanceMap {
+		instance.ClaimKeys = map[string]int{}
+		instance.RetainedAt = time.Now()
+	}
+	diffRetained := NewPolicyResolutionDiff(resolvedEmpty, resolvedRetained)
+	verifyDiff(t, diffRetained, 0, 0, 0, 0, 0)
+	assert.Equal(t, 0, countActions(diffRetained, "action-component-retention"), "Diff: component retentions")
+
+	// retained component should be reused when it gets claimed again
+	diffReused := NewPolicyResolutionDiff(resolvedPrev, resolvedRetained)
+	verifyDiff(t, diffReused, 0, 0, 0, 2, 0)
+	assert.Equal(t, 2, countActions(diffReused, "action-component-retention"), "Diff: component retentions")
+
+	// retained component should be destructed when purge is requested
+	for _, instance := range resolvedRetained.ComponentInstanceMap {
+		instance.PurgeRequested = true
+	}
+	diffPurged := NewPolicyResolutionDiff(resolvedEmpty, resolvedRetained)
+	verifyDiff(t, diffPurged, 0, 2, 0, 0, 0)
+
+	// retained component should be destructed when grace period expires
+	for _, instance := range resolvedRetained.ComponentInstanceMap {
+		instance.PurgeRequested = false
+		instance.Retention = "1h"
+		instance.RetainedAt = time.Now().Add(-2 * time.Hour)
+	}
+	diffExpired := NewPolicyResolutionDiff(resolvedEmpty, resolvedRetained)
+	verifyDiff(t, diffExpired, 0, 2, 0, 0, 0)
+}
+
+func TestDiffComponentAdopted(t *testing.T) {
+	b := makePolicyBuilder()
+
+	// add claim
+	c1 := b.AddClaim(b.AddUser(), b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service))
+	c1.Labels["param"] = "value1"
+	resolvedNext := resolvePolicy(t, b)
+
+	// adopt code component, which already exists and matches params
+	adoptedState := resolve.NewPolicyResolution()
+	for key, instance := range resolvedNext.ComponentInstanceMap {
+		if instance.IsCode {
+			adoptedState.ComponentInstanceMap[key] = instance.MakeAdopted(instance.GetDeployName(), true)
+		}
+	}
+
+	// adopted component should not be created again, claims should just get attached to it
+	diff := NewPolicyResolutionDiff(resolvedNext, adoptedState)
+	verifyDiff(t, diff, 1, 0, 0, 2, 0)
+
+	// adopted component with different params should be updated (together with its parent bundle)
+	for key, instance := range resolvedNext.ComponentInstanceMap {
+		if instance.IsCode {
+			adoptedState.ComponentInstanceMap[key] = instance.MakeAdopted("existing-"+instance.GetDeployName(), false)
+		}
+	}
+	diffUpdated := NewPolicyResolutionDiff(resolvedNext, adoptedState)
+	verifyDiff(t, diffUpdated, 1, 0, 2, 2, 0)
+
+	// adopted component should keep the name of existing deployment
+	for key, instance := range adoptedState.ComponentInstanceMap {
+		assert.Equal(t, "existing-"+resolvedNext.ComponentInstanceMap[key].GetDeployName(), instance.GetDeployName(), "Adopted component should keep deploy name")
+	}
+
+	// adoption requested in desired state should be a part of the plan, followed by update and attaching claims
+	for key, instance := range resolvedNext.ComponentInstanceMap {
+		if instance.IsCode {
+			resolvedNext.RecordAdoption(key, "existing-"+instance.GetDeployName(), false)
+		}
+	}
+	diffAdoption := NewPolicyResolutionDiff(resolvedNext, resolve.NewPolicyResolution())
+	verifyDiff(t, diffAdoption, 1, 0, 2, 2, 0)
+	assert.Equal(t, 1, countActions(diffAdoption, "action-component-adopt"), "Diff: component adoptions")
+}
+
+func TestDiffValidateProgress(t *testing.T) {
+	b := makePolicyBuilder()
+	resolvedPrev := resolvePolicy(t, b)
+
+	// add claim
+	c1 := b.AddClaim(b.AddUser(), b.Policy().GetObjectsByKind(lang.TypeService.Kind)[0].(*lang.Service))
+	c1.Labels["param"] = "value1"
+	resolvedNext := resolvePolicy(t, b)
+	diff := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+
+	// nothing has been applied yet
+	assert.NoError(t, diff.ValidateProgress(resolvedPrev, resolvedPrev, map[string]bool{}), "Progress should be valid when nothing has been applied")
+
+	// everything has been applied, but progress doesn't reflect that
+	assert.Error(t, diff.ValidateProgress(resolvedPrev, resolvedNext, map[string]bool{}), "Progress should be invalid when actual state has been changed")
+
+	// everything has been applied and recorded in progress
+	completed := make(map[string]bool)
+	for key := range diff.ActionPlan.NodeMap {
+		completed[key] = true
+	}
+	assert.NoError(t, diff.ValidateProgress(resolvedPrev, resolvedNext, completed), "Progress should be valid when all nodes have been completed")
+
+	// nodes have been marked as completed, but actual state hasn't been changed
+	assert.Error(t, diff.ValidateProgress(resolvedPrev, resolvedPrev, completed), "Progress should be invalid when actual state doesn't match completed nodes")
+}
+
 /*
 	Helpers
 */
@@ -194,6 +502,8 @@ func verifyDiff(t *testing.T, diff *PolicyResolutionDiff, componentInstantiate i
 			cnt.detach++
 		case *component.EndpointsAction:
 			cnt.endpoints++
+		case *component.MoveAction, *component.RetentionAction, *component.AdoptAction:
+			// verified separately by countActions
 		default:
 			t.Fatalf("Incorrect action type: %T", act)
 		}
@@ -201,7 +511,7 @@ func verifyDiff(t *testing.T, diff *PolicyResolutionDiff, componentInstantiate i
 		return nil
 	}
 
-	_ = diff.ActionPlan.Apply(action.WrapSequential(fn), action.NewApplyResultUpdaterImpl())
+	_ = diff.ActionPlan.Apply(action.WrapSequential(fn), action.NewApplyResultUpdaterImpl(), nil)
 
 	ok := assert.Equal(t, componentInstantiate, cnt.create, "Diff: component instantiations")
 	ok = ok && assert.Equal(t, componentDestruct, cnt.delete, "Diff: component destructions")
@@ -215,3 +525,15 @@ func verifyDiff(t *testing.T, diff *PolicyResolutionDiff, componentInstantiate i
 		t.FailNow()
 	}
 }
+
+func countActions(diff *PolicyResolutionDiff, kind string) int {
+	result := 0
+	for _, node := range diff.ActionPlan.NodeMap {
+		for _, act := range node.Actions {
+			if act.GetKind() == kind {
+				result++
+			}
+		}
+	}
+	return result
+}
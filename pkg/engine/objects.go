@@ -11,6 +11,12 @@ var (
 		TypePolicyData,
 		TypeRevision,
 		TypeDesiredState,
+		TypeRevisionActualState,
+		TypeRevisionProgress,
+		TypeActualStateChange,
+		TypeActualStateSnapshot,
+		TypeActualStateHistory,
+		TypePluginData,
 		resolve.TypeComponentInstance,
 	})
 )
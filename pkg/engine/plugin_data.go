@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"github.com/Aptomi/aptomi/pkg/runtime"
+)
+
+// TypePluginData is an informational data structure with Kind and Constructor for PluginData
+var TypePluginData = &runtime.TypeInfo{
+	Kind:        "plugin-data",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &PluginData{} },
+}
+
+// PluginData is a named set of files, which code plugin keeps for one of its deployments (e.g. Terraform state). It's
+// stored together with the rest of Aptomi data, so plugins don't depend on local disk of the server
+type PluginData struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	Name string
+	Data map[string]string
+}
+
+// NewPluginData creates new PluginData with the given name and data
+func NewPluginData(name string, data map[string]string) *PluginData {
+	return &PluginData{
+		TypeKind: TypePluginData.GetTypeKind(),
+		Name:     name,
+		Data:     data,
+	}
+}
+
+// PluginDataKey returns key of the PluginData with the given name
+func PluginDataKey(name string) runtime.Key {
+	return runtime.KeyFromParts(runtime.SystemNS, TypePluginData.Kind, name)
+}
+
+// GetName returns name of the PluginData
+func (data *PluginData) GetName() string {
+	return data.Name
+}
+
+// GetNamespace returns namespace of the PluginData
+func (data *PluginData) GetNamespace() string {
+	return runtime.SystemNS
+}
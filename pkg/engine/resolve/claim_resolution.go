@@ -9,12 +9,16 @@ type ClaimResolution struct {
 
 	// ComponentInstanceKey holds the reference to component instance, to which claim got resolved
 	ComponentInstanceKey string
+
+	// Conflicts is a list of params conflicts, which prevent claim from being resolved
+	Conflicts []*ParamsConflict
 }
 
 // Creates a new claim resolution
-func newClaimResolution(resolved bool, key string) *ClaimResolution {
+func newClaimResolution(resolved bool, key string, conflicts []*ParamsConflict) *ClaimResolution {
 	return &ClaimResolution{
 		Resolved:             resolved,
 		ComponentInstanceKey: key,
+		Conflicts:            conflicts,
 	}
 }
@@ -5,7 +5,6 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/Aptomi/aptomi/pkg/errors"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/util"
@@ -27,6 +26,14 @@ type ComponentInstanceMetadata struct {
 // AllowIngres is an special key, which is used in DataForPlugins to indicate whether ingress traffic should be allowed for a given component instance
 const AllowIngres = "allow_ingress"
 
+const (
+	// ColorBlue is one of the two alternating deployment colors used by blue/green updates
+	ColorBlue = "blue"
+
+	// ColorGreen is one of the two alternating deployment colors used by blue/green updates
+	ColorGreen = "green"
+)
+
 // ComponentInstance is an instance of a particular code component within a bundle, which indicate that this component
 // has to be instantiated and configured in a certain cluster. Policy resolver produces a map of component instances
 // and their parameters in desired state (PolicyResolution) as result of policy resolution.
@@ -70,6 +77,12 @@ type ComponentInstance struct {
 	// DataForPlugins is an additional data recorded for use in plugins
 	DataForPlugins map[string]string
 
+	// UpdateStrategy defines how running code instance gets updated when its code params change (see lang.BundleComponent)
+	UpdateStrategy string
+
+	// Retention defines what happens with component instance once it has no claims left (see lang.RetentionRetain)
+	Retention string
+
 	/*
 		These fields only make sense for the desired state. They will NOT be present in actual state
 	*/
@@ -77,6 +90,14 @@ type ComponentInstance struct {
 	// EdgesOut is a set of outgoing graph edges ('key' -> true) from this component instance. Only makes sense as a part of desired state
 	EdgesOut map[string]bool
 
+	// PreviousKeys is a set of previous keys ('key' -> true) of this component instance. If component instance with one
+	// of these keys exists in actual state, it will be moved over instead of being re-created. Only makes sense as a part of desired state
+	PreviousKeys map[string]bool
+
+	// ResolvedDeployName is a name of the deployment of code instance, which dependents have been resolved against
+	// (i.e. which gets announced in the discovery tree). Only makes sense as a part of desired state
+	ResolvedDeployName string
+
 	/*
 		These fields only make sense for the actual state. They will NOT be present in desired state
 	*/
@@ -92,6 +113,51 @@ type ComponentInstance struct {
 
 	// Endpoints represents all URLs that could be used to access deployed bundle
 	Endpoints map[string]string
+
+	// Drifted is true if deployed component instance doesn't match its code params anymore (e.g. changed manually)
+	Drifted bool
+
+	// Drift is a human-readable description of the differences between deployed component instance and its code params
+	Drift string
+
+	// RolledBack is a human-readable description of the last failed update, after which deployed component instance
+	// has been rolled back to its previous revision by code plugin. It's empty if the last update hasn't been rolled back
+	RolledBack string
+
+	// RolledBackAt is when the last rollback happened. It's zero if the last update hasn't been rolled back
+	RolledBackAt time.Time
+
+	// RolledBackParams are the code params of the last update, which has been rolled back. Update with the same code
+	// params isn't attempted again until they change. It's nil if the last update hasn't been rolled back
+	RolledBackParams util.NestedParameterMap
+
+	// RetainedAt is when component instance lost its last claim, but was retained instead of being destroyed. It's zero if component instance has claims
+	RetainedAt time.Time
+
+	// PurgeRequested is true if domain admin requested retained component instance to be destroyed
+	PurgeRequested bool
+
+	// Color is a color of the active deployment, which gets switched on every update with blue/green update strategy.
+	// Empty color means that the deployment has never been updated that way
+	Color string
+
+	// InactiveDeployName is a name of the previous deployment, which is kept running after blue/green update until all
+	// dependents get switched over to the active one. It's empty if there is no such deployment
+	InactiveDeployName string
+
+	// InactiveCodeParams are code params of the previous deployment, which is kept running after blue/green update
+	InactiveCodeParams util.NestedParameterMap
+
+	// CodeDestroyed is true if running code has been destroyed by recreate update, but hasn't been created again yet
+	// (e.g. because creation failed). Such code gets created without being destroyed again
+	CodeDestroyed bool
+
+	// Adopted is true if component instance has been deployed outside of Aptomi and then adopted, i.e. it has been
+	// recorded in actual state without being deployed. Claims get attached to it instead of creating it again
+	Adopted bool
+
+	// AdoptedDeployName is a name of the adopted deployment, if it's different from the default deploy name
+	AdoptedDeployName string
 }
 
 // Creates a new component instance
@@ -104,6 +170,7 @@ func newComponentInstance(cik *ComponentInstanceKey) *ComponentInstance {
 		CalculatedDiscovery:  util.NestedParameterMap{},
 		CalculatedCodeParams: util.NestedParameterMap{},
 		EdgesOut:             make(map[string]bool),
+		PreviousKeys:         make(map[string]bool),
 		DataForPlugins:       make(map[string]string),
 		Endpoints:            make(map[string]string),
 	}
@@ -116,7 +183,27 @@ func (instance *ComponentInstance) GetKey() string {
 
 // GetDeployName returns a string that could be used as name for deployment inside the cluster
 func (instance *ComponentInstance) GetDeployName() string {
-	return instance.Metadata.Key.GetDeployName()
+	return instance.GetDeployNameForColor(instance.Color)
+}
+
+// GetDeployNameForColor returns a name for deployment inside the cluster with the given color (used by blue/green updates)
+func (instance *ComponentInstance) GetDeployNameForColor(color string) string {
+	deployName := instance.Metadata.Key.GetDeployName()
+	if len(instance.AdoptedDeployName) > 0 {
+		deployName = instance.AdoptedDeployName
+	}
+	if len(color) > 0 {
+		return deployName + "-" + color
+	}
+	return deployName
+}
+
+// GetNextColor returns the color of the deployment, which will become active after the next blue/green update
+func (instance *ComponentInstance) GetNextColor() string {
+	if instance.Color == ColorGreen {
+		return ColorBlue
+	}
+	return ColorGreen
 }
 
 // GetNamespace returns an object namespace. It's a system namespace for all component instances
@@ -148,14 +235,7 @@ func (instance *ComponentInstance) addCodeParams(codeParams util.NestedParameter
 		instance.CalculatedCodeParams = codeParams
 	} else if !instance.CalculatedCodeParams.DeepEqual(codeParams) {
 		// Same component instance, different code parameters
-		return errors.NewErrorWithDetails(
-			fmt.Sprintf("conflicting code parameters for component instance: %s", instance.GetKey()),
-			errors.Details{
-				"code_params_existing": instance.CalculatedCodeParams,
-				"code_params_new":      codeParams,
-				"diff":                 instance.CalculatedCodeParams.Diff(codeParams),
-			},
-		)
+		return newParamsConflict(instance, ParamsTypeCode, instance.CalculatedCodeParams, codeParams)
 	}
 	return nil
 }
@@ -166,14 +246,7 @@ func (instance *ComponentInstance) addDiscoveryParams(discoveryParams util.Neste
 		instance.CalculatedDiscovery = discoveryParams
 	} else if !instance.CalculatedDiscovery.DeepEqual(discoveryParams) {
 		// Same component instance, different discovery parameters
-		return errors.NewErrorWithDetails(
-			fmt.Sprintf("conflicting discovery parameters for component instance: %s", instance.GetKey()),
-			errors.Details{
-				"discovery_params_existing": instance.CalculatedDiscovery,
-				"discovery_params_new":      discoveryParams,
-				"diff":                      instance.CalculatedDiscovery.Diff(discoveryParams),
-			},
-		)
+		return newParamsConflict(instance, ParamsTypeDiscovery, instance.CalculatedDiscovery, discoveryParams)
 	}
 	return nil
 }
@@ -187,6 +260,64 @@ func (instance *ComponentInstance) addEdgeOut(dstKey string) {
 	instance.EdgesOut[dstKey] = true
 }
 
+func (instance *ComponentInstance) addPreviousKey(previousKey string) {
+	// component instance can't be moved into itself (e.g. previous identity only differs by the fields of other components)
+	if previousKey != instance.GetKey() {
+		instance.PreviousKeys[previousKey] = true
+	}
+}
+
+// IsRetained returns true if component instance has no claims left, but it was retained instead of being destroyed
+func (instance *ComponentInstance) IsRetained() bool {
+	return len(instance.ClaimKeys) <= 0 && !instance.RetainedAt.IsZero()
+}
+
+// IsAdopted returns true if component instance has been adopted, but no claims have been attached to it yet
+func (instance *ComponentInstance) IsAdopted() bool {
+	return len(instance.ClaimKeys) <= 0 && instance.Adopted
+}
+
+// MakeAdopted returns a copy of desired component instance, which can be recorded in actual state for a deployment
+// that exists in the cloud, but hasn't been created by Aptomi. Claims don't get copied, they will be attached later.
+// Code params only get copied if the deployment is known to match them, otherwise it will be updated right after adoption
+func (instance *ComponentInstance) MakeAdopted(deployName string, upToDate bool) *ComponentInstance {
+	result := newComponentInstance(instance.Metadata.Key)
+	result.IsCode = instance.IsCode
+	result.CalculatedLabels = lang.NewLabelSet(instance.CalculatedLabels.Labels)
+	result.CalculatedDiscovery = instance.CalculatedDiscovery.MakeCopy()
+	if upToDate {
+		result.CalculatedCodeParams = instance.CalculatedCodeParams.MakeCopy()
+	}
+	for k, v := range instance.DataForPlugins {
+		result.DataForPlugins[k] = v
+	}
+	result.UpdateStrategy = instance.UpdateStrategy
+	result.Retention = instance.Retention
+	result.Adopted = true
+	if deployName != instance.GetDeployName() {
+		result.AdoptedDeployName = deployName
+	}
+	return result
+}
+
+// IsRetentionExpired returns true if retained component instance has to be destroyed, i.e. purge has been requested
+// or grace period has expired
+func (instance *ComponentInstance) IsRetentionExpired(now time.Time) bool {
+	if !instance.IsRetained() {
+		return false
+	}
+	if instance.PurgeRequested {
+		return true
+	}
+
+	retained, gracePeriod, err := lang.ParseRetention(instance.Retention)
+	if err != nil || !retained {
+		// retention has been validated as a part of policy, so it can't be invalid
+		return true
+	}
+	return gracePeriod > 0 && now.After(instance.RetainedAt.Add(gracePeriod))
+}
+
 // UpdateTimes updates component creation and update times
 func (instance *ComponentInstance) UpdateTimes(createdAt time.Time, updatedAt time.Time) {
 	if time.Time.IsZero(instance.CreatedAt) || (!time.Time.IsZero(createdAt) && createdAt.Before(instance.CreatedAt)) {
@@ -200,6 +331,9 @@ func (instance *ComponentInstance) UpdateTimes(createdAt time.Time, updatedAt ti
 // appendData gets called to append data for two existing component instances, both of which have been already processed
 // and populated with data
 func (instance *ComponentInstance) appendData(ops *ComponentInstance) {
+	// Check for conflicting params before combining claims and labels, so both sides of the conflict can be reported
+	conflict := instance.findParamsConflict(ops)
+
 	// Combine claims which are keeping this component instantiated
 	for claimKey, depth := range ops.ClaimKeys {
 		instance.addClaim(claimKey, depth)
@@ -212,6 +346,12 @@ func (instance *ComponentInstance) appendData(ops *ComponentInstance) {
 	}
 	instance.IsCode = instance.IsCode || ops.IsCode
 
+	// Same component instance, different code or discovery parameters
+	if conflict != nil {
+		instance.Error = conflict
+		return
+	}
+
 	// Combine labels
 	instance.addLabels(ops.CalculatedLabels)
 
@@ -234,6 +374,26 @@ func (instance *ComponentInstance) appendData(ops *ComponentInstance) {
 		instance.addEdgeOut(keyDst)
 	}
 
+	// Previous keys
+	for previousKey := range ops.PreviousKeys {
+		instance.addPreviousKey(previousKey)
+	}
+
+	// Update strategy
+	if len(instance.UpdateStrategy) <= 0 {
+		instance.UpdateStrategy = ops.UpdateStrategy
+	}
+
+	// Retention
+	if len(instance.Retention) <= 0 {
+		instance.Retention = ops.Retention
+	}
+
+	// Name of the deployment dependents have been resolved against
+	if len(instance.ResolvedDeployName) <= 0 {
+		instance.ResolvedDeployName = ops.ResolvedDeployName
+	}
+
 	// Data for plugins
 	for k, v := range ops.DataForPlugins {
 		instance.DataForPlugins[k] = v
@@ -121,8 +121,18 @@ func (cik ComponentInstanceKey) GetKey() string {
 	return cik.key
 }
 
+const (
+	// deployNamePrefix is a prefix of all deploy names generated by Aptomi
+	deployNamePrefix = "a-"
+
+	// deployNameHashLength is a length of component instance key hash in deploy name
+	deployNameHashLength = 13
+
+	base32LowerCaseHexAlphabet = "0123456789abcdefghijklmnopqrstuv"
+)
+
 var (
-	base32LowerCaseHexEncoding = base32.NewEncoding("0123456789abcdefghijklmnopqrstuv")
+	base32LowerCaseHexEncoding = base32.NewEncoding(base32LowerCaseHexAlphabet)
 )
 
 // GetDeployName returns a string that could be used as name for deployment inside the cluster
@@ -132,9 +142,29 @@ func (cik ComponentInstanceKey) GetDeployName() string {
 	if err != nil {
 		panic(err)
 	}
-	keyHash := base32LowerCaseHexEncoding.EncodeToString(h.Sum(nil))[0:13]
+	keyHash := base32LowerCaseHexEncoding.EncodeToString(h.Sum(nil))[0:deployNameHashLength]
 
-	return "a-" + keyHash
+	return deployNamePrefix + keyHash
+}
+
+// IsDeployName returns true if the given string looks like a name of deployment generated by Aptomi (with or without
+// a color suffix). It's used to identify deployments in the cluster, which have been created by Aptomi
+func IsDeployName(name string) bool {
+	for _, color := range []string{ColorGreen, ColorBlue} {
+		if strings.HasSuffix(name, "-"+color) {
+			name = strings.TrimSuffix(name, "-"+color)
+			break
+		}
+	}
+	if !strings.HasPrefix(name, deployNamePrefix) || len(name) != len(deployNamePrefix)+deployNameHashLength {
+		return false
+	}
+	for _, c := range strings.TrimPrefix(name, deployNamePrefix) {
+		if !strings.ContainsRune(base32LowerCaseHexAlphabet, c) {
+			return false
+		}
+	}
+	return true
 }
 
 // If cluster has not been resolved yet and we need a key, generate one
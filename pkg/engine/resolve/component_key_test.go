@@ -53,6 +53,17 @@ func TestComponentKeyUnsafe(t *testing.T) {
 	}
 }
 
+func TestComponentKeyDeployName(t *testing.T) {
+	deployName := makeKey(false).GetDeployName()
+	assert.True(t, IsDeployName(deployName), "Generated deploy name should be recognized: %s", deployName)
+	assert.True(t, IsDeployName(deployName+"-"+ColorGreen), "Generated deploy name with color should be recognized: %s", deployName)
+	assert.True(t, IsDeployName(deployName+"-"+ColorBlue), "Generated deploy name with color should be recognized: %s", deployName)
+
+	for _, name := range []string{"", "a-", "wordpress", "a-short", deployName + "x", deployName + "-red", "b-" + strings.TrimPrefix(deployName, "a-"), "a-ABCDEFGHIJKLM"} {
+		assert.False(t, IsDeployName(name), "Deploy name should not be recognized: %s", name)
+	}
+}
+
 func makeKey(root bool) *ComponentInstanceKey {
 	b := builder.NewPolicyBuilder()
 	bundle := b.AddBundle()
@@ -0,0 +1,132 @@
+package resolve
+
+import (
+	"sort"
+	"strings"
+)
+
+// AllowIngressFrom is a special key, which is used in DataForPlugins to record the list of component instances
+// allowed to send ingress traffic to a given component instance when ingress traffic is not allowed for it. It's a
+// sorted comma-separated list of "<target suffix>/<deploy name>" entries
+const AllowIngressFrom = "allow_ingress_from"
+
+// IsIngressAllowed returns true if ingress traffic is allowed for a given component instance. Instances, which have
+// no such data recorded (e.g. deployed by earlier versions), allow ingress traffic
+func (instance *ComponentInstance) IsIngressAllowed() bool {
+	return instance.DataForPlugins[AllowIngres] != "false"
+}
+
+// LabelPods is a special key, which is used in DataForPlugins to record that pods of a given component instance are
+// selected by network policies (either its own one or the ones of the component instances it sends ingress traffic
+// to), so they have to be labelled. It's "true" if pods have to be labelled and not set otherwise
+const LabelPods = "label_pods"
+
+// IngressIndex represents ingress settings of all code component instances of the policy resolution, for which
+// ingress traffic is restricted. It's built once for the whole policy resolution (see GetIngressIndex)
+type IngressIndex struct {
+	// allowFrom is a map from component instance key to the list of component instances allowed to send ingress
+	// traffic to it (in AllowIngressFrom format)
+	allowFrom map[string]string
+
+	// labelPods is a set of keys of component instances, which pods have to be labelled
+	labelPods map[string]bool
+}
+
+// GetIngressIndex returns ingress settings of all component instances, for which ingress traffic is not allowed. Code
+// components in the same cluster, which depend on such component instance through the resolution graph (including
+// other code components of the same bundle instance), are allowed to send ingress traffic to it
+func (resolution *PolicyResolution) GetIngressIndex() *IngressIndex {
+	index := &IngressIndex{
+		allowFrom: make(map[string]string),
+		labelPods: make(map[string]bool),
+	}
+
+	// reverse graph edges are only collected once and used for all component instances
+	var edgesIn map[string][]string
+	for key, instance := range resolution.ComponentInstanceMap {
+		if !instance.IsCode || instance.IsIngressAllowed() {
+			continue
+		}
+		if edgesIn == nil {
+			edgesIn = resolution.getEdgesIn()
+		}
+
+		peers := resolution.getIngressPeers(key, edgesIn)
+		allowFrom := make([]string, 0, len(peers))
+		for _, peer := range peers {
+			peerKey := resolution.ComponentInstanceMap[peer].Metadata.Key
+			allowFrom = append(allowFrom, peerKey.TargetSuffix+"/"+peerKey.GetDeployName())
+			index.labelPods[peer] = true
+		}
+		sort.Strings(allowFrom)
+
+		index.allowFrom[key] = strings.Join(allowFrom, ",")
+		index.labelPods[key] = true
+	}
+
+	return index
+}
+
+// GetAllowIngressFrom returns the list of code component instances (in AllowIngressFrom format), which are allowed to
+// send ingress traffic to the component instance with the given key, if ingress traffic is not allowed for it
+func (index *IngressIndex) GetAllowIngressFrom(key string) string {
+	return index.allowFrom[key]
+}
+
+// IsLabelPods returns true if pods of the component instance with the given key have to be labelled, so network
+// policies could select them
+func (index *IngressIndex) IsLabelPods(key string) bool {
+	return index.labelPods[key]
+}
+
+// getEdgesIn returns a map from component instance key to the keys of component instances with edges to it
+func (resolution *PolicyResolution) getEdgesIn() map[string][]string {
+	edgesIn := make(map[string][]string)
+	for src, srcInstance := range resolution.ComponentInstanceMap {
+		for dst := range srcInstance.EdgesOut {
+			edgesIn[dst] = append(edgesIn[dst], src)
+		}
+	}
+	return edgesIn
+}
+
+// getIngressPeers returns keys of code component instances in the same cluster, which depend on the component instance
+// with the given key through the resolution graph
+func (resolution *PolicyResolution) getIngressPeers(key string, edgesIn map[string][]string) []string {
+	instance := resolution.ComponentInstanceMap[key]
+
+	// walk graph edges backwards, stopping at code components. code components of every bundle instance on the way
+	// are dependents as well, as they consume the component through service references of that bundle
+	queue := append([]string{}, edgesIn[key]...)
+	visited := map[string]bool{key: true}
+	peers := []string{}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+
+		peer, found := resolution.ComponentInstanceMap[current]
+		if !found {
+			continue
+		}
+		if !peer.IsCode {
+			queue = append(queue, edgesIn[current]...)
+			if peer.Metadata.Key.IsBundle() {
+				for childKey := range peer.EdgesOut {
+					queue = append(queue, childKey)
+				}
+			}
+			continue
+		}
+
+		peerKey := peer.Metadata.Key
+		if peerKey.ClusterNameSpace == instance.Metadata.Key.ClusterNameSpace && peerKey.ClusterName == instance.Metadata.Key.ClusterName {
+			peers = append(peers, current)
+		}
+	}
+
+	return peers
+}
@@ -0,0 +1,81 @@
+package resolve
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetIngressIndex(t *testing.T) {
+	resolution := NewPolicyResolution()
+	key := func(cluster, service, component string) *ComponentInstanceKey {
+		return &ComponentInstanceKey{
+			ClusterNameSpace:    "system",
+			ClusterName:         cluster,
+			TargetSuffix:        "main",
+			Namespace:           "main",
+			ServiceName:         service,
+			ContextNameWithKeys: "prod",
+			ComponentName:       component,
+		}
+	}
+	code := func(cik *ComponentInstanceKey) {
+		resolution.GetComponentInstanceEntry(cik).IsCode = true
+	}
+
+	// db bundle with two code components, consumed by web app component through the web bundle
+	db := key("k8s", "db", componentRootName)
+	dbMaster := key("k8s", "db", "master")
+	dbReplica := key("k8s", "db", "replica")
+	web := key("k8s", "web", componentRootName)
+	webApp := key("k8s", "web", "app")
+	webDB := key("k8s", "web", "db")
+	remote := key("k8s-remote", "remote", componentRootName)
+	remoteApp := key("k8s-remote", "remote", "app")
+	remoteWeb := key("k8s-remote", "remote", "web")
+	unrelated := key("k8s", "unrelated", "app")
+
+	for _, cik := range []*ComponentInstanceKey{dbMaster, dbReplica, webApp, remoteApp, unrelated} {
+		code(cik)
+	}
+	resolution.GetComponentInstanceEntry(dbMaster).DataForPlugins[AllowIngres] = "false"
+	resolution.StoreEdge(db, dbMaster)
+	resolution.StoreEdge(db, dbReplica)
+	resolution.StoreEdge(web, webApp)
+	resolution.StoreEdge(web, webDB)
+	resolution.StoreEdge(webDB, db)
+	resolution.StoreEdge(remote, remoteApp)
+	resolution.StoreEdge(remote, remoteWeb)
+	resolution.StoreEdge(remoteWeb, web)
+
+	peer := func(cik *ComponentInstanceKey) string {
+		return cik.TargetSuffix + "/" + cik.GetDeployName()
+	}
+
+	index := resolution.GetIngressIndex()
+	peers := index.GetAllowIngressFrom(dbMaster.GetKey())
+	expected := []string{peer(dbReplica), peer(webApp)}
+	if expected[0] > expected[1] {
+		expected[0], expected[1] = expected[1], expected[0]
+	}
+	if !assert.Equal(t, expected[0]+","+expected[1], peers, "Sibling and dependent code components from the same cluster should be allowed") {
+		t.FailNow()
+	}
+
+	assert.Equal(t, "", index.GetAllowIngressFrom(webApp.GetKey()), "Component with allowed ingress traffic should not have the list")
+	assert.Equal(t, "", index.GetAllowIngressFrom("unknown"), "Unknown component should not allow anyone")
+
+	// pods of the component itself and of its peers are selected by network policy
+	for _, cik := range []*ComponentInstanceKey{dbMaster, dbReplica, webApp} {
+		assert.True(t, index.IsLabelPods(cik.GetKey()), "Pods of %s should be labelled", cik.GetKey())
+	}
+	for _, cik := range []*ComponentInstanceKey{remoteApp, unrelated} {
+		assert.False(t, index.IsLabelPods(cik.GetKey()), "Pods of %s should not be labelled", cik.GetKey())
+	}
+
+	// the list of peers doesn't include components from other clusters
+	resolution.GetComponentInstanceEntry(webApp).DataForPlugins[AllowIngres] = "false"
+	index = resolution.GetIngressIndex()
+	assert.Equal(t, "", index.GetAllowIngressFrom(webApp.GetKey()), "Components from other clusters should not be allowed")
+	assert.False(t, index.IsLabelPods(remoteApp.GetKey()), "Pods of components from other clusters should not be labelled")
+}
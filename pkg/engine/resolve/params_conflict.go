@@ -0,0 +1,141 @@
+package resolve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+const (
+	// ParamsTypeCode is used for conflicts in code params of a component instance
+	ParamsTypeCode = "code"
+
+	// ParamsTypeDiscovery is used for conflicts in discovery params of a component instance
+	ParamsTypeDiscovery = "discovery"
+)
+
+// ParamsConflict is an error which occurs when claims resolve to the same component instance, but calculate different
+// code or discovery params for it. It lists conflicting claims on both sides, differing params and the labels which
+// caused the difference
+type ParamsConflict struct {
+	// ComponentKey is a key of the component instance with conflicting params
+	ComponentKey string
+
+	// ParamsType is a type of conflicting params (ParamsTypeCode or ParamsTypeDiscovery)
+	ParamsType string
+
+	// ClaimKeys is a list of claims, which have calculated the existing params of the component instance
+	ClaimKeys []string
+
+	// ConflictingClaimKeys is a list of claims, which have calculated different params for the component instance
+	ConflictingClaimKeys []string
+
+	// Params is a list of differing params. OldValue is what has been calculated by ClaimKeys, while Value is what
+	// has been calculated by ConflictingClaimKeys. Secret-looking values are masked
+	Params []*util.ParameterChange
+
+	// Labels is a list of labels, which differ between the two sides and therefore caused the difference in params
+	Labels []*util.ParameterChange
+}
+
+// newParamsConflict creates a new ParamsConflict for the component instance, which only lists differing params.
+// Conflicting claims and labels are filled in by the caller, if they are known
+func newParamsConflict(instance *ComponentInstance, paramsType string, existing util.NestedParameterMap, conflicting util.NestedParameterMap) *ParamsConflict {
+	return &ParamsConflict{
+		ComponentKey:         instance.GetKey(),
+		ParamsType:           paramsType,
+		ClaimKeys:            []string{},
+		ConflictingClaimKeys: []string{},
+		Params:               existing.Changes(conflicting, ""),
+		Labels:               []*util.ParameterChange{},
+	}
+}
+
+// Error returns conflict summary, which includes all conflicting claims, params and labels
+func (conflict *ParamsConflict) Error() string {
+	result := fmt.Sprintf("conflicting %s parameters for component instance: %s", conflict.ParamsType, conflict.ComponentKey)
+	if len(conflict.ClaimKeys) > 0 || len(conflict.ConflictingClaimKeys) > 0 {
+		result += fmt.Sprintf(" (claims [%s] vs. [%s])", strings.Join(conflict.ClaimKeys, ", "), strings.Join(conflict.ConflictingClaimKeys, ", "))
+	}
+	if len(conflict.Params) > 0 {
+		result += fmt.Sprintf(", params: %s", changesAsString(conflict.Params))
+	}
+	if len(conflict.Labels) > 0 {
+		result += fmt.Sprintf(", labels: %s", changesAsString(conflict.Labels))
+	}
+	return result
+}
+
+// Describe returns human-readable description of the conflict, one line per conflicting claim group, param and label
+func (conflict *ParamsConflict) Describe() []string {
+	result := []string{
+		fmt.Sprintf("conflicting %s parameters for component instance: %s", conflict.ParamsType, conflict.ComponentKey),
+	}
+	if len(conflict.ClaimKeys) > 0 {
+		result = append(result, fmt.Sprintf("  claims with existing params: %s", strings.Join(conflict.ClaimKeys, ", ")))
+	}
+	if len(conflict.ConflictingClaimKeys) > 0 {
+		result = append(result, fmt.Sprintf("  claims with conflicting params: %s", strings.Join(conflict.ConflictingClaimKeys, ", ")))
+	}
+	for _, change := range conflict.Params {
+		result = append(result, fmt.Sprintf("  param %s", change))
+	}
+	for _, change := range conflict.Labels {
+		result = append(result, fmt.Sprintf("  label %s", change))
+	}
+	return result
+}
+
+func changesAsString(changes []*util.ParameterChange) string {
+	result := []string{}
+	for _, change := range changes {
+		result = append(result, change.String())
+	}
+	return strings.Join(result, "; ")
+}
+
+// findParamsConflict checks whether data of another component instance can be appended to the given one without
+// conflicts. If params conflict, it returns ParamsConflict listing claims and labels on both sides
+func (instance *ComponentInstance) findParamsConflict(ops *ComponentInstance) *ParamsConflict {
+	var conflict *ParamsConflict
+	if len(instance.CalculatedDiscovery) > 0 && !instance.CalculatedDiscovery.DeepEqual(ops.CalculatedDiscovery) {
+		conflict = newParamsConflict(instance, ParamsTypeDiscovery, instance.CalculatedDiscovery, ops.CalculatedDiscovery)
+	} else if len(instance.CalculatedCodeParams) > 0 && !instance.CalculatedCodeParams.DeepEqual(ops.CalculatedCodeParams) {
+		conflict = newParamsConflict(instance, ParamsTypeCode, instance.CalculatedCodeParams, ops.CalculatedCodeParams)
+	} else {
+		return nil
+	}
+
+	conflict.ClaimKeys = sortedClaimKeys(instance.ClaimKeys)
+	conflict.ConflictingClaimKeys = sortedClaimKeys(ops.ClaimKeys)
+	conflict.Labels = util.LabelChanges(instance.CalculatedLabels.Labels, ops.CalculatedLabels.Labels, "")
+	return conflict
+}
+
+func sortedClaimKeys(claimKeys map[string]int) []string {
+	result := []string{}
+	for claimKey := range claimKeys {
+		result = append(result, claimKey)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// findParamsConflicts returns the list of conflicts, which would occur if the given resolution data was appended to
+// the current PolicyResolution
+func (resolution *PolicyResolution) findParamsConflicts(ops *PolicyResolution) []*ParamsConflict {
+	result := []*ParamsConflict{}
+	for key, instance := range ops.ComponentInstanceMap {
+		if existing, ok := resolution.ComponentInstanceMap[key]; ok {
+			if conflict := existing.findParamsConflict(instance); conflict != nil {
+				result = append(result, conflict)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ComponentKey < result[j].ComponentKey
+	})
+	return result
+}
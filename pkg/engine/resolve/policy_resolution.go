@@ -2,6 +2,7 @@ package resolve
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
@@ -14,6 +15,28 @@ import (
 type PolicyResolution struct {
 	// Resolved component instances: componentKey -> componentInstance
 	ComponentInstanceMap map[string]*ComponentInstance
+
+	// Params conflicts of claims, which have failed to resolve because of them: claimKey -> conflicts. It's only
+	// populated when resolver fails conflicting claims instead of the whole component instances
+	ClaimConflicts map[string][]*ParamsConflict
+
+	// Existing deployments, which have to be adopted instead of being created: componentKey -> adoption. It's only
+	// populated in desired state of revisions, which have been created to adopt existing deployments
+	Adoptions map[string]*Adoption
+
+	// Fingerprints of external data (labels and secrets) of users of all claims, which resolution has been calculated
+	// against: userName -> fingerprint. It's used by incremental resolution to find users changed since then
+	UserData map[string]string
+}
+
+// Adoption describes an existing deployment, which hasn't been created by Aptomi, but has to be adopted by a
+// component instance
+type Adoption struct {
+	// DeployName is a name of the existing deployment
+	DeployName string
+
+	// UpToDate is true if the existing deployment is known to match code params of the component instance
+	UpToDate bool
 }
 
 // NewPolicyResolution creates new empty PolicyResolution, given a flag indicating whether it's a
@@ -21,6 +44,9 @@ type PolicyResolution struct {
 func NewPolicyResolution() *PolicyResolution {
 	return &PolicyResolution{
 		ComponentInstanceMap: make(map[string]*ComponentInstance),
+		ClaimConflicts:       make(map[string][]*ParamsConflict),
+		Adoptions:            make(map[string]*Adoption),
+		UserData:             make(map[string]string),
 	}
 }
 
@@ -40,6 +66,14 @@ func (resolution *PolicyResolution) RecordResolved(cik *ComponentInstanceKey, cl
 	instance.addRuleInformation(ruleResult)
 }
 
+// RecordAdoption stores an existing deployment, which has to be adopted by component instance instead of being created
+func (resolution *PolicyResolution) RecordAdoption(key string, deployName string, upToDate bool) {
+	if resolution.Adoptions == nil {
+		resolution.Adoptions = make(map[string]*Adoption)
+	}
+	resolution.Adoptions[key] = &Adoption{DeployName: deployName, UpToDate: upToDate}
+}
+
 // RecordCodeParams stores calculated code params for component instance
 func (resolution *PolicyResolution) RecordCodeParams(cik *ComponentInstanceKey, codeParams util.NestedParameterMap) error {
 	instance := resolution.GetComponentInstanceEntry(cik)
@@ -47,6 +81,21 @@ func (resolution *PolicyResolution) RecordCodeParams(cik *ComponentInstanceKey,
 	return instance.addCodeParams(codeParams)
 }
 
+// RecordUpdateStrategy stores update strategy for component instance
+func (resolution *PolicyResolution) RecordUpdateStrategy(cik *ComponentInstanceKey, updateStrategy string) {
+	resolution.GetComponentInstanceEntry(cik).UpdateStrategy = updateStrategy
+}
+
+// RecordDeployName stores the name of the deployment of component instance, which dependents have been resolved against
+func (resolution *PolicyResolution) RecordDeployName(cik *ComponentInstanceKey, deployName string) {
+	resolution.GetComponentInstanceEntry(cik).ResolvedDeployName = deployName
+}
+
+// RecordRetention stores retention for component instance
+func (resolution *PolicyResolution) RecordRetention(cik *ComponentInstanceKey, retention string) {
+	resolution.GetComponentInstanceEntry(cik).Retention = retention
+}
+
 // RecordDiscoveryParams stores calculated discovery params for component instance
 func (resolution *PolicyResolution) RecordDiscoveryParams(cik *ComponentInstanceKey, discoveryParams util.NestedParameterMap) error {
 	return resolution.GetComponentInstanceEntry(cik).addDiscoveryParams(discoveryParams)
@@ -57,6 +106,12 @@ func (resolution *PolicyResolution) RecordLabels(cik *ComponentInstanceKey, labe
 	resolution.GetComponentInstanceEntry(cik).addLabels(labels)
 }
 
+// RecordPreviousKey stores a previous key for component instance, so that existing component instance with that key
+// can be moved over instead of being re-created
+func (resolution *PolicyResolution) RecordPreviousKey(cik *ComponentInstanceKey, previous *ComponentInstanceKey) {
+	resolution.GetComponentInstanceEntry(cik).addPreviousKey(previous.GetKey())
+}
+
 // StoreEdge stores incoming/outgoing graph edges for component instance for observability and reporting
 func (resolution *PolicyResolution) StoreEdge(src *ComponentInstanceKey, dst *ComponentInstanceKey) {
 	// Arrival key can be empty at the very top of the recursive function in engine, so let's check for that
@@ -85,6 +140,7 @@ func (resolution *PolicyResolution) GetClaimResolution(claim *lang.Claim) *Claim
 
 	var dError error
 	var dComponentKey string
+	dConflicts := append([]*ParamsConflict{}, resolution.ClaimConflicts[claimKey]...)
 	for _, instance := range resolution.ComponentInstanceMap {
 		if depth, found := instance.ClaimKeys[claimKey]; found {
 			// see if claim components have errors
@@ -92,6 +148,11 @@ func (resolution *PolicyResolution) GetClaimResolution(claim *lang.Claim) *Claim
 				dError = instance.Error
 			}
 
+			// collect params conflicts of claim components
+			if conflict, isConflict := instance.Error.(*ParamsConflict); isConflict {
+				dConflicts = append(dConflicts, conflict)
+			}
+
 			// if it's a bundle at depth 0, we have found the bundle instance to which our claim resolved
 			if depth == 0 && instance.Metadata.Key.IsBundle() {
 				dComponentKey = instance.Metadata.Key.GetKey()
@@ -99,7 +160,7 @@ func (resolution *PolicyResolution) GetClaimResolution(claim *lang.Claim) *Claim
 		}
 	}
 
-	return newClaimResolution(dError == nil && len(dComponentKey) > 0, dComponentKey)
+	return newClaimResolution(dError == nil && len(dComponentKey) > 0, dComponentKey, dConflicts)
 }
 
 // Validate checks that the state is valid, meaning that all objects references are valid and all components are valid
@@ -165,3 +226,66 @@ func (resolution *PolicyResolution) Validate(policy *lang.Policy) error {
 
 	return nil
 }
+
+// GetMoves returns a map of component instances ('key' -> 'previous key'), which have to be moved over from their
+// previous keys when going from prev to the current policy resolution. It happens when a component instance with a new
+// key has a previous key, which exists in prev and doesn't exist in the current resolution anymore. Every previous
+// instance can only be moved once
+func (resolution *PolicyResolution) GetMoves(prev *PolicyResolution) map[string]string {
+	result := make(map[string]string)
+	taken := make(map[string]bool)
+
+	// go over keys in sorted order, so that the result is deterministic
+	keys := []string{}
+	for key := range resolution.ComponentInstanceMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		nextInstance := resolution.ComponentInstanceMap[key]
+		if len(nextInstance.ClaimKeys) <= 0 || hasClaims(prev, key) || isRetained(prev, key) || isAdopted(prev, key) {
+			continue
+		}
+
+		prevKeys := []string{}
+		for prevKey := range nextInstance.PreviousKeys {
+			prevKeys = append(prevKeys, prevKey)
+		}
+		sort.Strings(prevKeys)
+
+		for _, prevKey := range prevKeys {
+			if !taken[prevKey] && hasClaims(prev, prevKey) && !hasClaims(resolution, prevKey) && isMovable(prev.ComponentInstanceMap[prevKey], nextInstance) {
+				result[key] = prevKey
+				taken[prevKey] = true
+				break
+			}
+		}
+	}
+	return result
+}
+
+// isMovable returns true if the running code of the previous component instance can be moved over to the next one.
+// Code can't be moved across clusters or target suffixes (e.g. k8s namespaces), so such instances are re-created
+func isMovable(prevInstance *ComponentInstance, nextInstance *ComponentInstance) bool {
+	prevKey, key := prevInstance.Metadata.Key, nextInstance.Metadata.Key
+	return prevKey.ClusterNameSpace == key.ClusterNameSpace && prevKey.ClusterName == key.ClusterName && prevKey.TargetSuffix == key.TargetSuffix
+}
+
+// isRetained returns true if component instance exists in the given policy resolution and has been retained without claims
+func isRetained(resolution *PolicyResolution, key string) bool {
+	instance := resolution.ComponentInstanceMap[key]
+	return instance != nil && instance.IsRetained()
+}
+
+// isAdopted returns true if component instance exists in the given policy resolution and has been adopted without claims
+func isAdopted(resolution *PolicyResolution, key string) bool {
+	instance := resolution.ComponentInstanceMap[key]
+	return instance != nil && instance.IsAdopted()
+}
+
+// hasClaims returns true if component instance exists in the given policy resolution and has claims attached
+func hasClaims(resolution *PolicyResolution, key string) bool {
+	instance := resolution.ComponentInstanceMap[key]
+	return instance != nil && len(instance.ClaimKeys) > 0
+}
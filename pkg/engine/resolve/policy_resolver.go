@@ -11,6 +11,7 @@ import (
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/lang/expression"
 	"github.com/Aptomi/aptomi/pkg/lang/template"
+	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/util"
 )
 
@@ -32,6 +33,19 @@ type PolicyResolver struct {
 	// External data
 	externalData *external.Data
 
+	/*
+		Options
+	*/
+
+	// Whether to fail only claims with conflicting params instead of the whole component instances
+	failConflictingClaims bool
+
+	// Actual state, which tells under which names running code instances are deployed
+	actualState *PolicyResolution
+
+	// Names of existing deployments, which are going to be taken over by code instances ('key' -> deployName)
+	deployNames map[string]string
+
 	/*
 		Cache
 	*/
@@ -82,12 +96,115 @@ func NewPolicyResolver(policy *lang.Policy, externalData *external.Data, eventLo
 //
 // As a result, status of every claim will be stored in resolution state.
 func (resolver *PolicyResolver) ResolveAllClaims() *PolicyResolution {
+	claims := []*lang.Claim{}
+	for _, claim := range resolver.policy.GetObjectsByKind(lang.TypeClaim.Kind) {
+		claims = append(claims, claim.(*lang.Claim)) // nolint: errcheck
+	}
+
+	// Resolve every declared claim
+	resolver.resolveAndCombineClaims(claims)
+
+	// Record external data of users, so incremental resolution could find out which users get changed later on
+	resolver.resolution.UserData = resolver.getUserData()
+
+	// Once all components are resolved, print information about them into event log
+	resolver.logAllComponentParams()
+
+	return resolver.resolution
+}
+
+// FailConflictingClaims sets whether resolver should fail only the claims, which calculate params conflicting with the
+// ones calculated by other claims, instead of marking the whole component instance as failed. Claims get combined in
+// the order of their keys in this mode, so it's always the same claims that fail regardless of resolution order
+func (resolver *PolicyResolver) FailConflictingClaims(fail bool) *PolicyResolver {
+	resolver.failConflictingClaims = fail
+	return resolver
+}
+
+// ActualState sets actual state, which resolver uses to find out under which names code instances are deployed (e.g.
+// active color of blue/green deployments), so that dependents discover the deployments which are actually running
+func (resolver *PolicyResolver) ActualState(actualState *PolicyResolution) *PolicyResolver {
+	resolver.actualState = actualState
+	return resolver
+}
+
+// DeployNames sets names of existing deployments, which are going to be taken over by code instances instead of the
+// ones recorded in actual state (e.g. adopted deployments, or deployments moved over from previous keys by adoption),
+// so that dependents discover the deployments which are going to be running
+func (resolver *PolicyResolver) DeployNames(deployNames map[string]string) *PolicyResolver {
+	resolver.deployNames = deployNames
+	return resolver
+}
+
+// getDeployName returns the name of the deployment of code instance, which is going to be active once desired state
+// gets applied. Running code may be deployed under a different name than the one derived from the key (e.g. after
+// blue/green updates), so it's taken from actual state. When blue/green update is going to happen (i.e. code params
+// change), it's the deployment of the next color, as dependents get updated after the switch
+func (resolver *PolicyResolver) getDeployName(cik *ComponentInstanceKey, updateStrategy string, codeParams func() (util.NestedParameterMap, error)) (string, error) {
+	if deployName, found := resolver.deployNames[cik.GetKey()]; found {
+		return deployName, nil
+	}
+	if resolver.actualState == nil {
+		return cik.GetDeployName(), nil
+	}
+
+	current := resolver.actualState.ComponentInstanceMap[cik.GetKey()]
+	if current == nil {
+		return cik.GetDeployName(), nil
+	}
+	if updateStrategy != lang.UpdateStrategyBlueGreen {
+		return current.GetDeployName(), nil
+	}
+
+	params, err := codeParams()
+	if err != nil {
+		return "", err
+	}
+	if !params.DeepEqual(current.CalculatedCodeParams) {
+		return current.GetDeployNameForColor(current.GetNextColor()), nil
+	}
+	return current.GetDeployName(), nil
+}
+
+// Resolves given claims and combines their data into the overall state of the world
+func (resolver *PolicyResolver) resolveAndCombineClaims(claims []*lang.Claim) {
+	if !resolver.failConflictingClaims {
+		resolver.resolveClaims(claims, func(claim *lang.Claim, node *resolutionNode, resolveErr error) {
+			resolver.combineData(node, resolveErr)
+		})
+		return
+	}
+
+	// conflicting claims are failed in the order of claim keys, so all claims need to be resolved first
+	results := make(map[string]*claimResult)
+	resultsMutex := sync.Mutex{}
+	resolver.resolveClaims(claims, func(claim *lang.Claim, node *resolutionNode, resolveErr error) {
+		resultsMutex.Lock()
+		defer resultsMutex.Unlock()
+		results[runtime.KeyForStorable(claim)] = &claimResult{node: node, resolveErr: resolveErr}
+	})
+	resolver.combineClaimResults(results)
+}
+
+// Result of resolving a single claim
+type claimResult struct {
+	node       *resolutionNode
+	resolveErr error
+}
+
+// Combines results of resolved claims in the order of claim keys
+func (resolver *PolicyResolver) combineClaimResults(results map[string]*claimResult) {
+	for _, claimKey := range util.GetSortedStringKeys(results) {
+		resolver.combineData(results[claimKey].node, results[claimKey].resolveErr)
+	}
+}
+
+// Resolves given claims concurrently and calls the provided function for every claim once it's resolved
+func (resolver *PolicyResolver) resolveClaims(claims []*lang.Claim, resolved func(claim *lang.Claim, node *resolutionNode, resolveErr error)) {
 	// Allocate semaphore, making sure we don't run more than MaxConcurrentGoRoutines go routines at the same time
 	var semaphore = make(chan int, MaxConcurrentGoRoutines)
 	var wg sync.WaitGroup
-	claims := resolver.policy.GetObjectsByKind(lang.TypeClaim.Kind)
 
-	// Resolve every declared claim
 	for _, claim := range claims {
 		// Start go routine for resolving a given claim
 		wg.Add(1)
@@ -95,22 +212,22 @@ func (resolver *PolicyResolver) ResolveAllClaims() *PolicyResolution {
 		go func(c *lang.Claim) {
 			defer wg.Done()
 			node, resolveErr := resolver.resolveClaim(c)
-			resolver.combineData(node, resolveErr)
+			resolved(c, node, resolveErr)
 			<-semaphore
-		}(claim.(*lang.Claim))
+		}(claim)
 	}
 
 	// Wait for all go routines to end
 	wg.Wait()
+}
 
-	// Once all components are resolved, print information about them into event log
+// Prints information about all resolved components into event log
+func (resolver *PolicyResolver) logAllComponentParams() {
 	for _, instance := range resolver.resolution.ComponentInstanceMap {
 		if instance.Metadata.Key.IsComponent() {
 			resolver.logComponentParams(instance)
 		}
 	}
-
-	return resolver.resolution
 }
 
 // Resolves a single claim and returns an error if it cannot be resolved
@@ -151,6 +268,16 @@ func (resolver *PolicyResolver) combineData(node *resolutionNode, resolutionErr
 
 	// if there was no resolution error, combine component data
 	if resolutionErr == nil {
+		// fail the claim if its params conflict with the ones calculated by other claims, if we were asked to do so
+		if resolver.failConflictingClaims {
+			conflicts := resolver.resolution.findParamsConflicts(node.resolution)
+			if len(conflicts) > 0 {
+				resolver.resolution.ClaimConflicts[runtime.KeyForStorable(node.claim)] = conflicts
+				node.logClaimParamsConflicts(conflicts)
+				return
+			}
+		}
+
 		// aggregate component instance data
 		resolver.resolution.AppendData(node.resolution)
 	}
@@ -243,6 +370,15 @@ func (resolver *PolicyResolver) resolveNode(node *resolutionNode) (resolveErr er
 	// Store labels for bundle
 	node.resolution.RecordLabels(node.bundleKey, node.labels)
 
+	// Store retention for bundle
+	node.resolution.RecordRetention(node.bundleKey, node.bundle.Retention)
+
+	// Store previous keys for bundle, so it can be moved over instead of being re-created
+	err = node.recordPreviousKeys(node.bundleKey, nil)
+	if err != nil {
+		return err
+	}
+
 	// Store edge (last component instance -> bundle instance)
 	node.resolution.StoreEdge(node.arrivalKey, node.bundleKey)
 
@@ -254,6 +390,7 @@ func (resolver *PolicyResolver) resolveNode(node *resolutionNode) (resolveErr er
 
 	// Iterate over all bundle components and resolve them recursively
 	// Note that discovery variables can refer to other variables announced by dependents in the discovery tree
+	componentKeys := make(map[string]*ComponentInstanceKey)
 	for _, node.component = range componentsOrdered {
 		// Check if component criteria holds
 		componentMatch, componentMatchErr := node.componentMatches(node.component)
@@ -275,14 +412,43 @@ func (resolver *PolicyResolver) resolveNode(node *resolutionNode) (resolveErr er
 		// Store edge (bundle instance -> component instance)
 		node.resolution.StoreEdge(node.bundleKey, node.componentKey)
 
+		// Store edges (component instance -> component instances it depends on within the bundle), so it gets
+		// processed after them
+		componentKeys[node.component.Name] = node.componentKey
+		for _, dependency := range node.component.Dependencies {
+			node.resolution.StoreEdge(node.componentKey, componentKeys[dependency])
+		}
+
 		// Calculate and store labels for component
 		node.resolution.RecordLabels(node.componentKey, node.labels)
 
+		// Store retention for component (if it's not set, bundle retention is used)
+		if len(node.component.Retention) > 0 {
+			node.resolution.RecordRetention(node.componentKey, node.component.Retention)
+		} else {
+			node.resolution.RecordRetention(node.componentKey, node.bundle.Retention)
+		}
+
+		// Store previous keys for component, so it can be moved over instead of being re-created
+		err = node.recordPreviousKeys(node.componentKey, node.component)
+		if err != nil {
+			return err
+		}
+
 		// Create new map with resolution keys for component
 		node.discoveryTreeNode[node.component.Name] = util.NestedParameterMap{}
 
+		// Find out name of the deployment, which is going to be active
+		err = node.calculateDeployName()
+		if err != nil {
+			return err
+		}
+		if node.component.Code != nil {
+			node.resolution.RecordDeployName(node.componentKey, node.deployName)
+		}
+
 		// Calculate and store discovery params
-		err := node.calculateAndStoreDiscoveryParams()
+		err = node.calculateAndStoreDiscoveryParams()
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,369 @@
+package resolve
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/lang/yaml"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// PolicyChanges describes what has been changed since the previous policy resolution. It's used by incremental
+// resolution to find out which claims could be affected by the change and therefore have to be resolved again
+type PolicyChanges struct {
+	// Objects is a set of keys of policy objects which have been added, updated or removed
+	Objects map[string]bool
+
+	// Users is a set of names of users which have been added, updated or removed. Users are not a part of the
+	// policy, so resolver populates it by comparing external data of users with the one recorded in the previous
+	// resolution
+	Users map[string]bool
+
+	// userData is external data of users, which has been calculated while looking for changed users
+	userData map[string]string
+}
+
+// NewPolicyChanges compares two policies and returns the set of policy objects which differ between them. Object
+// generations are ignored, so objects which have been re-submitted without changes are not considered changed
+func NewPolicyChanges(prevPolicy *lang.Policy, policy *lang.Policy) *PolicyChanges {
+	result := &PolicyChanges{
+		Objects: make(map[string]bool),
+		Users:   make(map[string]bool),
+	}
+
+	for _, kind := range lang.PolicyTypes {
+		prevObjects := make(map[string]lang.Base)
+		for _, obj := range prevPolicy.GetObjectsByKind(kind.Kind) {
+			prevObjects[runtime.KeyForStorable(obj)] = obj
+		}
+		for _, obj := range policy.GetObjectsByKind(kind.Kind) {
+			key := runtime.KeyForStorable(obj)
+			prevObj, found := prevObjects[key]
+			if !found || !policyObjectsEqual(prevObj, obj) {
+				result.Objects[key] = true
+			}
+			delete(prevObjects, key)
+		}
+
+		// whatever is left has been removed from the policy
+		for key := range prevObjects {
+			result.Objects[key] = true
+		}
+	}
+
+	return result
+}
+
+// policyObjectsEqual compares two policy objects, ignoring their generations
+func policyObjectsEqual(a lang.Base, b lang.Base) bool {
+	return yaml.SerializeObject(withoutGeneration(a)) == yaml.SerializeObject(withoutGeneration(b))
+}
+
+// withoutGeneration returns a shallow copy of the object with generation set to zero
+func withoutGeneration(obj lang.Base) lang.Base {
+	value := reflect.ValueOf(obj).Elem()
+	result := reflect.New(value.Type())
+	result.Elem().Set(value)
+	objCopy := result.Interface().(lang.Base) // nolint: errcheck
+	objCopy.SetGeneration(0)
+	return objCopy
+}
+
+// ResolveChangedClaims calculates PolicyResolution (desired state) incrementally, given the previous PolicyResolution
+// and the set of changes made since it's been calculated. Only claims which could be affected by the changes are
+// resolved again, while component instances of all other claims are taken from the previous resolution as is.
+//
+// The result is always the same as the one produced by ResolveAllClaims. Whenever the set of affected claims can't be
+// narrowed down (e.g. ACL rules or global rules have been changed), all claims get resolved from scratch.
+func (resolver *PolicyResolver) ResolveChangedClaims(prevResolution *PolicyResolution, changes *PolicyChanges) *PolicyResolution {
+	affected, ok := resolver.getAffectedClaims(prevResolution, changes)
+	if !ok {
+		return resolver.ResolveAllClaims()
+	}
+	resolver.resolution.UserData = changes.userData
+
+	claims := make(map[string]*lang.Claim)
+	for _, claim := range resolver.policy.GetObjectsByKind(lang.TypeClaim.Kind) {
+		claims[runtime.KeyForStorable(claim)] = claim.(*lang.Claim) // nolint: errcheck
+	}
+
+	results := make(map[string]*claimResult)
+	resultsMutex := sync.Mutex{}
+
+	for {
+		// component instances are aggregated over all claims referencing them, so every claim sharing a component
+		// instance with an affected claim has to be resolved again as well
+		expandAffectedClaims(prevResolution, affected)
+
+		// resolve affected claims, which haven't been resolved yet
+		toResolve := []*lang.Claim{}
+		for claimKey := range affected {
+			if _, resolved := results[claimKey]; resolved {
+				continue
+			}
+			if claim, exists := claims[claimKey]; exists {
+				toResolve = append(toResolve, claim)
+			}
+		}
+		if len(toResolve) <= 0 {
+			break
+		}
+		resolver.resolveClaims(toResolve, func(claim *lang.Claim, node *resolutionNode, resolveErr error) {
+			resultsMutex.Lock()
+			defer resultsMutex.Unlock()
+			results[runtime.KeyForStorable(claim)] = &claimResult{node: node, resolveErr: resolveErr}
+		})
+
+		// claims may now land on component instances, which previously belonged only to claims not affected by the
+		// change. such claims have to be resolved again as well
+		for _, claim := range toResolve {
+			result := results[runtime.KeyForStorable(claim)]
+			if result.resolveErr != nil {
+				continue
+			}
+			for key := range result.node.resolution.ComponentInstanceMap {
+				if prevInstance, found := prevResolution.ComponentInstanceMap[key]; found {
+					for claimKey := range prevInstance.ClaimKeys {
+						affected[claimKey] = true
+					}
+				}
+			}
+		}
+	}
+
+	// take component instances of unaffected claims from the previous resolution
+	for key, instance := range prevResolution.ComponentInstanceMap {
+		if len(instance.ClaimKeys) > 0 && !hasAffectedClaims(instance, affected) {
+			resolver.resolution.ComponentInstanceMap[key] = instance
+		}
+	}
+
+	// and combine them with the data of claims which have been resolved again
+	resolver.combineClaimResults(results)
+
+	// Once all components are resolved, print information about them into event log
+	resolver.logAllComponentParams()
+
+	return resolver.resolution
+}
+
+// getAffectedClaims returns the set of keys of claims, which could be affected by the changes. It returns false if
+// all claims have to be resolved from scratch
+func (resolver *PolicyResolver) getAffectedClaims(prevResolution *PolicyResolution, changes *PolicyChanges) (map[string]bool, bool) {
+	if prevResolution == nil || changes == nil {
+		return nil, false
+	}
+
+	// users, which external data has been changed since the previous resolution
+	changes.userData = resolver.getUserData()
+	for name, fingerprint := range changes.userData {
+		if prevFingerprint, found := prevResolution.UserData[name]; !found || prevFingerprint != fingerprint {
+			changes.Users[name] = true
+		}
+	}
+
+	// namespaces, in which rules have been changed
+	changedRuleNamespaces := make(map[string]bool)
+	for key := range changes.Objects {
+		namespace, kind := splitObjectKey(key)
+		switch kind {
+		case lang.TypeACLRule.Kind:
+			// ACL rules define which services every user is allowed to consume
+			return nil, false
+		case lang.TypeRule.Kind:
+			if namespace == runtime.SystemNS {
+				// global rules are processed for every claim
+				return nil, false
+			}
+			changedRuleNamespaces[namespace] = true
+		}
+	}
+
+	// claims which have been resolved successfully and the clusters they have been resolved to
+	resolvedClaims := make(map[string]bool)
+	claimClusters := make(map[string]map[string]bool)
+	for _, instance := range prevResolution.ComponentInstanceMap {
+		clusterKey := runtime.KeyFromParts(instance.Metadata.Key.ClusterNameSpace, lang.TypeCluster.Kind, instance.Metadata.Key.ClusterName)
+		for claimKey := range instance.ClaimKeys {
+			resolvedClaims[claimKey] = true
+			if claimClusters[claimKey] == nil {
+				claimClusters[claimKey] = make(map[string]bool)
+			}
+			claimClusters[claimKey][clusterKey] = true
+		}
+	}
+
+	result := make(map[string]bool)
+	for _, claimObj := range resolver.policy.GetObjectsByKind(lang.TypeClaim.Kind) {
+		claim := claimObj.(*lang.Claim) // nolint: errcheck
+		claimKey := runtime.KeyForStorable(claim)
+
+		// claims which failed to resolve last time are always resolved again, as the reason for failure (e.g. missing
+		// user or cluster) could have gone away
+		if !resolvedClaims[claimKey] || changes.Objects[claimKey] || changes.Users[claim.User] {
+			result[claimKey] = true
+			continue
+		}
+
+		for clusterKey := range claimClusters[claimKey] {
+			if changes.Objects[clusterKey] {
+				result[claimKey] = true
+			}
+		}
+
+		objects, namespaces := resolver.getClaimDependencies(claim)
+		for key := range objects {
+			if changes.Objects[key] {
+				result[claimKey] = true
+			}
+		}
+		for namespace := range namespaces {
+			if changedRuleNamespaces[namespace] {
+				result[claimKey] = true
+			}
+		}
+	}
+
+	// claims which have been removed from the policy leave their component instances behind, so the claims sharing
+	// them have to be resolved again
+	for key := range changes.Objects {
+		if _, kind := splitObjectKey(key); kind == lang.TypeClaim.Kind {
+			result[key] = true
+		}
+	}
+
+	// code instances, which are going to be deployed under names different from the ones they have been resolved
+	// against (e.g. actual state has changed after blue/green update, adoption or move), have to be resolved again
+	// along with all their dependents, so that they discover the right deployments
+	for _, instance := range prevResolution.ComponentInstanceMap {
+		if instance.IsCode && !resolver.isDeployNameUpToDate(instance) {
+			for claimKey := range instance.ClaimKeys {
+				result[claimKey] = true
+			}
+		}
+	}
+
+	return result, true
+}
+
+// isDeployNameUpToDate returns true if code instance from the previous resolution is still going to be deployed under
+// the name, which it has been resolved against. Code params only change if the instance is affected by the changes,
+// in which case it gets resolved again anyway
+func (resolver *PolicyResolver) isDeployNameUpToDate(instance *ComponentInstance) bool {
+	deployName, err := resolver.getDeployName(instance.Metadata.Key, instance.UpdateStrategy, func() (util.NestedParameterMap, error) {
+		return instance.CalculatedCodeParams, nil
+	})
+	return err == nil && deployName == instance.ResolvedDeployName
+}
+
+// getClaimDependencies returns keys of all services and bundles the claim can possibly be resolved through, as well
+// as all namespaces in which rules can get processed while resolving it
+func (resolver *PolicyResolver) getClaimDependencies(claim *lang.Claim) (map[string]bool, map[string]bool) {
+	objects := make(map[string]bool)
+	namespaces := make(map[string]bool)
+
+	var walk func(serviceLocator string, namespace string)
+	walk = func(serviceLocator string, namespace string) {
+		serviceObj, err := resolver.policy.GetObject(lang.TypeService.Kind, serviceLocator, namespace)
+		if serviceObj == nil || err != nil {
+			return
+		}
+		service := serviceObj.(*lang.Service) // nolint: errcheck
+		serviceKey := runtime.KeyForStorable(service)
+		if objects[serviceKey] {
+			return
+		}
+		objects[serviceKey] = true
+		namespaces[service.Namespace] = true
+
+		for _, context := range service.Contexts {
+			bundleObj, bundleErr := resolver.policy.GetObject(lang.TypeBundle.Kind, context.Allocation.Bundle, service.Namespace)
+			if bundleObj == nil || bundleErr != nil {
+				continue
+			}
+			bundle := bundleObj.(*lang.Bundle) // nolint: errcheck
+			objects[runtime.KeyForStorable(bundle)] = true
+			for _, component := range bundle.Components {
+				if len(component.Service) > 0 {
+					walk(component.Service, service.Namespace)
+				}
+			}
+		}
+	}
+	walk(claim.Service, claim.Namespace)
+
+	return objects, namespaces
+}
+
+// expandAffectedClaims adds all claims sharing component instances with affected claims to the set of affected claims
+func expandAffectedClaims(resolution *PolicyResolution, affected map[string]bool) {
+	for changed := true; changed; {
+		changed = false
+		for _, instance := range resolution.ComponentInstanceMap {
+			if !hasAffectedClaims(instance, affected) {
+				continue
+			}
+			for claimKey := range instance.ClaimKeys {
+				if !affected[claimKey] {
+					affected[claimKey] = true
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+func hasAffectedClaims(instance *ComponentInstance, affected map[string]bool) bool {
+	for claimKey := range instance.ClaimKeys {
+		if affected[claimKey] {
+			return true
+		}
+	}
+	return false
+}
+
+// splitObjectKey returns namespace and kind of the policy object, given its key
+func splitObjectKey(key string) (string, string) {
+	parts := strings.SplitN(key, runtime.KeySeparator, 3)
+	if len(parts) < 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// getUserData returns fingerprints of external data of users of all claims from the policy
+func (resolver *PolicyResolver) getUserData() map[string]string {
+	result := make(map[string]string)
+	for _, claimObj := range resolver.policy.GetObjectsByKind(lang.TypeClaim.Kind) {
+		name := claimObj.(*lang.Claim).User // nolint: errcheck
+		if _, found := result[name]; !found {
+			result[name] = resolver.getUserFingerprint(name)
+		}
+	}
+	return result
+}
+
+// getUserFingerprint returns fingerprint of all user data, which resolution depends on (labels and secrets). Secrets
+// are only recorded as a part of the hash. Empty string is returned if user doesn't exist
+func (resolver *PolicyResolver) getUserFingerprint(name string) string {
+	user := resolver.externalData.UserLoader.LoadUserByName(name)
+	if user == nil {
+		return ""
+	}
+
+	data := yaml.SerializeObject(struct {
+		Labels      map[string]string
+		DomainAdmin bool
+		Secrets     map[string]string
+	}{
+		Labels:      user.Labels,
+		DomainAdmin: user.DomainAdmin,
+		Secrets:     resolver.externalData.SecretLoader.LoadSecretsByUserName(user.Name),
+	})
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
@@ -0,0 +1,252 @@
+package resolve
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Aptomi/aptomi/pkg/engine/enginetest"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/external"
+	"github.com/Aptomi/aptomi/pkg/external/users"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyResolverIncremental(t *testing.T) {
+	prevPolicy, externalData := enginetest.NewPolicyGenerator(239, 10, 20, 3, 3, 3, 2, 5, 20, 100).MakePolicyAndExternalData()
+	prevResolution := NewPolicyResolver(prevPolicy, externalData, event.NewLog(logrus.WarnLevel, "test-resolve")).ResolveAllClaims()
+
+	testCases := []struct {
+		name              string
+		change            func(t *testing.T, policy *lang.Policy)
+		changeUsers       func(t *testing.T, policy *lang.Policy) map[string]*lang.User
+		changeActualState func(t *testing.T, actualState *PolicyResolution)
+	}{
+		{
+			name:   "no changes",
+			change: func(t *testing.T, policy *lang.Policy) {},
+		},
+		{
+			name: "claim labels changed",
+			change: func(t *testing.T, policy *lang.Policy) {
+				claim := getClaim(t, policy, "claim-1")
+				claimUpdated := *claim
+				claimUpdated.Labels = map[string]string{"extra": "value"}
+				addObject(t, policy, &claimUpdated)
+			},
+		},
+		{
+			name: "claim removed",
+			change: func(t *testing.T, policy *lang.Policy) {
+				policy.RemoveObject(getClaim(t, policy, "claim-2"))
+			},
+		},
+		{
+			name: "claim added",
+			change: func(t *testing.T, policy *lang.Policy) {
+				claim := getClaim(t, policy, "claim-3")
+				claimAdded := *claim
+				claimAdded.Name = "claim-added"
+				claimAdded.Labels = map[string]string{"extra": "value"}
+				addObject(t, policy, &claimAdded)
+			},
+		},
+		{
+			name: "bundle code params changed",
+			change: func(t *testing.T, policy *lang.Policy) {
+				bundleObj, err := policy.GetObject(lang.TypeBundle.Kind, "bundle-4", "main")
+				if !assert.NoError(t, err, "Bundle should be retrieved") {
+					t.FailNow()
+				}
+				bundle := bundleObj.(*lang.Bundle)
+				bundleUpdated := &lang.Bundle{
+					TypeKind:   bundle.TypeKind,
+					Metadata:   bundle.Metadata,
+					Components: []*lang.BundleComponent{},
+				}
+				for _, component := range bundle.Components {
+					if component.Code != nil {
+						componentUpdated := *component
+						componentUpdated.Code = &lang.Code{Type: component.Code.Type, Params: component.Code.Params.MakeCopy()}
+						componentUpdated.Code.Params["extra"] = "value"
+						component = &componentUpdated
+					}
+					bundleUpdated.Components = append(bundleUpdated.Components, component)
+				}
+				addObject(t, policy, bundleUpdated)
+			},
+		},
+		{
+			name: "rule added",
+			change: func(t *testing.T, policy *lang.Policy) {
+				addObject(t, policy, &lang.Rule{
+					TypeKind: lang.TypeRule.GetTypeKind(),
+					Metadata: lang.Metadata{Namespace: "main", Name: "rule-added"},
+					Criteria: &lang.Criteria{RequireAll: []string{"Bundle.Name == 'bundle-5'"}},
+					Actions: &lang.RuleActions{
+						ChangeLabels: lang.NewLabelOperationsSetSingleLabel("extra", "value"),
+					},
+				})
+			},
+		},
+		{
+			name:   "user labels changed",
+			change: func(t *testing.T, policy *lang.Policy) {},
+			changeUsers: func(t *testing.T, policy *lang.Policy) map[string]*lang.User {
+				user := externalData.UserLoader.LoadUserByName(getClaim(t, policy, "claim-1").User)
+				if !assert.NotNil(t, user, "User should be retrieved") {
+					t.FailNow()
+				}
+				userUpdated := *user
+				userUpdated.Labels = make(map[string]string)
+				for name := range user.Labels {
+					userUpdated.Labels[name] = "changed"
+				}
+				return map[string]*lang.User{strings.ToLower(user.Name): &userUpdated}
+			},
+		},
+		{
+			name:   "deployment color switched",
+			change: func(t *testing.T, policy *lang.Policy) {},
+			changeActualState: func(t *testing.T, actualState *PolicyResolution) {
+				getCodeInstance(t, actualState).Color = ColorGreen
+			},
+		},
+		{
+			name:   "deployment adopted",
+			change: func(t *testing.T, policy *lang.Policy) {},
+			changeActualState: func(t *testing.T, actualState *PolicyResolution) {
+				getCodeInstance(t, actualState).AdoptedDeployName = "adopted-deployment"
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := copyPolicy(t, prevPolicy)
+			tc.change(t, policy)
+
+			externalDataUpdated := externalData
+			if tc.changeUsers != nil {
+				externalDataUpdated = external.NewData(
+					&userLoaderWithOverrides{UserLoader: externalData.UserLoader, overrides: tc.changeUsers(t, policy)},
+					externalData.SecretLoader,
+				)
+			}
+
+			actualState := makeActualState(prevResolution)
+			if tc.changeActualState != nil {
+				tc.changeActualState(t, actualState)
+			}
+
+			full := NewPolicyResolver(policy, externalDataUpdated, event.NewLog(logrus.WarnLevel, "test-resolve")).ActualState(actualState).ResolveAllClaims()
+			incremental := NewPolicyResolver(policy, externalDataUpdated, event.NewLog(logrus.WarnLevel, "test-resolve")).ActualState(actualState).ResolveChangedClaims(prevResolution, NewPolicyChanges(prevPolicy, policy))
+
+			assert.Equal(t, full.ComponentInstanceMap, incremental.ComponentInstanceMap, "Incremental resolution should be identical to the full one")
+
+			// dependents should discover deployments which are running in actual state
+			for key, instance := range incremental.ComponentInstanceMap {
+				if current := actualState.ComponentInstanceMap[key]; current != nil && instance.IsCode {
+					assert.Equal(t, current.GetDeployName(), instance.ResolvedDeployName, "Code instance should be resolved against its deployment: %s", key)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkPolicyResolverFull(b *testing.B) {
+	_, policy, externalData := makeBenchmarkPolicies(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewPolicyResolver(policy, externalData, event.NewLog(logrus.WarnLevel, "test-resolve")).ResolveAllClaims()
+	}
+}
+
+func BenchmarkPolicyResolverIncremental(b *testing.B) {
+	prevPolicy, policy, externalData := makeBenchmarkPolicies(b)
+	prevResolution := NewPolicyResolver(prevPolicy, externalData, event.NewLog(logrus.WarnLevel, "test-resolve")).ResolveAllClaims()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewPolicyResolver(policy, externalData, event.NewLog(logrus.WarnLevel, "test-resolve")).ResolveChangedClaims(prevResolution, NewPolicyChanges(prevPolicy, policy))
+	}
+}
+
+// makeBenchmarkPolicies generates a policy and its copy with labels of a single claim changed
+func makeBenchmarkPolicies(b *testing.B) (*lang.Policy, *lang.Policy, *external.Data) {
+	b.Helper()
+	prevPolicy, externalData := enginetest.NewPolicyGenerator(239, 30, 50, 6, 6, 4, 2, 25, 100, 500).MakePolicyAndExternalData()
+
+	policy := copyPolicy(b, prevPolicy)
+	claimUpdated := *getClaim(b, policy, "claim-1")
+	claimUpdated.Labels = map[string]string{"extra": "value"}
+	addObject(b, policy, &claimUpdated)
+
+	return prevPolicy, policy, externalData
+}
+
+// makeActualState returns actual state with copies of all component instances from the given resolution
+func makeActualState(resolution *PolicyResolution) *PolicyResolution {
+	result := NewPolicyResolution()
+	for key, instance := range resolution.ComponentInstanceMap {
+		instanceCopy := *instance
+		result.ComponentInstanceMap[key] = &instanceCopy
+	}
+	return result
+}
+
+// getCodeInstance returns code instance with the lowest key
+func getCodeInstance(t testing.TB, resolution *PolicyResolution) *ComponentInstance {
+	t.Helper()
+	var result *ComponentInstance
+	for key, instance := range resolution.ComponentInstanceMap {
+		if instance.IsCode && (result == nil || key < result.GetKey()) {
+			result = instance
+		}
+	}
+	if !assert.NotNil(t, result, "Code instance should be present") {
+		t.FailNow()
+	}
+	return result
+}
+
+func copyPolicy(t testing.TB, policy *lang.Policy) *lang.Policy {
+	t.Helper()
+	result := lang.NewPolicy()
+	for _, kind := range lang.PolicyTypes {
+		for _, obj := range policy.GetObjectsByKind(kind.Kind) {
+			addObject(t, result, obj)
+		}
+	}
+	return result
+}
+
+func addObject(t testing.TB, policy *lang.Policy, obj lang.Base) {
+	t.Helper()
+	assert.NoError(t, policy.AddObject(obj), "Object should be added to policy")
+}
+
+// userLoaderWithOverrides is a user loader, which returns given users (by lower case name) instead of the ones from the
+// underlying loader
+type userLoaderWithOverrides struct {
+	users.UserLoader
+	overrides map[string]*lang.User
+}
+
+func (loader *userLoaderWithOverrides) LoadUserByName(name string) *lang.User {
+	if user, found := loader.overrides[strings.ToLower(name)]; found {
+		return user
+	}
+	return loader.UserLoader.LoadUserByName(name)
+}
+
+func getClaim(t testing.TB, policy *lang.Policy, name string) *lang.Claim {
+	t.Helper()
+	claimObj, err := policy.GetObject(lang.TypeClaim.Kind, name, "main")
+	if !assert.NoError(t, err, "Claim should be retrieved") || claimObj == nil {
+		t.FailNow()
+	}
+	return claimObj.(*lang.Claim)
+}
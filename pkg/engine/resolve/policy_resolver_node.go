@@ -59,6 +59,9 @@ type resolutionNode struct {
 	// reference to the current component key
 	componentKey *ComponentInstanceKey
 
+	// name of the deployment of the current component, which is going to be active once desired state gets applied
+	deployName string
+
 	// reference to the current bundle key
 	bundleKey *ComponentInstanceKey
 
@@ -254,6 +257,40 @@ func (node *resolutionNode) createComponentKey(component *lang.BundleComponent)
 		return nil, node.errorTargetNotSet()
 	}
 
+	return node.createComponentKeyFor(targetLabel, node.context, node.allocationKeysResolved, component)
+}
+
+// createPreviousComponentKeys creates component keys for all previous identities of the current context, so that
+// existing component instances can be moved over to the current key
+func (node *resolutionNode) createPreviousComponentKeys(component *lang.BundleComponent) ([]*ComponentInstanceKey, error) {
+	result := []*ComponentInstanceKey{}
+	for _, previous := range node.context.Previous {
+		context := node.context
+		if len(previous.Name) > 0 {
+			context = &lang.Context{Name: previous.Name}
+		}
+
+		allocationKeysResolved, err := node.context.ResolvePreviousKeys(previous, node.getContextualDataForContextAllocationTemplate(), node.resolver.templateCache)
+		if err != nil {
+			return nil, node.errorWhenResolvingAllocationKeys(err)
+		}
+
+		targetLabel := node.labels.Labels[lang.LabelTarget]
+		if len(previous.Target) > 0 {
+			targetLabel = previous.Target
+		}
+
+		key, err := node.createComponentKeyFor(targetLabel, context, allocationKeysResolved, component)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+// createComponentKeyFor creates a component key for the given target, context and resolved allocation keys
+func (node *resolutionNode) createComponentKeyFor(targetLabel string, context *lang.Context, allocationKeysResolved []string, component *lang.BundleComponent) (*ComponentInstanceKey, error) {
 	target := lang.NewTarget(targetLabel)
 	cluster, err := target.GetCluster(node.resolver.policy, node.namespace)
 	if err != nil {
@@ -280,13 +317,26 @@ func (node *resolutionNode) createComponentKey(component *lang.BundleComponent)
 		cluster,
 		target.Suffix,
 		node.service,
-		node.context,
-		node.allocationKeysResolved,
+		context,
+		allocationKeysResolved,
 		node.bundle,
 		component,
 	), nil
 }
 
+// recordPreviousKeys creates component keys for all previous identities of the current context and stores them for
+// the component instance
+func (node *resolutionNode) recordPreviousKeys(cik *ComponentInstanceKey, component *lang.BundleComponent) error {
+	previousKeys, err := node.createPreviousComponentKeys(component)
+	if err != nil {
+		return err
+	}
+	for _, previousKey := range previousKeys {
+		node.resolution.RecordPreviousKey(cik, previousKey)
+	}
+	return nil
+}
+
 func (node *resolutionNode) transformLabels(labels *lang.LabelSet, operations lang.LabelOperations) {
 	changedLabels := labels.ApplyTransform(operations)
 	if changedLabels {
@@ -342,9 +392,9 @@ func (node *resolutionNode) processRules() (*lang.RuleActionResult, error) {
 }
 
 func (node *resolutionNode) calculateAndStoreCodeParams() error {
-	componentCodeParams, err := util.ProcessParameterTree(node.component.Code.Params, node.getContextualDataForCodeDiscoveryTemplate(), node.resolver.templateCache, util.ModeEvaluate)
+	componentCodeParams, err := node.calculateCodeParams()
 	if err != nil {
-		return node.errorWhenProcessingCodeParams(err)
+		return err
 	}
 
 	err = node.resolution.RecordCodeParams(node.componentKey, componentCodeParams)
@@ -352,13 +402,23 @@ func (node *resolutionNode) calculateAndStoreCodeParams() error {
 		return node.errorWhenProcessingCodeParams(err)
 	}
 
+	node.resolution.RecordUpdateStrategy(node.componentKey, node.component.UpdateStrategy)
+
 	return nil
 }
 
+func (node *resolutionNode) calculateCodeParams() (util.NestedParameterMap, error) {
+	componentCodeParams, err := util.ProcessParameterTree(node.component.Code.Params, node.getContextualDataForCodeDiscoveryTemplate(), node.resolver.templateCache, util.ModeEvaluate)
+	if err != nil {
+		return nil, node.errorWhenProcessingCodeParams(err)
+	}
+	return componentCodeParams, nil
+}
+
 func (node *resolutionNode) calculateAndStoreDiscoveryParams() error {
-	componentDiscoveryParams, err := util.ProcessParameterTree(node.component.Discovery, node.getContextualDataForCodeDiscoveryTemplate(), node.resolver.templateCache, util.ModeEvaluate)
+	componentDiscoveryParams, err := node.calculateDiscoveryParams()
 	if err != nil {
-		return node.errorWhenProcessingDiscoveryParams(err)
+		return err
 	}
 
 	err = node.resolution.RecordDiscoveryParams(node.componentKey, componentDiscoveryParams)
@@ -366,11 +426,48 @@ func (node *resolutionNode) calculateAndStoreDiscoveryParams() error {
 		return node.errorWhenProcessingDiscoveryParams(err)
 	}
 
+	return nil
+}
+
+func (node *resolutionNode) calculateDiscoveryParams() (util.NestedParameterMap, error) {
+	componentDiscoveryParams, err := util.ProcessParameterTree(node.component.Discovery, node.getContextualDataForCodeDiscoveryTemplate(), node.resolver.templateCache, util.ModeEvaluate)
+	if err != nil {
+		return nil, node.errorWhenProcessingDiscoveryParams(err)
+	}
+
 	// Populate discovery tree (allow this component to announce its discovery properties in the discovery tree)
-	node.discoveryTreeNode.GetNestedMap(node.component.Name)["instance"] = util.EscapeName(node.componentKey.GetDeployName())
+	node.discoveryTreeNode.GetNestedMap(node.component.Name)["instance"] = util.EscapeName(node.deployName)
 	for k, v := range componentDiscoveryParams {
 		node.discoveryTreeNode.GetNestedMap(node.component.Name)[k] = v
 	}
 
+	return componentDiscoveryParams, nil
+}
+
+// calculateDeployName finds out the name of the deployment of the current component, which is going to be active once
+// desired state gets applied (see PolicyResolver.getDeployName)
+func (node *resolutionNode) calculateDeployName() error {
+	node.deployName = node.componentKey.GetDeployName()
+	if node.component.Code == nil {
+		return nil
+	}
+
+	deployName, err := node.resolver.getDeployName(node.componentKey, node.component.UpdateStrategy, func() (util.NestedParameterMap, error) {
+		// calculate params against the active deployment to see if they change
+		node.deployName = node.resolver.actualState.ComponentInstanceMap[node.componentKey.GetKey()].GetDeployName()
+		defer func() {
+			node.discoveryTreeNode[node.component.Name] = util.NestedParameterMap{}
+		}()
+		_, err := node.calculateDiscoveryParams()
+		if err != nil {
+			return nil, err
+		}
+		return node.calculateCodeParams()
+	})
+	if err != nil {
+		return err
+	}
+	node.deployName = deployName
+
 	return nil
 }
@@ -78,7 +78,7 @@ func (node *resolutionNode) getContextualDataForCodeDiscoveryTemplate() *templat
 		}{
 			User:      node.proxyUser(node.user),
 			Labels:    node.labels.Labels,
-			Discovery: node.proxyDiscovery(node.discoveryTreeNode, node.componentKey),
+			Discovery: node.proxyDiscovery(node.discoveryTreeNode, node.componentKey, node.deployName),
 			Target:    node.proxyTarget(node.componentKey),
 		},
 	)
@@ -135,11 +135,11 @@ func (node *resolutionNode) proxyTarget(cik *ComponentInstanceKey) interface{} {
 }
 
 // How discovery tree is visible from the policy language
-func (node *resolutionNode) proxyDiscovery(discoveryTree util.NestedParameterMap, cik *ComponentInstanceKey) interface{} {
+func (node *resolutionNode) proxyDiscovery(discoveryTree util.NestedParameterMap, cik *ComponentInstanceKey, deployName string) interface{} {
 	result := discoveryTree.MakeCopy()
 
-	// special case to announce own component instance
-	result["Instance"] = util.EscapeName(cik.GetDeployName())
+	// special case to announce own component instance (under the name of the deployment, which is going to be active)
+	result["Instance"] = util.EscapeName(deployName)
 
 	// special case to announce own component ID
 	result["InstanceId"] = util.HashFnv(cik.GetKey())
@@ -170,6 +170,12 @@ func (node *resolutionNode) logCannotResolveInstance() {
 	}
 }
 
+func (node *resolutionNode) logClaimParamsConflicts(conflicts []*ParamsConflict) {
+	for _, conflict := range conflicts {
+		node.eventLog.NewEntry().Errorf("claim '%s/%s' failed, because its params conflict with other claims: %s", node.claim.Namespace, node.claim.Name, conflict)
+	}
+}
+
 func (resolver *PolicyResolver) logComponentParams(instance *ComponentInstance) {
 	bundleObj, err := resolver.policy.GetObject(lang.TypeBundle.Kind, instance.Metadata.Key.BundleName, instance.Metadata.Key.Namespace)
 	if err != nil {
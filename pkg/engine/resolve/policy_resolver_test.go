@@ -3,11 +3,13 @@ package resolve
 
 import (
 	"fmt"
+	"sort"
 	"testing"
 
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/lang/builder"
+	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/util"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -304,10 +306,75 @@ func TestPolicyResolverConflictingCodeParams(t *testing.T) {
 	c2.Labels["deplabel"] = "2"
 
 	// policy resolution with conflicting code parameters should result in an error
-	resolvePolicy(t, b, []verifyClaim{
+	resolution := resolvePolicy(t, b, []verifyClaim{
 		{claim: c1, resolved: false, logMessage: "conflicting code parameters"},
 		{claim: c2, resolved: false, logMessage: "conflicting code parameters"},
 	})
+
+	// conflict should list both claims, differing params and labels
+	conflicts := resolution.GetClaimResolution(c1).Conflicts
+	if !assert.Equal(t, 1, len(conflicts), "Claim should have one conflict") {
+		t.FailNow()
+	}
+	conflict := conflicts[0]
+	assert.Equal(t, ParamsTypeCode, conflict.ParamsType, "Conflict should be in code params")
+	assert.ElementsMatch(t, []string{runtime.KeyForStorable(c1), runtime.KeyForStorable(c2)}, append(conflict.ClaimKeys, conflict.ConflictingClaimKeys...), "Conflict should list both claims")
+	if assert.Equal(t, 1, len(conflict.Params), "Conflict should list differing params") {
+		assert.Equal(t, "/address", conflict.Params[0].Path, "Conflict should list differing param path")
+	}
+	if assert.Equal(t, 1, len(conflict.Labels), "Conflict should list differing labels") {
+		assert.Equal(t, "/deplabel", conflict.Labels[0].Path, "Conflict should list differing label")
+	}
+	assert.Equal(t, conflicts, resolution.GetClaimResolution(c2).Conflicts, "Both claims should have the same conflict")
+}
+
+func TestPolicyResolverFailConflictingClaims(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+
+	// create a bundle which uses label in its code parameters
+	bundle := b.AddBundle()
+	b.AddBundleComponent(bundle,
+		b.CodeComponent(
+			util.NestedParameterMap{"address": "{{ .Labels.deplabel }}"},
+			nil,
+		),
+	)
+	service := b.AddService(bundle, b.CriteriaTrue())
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelTarget, cluster.Name)))
+
+	// add claims which feed conflicting labels into a given component
+	c1 := b.AddClaim(b.AddUser(), service)
+	c1.Labels["deplabel"] = "1"
+	c2 := b.AddClaim(b.AddUser(), service)
+	c2.Labels["deplabel"] = "2"
+	c3 := b.AddClaim(b.AddUser(), service)
+	c3.Labels["deplabel"] = "1"
+
+	// claims get combined in the order of their keys, so only claims which conflict with the first one should fail
+	eventLog := event.NewLog(logrus.DebugLevel, "test-resolve")
+	resolution := NewPolicyResolver(b.Policy(), b.External(), eventLog).FailConflictingClaims(true).ResolveAllClaims()
+
+	claims := []*lang.Claim{c1, c2, c3}
+	sort.Slice(claims, func(i, j int) bool {
+		return runtime.KeyForStorable(claims[i]) < runtime.KeyForStorable(claims[j])
+	})
+	for _, claim := range claims {
+		claimResolution := resolution.GetClaimResolution(claim)
+		if claim.Labels["deplabel"] == claims[0].Labels["deplabel"] {
+			assert.True(t, claimResolution.Resolved, "Claim with the same params as the first one should be resolved")
+			assert.Empty(t, claimResolution.Conflicts, "Claim with the same params as the first one should not have conflicts")
+		} else {
+			assert.False(t, claimResolution.Resolved, "Conflicting claim should not be resolved")
+			if assert.Equal(t, 1, len(claimResolution.Conflicts), "Conflicting claim should have one conflict") {
+				assert.Equal(t, []string{runtime.KeyForStorable(claim)}, claimResolution.Conflicts[0].ConflictingClaimKeys, "Conflict should list conflicting claim")
+			}
+		}
+	}
+
+	verifier := event.NewLogVerifier("conflict with other claims", true)
+	eventLog.Save(verifier)
+	assert.True(t, verifier.MatchedErrorsCount() > 0, "Event log should have an error about conflicting claim")
 }
 
 func TestPolicyResolverConflictingDiscoveryParams(t *testing.T) {
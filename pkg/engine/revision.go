@@ -6,6 +6,7 @@ import (
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
 )
 
 const (
@@ -15,6 +16,8 @@ const (
 	RevisionStatusInProgress = "inprogress"
 	// RevisionStatusCompleted represents Revision status with apply finished
 	RevisionStatusCompleted = "completed"
+	// RevisionStatusCancelled represents Revision status when apply has been cancelled by user (it will not be retried)
+	RevisionStatusCancelled = "cancelled"
 	// RevisionStatusError represents Revision status when a critical error happened (we should rarely see those)
 	RevisionStatusError = "error"
 )
@@ -53,6 +56,10 @@ type Revision struct {
 	Result    *action.ApplyResult
 	AppliedAt time.Time
 
+	// Changes is a map from component instance key to the list of field-level changes of its parameters, which
+	// are getting applied in this revision
+	Changes map[string][]*util.ParameterChange
+
 	// TODO: do not store apply log in revision
 	ApplyLog []*event.APIEvent
 }
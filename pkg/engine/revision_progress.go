@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+)
+
+// TypeRevisionActualState is an informational data structure with Kind and Constructor for RevisionActualState
+var TypeRevisionActualState = &runtime.TypeInfo{
+	Kind:        "revision-actual-state",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &RevisionActualState{} },
+}
+
+// RevisionActualState represents snapshot of the actual state at the moment when apply of specific revision has been
+// started. It allows to rebuild exactly the same action plan if apply gets interrupted
+type RevisionActualState struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	RevisionGen runtime.Generation
+	Resolution  resolve.PolicyResolution
+}
+
+// NewRevisionActualState creates new RevisionActualState instance from revision and actual state
+func NewRevisionActualState(revision *Revision, actualState *resolve.PolicyResolution) *RevisionActualState {
+	return &RevisionActualState{
+		TypeKind:    TypeRevisionActualState.GetTypeKind(),
+		RevisionGen: revision.GetGeneration(),
+		Resolution:  *actualState,
+	}
+}
+
+// GetName returns name of the RevisionActualState
+func (as *RevisionActualState) GetName() string {
+	return GetRevisionActualStateName(as.RevisionGen)
+}
+
+// GetNamespace returns namespace of the RevisionActualState
+func (as *RevisionActualState) GetNamespace() string {
+	return runtime.SystemNS
+}
+
+// GetRevisionActualStateName returns name of the RevisionActualState for specific Revision generations
+func GetRevisionActualStateName(revisionGen runtime.Generation) string {
+	return fmt.Sprintf("revision-%s-actual-state", revisionGen)
+}
+
+// TypeRevisionProgress is an informational data structure with Kind and Constructor for RevisionProgress
+var TypeRevisionProgress = &runtime.TypeInfo{
+	Kind:        "revision-progress",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &RevisionProgress{} },
+}
+
+// RevisionProgress represents progress of applying action plan for specific revision. It gets updated every time
+// a node of the action plan is successfully completed
+type RevisionProgress struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	RevisionGen runtime.Generation
+
+	// CompletedNodes is a set of keys of action plan nodes, which have been successfully completed
+	CompletedNodes map[string]bool
+}
+
+// NewRevisionProgress creates new RevisionProgress instance for revision with no completed nodes
+func NewRevisionProgress(revision *Revision) *RevisionProgress {
+	return &RevisionProgress{
+		TypeKind:       TypeRevisionProgress.GetTypeKind(),
+		RevisionGen:    revision.GetGeneration(),
+		CompletedNodes: make(map[string]bool),
+	}
+}
+
+// GetName returns name of the RevisionProgress
+func (progress *RevisionProgress) GetName() string {
+	return GetRevisionProgressName(progress.RevisionGen)
+}
+
+// GetNamespace returns namespace of the RevisionProgress
+func (progress *RevisionProgress) GetNamespace() string {
+	return runtime.SystemNS
+}
+
+// GetRevisionProgressName returns name of the RevisionProgress for specific Revision generations
+func GetRevisionProgressName(revisionGen runtime.Generation) string {
+	return fmt.Sprintf("revision-%s-progress", revisionGen)
+}
@@ -3,6 +3,7 @@ package lang
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/Aptomi/aptomi/pkg/lang/expression"
 	"github.com/Aptomi/aptomi/pkg/runtime"
@@ -33,6 +34,10 @@ type Bundle struct {
 	// Components is the list of components bundle consists of
 	Components []*BundleComponent `validate:"dive"`
 
+	// Retention defines what happens with bundle instances and their components once they have no claims left. It's an
+	// optional field, so if it's empty then they get destroyed right away. See RetentionRetain for the other options
+	Retention string `yaml:"retention,omitempty" validate:"omitempty,retention"`
+
 	// Lazily evaluated fields (all components topologically sorted). Use via getter
 	componentsOrderedOnce sync.Once
 	componentsOrderedErr  error
@@ -66,6 +71,50 @@ type BundleComponent struct {
 	// Dependencies represent cross-component dependencies within a given bundle. Component may need other components
 	// within that bundle to exist, before it gets instantiated
 	Dependencies []string `yaml:"dependencies,omitempty" validate:"dive,identifier"`
+
+	// UpdateStrategy defines how running code instances of the component get updated when their parameters change.
+	// It's an optional field, so if it's empty then UpdateStrategyInPlace is used
+	UpdateStrategy string `yaml:"update-strategy,omitempty" validate:"omitempty,updateStrategy"`
+
+	// Retention defines what happens with component instances once they have no claims left. It's an optional field,
+	// so if it's empty then retention of the bundle is used
+	Retention string `yaml:"retention,omitempty" validate:"omitempty,retention"`
+}
+
+const (
+	// UpdateStrategyInPlace updates running code instance in place
+	UpdateStrategyInPlace = "in-place"
+
+	// UpdateStrategyRecreate destroys running code instance first and then creates it with the new parameters
+	UpdateStrategyRecreate = "recreate"
+
+	// UpdateStrategyBlueGreen deploys code instance with the new parameters under a new deploy name, waits for it to
+	// become ready, switches over to it and then destroys the old one
+	UpdateStrategyBlueGreen = "blue-green"
+)
+
+// RetentionRetain means that instances without claims never get destroyed automatically, they only get detached
+// and can be purged by domain admin. Other than that, retention can be set to a duration (e.g. "24h"), which is a grace
+// period instances can stay without claims before they get destroyed
+const RetentionRetain = "retain"
+
+// ParseRetention parses retention and returns whether instances should be retained, as well as their grace period.
+// Zero grace period along with retained = true means that instances should be retained forever
+func ParseRetention(retention string) (retained bool, gracePeriod time.Duration, err error) {
+	if len(retention) <= 0 {
+		return false, 0, nil
+	}
+	if retention == RetentionRetain {
+		return true, 0, nil
+	}
+	gracePeriod, err = time.ParseDuration(retention)
+	if err != nil {
+		return false, 0, fmt.Errorf("retention must be either '%s' or a duration: %s", RetentionRetain, err)
+	}
+	if gracePeriod <= 0 {
+		return false, 0, fmt.Errorf("retention grace period must be positive: %s", retention)
+	}
+	return true, gracePeriod, nil
 }
 
 // Code with type and parameters, used to instantiate/update/delete component instances
@@ -49,6 +49,24 @@ type Context struct {
 
 	// Allocation defines how the context will get allocated (which bundle to allocate and which unique key to use)
 	Allocation *Allocation `validate:"required"`
+
+	// Previous is an optional list of previous identities of the context. If context gets renamed, its allocation keys
+	// get changed or it gets moved to a different target, then existing component instances will be moved over to the new
+	// keys instead of being destroyed and created from scratch (which is important for components with stateful data)
+	Previous []*ContextPrevious `yaml:"previous,omitempty" validate:"dive"`
+}
+
+// ContextPrevious defines a previous identity of the context. Fields which are not set are considered to be the
+// same as the current ones
+type ContextPrevious struct {
+	// Name is a previous name of the context
+	Name string `yaml:"name,omitempty" validate:"omitempty,identifier"`
+
+	// Keys is a previous set of allocation keys of the context
+	Keys []string `yaml:"keys,omitempty" validate:"dive,template"`
+
+	// Target is a previous target (cluster, optionally followed by namespace) of the context
+	Target string `yaml:"target,omitempty"`
 }
 
 // Allocation determines which bundle should be allocated for by the given context
@@ -81,9 +99,25 @@ func (context *Context) ResolveKeys(params *template.Parameters, cache *template
 	if cache == nil {
 		cache = template.NewCache()
 	}
+	return resolveKeys(context.Allocation.Keys, params, cache)
+}
+
+// ResolvePreviousKeys resolves dynamic allocation keys for the given previous identity of the context. If previous
+// keys are not set, then current allocation keys will be resolved
+func (context *Context) ResolvePreviousKeys(previous *ContextPrevious, params *template.Parameters, cache *template.Cache) ([]string, error) {
+	if previous.Keys == nil {
+		return context.ResolveKeys(params, cache)
+	}
+	if cache == nil {
+		cache = template.NewCache()
+	}
+	return resolveKeys(previous.Keys, params, cache)
+}
+
+func resolveKeys(keys []string, params *template.Parameters, cache *template.Cache) ([]string, error) {
 	// Resolve allocation keys (they can be dynamic, depending on user labels)
 	result := []string{}
-	for _, key := range context.Allocation.Keys {
+	for _, key := range keys {
 		keyResolved, err := cache.Evaluate(key, params)
 		if err != nil {
 			return nil, err
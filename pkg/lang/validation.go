@@ -19,13 +19,30 @@ import (
 
 // Constants
 var (
-	identifierRegex = "^[a-zA-Z][a-zA-Z0-9_-]{0,63}$"
-	clusterTypes    = []string{"kubernetes"}
-	codeTypes       = []string{"helm", "raw"}
-	labelOpsKeys    = []string{"set", "remove"}
-	allowReject     = []string{"allow", "reject"}
+	identifierRegex  = "^[a-zA-Z][a-zA-Z0-9_-]{0,63}$"
+	clusterTypes     = []string{"kubernetes", "local"}
+	codeTypes        = []string{"helm", "raw", "kustomize", "process", "terraform"}
+	labelOpsKeys     = []string{"set", "remove"}
+	allowReject      = []string{"allow", "reject"}
+	updateStrategies = []string{UpdateStrategyInPlace, UpdateStrategyRecreate, UpdateStrategyBlueGreen}
 )
 
+// RegisterClusterType makes policy validation accept the given cluster type. It's used for cluster types provided by
+// plugins, which are not built into Aptomi. It should only be called on startup, before any policy gets validated
+func RegisterClusterType(clusterType string) {
+	if !util.ContainsString(clusterTypes, clusterType) {
+		clusterTypes = append(clusterTypes, clusterType)
+	}
+}
+
+// RegisterCodeType makes policy validation accept the given code type. It's used for code types provided by plugins,
+// which are not built into Aptomi. It should only be called on startup, before any policy gets validated
+func RegisterCodeType(codeType string) {
+	if !util.ContainsString(codeTypes, codeType) {
+		codeTypes = append(codeTypes, codeType)
+	}
+}
+
 // Custom type for context key, so we don't have to use 'string' directly
 type contextKey string
 
@@ -71,6 +88,8 @@ func NewPolicyValidator(policy *Policy) *PolicyValidator {
 	result.RegisterValidationCtx("labels", validateLabels)                       // nolint: errcheck
 	result.RegisterValidationCtx("labelOperations", validateLabelOperations)     // nolint: errcheck
 	result.RegisterValidationCtx("allowReject", validateAllowRejectAction)       // nolint: errcheck
+	result.RegisterValidationCtx("updateStrategy", validateUpdateStrategy)       // nolint: errcheck
+	result.RegisterValidationCtx("retention", validateRetention)                 // nolint: errcheck
 	result.RegisterValidationCtx("addRoleNS", validateACLRoleActionMap)          // nolint: errcheck
 
 	// validators with context containing policy
@@ -111,6 +130,14 @@ func NewPolicyValidator(policy *Policy) *PolicyValidator {
 			tag:         "allowReject",
 			translation: fmt.Sprintf("'{0}' is not valid, must be in %s", allowReject),
 		},
+		{
+			tag:         "updateStrategy",
+			translation: fmt.Sprintf("'{0}' is not valid, must be in %s", updateStrategies),
+		},
+		{
+			tag:         "retention",
+			translation: fmt.Sprintf("'{0}' is not valid, must be either '%s' or a duration", RetentionRetain),
+		},
 		{
 			tag:         "systemNS",
 			translation: fmt.Sprintf("'{0}' is not valid, must always be '%s'", runtime.SystemNS),
@@ -242,6 +269,20 @@ func validateAllowRejectAction(ctx context.Context, fl validator.FieldLevel) boo
 	return validateInStringArray(ctx, allowReject, fl)
 }
 
+// checks if a given string is a valid update strategy of a component
+func validateUpdateStrategy(ctx context.Context, fl validator.FieldLevel) bool {
+	return validateInStringArray(ctx, updateStrategies, fl)
+}
+
+// checks if a given string is a valid retention of a bundle or a component
+func validateRetention(ctx context.Context, fl validator.FieldLevel) bool {
+	_, _, err := ParseRetention(fl.Field().String())
+	if err != nil {
+		attachErrorToContext(ctx, fl, err.Error())
+	}
+	return err == nil
+}
+
 // checks if a given string is a valid cluster type
 func validateClusterType(ctx context.Context, fl validator.FieldLevel) bool {
 	return validateInStringArray(ctx, clusterTypes, fl)
@@ -0,0 +1,198 @@
+package external
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/sirupsen/logrus"
+)
+
+// clusterPlugin is a cluster plugin on Aptomi side, which forwards all calls to the external plugin process
+type clusterPlugin struct {
+	process *Process
+	cluster *lang.Cluster
+	data    string
+}
+
+var _ plugin.ClusterPlugin = &clusterPlugin{}
+
+func (process *Process) newClusterPlugin(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+	data, err := encodeCluster(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return &clusterPlugin{
+		process: process,
+		cluster: cluster,
+		data:    data,
+	}, nil
+}
+
+func (p *clusterPlugin) args(eventLog *event.Log) ClusterArgs {
+	level := logrus.InfoLevel
+	if eventLog != nil {
+		level = eventLog.GetLevel()
+	}
+	return ClusterArgs{
+		Cluster:  p.data,
+		LogLevel: level,
+	}
+}
+
+func (p *clusterPlugin) Validate() error {
+	args := p.args(nil)
+	return p.process.invoke("Validate", &args, &Reply{}, nil)
+}
+
+func (p *clusterPlugin) Cleanup() error {
+	args := p.args(nil)
+	return p.process.invoke("Cleanup", &args, &Reply{}, nil)
+}
+
+// invoke calls the given method of the plugin, forwards events produced by plugin into the event log and returns
+// error plugin has failed with
+func (process *Process) invoke(method string, args interface{}, reply baseReply, eventLog *event.Log) error {
+	err := process.call(method, args, reply)
+	forwardEvents(eventLog, reply.base().Events)
+	if err == nil && len(reply.base().Error) > 0 {
+		err = errors.New(reply.base().Error)
+	}
+	return err
+}
+
+// codePlugin is a code plugin on Aptomi side, which forwards all calls to the external plugin process
+type codePlugin struct {
+	cluster  *clusterPlugin
+	codeType string
+}
+
+var _ plugin.CodePlugin = &codePlugin{}
+
+func (process *Process) codePluginConstructor(codeType string) plugin.CodePluginConstructor {
+	return func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+		owner, ok := cluster.(*clusterPlugin)
+		if !ok || owner.process != process {
+			return nil, fmt.Errorf("code type %s of external plugin %s can only be used with cluster types of the same plugin", codeType, process.path)
+		}
+		return &codePlugin{
+			cluster:  owner,
+			codeType: codeType,
+		}, nil
+	}
+}
+
+func (p *codePlugin) args(invocation *plugin.CodePluginInvocationParams) (*CodeArgs, error) {
+	result := &CodeArgs{
+		ClusterArgs: p.cluster.args(invocation.EventLog),
+		CodeType:    p.codeType,
+	}
+	var err error
+	result.Invocation, err = encodeInvocation(invocation)
+	return result, err
+}
+
+func (p *codePlugin) invoke(method string, invocation *plugin.CodePluginInvocationParams, reply baseReply) error {
+	args, err := p.args(invocation)
+	if err != nil {
+		return err
+	}
+	return p.cluster.process.invoke(method, args, reply, invocation.EventLog)
+}
+
+func (p *codePlugin) Cleanup() error {
+	// plugin process cleans up code plugins together with the cluster plugin
+	return nil
+}
+
+func (p *codePlugin) Create(invocation *plugin.CodePluginInvocationParams) error {
+	reply := &Reply{}
+	return p.invoke("Create", invocation, reply)
+}
+
+func (p *codePlugin) Update(invocation *plugin.CodePluginInvocationParams) error {
+	reply := &Reply{}
+	return p.invoke("Update", invocation, reply)
+}
+
+func (p *codePlugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
+	reply := &Reply{}
+	return p.invoke("Destroy", invocation, reply)
+}
+
+func (p *codePlugin) Endpoints(invocation *plugin.CodePluginInvocationParams) (map[string]string, error) {
+	reply := &EndpointsReply{}
+	err := p.invoke("Endpoints", invocation, reply)
+	return reply.Endpoints, err
+}
+
+func (p *codePlugin) Resources(invocation *plugin.CodePluginInvocationParams) (plugin.Resources, error) {
+	reply := &ResourcesReply{}
+	err := p.invoke("Resources", invocation, reply)
+	return reply.Resources, err
+}
+
+func (p *codePlugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	reply := &BoolReply{}
+	err := p.invoke("Status", invocation, reply)
+	return reply.Result, err
+}
+
+func (p *codePlugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	reply := &DriftReply{}
+	err := p.invoke("Drift", invocation, reply)
+	return reply.Drift, err
+}
+
+func (p *codePlugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	reply := &BoolReply{}
+	err := p.invoke("Exists", invocation, reply)
+	return reply.Result, err
+}
+
+func (p *codePlugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	args := &CodeArgs{
+		ClusterArgs: p.cluster.args(eventLog),
+		CodeType:    p.codeType,
+	}
+	reply := &DeploymentsReply{}
+	err := p.cluster.process.invoke("Deployments", args, reply, eventLog)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*plugin.Deployment{}
+	for _, deployment := range reply.Deployments {
+		params, decodeErr := decodeParams(deployment.Params)
+		if decodeErr != nil {
+			return nil, decodeErr
+		}
+		result = append(result, &plugin.Deployment{
+			DeployName:   deployment.DeployName,
+			TargetSuffix: deployment.TargetSuffix,
+			Params:       params,
+		})
+	}
+	return result, nil
+}
+
+func (p *codePlugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	fromInvocation, err := encodeInvocation(from)
+	if err != nil {
+		return err
+	}
+	toInvocation, err := encodeInvocation(to)
+	if err != nil {
+		return err
+	}
+	args := &MoveArgs{
+		ClusterArgs: p.cluster.args(to.EventLog),
+		CodeType:    p.codeType,
+		From:        fromInvocation,
+		To:          toInvocation,
+	}
+	return p.cluster.process.invoke("Move", args, &Reply{}, to.EventLog)
+}
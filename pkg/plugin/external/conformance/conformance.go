@@ -0,0 +1,262 @@
+package conformance
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// Suite is a conformance test suite for cluster and code plugins. It drives a single deployment through its whole
+// lifecycle (create, update, move, destroy) and checks that plugin behaves the way Aptomi engine expects it to
+type Suite struct {
+	// Registry is a plugin registry, which provides plugins under test
+	Registry plugin.Registry
+
+	// Cluster is a cluster deployment is made in
+	Cluster *lang.Cluster
+
+	// CodeType is a code type of the plugin under test
+	CodeType string
+
+	// Params are code params deployment gets created with
+	Params util.NestedParameterMap
+
+	// UpdatedParams are code params deployment gets updated with
+	UpdatedParams util.NestedParameterMap
+
+	// PluginParams are plugin params passed with every invocation
+	PluginParams map[string]string
+
+	// StatusTimeout is how long to wait for deployment to become ready. Default is 1 minute
+	StatusTimeout time.Duration
+}
+
+// Run runs the conformance test suite. Every step runs as a separate subtest and suite stops on the first failed step
+func (suite *Suite) Run(t *testing.T) {
+	t.Helper()
+
+	eventLog := event.NewLog(logrus.DebugLevel, "conformance")
+	deployName := fmt.Sprintf("conformance-%d", time.Now().UnixNano())
+	movedDeployName := deployName + "-moved"
+	invocation := func(deployName string, params util.NestedParameterMap) *plugin.CodePluginInvocationParams {
+		return &plugin.CodePluginInvocationParams{
+			DeployName:   deployName,
+			Params:       params,
+			PluginParams: suite.PluginParams,
+			EventLog:     eventLog,
+		}
+	}
+
+	var clusterPlugin plugin.ClusterPlugin
+	var codePlugin plugin.CodePlugin
+
+	steps := []struct {
+		name string
+		run  func(t *testing.T)
+	}{
+		{
+			name: "validate cluster",
+			run: func(t *testing.T) {
+				var err error
+				clusterPlugin, err = suite.Registry.ForCluster(suite.Cluster)
+				if !assert.NoError(t, err, "Cluster plugin should be created") {
+					t.FailNow()
+				}
+				if !assert.NoError(t, clusterPlugin.Validate(), "Cluster should be valid") {
+					t.FailNow()
+				}
+				if !assert.Contains(t, suite.Registry.CodeTypes(suite.Cluster), suite.CodeType, "Code type should be supported for the cluster") {
+					t.FailNow()
+				}
+
+				codePlugin, err = suite.Registry.ForCodeType(suite.Cluster, suite.CodeType)
+				if !assert.NoError(t, err, "Code plugin should be created") {
+					t.FailNow()
+				}
+			},
+		},
+		{
+			name: "create",
+			run: func(t *testing.T) {
+				exists, err := codePlugin.Exists(invocation(deployName, suite.Params))
+				if !assert.NoError(t, err, "Exists should succeed") {
+					t.FailNow()
+				}
+				if !assert.False(t, exists, "Deployment shouldn't exist before it's created") {
+					t.FailNow()
+				}
+
+				if !assert.NoError(t, codePlugin.Create(invocation(deployName, suite.Params)), "Create should succeed") {
+					t.FailNow()
+				}
+
+				exists, err = codePlugin.Exists(invocation(deployName, suite.Params))
+				if !assert.NoError(t, err, "Exists should succeed") {
+					t.FailNow()
+				}
+				if !assert.True(t, exists, "Deployment should exist after it's created") {
+					t.FailNow()
+				}
+			},
+		},
+		{
+			name: "status",
+			run: func(t *testing.T) {
+				timeout := suite.StatusTimeout
+				if timeout <= 0 {
+					timeout = time.Minute
+				}
+				deadline := time.Now().Add(timeout)
+				for {
+					ready, err := codePlugin.Status(invocation(deployName, suite.Params))
+					if !assert.NoError(t, err, "Status should succeed") {
+						t.FailNow()
+					}
+					if ready {
+						return
+					}
+					if !assert.True(t, time.Now().Before(deadline), "Deployment should become ready in %s", timeout) {
+						t.FailNow()
+					}
+					time.Sleep(time.Second)
+				}
+			},
+		},
+		{
+			name: "endpoints and resources",
+			run: func(t *testing.T) {
+				_, err := codePlugin.Endpoints(invocation(deployName, suite.Params))
+				if !assert.NoError(t, err, "Endpoints should succeed") {
+					t.FailNow()
+				}
+
+				resources, err := codePlugin.Resources(invocation(deployName, suite.Params))
+				if !assert.NoError(t, err, "Resources should succeed") {
+					t.FailNow()
+				}
+				for resourceType, table := range resources {
+					for _, item := range table.Items {
+						assert.Equal(t, len(table.Headers), len(item), "Resource of type %s should have a column for every header", resourceType)
+					}
+				}
+			},
+		},
+		{
+			name: "drift and deployments",
+			run: func(t *testing.T) {
+				drift, err := codePlugin.Drift(invocation(deployName, suite.Params))
+				if !assert.NoError(t, err, "Drift should succeed") {
+					t.FailNow()
+				}
+				if !assert.Empty(t, drift, "Deployment shouldn't drift right after it's created") {
+					t.FailNow()
+				}
+
+				deployments, err := codePlugin.Deployments(eventLog)
+				if !assert.NoError(t, err, "Deployments should succeed") {
+					t.FailNow()
+				}
+				if !assert.True(t, hasDeployment(deployments, deployName), "Deployment should be listed") {
+					t.FailNow()
+				}
+			},
+		},
+		{
+			name: "update",
+			run: func(t *testing.T) {
+				if !assert.NoError(t, codePlugin.Update(invocation(deployName, suite.UpdatedParams)), "Update should succeed") {
+					t.FailNow()
+				}
+
+				drift, err := codePlugin.Drift(invocation(deployName, suite.UpdatedParams))
+				if !assert.NoError(t, err, "Drift should succeed") {
+					t.FailNow()
+				}
+				if !assert.Empty(t, drift, "Deployment shouldn't drift from params it's been updated with") {
+					t.FailNow()
+				}
+			},
+		},
+		{
+			name: "move",
+			run: func(t *testing.T) {
+				if !assert.NoError(t, codePlugin.Move(invocation(deployName, suite.UpdatedParams), invocation(movedDeployName, suite.UpdatedParams)), "Move should succeed") {
+					t.FailNow()
+				}
+
+				exists, err := codePlugin.Exists(invocation(movedDeployName, suite.UpdatedParams))
+				if !assert.NoError(t, err, "Exists should succeed") {
+					t.FailNow()
+				}
+				if !assert.True(t, exists, "Deployment should exist under the new name after it's moved") {
+					t.FailNow()
+				}
+
+				exists, err = codePlugin.Exists(invocation(deployName, suite.UpdatedParams))
+				if !assert.NoError(t, err, "Exists should succeed") {
+					t.FailNow()
+				}
+				if !assert.False(t, exists, "Deployment shouldn't exist under the old name after it's moved") {
+					t.FailNow()
+				}
+			},
+		},
+		{
+			name: "destroy",
+			run: func(t *testing.T) {
+				if !assert.NoError(t, codePlugin.Destroy(invocation(movedDeployName, suite.UpdatedParams)), "Destroy should succeed") {
+					t.FailNow()
+				}
+
+				exists, err := codePlugin.Exists(invocation(movedDeployName, suite.UpdatedParams))
+				if !assert.NoError(t, err, "Exists should succeed") {
+					t.FailNow()
+				}
+				if !assert.False(t, exists, "Deployment shouldn't exist after it's destroyed") {
+					t.FailNow()
+				}
+
+				deployments, err := codePlugin.Deployments(eventLog)
+				if !assert.NoError(t, err, "Deployments should succeed") {
+					t.FailNow()
+				}
+				if !assert.False(t, hasDeployment(deployments, movedDeployName), "Deployment shouldn't be listed after it's destroyed") {
+					t.FailNow()
+				}
+			},
+		},
+		{
+			name: "cleanup",
+			run: func(t *testing.T) {
+				if !assert.NoError(t, codePlugin.Cleanup(), "Code plugin cleanup should succeed") {
+					t.FailNow()
+				}
+				if !assert.NoError(t, clusterPlugin.Cleanup(), "Cluster plugin cleanup should succeed") {
+					t.FailNow()
+				}
+			},
+		},
+	}
+
+	for _, step := range steps {
+		if !t.Run(step.name, step.run) {
+			return
+		}
+	}
+}
+
+func hasDeployment(deployments []*plugin.Deployment, deployName string) bool {
+	for _, deployment := range deployments {
+		if deployment.DeployName == deployName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,3 @@
+// Package conformance implements a conformance test suite for plugins. It's used to check that external plugins (as
+// well as built-in ones) behave the way Aptomi engine expects them to.
+package conformance
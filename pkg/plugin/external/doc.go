@@ -0,0 +1,12 @@
+// Package external implements support for out-of-process plugins, which allow to add cluster and code types without
+// changing Aptomi itself.
+//
+// External plugin is an executable, which Aptomi starts as a subprocess and talks to using JSON-RPC over plugin's
+// stdin and stdout. On start, Aptomi calls Plugin.Info to find out which cluster and code types the plugin provides.
+// Then every call to ClusterPlugin and CodePlugin methods gets forwarded to the plugin process, together with the
+// cluster it's made for. Event log entries produced by the plugin while serving a call are sent back and written into
+// the event log on Aptomi side.
+//
+// Plugins are discovered from a directory configured in config.External. Plugin authors implement regular
+// plugin.ClusterPlugin and plugin.CodePlugin interfaces and run them using Serve.
+package external
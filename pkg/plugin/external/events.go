@@ -0,0 +1,79 @@
+package external
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/sirupsen/logrus"
+)
+
+// eventRecorder is an event log hook, which records all entries produced by plugin while serving a single call, so
+// they can be sent back to Aptomi
+type eventRecorder struct {
+	fixedFields map[string]bool
+	events      []*Event
+}
+
+func newEventLog(level logrus.Level) (*event.Log, *eventRecorder) {
+	eventLog := event.NewLog(level, "plugin")
+	recorder := &eventRecorder{
+		// fixed fields are added by event log on Aptomi side
+		fixedFields: map[string]bool{"scope": true},
+		events:      []*Event{},
+	}
+	eventLog.AddHook(recorder)
+	return eventLog, recorder
+}
+
+// Levels defines on which log levels this hook should be fired
+func (recorder *eventRecorder) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire processes a single log entry
+func (recorder *eventRecorder) Fire(e *logrus.Entry) error {
+	fields := make(map[string]interface{})
+	for key, value := range e.Data {
+		if recorder.fixedFields[key] {
+			continue
+		}
+		switch value.(type) {
+		case string, bool, int, int64, float64:
+			fields[key] = value
+		default:
+			fields[key] = fmt.Sprintf("%v", value)
+		}
+	}
+	recorder.events = append(recorder.events, &Event{
+		Level:   e.Level,
+		Message: e.Message,
+		Fields:  fields,
+	})
+	return nil
+}
+
+// forwardEvents writes events received from plugin into the event log. If event log is not specified, events are
+// written into the server log
+func forwardEvents(eventLog *event.Log, events []*Event) {
+	for _, e := range events {
+		var entry *logrus.Entry
+		if eventLog != nil {
+			entry = eventLog.NewEntry()
+		} else {
+			entry = logrus.NewEntry(logrus.StandardLogger())
+		}
+		entry = entry.WithFields(logrus.Fields(e.Fields))
+
+		// plugin is not allowed to bring Aptomi down, so panic and fatal entries are recorded as errors
+		switch e.Level {
+		case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+			entry.Error(e.Message)
+		case logrus.WarnLevel:
+			entry.Warn(e.Message)
+		case logrus.InfoLevel:
+			entry.Info(e.Message)
+		default:
+			entry.Debug(e.Message)
+		}
+	}
+}
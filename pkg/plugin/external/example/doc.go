@@ -0,0 +1,3 @@
+// Package example implements a reference external plugin, which keeps deployments in memory of the plugin process.
+// It's meant to be used as a starting point for writing external plugins.
+package example
@@ -0,0 +1,243 @@
+package example
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/external"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+const (
+	// ClusterType is a cluster type provided by the example plugin
+	ClusterType = "example"
+
+	// CodeType is a code type provided by the example plugin
+	CodeType = "example"
+)
+
+// ClusterConfig represents example cluster configuration
+type ClusterConfig struct {
+	// Domain is a domain endpoints of deployments are generated in
+	Domain string `yaml:",omitempty"`
+}
+
+// Plugin is an example cluster and code plugin, which keeps deployments in memory of the plugin process. All
+// deployments are lost once plugin process exits
+type Plugin struct {
+	cluster *lang.Cluster
+	domain  string
+	state   *clusterState
+}
+
+var _ plugin.ClusterPlugin = &Plugin{}
+var _ plugin.CodePlugin = &Plugin{}
+
+// clusterState holds deployments of a single cluster. It's shared by all plugin instances created for the cluster
+type clusterState struct {
+	mu          sync.Mutex
+	deployments map[string]util.NestedParameterMap
+}
+
+var (
+	statesMu sync.Mutex
+	states   = make(map[string]*clusterState)
+)
+
+// New creates a new example plugin for the given cluster
+func New(cluster *lang.Cluster, cfg config.Plugins) (*Plugin, error) {
+	clusterConfig := &ClusterConfig{}
+	err := cluster.ParseConfigInto(clusterConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing example specific config of cluster %s: %s", cluster.Name, err)
+	}
+
+	statesMu.Lock()
+	defer statesMu.Unlock()
+	state, exist := states[cluster.Name]
+	if !exist {
+		state = &clusterState{deployments: make(map[string]util.NestedParameterMap)}
+		states[cluster.Name] = state
+	}
+
+	return &Plugin{
+		cluster: cluster,
+		domain:  clusterConfig.Domain,
+		state:   state,
+	}, nil
+}
+
+// Serve runs example plugin as an external plugin over stdin and stdout
+func Serve() error {
+	clusterTypes := map[string]plugin.ClusterPluginConstructor{
+		ClusterType: func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+			return New(cluster, cfg)
+		},
+	}
+	codeTypes := map[string]map[string]plugin.CodePluginConstructor{
+		ClusterType: {
+			CodeType: func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+				p, ok := cluster.(*Plugin)
+				if !ok {
+					return nil, fmt.Errorf("example code plugin can't be used with cluster plugin %T", cluster)
+				}
+				return p, nil
+			},
+		},
+	}
+	return external.Serve("example", clusterTypes, codeTypes, config.Plugins{})
+}
+
+// Validate checks that example cluster has a domain configured
+func (p *Plugin) Validate() error {
+	if len(p.domain) <= 0 {
+		return fmt.Errorf("domain is not specified in config of cluster %s", p.cluster.Name)
+	}
+	return nil
+}
+
+// Cleanup does nothing, as deployments are kept in memory
+func (p *Plugin) Cleanup() error {
+	return nil
+}
+
+// Create creates a deployment
+func (p *Plugin) Create(invocation *plugin.CodePluginInvocationParams) error {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	if _, exist := p.state.deployments[invocation.DeployName]; exist {
+		return fmt.Errorf("deployment %s already exists", invocation.DeployName)
+	}
+	p.state.deployments[invocation.DeployName] = invocation.Params
+	invocation.EventLog.NewEntry().Infof("Created deployment %s in cluster %s", invocation.DeployName, p.cluster.Name)
+	return nil
+}
+
+// Update updates params of an existing deployment
+func (p *Plugin) Update(invocation *plugin.CodePluginInvocationParams) error {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	if _, exist := p.state.deployments[invocation.DeployName]; !exist {
+		return fmt.Errorf("deployment %s doesn't exist", invocation.DeployName)
+	}
+	p.state.deployments[invocation.DeployName] = invocation.Params
+	invocation.EventLog.NewEntry().Infof("Updated deployment %s in cluster %s", invocation.DeployName, p.cluster.Name)
+	return nil
+}
+
+// Destroy deletes a deployment. It's not an error if deployment doesn't exist
+func (p *Plugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	delete(p.state.deployments, invocation.DeployName)
+	invocation.EventLog.NewEntry().Infof("Destroyed deployment %s in cluster %s", invocation.DeployName, p.cluster.Name)
+	return nil
+}
+
+// Move makes an existing deployment available under the new deploy name
+func (p *Plugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	params, exist := p.state.deployments[from.DeployName]
+	if !exist {
+		return fmt.Errorf("deployment %s doesn't exist", from.DeployName)
+	}
+	delete(p.state.deployments, from.DeployName)
+	p.state.deployments[to.DeployName] = params
+	to.EventLog.NewEntry().Infof("Moved deployment %s to %s in cluster %s", from.DeployName, to.DeployName, p.cluster.Name)
+	return nil
+}
+
+// Endpoints returns a single http endpoint of the deployment in the cluster domain
+func (p *Plugin) Endpoints(invocation *plugin.CodePluginInvocationParams) (map[string]string, error) {
+	if !p.exists(invocation.DeployName) {
+		return nil, fmt.Errorf("deployment %s doesn't exist", invocation.DeployName)
+	}
+	return map[string]string{
+		"http": fmt.Sprintf("http://%s.%s", invocation.DeployName, p.domain),
+	}, nil
+}
+
+// Resources returns a single resource representing the deployment
+func (p *Plugin) Resources(invocation *plugin.CodePluginInvocationParams) (plugin.Resources, error) {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	params, exist := p.state.deployments[invocation.DeployName]
+	if !exist {
+		return nil, fmt.Errorf("deployment %s doesn't exist", invocation.DeployName)
+	}
+	keys := []string{}
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return plugin.Resources{
+		"deployment": &plugin.ResourceTable{
+			Headers: []string{"Name", "Params"},
+			Items:   []plugin.Resource{{invocation.DeployName, strings.Join(keys, ", ")}},
+		},
+	}, nil
+}
+
+// Status returns true if deployment exists, as deployments become ready immediately
+func (p *Plugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	return p.exists(invocation.DeployName), nil
+}
+
+// Drift compares params deployment has been created with to the given params
+func (p *Plugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	params, exist := p.state.deployments[invocation.DeployName]
+	if !exist {
+		return fmt.Sprintf("deployment %s doesn't exist", invocation.DeployName), nil
+	}
+	if !params.DeepEqual(invocation.Params) {
+		return fmt.Sprintf("params of deployment %s differ: %s", invocation.DeployName, params.Diff(invocation.Params)), nil
+	}
+	return "", nil
+}
+
+// Exists returns true if deployment exists
+func (p *Plugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	return p.exists(invocation.DeployName), nil
+}
+
+// Deployments returns all deployments in the cluster
+func (p *Plugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	result := []*plugin.Deployment{}
+	for deployName, params := range p.state.deployments {
+		result = append(result, &plugin.Deployment{
+			DeployName: deployName,
+			Params:     params,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DeployName < result[j].DeployName
+	})
+	return result, nil
+}
+
+func (p *Plugin) exists(deployName string) bool {
+	p.state.mu.Lock()
+	defer p.state.mu.Unlock()
+
+	_, exist := p.state.deployments[deployName]
+	return exist
+}
@@ -0,0 +1,250 @@
+package external_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/external"
+	"github.com/Aptomi/aptomi/pkg/plugin/external/conformance"
+	"github.com/Aptomi/aptomi/pkg/plugin/external/example"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// servePluginEnv is set when test binary is started as the example external plugin. It's set to "slow" when example
+// plugin has to sleep in Create (see slowPlugin)
+const servePluginEnv = "APTOMI_TEST_SERVE_EXAMPLE_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(servePluginEnv); len(mode) > 0 {
+		serve := example.Serve
+		if mode == "slow" {
+			serve = serveSlow
+		}
+		if err := serve(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestExternalPluginConformance(t *testing.T) {
+	registry, _, cleanup := makeRegistry(t)
+	defer cleanup()
+
+	suite := &conformance.Suite{
+		Registry:      registry,
+		Cluster:       makeCluster("cluster-conformance", "example.com"),
+		CodeType:      example.CodeType,
+		Params:        util.NestedParameterMap{"replicas": 1, "image": "nginx"},
+		UpdatedParams: util.NestedParameterMap{"replicas": 2, "image": "nginx", "nested": util.NestedParameterMap{"key": "value"}},
+	}
+	suite.Run(t)
+}
+
+func TestExternalPlugin(t *testing.T) {
+	registry, processes, cleanup := makeRegistry(t)
+	defer cleanup()
+
+	if !assert.Equal(t, 1, len(processes), "Example plugin should be discovered") {
+		t.FailNow()
+	}
+	info := processes[0].Info()
+	assert.Equal(t, []string{example.ClusterType}, info.ClusterTypes, "Plugin should report its cluster types")
+	assert.Equal(t, []string{example.CodeType}, info.CodeTypes[example.ClusterType], "Plugin should report its code types")
+
+	// cluster validation errors are returned from plugin
+	clusterPlugin, err := registry.ForCluster(makeCluster("cluster-no-domain", ""))
+	if !assert.NoError(t, err, "Cluster plugin should be created") {
+		t.FailNow()
+	}
+	assert.Error(t, clusterPlugin.Validate(), "Cluster without domain should be invalid")
+
+	cluster := makeCluster("cluster-events", "example.com")
+	codePlugin, err := registry.ForCodeType(cluster, example.CodeType)
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+
+	// events are forwarded into the event log
+	eventLog := event.NewLog(logrus.DebugLevel, "test-external")
+	verifier := event.NewLogVerifier("Created deployment test-deployment in cluster cluster-events", false)
+	eventLog.AddHook(verifier)
+	invocation := &plugin.CodePluginInvocationParams{
+		DeployName: "test-deployment",
+		Params:     util.NestedParameterMap{"key": "value"},
+		EventLog:   eventLog,
+	}
+	assert.NoError(t, codePlugin.Create(invocation), "Create should succeed")
+	assert.Equal(t, 1, verifier.MatchedErrorsCount(), "Event should be forwarded from plugin")
+
+	// params are passed as is
+	deployments, err := codePlugin.Deployments(eventLog)
+	if !assert.NoError(t, err, "Deployments should succeed") || !assert.Equal(t, 1, len(deployments), "Deployment should be listed") {
+		t.FailNow()
+	}
+	assert.Equal(t, invocation.Params, deployments[0].Params, "Deployment params should be preserved")
+
+	// errors are returned from plugin
+	assert.Error(t, codePlugin.Create(invocation), "Create of existing deployment should fail")
+
+	// plugin process gets restarted if it exits (deployments of the example plugin are lost)
+	assert.NoError(t, processes[0].Stop(), "Plugin process should be stopped")
+	exists, err := codePlugin.Exists(invocation)
+	assert.NoError(t, err, "Plugin process should be restarted")
+	assert.False(t, exists, "Deployment should be lost after plugin restart")
+}
+
+func TestExternalPluginTimeout(t *testing.T) {
+	processes, cleanup := discover(t, "slow", 500*time.Millisecond)
+	defer cleanup()
+
+	clusterTypes := make(map[string]plugin.ClusterPluginConstructor)
+	codeTypes := make(map[string]map[string]plugin.CodePluginConstructor)
+	if !assert.NoError(t, external.Register(processes, clusterTypes, codeTypes), "External plugins should be registered") {
+		t.FailNow()
+	}
+	registry := plugin.NewRegistry(config.Plugins{}, clusterTypes, codeTypes)
+	codePlugin, err := registry.ForCodeType(makeCluster("cluster-timeout", "example.com"), example.CodeType)
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+
+	// slow create times out, plugin process gets killed and create never completes
+	marker := filepath.Join(os.TempDir(), fmt.Sprintf("aptomi-plugin-timeout-%d", os.Getpid()))
+	defer os.Remove(marker) // nolint: errcheck
+	invocation := &plugin.CodePluginInvocationParams{
+		DeployName: "test-deployment",
+		Params:     util.NestedParameterMap{"sleep": "1s", "marker": marker},
+		EventLog:   event.NewLog(logrus.DebugLevel, "test-external"),
+	}
+	assert.Error(t, codePlugin.Create(invocation), "Create should time out")
+	time.Sleep(1500 * time.Millisecond)
+	_, err = os.Stat(marker)
+	assert.True(t, os.IsNotExist(err), "Plugin should be killed after timeout and not complete the call")
+
+	// plugin process gets restarted on the next call
+	invocation.Params = util.NestedParameterMap{}
+	assert.NoError(t, codePlugin.Create(invocation), "Create should succeed after plugin restart")
+}
+
+func TestExternalPluginConflict(t *testing.T) {
+	processes, cleanup := discover(t, "1", 0)
+	defer cleanup()
+
+	clusterTypes := map[string]plugin.ClusterPluginConstructor{
+		example.ClusterType: func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+			return nil, nil
+		},
+	}
+	codeTypes := make(map[string]map[string]plugin.CodePluginConstructor)
+	assert.Error(t, external.Register(processes, clusterTypes, codeTypes), "Registered cluster types can't be overridden")
+}
+
+// discover creates plugins dir with a script, which runs test binary as the example plugin in the given mode, and
+// discovers it. It returns a function, which stops plugin processes and deletes plugins dir
+func discover(t *testing.T, mode string, timeout time.Duration) ([]*external.Process, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "aptomi-plugins")
+	if !assert.NoError(t, err, "Temp dir should be created") {
+		t.FailNow()
+	}
+
+	binary, err := filepath.Abs(os.Args[0])
+	if !assert.NoError(t, err, "Test binary path should be resolved") {
+		t.FailNow()
+	}
+	script := fmt.Sprintf("#!/bin/sh\n%s=%s exec %q\n", servePluginEnv, mode, binary)
+	err = ioutil.WriteFile(filepath.Join(dir, "example"), []byte(script), 0755)
+	if !assert.NoError(t, err, "Plugin script should be written") {
+		t.FailNow()
+	}
+
+	// non-executable and hidden files are ignored
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("readme"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte(script), 0755))
+
+	processes, err := external.Discover(config.External{Dir: dir, Timeout: timeout})
+	if !assert.NoError(t, err, "External plugins should be discovered") {
+		t.FailNow()
+	}
+	return processes, func() {
+		for _, process := range processes {
+			process.Stop() // nolint: errcheck
+		}
+		os.RemoveAll(dir) // nolint: errcheck
+	}
+}
+
+func makeRegistry(t *testing.T) (plugin.Registry, []*external.Process, func()) {
+	t.Helper()
+
+	processes, cleanup := discover(t, "1", 0)
+	clusterTypes := make(map[string]plugin.ClusterPluginConstructor)
+	codeTypes := make(map[string]map[string]plugin.CodePluginConstructor)
+	if !assert.NoError(t, external.Register(processes, clusterTypes, codeTypes), "External plugins should be registered") {
+		t.FailNow()
+	}
+	return plugin.NewRegistry(config.Plugins{}, clusterTypes, codeTypes), processes, cleanup
+}
+
+func makeCluster(name string, domain string) *lang.Cluster {
+	return &lang.Cluster{
+		TypeKind: lang.TypeCluster.GetTypeKind(),
+		Metadata: lang.Metadata{
+			Namespace: "system",
+			Name:      name,
+		},
+		Type:   example.ClusterType,
+		Config: map[string]string{"domain": domain},
+	}
+}
+
+// serveSlow runs example plugin, which sleeps in Create for the duration given in "sleep" param and then creates
+// the file given in "marker" param
+func serveSlow() error {
+	clusterTypes := map[string]plugin.ClusterPluginConstructor{
+		example.ClusterType: func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+			return example.New(cluster, cfg)
+		},
+	}
+	codeTypes := map[string]map[string]plugin.CodePluginConstructor{
+		example.ClusterType: {
+			example.CodeType: func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+				return &slowPlugin{Plugin: cluster.(*example.Plugin)}, nil
+			},
+		},
+	}
+	return external.Serve("example", clusterTypes, codeTypes, config.Plugins{})
+}
+
+type slowPlugin struct {
+	*example.Plugin
+}
+
+func (p *slowPlugin) Create(invocation *plugin.CodePluginInvocationParams) error {
+	if sleep, ok := invocation.Params["sleep"].(string); ok {
+		duration, err := time.ParseDuration(sleep)
+		if err != nil {
+			return err
+		}
+		time.Sleep(duration)
+		err = ioutil.WriteFile(invocation.Params["marker"].(string), []byte("created"), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return p.Plugin.Create(invocation)
+}
@@ -0,0 +1,290 @@
+package external
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultTimeout is a max duration of a single plugin call, unless it's specified in config
+const defaultTimeout = 10 * time.Minute
+
+// Process is an external plugin running as a subprocess of Aptomi. Aptomi talks to it using JSON-RPC over plugin's
+// stdin and stdout, while plugin's stderr is passed through to Aptomi's stderr. Process gets restarted on the next
+// call if it exits, or if it gets killed because a call has timed out
+type Process struct {
+	mu sync.Mutex
+
+	path    string
+	timeout time.Duration
+
+	cmd    *exec.Cmd
+	client *rpc.Client
+	info   *Info
+}
+
+// NewProcess creates a new external plugin for the given executable. It doesn't start plugin process
+func NewProcess(path string, timeout time.Duration) *Process {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Process{
+		path:    path,
+		timeout: timeout,
+	}
+}
+
+// Discover starts all external plugins found in the configured directory and returns them. Every regular executable
+// file in the directory is considered a plugin, except hidden files. Cluster and code types provided by the plugins
+// are registered in policy validation, so policy can refer to them
+func Discover(cfg config.External) ([]*Process, error) {
+	if len(cfg.Dir) <= 0 {
+		return nil, nil
+	}
+
+	files, err := ioutil.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading external plugins dir %s: %s", cfg.Dir, err)
+	}
+
+	result := []*Process{}
+	for _, file := range files {
+		if !file.Mode().IsRegular() || file.Mode().Perm()&0111 == 0 || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		process := NewProcess(filepath.Join(cfg.Dir, file.Name()), cfg.Timeout)
+		info, startErr := process.Start()
+		if startErr != nil {
+			for _, started := range result {
+				started.Stop() // nolint: errcheck
+			}
+			return nil, startErr
+		}
+		log.Infof("Loaded external plugin '%s' from %s (cluster types: %s)", info.Name, process.path, info.ClusterTypes)
+
+		for _, clusterType := range info.ClusterTypes {
+			lang.RegisterClusterType(clusterType)
+			for _, codeType := range info.CodeTypes[clusterType] {
+				lang.RegisterCodeType(codeType)
+			}
+		}
+
+		result = append(result, process)
+	}
+
+	return result, nil
+}
+
+// Register adds cluster and code types supported by the external plugins into the maps of plugin constructors, which
+// are passed into plugin.NewRegistry. External plugins can't override cluster types, which have already been registered
+func Register(processes []*Process, clusterTypes map[string]plugin.ClusterPluginConstructor, codeTypes map[string]map[string]plugin.CodePluginConstructor) error {
+	for _, process := range processes {
+		info := process.Info()
+		for _, clusterType := range info.ClusterTypes {
+			if _, exist := clusterTypes[clusterType]; exist {
+				return fmt.Errorf("external plugin '%s' provides cluster type '%s', which has already been registered", info.Name, clusterType)
+			}
+			clusterTypes[clusterType] = process.newClusterPlugin
+
+			codeTypes[clusterType] = make(map[string]plugin.CodePluginConstructor)
+			for _, codeType := range info.CodeTypes[clusterType] {
+				codeTypes[clusterType][codeType] = process.codePluginConstructor(codeType)
+			}
+		}
+	}
+	return nil
+}
+
+// Start starts plugin process and returns information about the plugin
+func (process *Process) Start() (*Info, error) {
+	process.mu.Lock()
+	defer process.mu.Unlock()
+
+	_, err := process.start()
+	if err != nil {
+		return nil, err
+	}
+	return process.info, nil
+}
+
+// Info returns information about the plugin, which it has reported on start
+func (process *Process) Info() *Info {
+	process.mu.Lock()
+	defer process.mu.Unlock()
+
+	return process.info
+}
+
+// Stop stops plugin process by closing its stdin and waiting for it to exit
+func (process *Process) Stop() error {
+	process.mu.Lock()
+	defer process.mu.Unlock()
+
+	if process.client == nil {
+		return nil
+	}
+
+	// closing the client closes plugin's stdin, which makes plugin exit
+	process.client.Close() // nolint: errcheck
+	process.client = nil
+	return process.cmd.Wait()
+}
+
+// stdio combines plugin's stdout and stdin into a single connection
+type stdio struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (conn *stdio) Close() error {
+	writeErr := conn.WriteCloser.Close()
+	readErr := conn.ReadCloser.Close()
+	if writeErr != nil {
+		return writeErr
+	}
+	return readErr
+}
+
+func (process *Process) start() (*rpc.Client, error) {
+	if process.client != nil {
+		return process.client, nil
+	}
+
+	cmd := exec.Command(process.path) // nolint: gas
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error while creating stdin pipe for external plugin %s: %s", process.path, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error while creating stdout pipe for external plugin %s: %s", process.path, err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("error while starting external plugin %s: %s", process.path, err)
+	}
+
+	client := jsonrpc.NewClient(&stdio{ReadCloser: stdout, WriteCloser: stdin})
+	reply := &InfoReply{}
+	err = process.callWithTimeout(client, "Info", &InfoArgs{}, reply)
+	if err == nil && reply.Info == nil {
+		err = fmt.Errorf("no plugin info returned")
+	}
+	if err == nil && reply.Info.ProtocolVersion != ProtocolVersion {
+		err = fmt.Errorf("unsupported protocol version %d (expected %d)", reply.Info.ProtocolVersion, ProtocolVersion)
+	}
+	if err != nil {
+		client.Close()     // nolint: errcheck
+		cmd.Process.Kill() // nolint: errcheck
+		cmd.Wait()         // nolint: errcheck
+		return nil, fmt.Errorf("error while handshaking with external plugin %s: %s", process.path, err)
+	}
+
+	if process.info != nil && !sameTypes(process.info, reply.Info) {
+		log.Warnf("External plugin %s has been restarted and now reports different cluster and code types. Aptomi has to be restarted to pick them up", process.path)
+	} else {
+		process.info = reply.Info
+	}
+
+	process.cmd = cmd
+	process.client = client
+	return client, nil
+}
+
+func sameTypes(info *Info, other *Info) bool {
+	typesString := func(info *Info) string {
+		result := []string{}
+		for _, clusterType := range info.ClusterTypes {
+			codeTypes := append([]string{}, info.CodeTypes[clusterType]...)
+			sort.Strings(codeTypes)
+			result = append(result, clusterType+":"+strings.Join(codeTypes, ","))
+		}
+		sort.Strings(result)
+		return strings.Join(result, ";")
+	}
+	return typesString(info) == typesString(other)
+}
+
+// call invokes the given method of the plugin, starting plugin process if it's not running
+func (process *Process) call(method string, args interface{}, reply interface{}) error {
+	process.mu.Lock()
+	client, err := process.start()
+	process.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = process.callWithTimeout(client, method, args, reply)
+	if err == rpc.ErrShutdown || err == io.EOF || err == io.ErrUnexpectedEOF {
+		// plugin process has exited, so it will be started again on the next call
+		process.mu.Lock()
+		if process.client == client {
+			process.client = nil
+			process.cmd.Wait() // nolint: errcheck
+		}
+		process.mu.Unlock()
+		return fmt.Errorf("external plugin %s exited while serving %s: %s", process.path, method, err)
+	}
+	if _, ok := err.(*timeoutError); ok {
+		// plugin may still be serving the call, so it gets killed to make sure the call doesn't run concurrently with
+		// retries. it will be started again on the next call
+		process.mu.Lock()
+		if process.client == client {
+			process.kill()
+		}
+		process.mu.Unlock()
+		return fmt.Errorf("external plugin %s has been killed after %s of serving %s", process.path, process.timeout, method)
+	}
+	if serverErr, ok := err.(rpc.ServerError); ok {
+		// errors returned by plugin are passed as is
+		return errors.New(string(serverErr))
+	}
+	if err != nil {
+		return fmt.Errorf("error while calling %s of external plugin %s: %s", method, process.path, err)
+	}
+	return nil
+}
+
+// timeoutError is returned when plugin doesn't reply to a call in time
+type timeoutError struct {
+	timeout time.Duration
+}
+
+func (err *timeoutError) Error() string {
+	return fmt.Sprintf("timeout after %s", err.timeout)
+}
+
+func (process *Process) callWithTimeout(client *rpc.Client, method string, args interface{}, reply interface{}) error {
+	call := client.Go(serviceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-time.After(process.timeout):
+		return &timeoutError{timeout: process.timeout}
+	}
+}
+
+// kill kills plugin process and waits for it to exit. Calls in progress fail with rpc.ErrShutdown
+func (process *Process) kill() {
+	process.client.Close()     // nolint: errcheck
+	process.cmd.Process.Kill() // nolint: errcheck
+	process.cmd.Wait()         // nolint: errcheck
+	process.client = nil
+}
@@ -0,0 +1,215 @@
+package external
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// ProtocolVersion is a version of the protocol between Aptomi and external plugins. Plugins reporting a different
+// version are refused to be loaded
+const ProtocolVersion = 1
+
+// serviceName is a name of the RPC service, which every external plugin exposes
+const serviceName = "Plugin"
+
+// Info describes an external plugin and the cluster and code types it supports
+type Info struct {
+	// ProtocolVersion is a version of the protocol plugin talks
+	ProtocolVersion int
+
+	// Name is a human-readable name of the plugin
+	Name string
+
+	// ClusterTypes is a list of cluster types supported by the plugin
+	ClusterTypes []string
+
+	// CodeTypes is a map from cluster type to the list of code types supported by the plugin for it
+	CodeTypes map[string][]string
+}
+
+// InfoArgs are arguments of Plugin.Info call
+type InfoArgs struct{}
+
+// ClusterArgs are arguments of Plugin.Validate and Plugin.Cleanup calls
+type ClusterArgs struct {
+	// Cluster is a cluster serialized into yaml. Cluster config is an arbitrary structure, which can't always be
+	// represented in JSON, so yaml is used for it
+	Cluster string
+
+	// LogLevel is a level of the event log on Aptomi side, so that plugin doesn't send events which will be dropped
+	LogLevel logrus.Level
+}
+
+// CodeArgs are arguments of all Plugin calls for code plugins
+type CodeArgs struct {
+	ClusterArgs
+
+	// CodeType is a code type plugin is being invoked for
+	CodeType string
+
+	// Invocation is a deployment plugin is being invoked for. It's empty for Plugin.Deployments
+	Invocation *Invocation
+}
+
+// MoveArgs are arguments of Plugin.Move call
+type MoveArgs struct {
+	ClusterArgs
+
+	// CodeType is a code type plugin is being invoked for
+	CodeType string
+
+	// From is an existing deployment, which is being moved
+	From *Invocation
+
+	// To is a new deployment, which existing deployment is being moved to
+	To *Invocation
+}
+
+// Invocation is a wire representation of plugin.CodePluginInvocationParams
+type Invocation struct {
+	DeployName string
+
+	// Params are code params serialized into yaml, so that nested maps and value types are preserved
+	Params string
+
+	PluginParams map[string]string
+}
+
+// Event is a wire representation of an event log entry, which has been produced by plugin while serving a call
+type Event struct {
+	Level   logrus.Level
+	Message string
+	Fields  map[string]interface{}
+}
+
+// Reply is a reply to all Plugin calls, except Plugin.Info. Events are forwarded into the event log on Aptomi side.
+// Errors are returned as a part of the reply, so that events are forwarded even if plugin call fails
+type Reply struct {
+	Events []*Event
+	Error  string
+}
+
+// baseReply is implemented by all replies embedding Reply
+type baseReply interface {
+	base() *Reply
+}
+
+func (reply *Reply) base() *Reply {
+	return reply
+}
+
+// InfoReply is a reply to Plugin.Info call
+type InfoReply struct {
+	Info *Info
+}
+
+// EndpointsReply is a reply to Plugin.Endpoints call
+type EndpointsReply struct {
+	Reply
+	Endpoints map[string]string
+}
+
+// ResourcesReply is a reply to Plugin.Resources call
+type ResourcesReply struct {
+	Reply
+	Resources plugin.Resources
+}
+
+// BoolReply is a reply to Plugin.Status and Plugin.Exists calls
+type BoolReply struct {
+	Reply
+	Result bool
+}
+
+// DriftReply is a reply to Plugin.Drift call
+type DriftReply struct {
+	Reply
+	Drift string
+}
+
+// DeploymentsReply is a reply to Plugin.Deployments call
+type DeploymentsReply struct {
+	Reply
+	Deployments []*Deployment
+}
+
+// Deployment is a wire representation of plugin.Deployment
+type Deployment struct {
+	DeployName   string
+	TargetSuffix string
+
+	// Params are deployment params serialized into yaml
+	Params string
+}
+
+func encodeCluster(cluster *lang.Cluster) (string, error) {
+	data, err := yaml.Marshal(cluster)
+	if err != nil {
+		return "", fmt.Errorf("error while marshalling cluster %s: %s", cluster.Name, err)
+	}
+	return string(data), nil
+}
+
+func decodeCluster(data string) (*lang.Cluster, error) {
+	cluster := &lang.Cluster{}
+	err := yaml.Unmarshal([]byte(data), cluster)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshalling cluster: %s", err)
+	}
+	return cluster, nil
+}
+
+func encodeParams(params util.NestedParameterMap) (string, error) {
+	if params == nil {
+		return "", nil
+	}
+	data, err := yaml.Marshal(params)
+	if err != nil {
+		return "", fmt.Errorf("error while marshalling params: %s", err)
+	}
+	return string(data), nil
+}
+
+func decodeParams(data string) (util.NestedParameterMap, error) {
+	if len(data) <= 0 {
+		return nil, nil
+	}
+	params := util.NestedParameterMap{}
+	err := yaml.Unmarshal([]byte(data), &params)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshalling params: %s", err)
+	}
+	return params, nil
+}
+
+func encodeInvocation(invocation *plugin.CodePluginInvocationParams) (*Invocation, error) {
+	params, err := encodeParams(invocation.Params)
+	if err != nil {
+		return nil, err
+	}
+	return &Invocation{
+		DeployName:   invocation.DeployName,
+		Params:       params,
+		PluginParams: invocation.PluginParams,
+	}, nil
+}
+
+func decodeInvocation(invocation *Invocation) (*plugin.CodePluginInvocationParams, error) {
+	if invocation == nil {
+		return nil, fmt.Errorf("invocation is not specified")
+	}
+	params, err := decodeParams(invocation.Params)
+	if err != nil {
+		return nil, err
+	}
+	return &plugin.CodePluginInvocationParams{
+		DeployName:   invocation.DeployName,
+		Params:       params,
+		PluginParams: invocation.PluginParams,
+	}, nil
+}
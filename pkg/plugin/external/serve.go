@@ -0,0 +1,326 @@
+package external
+
+import (
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+)
+
+// Serve runs an external plugin, which provides the given cluster and code types, talking to Aptomi over stdin and
+// stdout. It blocks until Aptomi closes plugin's stdin. Stdout is reserved for the protocol, so everything else
+// written into os.Stdout by the plugin gets redirected to stderr
+func Serve(name string, clusterTypes map[string]plugin.ClusterPluginConstructor, codeTypes map[string]map[string]plugin.CodePluginConstructor, cfg config.Plugins) error {
+	conn := &stdio{ReadCloser: os.Stdin, WriteCloser: os.Stdout}
+	os.Stdout = os.Stderr
+	return ServeConn(conn, name, clusterTypes, codeTypes, cfg)
+}
+
+// ServeConn runs an external plugin, which provides the given cluster and code types, over the given connection. It
+// blocks until the connection gets closed
+func ServeConn(conn io.ReadWriteCloser, name string, clusterTypes map[string]plugin.ClusterPluginConstructor, codeTypes map[string]map[string]plugin.CodePluginConstructor, cfg config.Plugins) error {
+	server := rpc.NewServer()
+	err := server.RegisterName(serviceName, newService(name, clusterTypes, codeTypes, cfg))
+	if err != nil {
+		return fmt.Errorf("error while registering plugin service: %s", err)
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+// service serves calls from Aptomi by invoking plugins created using the given constructors. Plugins are created for
+// every cluster once and cached until Aptomi calls Cleanup for the cluster. Cluster gets a new set of plugins if its
+// definition changes
+type service struct {
+	mu sync.Mutex
+
+	info         *Info
+	config       config.Plugins
+	clusterTypes map[string]plugin.ClusterPluginConstructor
+	codeTypes    map[string]map[string]plugin.CodePluginConstructor
+
+	// Cached plugin instances by serialized cluster
+	clusters map[string]*serviceCluster
+}
+
+type serviceCluster struct {
+	clusterType   string
+	clusterPlugin plugin.ClusterPlugin
+	codePlugins   map[string]plugin.CodePlugin
+}
+
+func newService(name string, clusterTypes map[string]plugin.ClusterPluginConstructor, codeTypes map[string]map[string]plugin.CodePluginConstructor, cfg config.Plugins) *service {
+	info := &Info{
+		ProtocolVersion: ProtocolVersion,
+		Name:            name,
+		ClusterTypes:    []string{},
+		CodeTypes:       make(map[string][]string),
+	}
+	for clusterType := range clusterTypes {
+		info.ClusterTypes = append(info.ClusterTypes, clusterType)
+		info.CodeTypes[clusterType] = []string{}
+		for codeType := range codeTypes[clusterType] {
+			info.CodeTypes[clusterType] = append(info.CodeTypes[clusterType], codeType)
+		}
+		sort.Strings(info.CodeTypes[clusterType])
+	}
+	sort.Strings(info.ClusterTypes)
+
+	return &service{
+		info:         info,
+		config:       cfg,
+		clusterTypes: clusterTypes,
+		codeTypes:    codeTypes,
+		clusters:     make(map[string]*serviceCluster),
+	}
+}
+
+func (svc *service) getCluster(args *ClusterArgs) (*serviceCluster, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	result, exist := svc.clusters[args.Cluster]
+	if exist {
+		return result, nil
+	}
+
+	cluster, err := decodeCluster(args.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	constructor, exist := svc.clusterTypes[cluster.Type]
+	if !exist {
+		return nil, fmt.Errorf("no plugin found for cluster type: %s", cluster.Type)
+	}
+	clusterPlugin, err := constructor(cluster, svc.config)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &serviceCluster{
+		clusterType:   cluster.Type,
+		clusterPlugin: clusterPlugin,
+		codePlugins:   make(map[string]plugin.CodePlugin),
+	}
+	svc.clusters[args.Cluster] = result
+	return result, nil
+}
+
+func (svc *service) getCodePlugin(args *ClusterArgs, codeType string) (plugin.CodePlugin, error) {
+	cluster, err := svc.getCluster(args)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	codePlugin, exist := cluster.codePlugins[codeType]
+	if exist {
+		return codePlugin, nil
+	}
+
+	constructor, exist := svc.codeTypes[cluster.clusterType][codeType]
+	if !exist {
+		return nil, fmt.Errorf("no plugin found for code type: %s", codeType)
+	}
+	codePlugin, err = constructor(cluster.clusterPlugin, svc.config)
+	if err != nil {
+		return nil, err
+	}
+	cluster.codePlugins[codeType] = codePlugin
+	return codePlugin, nil
+}
+
+// serve runs the given function, recording events it produces and the error it returns into the reply. Plugin
+// panics are turned into errors, so they don't bring the whole plugin process down
+func serve(reply *Reply, args *ClusterArgs, fn func(eventLog *event.Log) error) error {
+	eventLog, recorder := newEventLog(args.LogLevel)
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("plugin panic: %v", r)
+			}
+		}()
+		return fn(eventLog)
+	}()
+
+	reply.Events = recorder.events
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	return nil
+}
+
+func (svc *service) serveCode(reply *Reply, args *CodeArgs, fn func(codePlugin plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams) error) error {
+	return serve(reply, &args.ClusterArgs, func(eventLog *event.Log) error {
+		codePlugin, err := svc.getCodePlugin(&args.ClusterArgs, args.CodeType)
+		if err != nil {
+			return err
+		}
+		invocation, err := decodeInvocation(args.Invocation)
+		if err != nil {
+			return err
+		}
+		invocation.EventLog = eventLog
+		return fn(codePlugin, invocation)
+	})
+}
+
+// Info returns information about the plugin
+func (svc *service) Info(args *InfoArgs, reply *InfoReply) error {
+	reply.Info = svc.info
+	return nil
+}
+
+// Validate validates the cluster
+func (svc *service) Validate(args *ClusterArgs, reply *Reply) error {
+	return serve(reply, args, func(eventLog *event.Log) error {
+		cluster, err := svc.getCluster(args)
+		if err != nil {
+			return err
+		}
+		return cluster.clusterPlugin.Validate()
+	})
+}
+
+// Cleanup cleans up cluster and code plugins of the cluster and drops them from cache
+func (svc *service) Cleanup(args *ClusterArgs, reply *Reply) error {
+	return serve(reply, args, func(eventLog *event.Log) error {
+		svc.mu.Lock()
+		cluster, exist := svc.clusters[args.Cluster]
+		delete(svc.clusters, args.Cluster)
+		svc.mu.Unlock()
+
+		if !exist {
+			return nil
+		}
+		for _, codePlugin := range cluster.codePlugins {
+			if err := codePlugin.Cleanup(); err != nil {
+				return err
+			}
+		}
+		return cluster.clusterPlugin.Cleanup()
+	})
+}
+
+// Create creates a deployment
+func (svc *service) Create(args *CodeArgs, reply *Reply) error {
+	return svc.serveCode(reply, args, func(codePlugin plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams) error {
+		return codePlugin.Create(invocation)
+	})
+}
+
+// Update updates a deployment
+func (svc *service) Update(args *CodeArgs, reply *Reply) error {
+	return svc.serveCode(reply, args, func(codePlugin plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams) error {
+		return codePlugin.Update(invocation)
+	})
+}
+
+// Destroy destroys a deployment
+func (svc *service) Destroy(args *CodeArgs, reply *Reply) error {
+	return svc.serveCode(reply, args, func(codePlugin plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams) error {
+		return codePlugin.Destroy(invocation)
+	})
+}
+
+// Endpoints returns endpoints of a deployment
+func (svc *service) Endpoints(args *CodeArgs, reply *EndpointsReply) error {
+	return svc.serveCode(&reply.Reply, args, func(codePlugin plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams) error {
+		var err error
+		reply.Endpoints, err = codePlugin.Endpoints(invocation)
+		return err
+	})
+}
+
+// Resources returns resources of a deployment
+func (svc *service) Resources(args *CodeArgs, reply *ResourcesReply) error {
+	return svc.serveCode(&reply.Reply, args, func(codePlugin plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams) error {
+		var err error
+		reply.Resources, err = codePlugin.Resources(invocation)
+		return err
+	})
+}
+
+// Status returns readiness of a deployment
+func (svc *service) Status(args *CodeArgs, reply *BoolReply) error {
+	return svc.serveCode(&reply.Reply, args, func(codePlugin plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams) error {
+		var err error
+		reply.Result, err = codePlugin.Status(invocation)
+		return err
+	})
+}
+
+// Drift returns drift of a deployment from the given params
+func (svc *service) Drift(args *CodeArgs, reply *DriftReply) error {
+	return svc.serveCode(&reply.Reply, args, func(codePlugin plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams) error {
+		var err error
+		reply.Drift, err = codePlugin.Drift(invocation)
+		return err
+	})
+}
+
+// Exists returns whether a deployment exists
+func (svc *service) Exists(args *CodeArgs, reply *BoolReply) error {
+	return svc.serveCode(&reply.Reply, args, func(codePlugin plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams) error {
+		var err error
+		reply.Result, err = codePlugin.Exists(invocation)
+		return err
+	})
+}
+
+// Deployments returns all deployments created by the code plugin
+func (svc *service) Deployments(args *CodeArgs, reply *DeploymentsReply) error {
+	return serve(&reply.Reply, &args.ClusterArgs, func(eventLog *event.Log) error {
+		codePlugin, err := svc.getCodePlugin(&args.ClusterArgs, args.CodeType)
+		if err != nil {
+			return err
+		}
+		deployments, err := codePlugin.Deployments(eventLog)
+		if err != nil {
+			return err
+		}
+		reply.Deployments = []*Deployment{}
+		for _, deployment := range deployments {
+			params, encodeErr := encodeParams(deployment.Params)
+			if encodeErr != nil {
+				return encodeErr
+			}
+			reply.Deployments = append(reply.Deployments, &Deployment{
+				DeployName:   deployment.DeployName,
+				TargetSuffix: deployment.TargetSuffix,
+				Params:       params,
+			})
+		}
+		return nil
+	})
+}
+
+// Move moves an existing deployment under the new deploy name
+func (svc *service) Move(args *MoveArgs, reply *Reply) error {
+	return serve(reply, &args.ClusterArgs, func(eventLog *event.Log) error {
+		codePlugin, err := svc.getCodePlugin(&args.ClusterArgs, args.CodeType)
+		if err != nil {
+			return err
+		}
+		from, err := decodeInvocation(args.From)
+		if err != nil {
+			return err
+		}
+		to, err := decodeInvocation(args.To)
+		if err != nil {
+			return err
+		}
+		from.EventLog = eventLog
+		to.EventLog = eventLog
+		return codePlugin.Move(from, to)
+	})
+}
@@ -0,0 +1,70 @@
+package fake
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Aptomi/aptomi/pkg/plugin"
+)
+
+type memoryDataStore struct {
+	lock sync.Mutex
+	data map[string]map[string]string
+}
+
+var _ plugin.DataStore = &memoryDataStore{}
+
+// NewDataStore returns plugin data store, which keeps all data in memory
+func NewDataStore() plugin.DataStore {
+	return &memoryDataStore{
+		data: make(map[string]map[string]string),
+	}
+}
+
+func (store *memoryDataStore) LoadPluginData(name string) (map[string]string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	data, found := store.data[name]
+	if !found {
+		return nil, nil
+	}
+	return copyData(data), nil
+}
+
+func (store *memoryDataStore) FindPluginData(prefix string) (map[string]map[string]string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	result := make(map[string]map[string]string)
+	for name, data := range store.data {
+		if strings.HasPrefix(name, prefix) {
+			result[name] = copyData(data)
+		}
+	}
+	return result, nil
+}
+
+func (store *memoryDataStore) SavePluginData(name string, data map[string]string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.data[name] = copyData(data)
+	return nil
+}
+
+func (store *memoryDataStore) DeletePluginData(name string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.data, name)
+	return nil
+}
+
+func copyData(data map[string]string) map[string]string {
+	result := make(map[string]string)
+	for file, content := range data {
+		result[file] = content
+	}
+	return result
+}
@@ -3,6 +3,7 @@ package fake
 import (
 	"fmt"
 
+	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/plugin"
 )
 
@@ -45,11 +46,24 @@ func (plugin *failCodePlugin) Update(invocation *plugin.CodePluginInvocationPara
 	return plugin.fail("update", invocation.DeployName)
 }
 
+func (plugin *failCodePlugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	to.EventLog.NewEntry().Infof("[^] %s -> %s", from.DeployName, to.DeployName)
+	return plugin.fail("move", to.DeployName)
+}
+
 func (plugin *failCodePlugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
 	invocation.EventLog.NewEntry().Infof("[-] %s", invocation.DeployName)
 	return plugin.fail("delete", invocation.DeployName)
 }
 
+func (plugin *failCodePlugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	return false, nil
+}
+
+func (plugin *failCodePlugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	return nil, nil
+}
+
 func (plugin *failCodePlugin) Endpoints(invocation *plugin.CodePluginInvocationParams) (map[string]string, error) {
 	return make(map[string]string), nil
 }
@@ -61,3 +75,7 @@ func (plugin *failCodePlugin) Resources(invocation *plugin.CodePluginInvocationP
 func (plugin *failCodePlugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
 	return false, nil
 }
+
+func (plugin *failCodePlugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	return "", nil
+}
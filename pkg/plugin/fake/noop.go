@@ -3,6 +3,7 @@ package fake
 import (
 	"time"
 
+	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/plugin"
 )
 
@@ -45,6 +46,19 @@ func (plugin *noOpPlugin) Update(invocation *plugin.CodePluginInvocationParams)
 	return nil
 }
 
+func (plugin *noOpPlugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	time.Sleep(plugin.sleepTime)
+	return nil
+}
+
+func (plugin *noOpPlugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	return false, nil
+}
+
+func (plugin *noOpPlugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	return nil, nil
+}
+
 func (plugin *noOpPlugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
 	time.Sleep(plugin.sleepTime)
 	return nil
@@ -64,3 +78,7 @@ func (plugin *noOpPlugin) Resources(invocation *plugin.CodePluginInvocationParam
 func (plugin *noOpPlugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
 	return true, nil
 }
+
+func (plugin *noOpPlugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,314 @@
+package fake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// simulatedClusterPlugin is a cluster plugin for simulated clusters, which are always valid
+type simulatedClusterPlugin struct {
+	cluster *lang.Cluster
+	sim     *Simulation
+}
+
+var _ plugin.ClusterPlugin = &simulatedClusterPlugin{}
+
+// simulatedCodePlugin is a code plugin, which doesn't deploy anything, but keeps components in the simulation. It
+// generates endpoints and resources from code params, reports components ready after configured delay and fails
+// actions according to simulation config
+type simulatedCodePlugin struct {
+	cluster *lang.Cluster
+	sim     *Simulation
+}
+
+var _ plugin.CodePlugin = &simulatedCodePlugin{}
+
+// NewClusterPlugin returns simulated cluster plugin for specified cluster. It could be used as a cluster plugin
+// constructor for any cluster type
+func (sim *Simulation) NewClusterPlugin(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+	return &simulatedClusterPlugin{
+		cluster: cluster,
+		sim:     sim,
+	}, nil
+}
+
+// NewCodePlugin returns simulated code plugin for specified simulated cluster plugin. It could be used as a code
+// plugin constructor for any code type
+func (sim *Simulation) NewCodePlugin(clusterPlugin plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+	simulatedCluster, ok := clusterPlugin.(*simulatedClusterPlugin)
+	if !ok {
+		return nil, fmt.Errorf("simulated cluster plugin expected for simulated code plugin creation but received: %T", clusterPlugin)
+	}
+
+	return &simulatedCodePlugin{
+		cluster: simulatedCluster.cluster,
+		sim:     sim,
+	}, nil
+}
+
+func (p *simulatedClusterPlugin) Validate() error {
+	return nil
+}
+
+func (p *simulatedClusterPlugin) Cleanup() error {
+	return nil
+}
+
+func (p *simulatedCodePlugin) Cleanup() error {
+	return nil
+}
+
+func (p *simulatedCodePlugin) Create(invocation *plugin.CodePluginInvocationParams) error {
+	err := p.sim.act("create", invocation.DeployName)
+	if err != nil {
+		return err
+	}
+
+	return p.sim.update(p.cluster.Name, func(records map[string]*simulatedRecord) error {
+		if _, exist := records[invocation.DeployName]; exist {
+			return fmt.Errorf("simulated component %s already exists", invocation.DeployName)
+		}
+		now := time.Now()
+		records[invocation.DeployName] = &simulatedRecord{
+			Params:    invocation.Params,
+			CreatedAt: now,
+			UpdatedAt: now,
+			ReadyAt:   now.Add(p.sim.cfg.ReadyDelay),
+		}
+		invocation.EventLog.NewEntry().Debugf("Simulated component %s created", invocation.DeployName)
+		return nil
+	})
+}
+
+func (p *simulatedCodePlugin) Update(invocation *plugin.CodePluginInvocationParams) error {
+	err := p.sim.act("update", invocation.DeployName)
+	if err != nil {
+		return err
+	}
+
+	return p.sim.update(p.cluster.Name, func(records map[string]*simulatedRecord) error {
+		now := time.Now()
+		record, exist := records[invocation.DeployName]
+		if !exist {
+			record = &simulatedRecord{CreatedAt: now}
+			records[invocation.DeployName] = record
+		}
+		record.Params = invocation.Params
+		record.UpdatedAt = now
+		record.ReadyAt = now.Add(p.sim.cfg.ReadyDelay)
+		invocation.EventLog.NewEntry().Debugf("Simulated component %s updated", invocation.DeployName)
+		return nil
+	})
+}
+
+func (p *simulatedCodePlugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
+	err := p.sim.act("destroy", invocation.DeployName)
+	if err != nil {
+		return err
+	}
+
+	return p.sim.update(p.cluster.Name, func(records map[string]*simulatedRecord) error {
+		delete(records, invocation.DeployName)
+		invocation.EventLog.NewEntry().Debugf("Simulated component %s destroyed", invocation.DeployName)
+		return nil
+	})
+}
+
+func (p *simulatedCodePlugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	err := p.sim.act("move", from.DeployName)
+	if err != nil {
+		return err
+	}
+
+	return p.sim.update(p.cluster.Name, func(records map[string]*simulatedRecord) error {
+		record, exist := records[from.DeployName]
+		if !exist {
+			return fmt.Errorf("simulated component %s not found", from.DeployName)
+		}
+		delete(records, from.DeployName)
+		records[to.DeployName] = record
+		to.EventLog.NewEntry().Debugf("Simulated component moved from %s to %s", from.DeployName, to.DeployName)
+		return nil
+	})
+}
+
+// Endpoints returns endpoints for ports declared in code params ("port" and "ports" params, the same way as for local
+// processes) or a single "http" endpoint if there are no ports in code params
+func (p *simulatedCodePlugin) Endpoints(invocation *plugin.CodePluginInvocationParams) (map[string]string, error) {
+	ports, err := simulatedPorts(invocation.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	host := p.host(invocation.DeployName)
+	endpoints := make(map[string]string)
+	for name, port := range ports {
+		url := fmt.Sprintf("%s:%d", host, port)
+		if util.StringContainsAny(name, "https") {
+			url = "https://" + url
+		} else if util.StringContainsAny(name, "ui", "rest", "http") {
+			url = "http://" + url
+		}
+		endpoints[name] = url
+	}
+	return endpoints, nil
+}
+
+// Resources returns a service with all endpoints and a number of pods equal to "replicas" code param (1 by default)
+func (p *simulatedCodePlugin) Resources(invocation *plugin.CodePluginInvocationParams) (plugin.Resources, error) {
+	services := &plugin.ResourceTable{
+		Headers: []string{"Name", "Host", "Ports", "Created"},
+		Items:   []plugin.Resource{},
+	}
+	pods := &plugin.ResourceTable{
+		Headers: []string{"Name", "Status", "Ready", "Created"},
+		Items:   []plugin.Resource{},
+	}
+
+	record := p.sim.get(p.cluster.Name, invocation.DeployName)
+	if record != nil {
+		ports, err := simulatedPorts(record.Params)
+		if err != nil {
+			return nil, err
+		}
+		portList := []string{}
+		for _, name := range util.GetSortedStringKeys(ports) {
+			portList = append(portList, fmt.Sprintf("%s:%d", name, ports[name]))
+		}
+		services.Items = append(services.Items, plugin.Resource{
+			invocation.DeployName,
+			p.host(invocation.DeployName),
+			strings.Join(portList, ","),
+			record.CreatedAt.Format(time.RFC3339),
+		})
+
+		replicas, err := simulatedReplicas(record.Params)
+		if err != nil {
+			return nil, err
+		}
+		status, ready := "ContainerCreating", "0/1"
+		if record.isReady() {
+			status, ready = "Running", "1/1"
+		}
+		for i := 0; i < replicas; i++ {
+			pods.Items = append(pods.Items, plugin.Resource{
+				fmt.Sprintf("%s-%d", invocation.DeployName, i),
+				status,
+				ready,
+				record.UpdatedAt.Format(time.RFC3339),
+			})
+		}
+	}
+
+	return plugin.Resources{
+		"service": services,
+		"pod":     pods,
+	}, nil
+}
+
+// Status returns true if the component exists and configured ready delay has passed since it was created or updated
+func (p *simulatedCodePlugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	record := p.sim.get(p.cluster.Name, invocation.DeployName)
+	return record != nil && record.isReady(), nil
+}
+
+func (p *simulatedCodePlugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	record := p.sim.get(p.cluster.Name, invocation.DeployName)
+	if record == nil {
+		return fmt.Sprintf("simulated component %s not found", invocation.DeployName), nil
+	}
+	if !record.Params.DeepEqual(invocation.Params) {
+		return fmt.Sprintf("simulated component %s has different params: %s", invocation.DeployName, record.Params.Diff(invocation.Params)), nil
+	}
+	return "", nil
+}
+
+func (p *simulatedCodePlugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	return p.sim.get(p.cluster.Name, invocation.DeployName) != nil, nil
+}
+
+func (p *simulatedCodePlugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	records := p.sim.list(p.cluster.Name)
+	result := []*plugin.Deployment{}
+	for _, deployName := range util.GetSortedStringKeys(records) {
+		result = append(result, &plugin.Deployment{
+			DeployName: deployName,
+			Params:     records[deployName].Params,
+		})
+	}
+	return result, nil
+}
+
+// host returns a fake host name of the component
+func (p *simulatedCodePlugin) host(deployName string) string {
+	return fmt.Sprintf("%s.%s.simulated", strings.ToLower(util.EscapeName(deployName)), strings.ToLower(util.EscapeName(p.cluster.Name)))
+}
+
+func (record *simulatedRecord) isReady() bool {
+	return !time.Now().Before(record.ReadyAt)
+}
+
+// simulatedPorts returns ports declared in "port" and "ports" code params or a single "http" port 80 if there are none
+func simulatedPorts(params util.NestedParameterMap) (map[string]int, error) {
+	result := make(map[string]int)
+
+	if port, exist := params["port"]; exist {
+		portNum, err := simulatedNumber("port", port)
+		if err != nil {
+			return nil, err
+		}
+		result["http"] = portNum
+	}
+
+	if ports, exist := params["ports"]; exist {
+		portsMap, isMap := ports.(util.NestedParameterMap)
+		if !isMap {
+			return nil, fmt.Errorf("ports should be a map, but found: %T", ports)
+		}
+		for name, port := range portsMap {
+			portNum, err := simulatedNumber("port", port)
+			if err != nil {
+				return nil, err
+			}
+			result[name] = portNum
+		}
+	}
+
+	if len(result) <= 0 {
+		result["http"] = 80
+	}
+
+	return result, nil
+}
+
+// simulatedReplicas returns number of replicas declared in "replicas" code param or 1 if it's not set
+func simulatedReplicas(params util.NestedParameterMap) (int, error) {
+	replicas, exist := params["replicas"]
+	if !exist {
+		return 1, nil
+	}
+	return simulatedNumber("replicas", replicas)
+}
+
+func simulatedNumber(name string, value interface{}) (int, error) {
+	switch number := value.(type) {
+	case int:
+		return number, nil
+	case string:
+		result, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("%s should be a number, but found: %s", name, number)
+		}
+		return result, nil
+	default:
+		return 0, fmt.Errorf("%s should be a number, but found: %T", name, value)
+	}
+}
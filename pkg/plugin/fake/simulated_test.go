@@ -0,0 +1,158 @@
+package fake
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/external/conformance"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatedPluginConformance(t *testing.T) {
+	sim, err := NewSimulation(config.Simulated{ReadyDelay: 200 * time.Millisecond})
+	if !assert.NoError(t, err, "Simulation should be created") {
+		t.FailNow()
+	}
+
+	suite := &conformance.Suite{
+		Registry:      makeSimulatedRegistry(sim),
+		Cluster:       makeSimulatedCluster(),
+		CodeType:      "helm",
+		Params:        util.NestedParameterMap{"replicas": 2},
+		UpdatedParams: util.NestedParameterMap{"replicas": 3, "port": 8080},
+		StatusTimeout: 5 * time.Second,
+	}
+	suite.Run(t)
+}
+
+func TestSimulatedPlugin(t *testing.T) {
+	stateDir, err := ioutil.TempDir("", "aptomi-simulated")
+	if !assert.NoError(t, err, "Temp dir should be created") {
+		t.FailNow()
+	}
+	defer os.RemoveAll(stateDir) // nolint: errcheck
+
+	cfg := config.Simulated{
+		StateFile:   filepath.Join(stateDir, "state.yaml"),
+		ReadyDelay:  time.Hour,
+		FailPattern: "^broken",
+		FailActions: []string{"create"},
+	}
+	sim, err := NewSimulation(cfg)
+	if !assert.NoError(t, err, "Simulation should be created") {
+		t.FailNow()
+	}
+
+	cluster := makeSimulatedCluster()
+	codePlugin, err := makeSimulatedRegistry(sim).ForCodeType(cluster, "raw")
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+
+	eventLog := event.NewLog(logrus.WarnLevel, "test-simulated")
+	invocation := &plugin.CodePluginInvocationParams{
+		DeployName: "test-component",
+		Params:     util.NestedParameterMap{"ports": util.NestedParameterMap{"https": "8443", "db": 5432}},
+		EventLog:   eventLog,
+	}
+	if !assert.NoError(t, codePlugin.Create(invocation), "Component should be created") {
+		t.FailNow()
+	}
+
+	endpoints, err := codePlugin.Endpoints(invocation)
+	assert.NoError(t, err, "Endpoints should be returned")
+	assert.Equal(t, map[string]string{
+		"https": "https://test-component.cluster-simulated.simulated:8443",
+		"db":    "test-component.cluster-simulated.simulated:5432",
+	}, endpoints, "Endpoints should be generated from ports")
+
+	// component is not ready until ready delay passes
+	ready, err := codePlugin.Status(invocation)
+	assert.NoError(t, err, "Status should be returned")
+	assert.False(t, ready, "Component should not be ready before ready delay")
+
+	resources, err := codePlugin.Resources(invocation)
+	if !assert.NoError(t, err, "Resources should be returned") || !assert.Equal(t, 1, len(resources["pod"].Items), "Single pod should be returned by default") {
+		t.FailNow()
+	}
+	assert.Equal(t, "ContainerCreating", resources["pod"].Items[0][1], "Pod should not be running before ready delay")
+	assert.Equal(t, "db:5432,https:8443", resources["service"].Items[0][2], "Service should have all ports")
+
+	// failures are injected for matching components and actions only
+	broken := &plugin.CodePluginInvocationParams{
+		DeployName: "broken-component",
+		Params:     util.NestedParameterMap{},
+		EventLog:   eventLog,
+	}
+	assert.Error(t, codePlugin.Create(broken), "Create should fail for component matching fail pattern")
+	assert.NoError(t, codePlugin.Update(broken), "Update should not fail, as only create fails")
+
+	// deployed components are loaded from state file by the new simulation
+	restored, err := NewSimulation(cfg)
+	if !assert.NoError(t, err, "Simulation should be restored") {
+		t.FailNow()
+	}
+	restoredPlugin, err := makeSimulatedRegistry(restored).ForCodeType(cluster, "raw")
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+	deployments, err := restoredPlugin.Deployments(eventLog)
+	assert.NoError(t, err, "Deployments should be returned")
+	assert.Equal(t, 2, len(deployments), "Deployed components should be restored from state file")
+	drift, err := restoredPlugin.Drift(invocation)
+	assert.NoError(t, err, "Drift should be returned")
+	assert.Empty(t, drift, "Restored component should not be drifted")
+
+	// invalid config is rejected
+	_, err = NewSimulation(config.Simulated{FailRate: 2})
+	assert.Error(t, err, "Fail rate out of range should be rejected")
+	_, err = NewSimulation(config.Simulated{FailActions: []string{"endpoints"}})
+	assert.Error(t, err, "Unknown fail action should be rejected")
+}
+
+func TestSimulatedPluginFailRate(t *testing.T) {
+	sim, err := NewSimulation(config.Simulated{FailRate: 1})
+	if !assert.NoError(t, err, "Simulation should be created") {
+		t.FailNow()
+	}
+	codePlugin, err := makeSimulatedRegistry(sim).ForCodeType(makeSimulatedCluster(), "helm")
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+
+	invocation := &plugin.CodePluginInvocationParams{
+		DeployName: "test-component",
+		Params:     util.NestedParameterMap{},
+		EventLog:   event.NewLog(logrus.WarnLevel, "test-simulated"),
+	}
+	assert.Error(t, codePlugin.Create(invocation), "Create should fail with fail rate 1")
+	exists, err := codePlugin.Exists(invocation)
+	assert.NoError(t, err, "Exists should be returned")
+	assert.False(t, exists, "Component should not be created if create failed")
+}
+
+func makeSimulatedRegistry(sim *Simulation) plugin.Registry {
+	clusterTypes := map[string]plugin.ClusterPluginConstructor{"kubernetes": sim.NewClusterPlugin}
+	codeTypes := map[string]map[string]plugin.CodePluginConstructor{"kubernetes": {"helm": sim.NewCodePlugin, "raw": sim.NewCodePlugin}}
+	return plugin.NewRegistry(config.Plugins{}, clusterTypes, codeTypes)
+}
+
+func makeSimulatedCluster() *lang.Cluster {
+	return &lang.Cluster{
+		TypeKind: lang.TypeCluster.GetTypeKind(),
+		Metadata: lang.Metadata{
+			Namespace: "system",
+			Name:      "cluster-simulated",
+		},
+		Type: "kubernetes",
+	}
+}
@@ -0,0 +1,182 @@
+package fake
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"gopkg.in/yaml.v2"
+)
+
+// simulatedRecord is a component, which has been "deployed" by simulated plugins
+type simulatedRecord struct {
+	Params    util.NestedParameterMap
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ReadyAt   time.Time
+}
+
+// Simulation keeps components "deployed" by simulated plugins and decides when actions fail. All simulated plugins
+// created by the same simulation share deployed components, so they could be seen by both enforcer and updater
+type Simulation struct {
+	cfg         config.Simulated
+	failPattern *regexp.Regexp
+
+	mu      sync.Mutex
+	records map[string]map[string]*simulatedRecord
+	random  *rand.Rand
+}
+
+// NewSimulation creates a new simulation for specified config. If state file is configured, previously deployed
+// components are loaded from it
+func NewSimulation(cfg config.Simulated) (*Simulation, error) {
+	sim := &Simulation{
+		cfg:     cfg,
+		records: make(map[string]map[string]*simulatedRecord),
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())), // nolint: gas
+	}
+
+	if cfg.FailRate < 0 || cfg.FailRate > 1 {
+		return nil, fmt.Errorf("simulated fail rate should be in range 0-1, but found: %f", cfg.FailRate)
+	}
+
+	if len(cfg.FailPattern) > 0 {
+		var err error
+		sim.failPattern, err = regexp.Compile(cfg.FailPattern)
+		if err != nil {
+			return nil, fmt.Errorf("error while compiling simulated fail pattern '%s': %s", cfg.FailPattern, err)
+		}
+	}
+
+	for _, action := range cfg.FailActions {
+		if !util.ContainsString(simulatedActions, action) {
+			return nil, fmt.Errorf("simulated fail action should be one of %v, but found: %s", simulatedActions, action)
+		}
+	}
+
+	err := sim.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return sim, nil
+}
+
+// simulatedActions are actions failures can be injected into
+var simulatedActions = []string{"create", "update", "move", "destroy"}
+
+// act sleeps configured time and then returns an error if the action should fail for the given deploy name
+func (sim *Simulation) act(action string, deployName string) error {
+	time.Sleep(sim.cfg.ActionSleep)
+
+	if len(sim.cfg.FailActions) > 0 && !util.ContainsString(sim.cfg.FailActions, action) {
+		return nil
+	}
+
+	if sim.failPattern != nil && sim.failPattern.MatchString(deployName) {
+		return fmt.Errorf("simulated failure of %s for %s (matches pattern '%s')", action, deployName, sim.cfg.FailPattern)
+	}
+
+	if sim.cfg.FailRate > 0 {
+		sim.mu.Lock()
+		roll := sim.random.Float64()
+		sim.mu.Unlock()
+		if roll < sim.cfg.FailRate {
+			return fmt.Errorf("simulated failure of %s for %s (fail rate %.2f)", action, deployName, sim.cfg.FailRate)
+		}
+	}
+
+	return nil
+}
+
+// update calls the given function to modify deployed components of the cluster and saves them into the state file
+func (sim *Simulation) update(cluster string, fn func(records map[string]*simulatedRecord) error) error {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	records, exist := sim.records[cluster]
+	if !exist {
+		records = make(map[string]*simulatedRecord)
+		sim.records[cluster] = records
+	}
+
+	err := fn(records)
+	if err != nil {
+		return err
+	}
+	return sim.save()
+}
+
+// get returns a copy of the deployed component record, or nil if it doesn't exist
+func (sim *Simulation) get(cluster string, deployName string) *simulatedRecord {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	record, exist := sim.records[cluster][deployName]
+	if !exist {
+		return nil
+	}
+	result := *record
+	return &result
+}
+
+// list returns copies of all deployed component records of the cluster
+func (sim *Simulation) list(cluster string) map[string]*simulatedRecord {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	result := make(map[string]*simulatedRecord)
+	for deployName, record := range sim.records[cluster] {
+		recordCopy := *record
+		result[deployName] = &recordCopy
+	}
+	return result
+}
+
+func (sim *Simulation) load() error {
+	if len(sim.cfg.StateFile) <= 0 {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(sim.cfg.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error while reading simulated state from %s: %s", sim.cfg.StateFile, err)
+	}
+	err = yaml.Unmarshal(data, &sim.records)
+	if err != nil {
+		return fmt.Errorf("error while unmarshalling simulated state from %s: %s", sim.cfg.StateFile, err)
+	}
+	return nil
+}
+
+func (sim *Simulation) save() error {
+	if len(sim.cfg.StateFile) <= 0 {
+		return nil
+	}
+
+	data, err := yaml.Marshal(sim.records)
+	if err != nil {
+		return fmt.Errorf("error while marshalling simulated state: %s", err)
+	}
+
+	// write into temp file first and then rename it, so state doesn't get corrupted if server crashes
+	tmpPath := sim.cfg.StateFile + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("error while writing simulated state into %s: %s", tmpPath, err)
+	}
+	err = os.Rename(tmpPath, sim.cfg.StateFile)
+	if err != nil {
+		return fmt.Errorf("error while renaming %s into %s: %s", tmpPath, sim.cfg.StateFile, err)
+	}
+	return nil
+}
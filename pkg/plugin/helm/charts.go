@@ -0,0 +1,341 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/ghodss/yaml"
+	"github.com/patrickmn/go-cache"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/repo"
+)
+
+// chartRef is a reference to the chart from code params. Chart is either carried with the policy as an archive, taken
+// from the chart repository, from the path in the server charts dir or by name from the server charts dir
+type chartRef struct {
+	Repo    string
+	Name    string
+	Version string
+	Path    string
+	Archive string
+}
+
+func (ref *chartRef) String() string {
+	if len(ref.Archive) > 0 && len(ref.Name) <= 0 {
+		return "chart archive"
+	}
+	if len(ref.Path) > 0 {
+		return ref.Path
+	}
+	if len(ref.Version) > 0 {
+		return ref.Name + "-" + ref.Version
+	}
+	return ref.Name
+}
+
+func getChartRef(params util.NestedParameterMap) (*chartRef, error) {
+	ref := &chartRef{}
+	for key, value := range map[string]*string{"chartRepo": &ref.Repo, "chartName": &ref.Name, "chartVersion": &ref.Version, "chartPath": &ref.Path, "chartArchive": &ref.Archive} {
+		if _, ok := params[key]; !ok {
+			continue
+		}
+		str, ok := params[key].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a valid string", key)
+		}
+		*value = str
+	}
+
+	if len(ref.Archive) <= 0 && len(ref.Path) <= 0 && len(ref.Name) <= 0 {
+		return nil, fmt.Errorf("chartName, chartPath or chartArchive is a mandatory parameter")
+	}
+
+	return ref, nil
+}
+
+// ChartFetcher fetches charts referenced in code params. Charts from chart repositories are cached on disk by digest,
+// so every chart version is downloaded only once, and repository indexes are cached in memory for a minute
+type ChartFetcher struct {
+	config  config.Helm
+	secrets secrets.SecretLoader
+	indexes *cache.Cache
+}
+
+// NewChartFetcher returns new chart fetcher for the given Helm plugin config. Credentials for private chart
+// repositories are loaded using the given secret loader
+func NewChartFetcher(cfg config.Helm, secretLoader secrets.SecretLoader) *ChartFetcher {
+	return &ChartFetcher{
+		config:  cfg,
+		secrets: secretLoader,
+		indexes: cache.New(time.Minute, time.Minute),
+	}
+}
+
+// Fetch returns path to the chart directory or chart tarball, which could be loaded by chartutil
+func (f *ChartFetcher) Fetch(ref *chartRef, eventLog *event.Log) (string, error) {
+	if len(ref.Archive) > 0 {
+		return f.archivedChart(ref.Archive)
+	}
+	if len(ref.Path) > 0 {
+		return f.localChart(ref.Path)
+	}
+	if len(ref.Repo) <= 0 {
+		return f.bundledChart(ref.Name, ref.Version)
+	}
+	return f.remoteChart(ref, eventLog)
+}
+
+// localChart returns path to the chart directory or tarball in the charts dir. Path can't point outside of it
+func (f *ChartFetcher) localChart(chartPath string) (string, error) {
+	if len(f.config.ChartsDir) <= 0 {
+		return "", fmt.Errorf("charts dir isn't configured for helm plugin, so chart %s can't be used", chartPath)
+	}
+
+	path := filepath.Join(f.config.ChartsDir, filepath.Clean("/"+chartPath))
+	_, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("error while looking for chart %s in charts dir: %s", chartPath, err)
+	}
+
+	return path, nil
+}
+
+// bundledChart looks for the chart by name in the charts dir, either as a <name>-<version>.tgz tarball (the way
+// "helm package" names them) or as a <name> directory
+func (f *ChartFetcher) bundledChart(name, version string) (string, error) {
+	if len(f.config.ChartsDir) <= 0 {
+		return "", fmt.Errorf("chartRepo isn't specified and charts dir isn't configured for helm plugin, so chart %s can't be found", name)
+	}
+
+	if len(version) > 0 {
+		tarball := filepath.Join(f.config.ChartsDir, filepath.Clean("/"+name+"-"+version+".tgz"))
+		if _, err := os.Stat(tarball); err == nil {
+			return tarball, nil
+		}
+	}
+
+	dir := filepath.Join(f.config.ChartsDir, filepath.Clean("/"+name))
+	metadata, err := chartutil.LoadChartfile(filepath.Join(dir, chartutil.ChartfileName))
+	if err != nil {
+		return "", fmt.Errorf("chart %s not found in charts dir: %s", name, err)
+	}
+	if len(version) > 0 && metadata.GetVersion() != version {
+		return "", fmt.Errorf("chart %s version %s not found in charts dir, found version %s", name, version, metadata.GetVersion())
+	}
+
+	return dir, nil
+}
+
+// archivedChart writes the chart carried with the policy as base64 encoded tarball into the cache dir, unless it's
+// already there
+func (f *ChartFetcher) archivedChart(archive string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(archive)
+	if err != nil {
+		return "", fmt.Errorf("chartArchive is not a valid base64 encoded chart tarball: %s", err)
+	}
+
+	key := sha256String(data)
+	chartFile := filepath.Join(f.cacheDir(), key+".tgz")
+	if _, statErr := os.Stat(chartFile); statErr == nil {
+		return chartFile, nil
+	}
+
+	return chartFile, f.writeCached(key, data)
+}
+
+// remoteChart downloads the chart from the chart repository into the cache dir, unless it's already there
+func (f *ChartFetcher) remoteChart(ref *chartRef, eventLog *event.Log) (string, error) {
+	creds, err := f.credentials(ref.Repo)
+	if err != nil {
+		return "", err
+	}
+
+	index, err := f.index(ref.Repo, creds)
+	if err != nil {
+		return "", err
+	}
+
+	chartVersion, err := index.Get(ref.Name, ref.Version)
+	if err != nil {
+		return "", fmt.Errorf("error while looking for chart %s in repo %s: %s", ref, ref.Repo, err)
+	}
+	if len(chartVersion.URLs) <= 0 {
+		return "", fmt.Errorf("chart %s has no downloadable URLs in repo %s", ref, ref.Repo)
+	}
+
+	chartURL, err := resolveURL(ref.Repo, chartVersion.URLs[0])
+	if err != nil {
+		return "", err
+	}
+
+	// charts are cached by digest from repo index, while charts without digest are cached by URL
+	key := chartVersion.Digest
+	if len(key) <= 0 {
+		key = sha256String([]byte(chartURL))
+	}
+
+	cacheDir := f.cacheDir()
+	chartFile := filepath.Join(cacheDir, key+".tgz")
+	if _, statErr := os.Stat(chartFile); statErr == nil {
+		eventLog.NewEntry().Debugf("Using cached chart %s from repo %s: %s", ref, ref.Repo, chartFile)
+		return chartFile, nil
+	}
+
+	eventLog.NewEntry().Debugf("Downloading chart %s from repo %s: %s", ref, ref.Repo, chartURL)
+
+	// credentials are only sent to the repository host, as charts could be hosted somewhere else
+	chartCreds := creds
+	if !sameHost(ref.Repo, chartURL) {
+		chartCreds = nil
+	}
+	chartGetter, err := newHTTPGetter(chartCreds)
+	if err != nil {
+		return "", fmt.Errorf("error while creating chart downloader: %s", err)
+	}
+
+	resp, err := chartGetter.Get(chartURL)
+	if err != nil {
+		return "", fmt.Errorf("error while downloading chart: %s", err)
+	}
+
+	if len(chartVersion.Digest) > 0 && sha256String(resp.Bytes()) != chartVersion.Digest {
+		return "", fmt.Errorf("digest of downloaded chart %s doesn't match the one from repo %s", ref, ref.Repo)
+	}
+
+	return chartFile, f.writeCached(key, resp.Bytes())
+}
+
+// writeCached writes the chart into the cache dir under the given key
+func (f *ChartFetcher) writeCached(key string, data []byte) error {
+	cacheDir := f.cacheDir()
+	err := os.MkdirAll(cacheDir, 0700)
+	if err != nil {
+		return fmt.Errorf("error while creating chart cache dir: %s", err)
+	}
+
+	// chart is written into temp file first and then renamed, so concurrent writers don't see partially written file
+	tmpFile, err := ioutil.TempFile(cacheDir, key)
+	if err != nil {
+		return fmt.Errorf("error while creating temp file for chart: %s", err)
+	}
+	defer os.Remove(tmpFile.Name()) // nolint: errcheck
+
+	_, err = tmpFile.Write(data)
+	closeErr := tmpFile.Close()
+	if err != nil || closeErr != nil {
+		return fmt.Errorf("error while writing chart to the temp file")
+	}
+
+	err = os.Rename(tmpFile.Name(), filepath.Join(cacheDir, key+".tgz"))
+	if err != nil {
+		return fmt.Errorf("error while moving chart to the cache: %s", err)
+	}
+
+	return nil
+}
+
+// index returns index of the chart repository, which is downloaded at most once a minute
+func (f *ChartFetcher) index(repoURL string, creds *repoCredentials) (*repo.IndexFile, error) {
+	if cached, found := f.indexes.Get(repoURL); found {
+		return cached.(*repo.IndexFile), nil
+	}
+
+	indexGetter, err := newHTTPGetter(creds)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating repo index downloader: %s", err)
+	}
+
+	resp, err := indexGetter.Get(strings.TrimSuffix(repoURL, "/") + "/index.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("error while downloading index of repo %s: %s", repoURL, err)
+	}
+
+	index := &repo.IndexFile{}
+	err = yaml.Unmarshal(resp.Bytes(), index)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing index of repo %s: %s", repoURL, err)
+	}
+	if len(index.APIVersion) <= 0 {
+		return nil, fmt.Errorf("error while parsing index of repo %s: no API version specified", repoURL)
+	}
+	index.SortEntries()
+
+	f.indexes.Set(repoURL, index, cache.DefaultExpiration)
+	return index, nil
+}
+
+// credentials returns credentials for the chart repository or nil if it doesn't need them
+func (f *ChartFetcher) credentials(repoURL string) (*repoCredentials, error) {
+	for _, repository := range f.config.Repositories {
+		if strings.TrimSuffix(repository.URL, "/") != strings.TrimSuffix(repoURL, "/") || len(repository.Credentials) <= 0 {
+			continue
+		}
+
+		var values map[string]string
+		if f.secrets != nil {
+			values = f.secrets.LoadSecretsByUserName(repository.Credentials)
+		}
+		if values == nil {
+			return nil, fmt.Errorf("secrets %s with credentials for repo %s not found", repository.Credentials, repoURL)
+		}
+
+		return &repoCredentials{
+			Username: values["username"],
+			Password: values["password"],
+			CertPEM:  values["cert"],
+			KeyPEM:   values["key"],
+			CAPEM:    values["ca"],
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func (f *ChartFetcher) cacheDir() string {
+	if len(f.config.CacheDir) > 0 {
+		return f.config.CacheDir
+	}
+	return filepath.Join(os.TempDir(), "aptomi-helm-charts")
+}
+
+// resolveURL resolves chart URL from the repo index, which could be relative to the repo URL
+func resolveURL(repoURL, chartURL string) (string, error) {
+	base, err := url.Parse(strings.TrimSuffix(repoURL, "/") + "/")
+	if err != nil {
+		return "", fmt.Errorf("invalid repo url %s: %s", repoURL, err)
+	}
+	ref, err := url.Parse(chartURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid chart url %s: %s", chartURL, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func sameHost(repoURL, chartURL string) bool {
+	repoParsed, err := url.Parse(repoURL)
+	if err != nil {
+		return false
+	}
+	chartParsed, err := url.Parse(chartURL)
+	if err != nil {
+		return false
+	}
+	return repoParsed.Scheme == chartParsed.Scheme && repoParsed.Host == chartParsed.Host
+}
+
+func sha256String(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
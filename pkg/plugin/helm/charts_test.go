@@ -0,0 +1,262 @@
+package helm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalChart(t *testing.T) {
+	chartsDir, cleanup := prepareChartsDir(t)
+	defer cleanup()
+
+	fetcher := NewChartFetcher(config.Helm{ChartsDir: chartsDir}, nil)
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"web", filepath.Join(chartsDir, "web")},
+		{"/web", filepath.Join(chartsDir, "web")},
+		{"db-2.0.0.tgz", filepath.Join(chartsDir, "db-2.0.0.tgz")},
+		{"../../web", filepath.Join(chartsDir, "web")},
+		{"../" + filepath.Base(chartsDir) + "-outside", ""},
+		{"missing", ""},
+	}
+	for _, test := range tests {
+		path, err := fetcher.localChart(test.path)
+		if len(test.expected) <= 0 {
+			assert.Error(t, err, "Chart path %s should be rejected", test.path)
+			continue
+		}
+		assert.NoError(t, err, "Chart path %s should be found", test.path)
+		assert.Equal(t, test.expected, path, "Chart path %s should be resolved within charts dir", test.path)
+	}
+
+	_, err := NewChartFetcher(config.Helm{}, nil).localChart("web")
+	assert.Error(t, err, "Chart path should be rejected if charts dir isn't configured")
+}
+
+func TestBundledChart(t *testing.T) {
+	chartsDir, cleanup := prepareChartsDir(t)
+	defer cleanup()
+
+	fetcher := NewChartFetcher(config.Helm{ChartsDir: chartsDir}, nil)
+	tests := []struct {
+		name     string
+		version  string
+		expected string
+	}{
+		{"web", "", filepath.Join(chartsDir, "web")},
+		{"web", "1.0.0", filepath.Join(chartsDir, "web")},
+		{"web", "2.0.0", ""},
+		{"../web", "1.0.0", filepath.Join(chartsDir, "web")},
+		{"db", "2.0.0", filepath.Join(chartsDir, "db-2.0.0.tgz")},
+		{"db", "1.0.0", ""},
+		{"db", "", ""},
+	}
+	for _, test := range tests {
+		path, err := fetcher.bundledChart(test.name, test.version)
+		if len(test.expected) <= 0 {
+			assert.Error(t, err, "Chart %s version '%s' should not be found", test.name, test.version)
+			continue
+		}
+		assert.NoError(t, err, "Chart %s version '%s' should be found", test.name, test.version)
+		assert.Equal(t, test.expected, path, "Chart %s version '%s' should be found in charts dir", test.name, test.version)
+	}
+
+	_, err := NewChartFetcher(config.Helm{}, nil).bundledChart("web", "")
+	assert.Error(t, err, "Chart should not be found if charts dir isn't configured")
+}
+
+func TestArchivedChart(t *testing.T) {
+	chartsDir, cleanup := prepareChartsDir(t)
+	defer cleanup()
+
+	archive, err := util.ReadArchive(filepath.Join(chartsDir, "web"))
+	if !assert.NoError(t, err, "Chart should be packed") {
+		t.FailNow()
+	}
+
+	// archive doesn't change when files are touched or their permissions change
+	chartFile := filepath.Join(chartsDir, "web", "Chart.yaml")
+	assert.NoError(t, os.Chtimes(chartFile, time.Now(), time.Now().Add(time.Hour)), "Chart file should be touched")
+	assert.NoError(t, os.Chmod(chartFile, 0600), "Chart file permissions should be changed")
+	repacked, err := util.ReadArchive(filepath.Join(chartsDir, "web"))
+	assert.NoError(t, err, "Chart should be packed again")
+	assert.Equal(t, archive, repacked, "Archive should only depend on content of the chart")
+
+	fetcher := NewChartFetcher(config.Helm{CacheDir: filepath.Join(chartsDir, "cache")}, nil)
+	path, err := fetcher.archivedChart(base64.StdEncoding.EncodeToString(archive))
+	if !assert.NoError(t, err, "Chart archive should be written into cache") {
+		t.FailNow()
+	}
+	assert.Equal(t, filepath.Join(chartsDir, "cache", sha256String(archive)+".tgz"), path, "Chart archive should be cached by digest")
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err, "Cached chart should be read")
+	assert.Equal(t, archive, data, "Cached chart should be the same as archive")
+
+	_, err = fetcher.archivedChart("not base64!")
+	assert.Error(t, err, "Invalid chart archive should be rejected")
+}
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		repo     string
+		chart    string
+		expected string
+	}{
+		{"https://charts.local/repo", "web-1.0.0.tgz", "https://charts.local/repo/web-1.0.0.tgz"},
+		{"https://charts.local/repo/", "web-1.0.0.tgz", "https://charts.local/repo/web-1.0.0.tgz"},
+		{"https://charts.local/repo", "charts/web-1.0.0.tgz", "https://charts.local/repo/charts/web-1.0.0.tgz"},
+		{"https://charts.local/repo", "/other/web-1.0.0.tgz", "https://charts.local/other/web-1.0.0.tgz"},
+		{"https://charts.local/repo", "https://cdn.local/web-1.0.0.tgz", "https://cdn.local/web-1.0.0.tgz"},
+	}
+	for _, test := range tests {
+		result, err := resolveURL(test.repo, test.chart)
+		assert.NoError(t, err, "Chart URL %s should be resolved", test.chart)
+		assert.Equal(t, test.expected, result, "Chart URL %s should be resolved against repo URL %s", test.chart, test.repo)
+	}
+
+	_, err := resolveURL("https://charts.local/repo", "%zz")
+	assert.Error(t, err, "Invalid chart URL should be rejected")
+}
+
+func TestSameHost(t *testing.T) {
+	tests := []struct {
+		repo     string
+		chart    string
+		expected bool
+	}{
+		{"https://charts.local/repo", "https://charts.local/repo/web-1.0.0.tgz", true},
+		{"https://charts.local/repo", "https://charts.local/other/web-1.0.0.tgz", true},
+		{"https://charts.local/repo", "http://charts.local/repo/web-1.0.0.tgz", false},
+		{"https://charts.local/repo", "https://charts.local:8443/repo/web-1.0.0.tgz", false},
+		{"https://charts.local/repo", "https://cdn.local/web-1.0.0.tgz", false},
+		{"https://charts.local/repo", "%zz", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, sameHost(test.repo, test.chart), "Credentials scoping for chart URL %s from repo %s", test.chart, test.repo)
+	}
+}
+
+func TestRemoteChart(t *testing.T) {
+	chartsDir, cleanup := prepareChartsDir(t)
+	defer cleanup()
+
+	archive, err := util.ReadArchive(filepath.Join(chartsDir, "web"))
+	if !assert.NoError(t, err, "Chart should be packed") {
+		t.FailNow()
+	}
+
+	// charts hosted outside of the repository should never get repository credentials
+	cdnArchive := []byte("chart hosted on cdn")
+	cdnRequested, cdnAuthorized := false, false
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnRequested = true
+		_, _, cdnAuthorized = r.BasicAuth()
+		w.Write(cdnArchive) // nolint: errcheck
+	}))
+	defer cdn.Close()
+
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/index.yaml":
+			fmt.Fprintf(w, chartIndex, sha256String(archive), sha256String([]byte("other")), cdn.URL, sha256String(cdnArchive)) // nolint: errcheck
+		default:
+			w.Write(archive) // nolint: errcheck
+		}
+	}))
+	defer repo.Close()
+
+	fetcher := NewChartFetcher(config.Helm{
+		CacheDir:     filepath.Join(chartsDir, "cache"),
+		Repositories: []config.HelmRepository{{URL: repo.URL, Credentials: "repo-creds"}},
+	}, chartSecrets{"repo-creds": {"username": "user", "password": "secret"}})
+	eventLog := event.NewLog(logrus.WarnLevel, "test-helm-charts")
+
+	path, err := fetcher.Fetch(&chartRef{Repo: repo.URL, Name: "web", Version: "1.0.0"}, eventLog)
+	if assert.NoError(t, err, "Chart should be downloaded from private repo") {
+		assert.Equal(t, filepath.Join(chartsDir, "cache", sha256String(archive)+".tgz"), path, "Chart should be cached by digest")
+	}
+
+	_, err = fetcher.Fetch(&chartRef{Repo: repo.URL, Name: "web", Version: "2.0.0"}, eventLog)
+	assert.Error(t, err, "Chart with digest different from repo index should be rejected")
+
+	_, err = fetcher.Fetch(&chartRef{Repo: repo.URL, Name: "web", Version: "3.0.0"}, eventLog)
+	assert.NoError(t, err, "Chart hosted outside of repo should be downloaded")
+	assert.True(t, cdnRequested, "Chart hosted outside of repo should be requested from its host")
+	assert.False(t, cdnAuthorized, "Repo credentials should not be sent to other hosts")
+
+	_, err = NewChartFetcher(fetcher.config, chartSecrets{}).Fetch(&chartRef{Repo: repo.URL, Name: "web"}, eventLog)
+	assert.Error(t, err, "Missing repo credentials should be reported")
+}
+
+// chartIndex is an index of the chart repository with the chart in the repo, the chart with wrong digest and the chart
+// hosted on another host
+const chartIndex = `
+apiVersion: v1
+entries:
+  web:
+  - name: web
+    version: 1.0.0
+    digest: %s
+    urls: [charts/web-1.0.0.tgz]
+  - name: web
+    version: 2.0.0
+    digest: %s
+    urls: [charts/web-2.0.0.tgz]
+  - name: web
+    version: 3.0.0
+    urls: [%s/web-3.0.0.tgz]
+    digest: %s
+`
+
+// chartSecrets is a secret loader with credentials for chart repositories
+type chartSecrets map[string]map[string]string
+
+func (secrets chartSecrets) LoadSecretsByUserName(name string) map[string]string {
+	return secrets[name]
+}
+
+// prepareChartsDir creates charts dir with "web" chart directory and "db" chart tarball
+func prepareChartsDir(t *testing.T) (string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "aptomi-helm-charts")
+	if !assert.NoError(t, err, "Temp dir should be created") {
+		t.FailNow()
+	}
+	chartsDir := filepath.Join(dir, "charts")
+	files := map[string]string{
+		filepath.Join(chartsDir, "web", "Chart.yaml"):                    "name: web\nversion: 1.0.0\n",
+		filepath.Join(chartsDir, "web", "templates", "service.yaml"):     "kind: Service\nmetadata:\n  name: web\n",
+		filepath.Join(chartsDir, "db-2.0.0.tgz"):                         "tarball",
+		filepath.Join(dir, "charts-outside", "Chart.yaml"):               "name: outside\nversion: 1.0.0\n",
+		filepath.Join(dir, "charts-outside", "templates", "secret.yaml"): "kind: Secret\nmetadata:\n  name: outside\n",
+	}
+	for path, content := range files {
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755), "Dir should be created") || !assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644), "File should be written") {
+			t.FailNow()
+		}
+	}
+
+	return chartsDir, func() {
+		os.RemoveAll(dir) // nolint: errcheck
+	}
+}
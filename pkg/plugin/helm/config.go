@@ -1,23 +1,44 @@
 package helm
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/pkg/lang"
+)
 
 // ClusterConfig represents Kubernetes cluster configuration specific for Helm plugin
 type ClusterConfig struct {
 	TillerNamespace string `yaml:",omitempty"`
+
+	// ReleaseNamespace is a namespace where Tiller-less plugin keeps release Secrets. Default is the Tiller namespace,
+	// so releases are kept the same way Tiller keeps them with Secrets storage driver
+	ReleaseNamespace string `yaml:",omitempty"`
 }
 
-func (p *Plugin) parseClusterConfig() error {
+func parseClusterConfig(cluster *lang.Cluster) (*ClusterConfig, error) {
 	clusterConfig := &ClusterConfig{}
-	err := p.cluster.ParseConfigInto(clusterConfig)
+	err := cluster.ParseConfigInto(clusterConfig)
 	if err != nil {
-		return fmt.Errorf("error while parsing helm specific config of cluster %s: %s", p.cluster.Name, err)
+		return nil, fmt.Errorf("error while parsing helm specific config of cluster %s: %s", cluster.Name, err)
 	}
 
-	p.tillerNamespace = "kube-system"
-	if len(clusterConfig.TillerNamespace) > 0 {
-		p.tillerNamespace = clusterConfig.TillerNamespace
+	if len(clusterConfig.TillerNamespace) <= 0 {
+		clusterConfig.TillerNamespace = "kube-system"
 	}
+	if len(clusterConfig.ReleaseNamespace) <= 0 {
+		clusterConfig.ReleaseNamespace = clusterConfig.TillerNamespace
+	}
+
+	return clusterConfig, nil
+}
+
+func (p *Plugin) parseClusterConfig() error {
+	clusterConfig, err := parseClusterConfig(p.cluster)
+	if err != nil {
+		return err
+	}
+
+	p.tillerNamespace = clusterConfig.TillerNamespace
 
 	return nil
 }
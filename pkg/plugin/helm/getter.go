@@ -1,35 +1,51 @@
 package helm
 
-// Copied from https://github.com/kubernetes/helm/blob/release-2.6/pkg/getter/httpgetter.go
+// Based on https://github.com/kubernetes/helm/blob/release-2.6/pkg/getter/httpgetter.go
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net/http"
-
-	"k8s.io/helm/pkg/getter"
-
 	"time"
-
-	"k8s.io/helm/pkg/tlsutil"
-	"k8s.io/helm/pkg/urlutil"
 )
 
+// repoCredentials represents credentials for the private chart repository. Certificates and keys are PEM encoded
+type repoCredentials struct {
+	Username string
+	Password string
+	CertPEM  string
+	KeyPEM   string
+	CAPEM    string
+}
+
 // httpGetter is the default HTTP(/S) backend handler
 type httpGetter struct {
-	client *http.Client
+	client   *http.Client
+	username string
+	password string
 }
 
-// Get performs a Get from repo.Getter and returns the body.
+// Get performs a Get and returns the body.
 func (g *httpGetter) Get(href string) (*bytes.Buffer, error) {
 	buf := bytes.NewBuffer(nil)
 
-	resp, err := g.client.Get(href)
+	req, err := http.NewRequest(http.MethodGet, href, nil)
+	if err != nil {
+		return buf, err
+	}
+	if len(g.username) > 0 || len(g.password) > 0 {
+		req.SetBasicAuth(g.username, g.password)
+	}
+
+	resp, err := g.client.Do(req)
 	if err != nil {
 		return buf, err
 	}
 	if resp.StatusCode != 200 {
+		resp.Body.Close() // nolint: errcheck,gas
 		return buf, fmt.Errorf("Failed to fetch %s : %s", href, resp.Status)
 	}
 
@@ -38,39 +54,43 @@ func (g *httpGetter) Get(href string) (*bytes.Buffer, error) {
 	return buf, err
 }
 
-// newHTTPGetter constructs a valid http/https client as Getter
-func newHTTPGetter(URL, CertFile, KeyFile, CAFile string) (getter.Getter, error) {
+// newHTTPGetter constructs a valid http/https client as Getter, which uses given credentials if they aren't nil
+func newHTTPGetter(creds *repoCredentials) (*httpGetter, error) {
 	var client httpGetter
-	if CertFile != "" && KeyFile != "" {
-		tlsConf, err := tlsutil.NewClientTLS(CertFile, KeyFile, CAFile)
-		if err != nil {
-			return nil, fmt.Errorf("can't create TLS config for client: %s", err.Error())
-		}
-		tlsConf.BuildNameToCertificate()
+	if creds == nil {
+		client.client = http.DefaultClient
+		return &client, nil
+	}
+
+	client.username = creds.Username
+	client.password = creds.Password
+
+	if len(creds.CertPEM) <= 0 && len(creds.CAPEM) <= 0 {
+		client.client = http.DefaultClient
+		return &client, nil
+	}
 
-		sni, err := urlutil.ExtractHostname(URL)
+	tlsConf := &tls.Config{}
+	if len(creds.CertPEM) > 0 {
+		cert, err := tls.X509KeyPair([]byte(creds.CertPEM), []byte(creds.KeyPEM))
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("can't load client certificate: %s", err)
 		}
-		tlsConf.ServerName = sni
-
-		client.client = &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: tlsConf,
-			},
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	if len(creds.CAPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(creds.CAPEM)) {
+			return nil, fmt.Errorf("can't load CA certificate")
 		}
-	} else {
-		client.client = http.DefaultClient
+		tlsConf.RootCAs = pool
 	}
-	return &client, nil
-}
 
-func newGetterProviders() getter.Providers {
-	return getter.Providers{
-		{
-			Schemes: []string{"http", "https"},
-			New:     newHTTPGetter,
+	client.client = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConf,
 		},
 	}
+	return &client, nil
 }
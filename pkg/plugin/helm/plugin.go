@@ -2,6 +2,7 @@ package helm
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/Aptomi/aptomi/pkg/config"
@@ -14,6 +15,7 @@ import (
 	"gopkg.in/yaml.v2"
 	"k8s.io/helm/pkg/helm"
 	"k8s.io/helm/pkg/kube"
+	"k8s.io/helm/pkg/proto/hapi/release"
 )
 
 // Plugin represents Helm code plugin for Kubernetes cluster
@@ -25,21 +27,28 @@ type Plugin struct {
 	tillerNamespace string       // namespace for tiller
 	tillerTunnel    *kube.Tunnel // tunnel for accessing tiller
 	tillerHost      string       // local proxy address when connection established
+	charts          *ChartFetcher
 }
 
 var _ plugin.CodePlugin = &Plugin{}
 
-// New returns new instance of the Helm code plugin for specified Kubernetes cluster plugin and plugins config
-func New(clusterPlugin plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+// New returns new instance of the Helm code plugin for specified Kubernetes cluster plugin and plugins config. Charts
+// are fetched using the given chart fetcher, which could be shared by multiple plugin instances
+func New(clusterPlugin plugin.ClusterPlugin, cfg config.Plugins, charts *ChartFetcher) (plugin.CodePlugin, error) {
 	kubePlugin, ok := clusterPlugin.(*k8s.Plugin)
 	if !ok {
 		return nil, fmt.Errorf("k8s cluster plugin expected for helm code plugin creation but received: %T", clusterPlugin)
 	}
 
+	if cfg.Helm.Tillerless {
+		return NewTillerless(clusterPlugin, cfg, charts)
+	}
+
 	return &Plugin{
 		config:  cfg.Helm,
 		kube:    kubePlugin,
 		cluster: kubePlugin.Cluster,
+		charts:  charts,
 	}, nil
 }
 
@@ -101,19 +110,30 @@ func (p *Plugin) createOrUpdate(invocation *plugin.CodePluginInvocationParams, c
 	}
 
 	releaseName := getReleaseName(invocation.DeployName)
-	chartRepo, chartName, chartVersion, err := getHelmReleaseInfo(invocation.Params)
+	ref, err := getChartRef(invocation.Params)
 	if err != nil {
 		return err
 	}
+	chartName := ref.String()
+
+	rollback, err := getRollbackOptions(invocation.Params)
+	if err != nil {
+		return err
+	}
+
+	// manifests are rendered by Tiller, so there is no way to label pods before they get created
+	if invocation.PluginParams[plugin.ParamLabelPods] == "true" {
+		return fmt.Errorf("pods of Helm release %s are selected by network policies, so they have to be labeled, which is only supported by tiller-less Helm plugin (plugins.helm.tillerless)", releaseName)
+	}
 
 	helmClient := p.newClient()
 
-	chartPath, err := p.fetchChart(chartRepo, chartName, chartVersion)
+	chartPath, err := p.charts.Fetch(ref, invocation.EventLog)
 	if err != nil {
 		return err
 	}
 
-	helmParams, err := yaml.Marshal(invocation.Params)
+	helmParams, err := yaml.Marshal(chartValues(invocation.Params))
 	if err != nil {
 		return err
 	}
@@ -135,7 +155,7 @@ func (p *Plugin) createOrUpdate(invocation *plugin.CodePluginInvocationParams, c
 			// Print installation line on info level
 			invocation.EventLog.NewEntry().Infof("Installing Helm release '%s', chart '%s', cluster: '%s'", releaseName, chartName, cluster.Name)
 
-			_, err = helmClient.InstallRelease(
+			_, installErr := helmClient.InstallRelease(
 				chartPath,
 				namespace,
 				helm.ReleaseName(releaseName),
@@ -143,8 +163,11 @@ func (p *Plugin) createOrUpdate(invocation *plugin.CodePluginInvocationParams, c
 				helm.InstallReuseName(true),
 				helm.InstallTimeout(int64(p.config.Timeout)),
 			)
+			if installErr != nil {
+				return installErr
+			}
 
-			return err
+			return p.kube.EnsureIngressPolicy(namespace, invocation.DeployName, invocation.PluginParams, invocation.EventLog)
 		}
 	}
 
@@ -169,6 +192,9 @@ func (p *Plugin) createOrUpdate(invocation *plugin.CodePluginInvocationParams, c
 		helm.UpgradeTimeout(int64(p.config.Timeout)),
 	)
 	if err != nil {
+		if rollback.Enabled {
+			return p.rollback(helmClient, invocation, currRelease.Release.Version+1, err)
+		}
 		return err
 	}
 
@@ -195,7 +221,123 @@ func (p *Plugin) createOrUpdate(invocation *plugin.CodePluginInvocationParams, c
 	// Print update line on info level
 	invocation.EventLog.NewEntry().Infof("Updated Helm release '%s', chart '%s', cluster '%s'", releaseName, chartName, cluster.Name)
 
-	return err
+	if rollback.Enabled {
+		err = waitForReadiness(p, invocation, rollback.Timeout)
+		if err != nil {
+			return p.rollback(helmClient, invocation, newRelease.Release.Version, err)
+		}
+	}
+
+	return p.kube.EnsureIngressPolicy(namespace, invocation.DeployName, invocation.PluginParams, invocation.EventLog)
+}
+
+// rollback rolls the release back to the latest good revision before the failed one and returns
+// plugin.RolledBackError with the reason of the rollback, so it gets recorded in the component instance state
+func (p *Plugin) rollback(helmClient *helm.Client, invocation *plugin.CodePluginInvocationParams, failedVersion int32, reason error) error {
+	releaseName := getReleaseName(invocation.DeployName)
+	invocation.EventLog.NewEntry().Warnf("Update of Helm release '%s' failed, rolling it back: %s", releaseName, reason)
+
+	history, err := helmClient.ReleaseHistory(releaseName, helm.WithMaxHistory(256))
+	if err != nil {
+		return fmt.Errorf("update of Helm release %s failed (%s) and it can't be rolled back: error while getting release history: %s", releaseName, reason, err)
+	}
+
+	good := lastGoodRelease(history.GetReleases(), failedVersion)
+	if good == nil {
+		return fmt.Errorf("update of Helm release %s failed (%s) and it can't be rolled back: no previous good revision found", releaseName, reason)
+	}
+
+	_, err = helmClient.RollbackRelease(
+		releaseName,
+		helm.RollbackVersion(good.GetVersion()),
+		helm.RollbackTimeout(int64(p.config.Timeout)),
+	)
+	if err != nil {
+		return fmt.Errorf("update of Helm release %s failed (%s) and rollback to revision %d failed: %s", releaseName, reason, good.GetVersion(), err)
+	}
+
+	invocation.EventLog.NewEntry().Infof("Rolled back Helm release '%s' to revision %d", releaseName, good.GetVersion())
+
+	return &plugin.RolledBackError{Reason: reason, Revision: strconv.Itoa(int(good.GetVersion()))}
+}
+
+// Move verifies that the Helm release deployed under the previous deploy name can be adopted by the new component
+// instance. Helm releases can't be renamed and names of the objects in a chart are usually derived from the release
+// name, so the release keeps its name (see MovesByAdoption)
+func (p *Plugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	// pods would have to be relabelled with the component name of the new component instance
+	if to.PluginParams[plugin.ParamLabelPods] == "true" {
+		return fmt.Errorf("pods of Helm release %s are selected by network policies, so they have to be relabelled when it's moved, which is only supported by tiller-less Helm plugin (plugins.helm.tillerless)", getReleaseName(from.DeployName))
+	}
+	return moveByAdoption(p, from, to)
+}
+
+// MovesByAdoption returns true, as Helm releases stay under the previous deploy name when moved
+func (p *Plugin) MovesByAdoption() bool {
+	return true
+}
+
+// Exists returns true if Helm release with the corresponding name exists in the cluster, no matter who has installed it
+func (p *Plugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	err := p.init(invocation.EventLog)
+	if err != nil {
+		return false, err
+	}
+
+	releaseName := getReleaseName(invocation.DeployName)
+
+	helmClient := p.newClient()
+
+	_, err = helmClient.ReleaseContent(releaseName)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return false, nil
+		}
+		return false, fmt.Errorf("error while looking for Helm release %s: %s", releaseName, err)
+	}
+
+	return true, nil
+}
+
+// Deployments returns all Helm releases in the cluster, which haven't been deleted yet
+func (p *Plugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	err := p.init(eventLog)
+	if err != nil {
+		return nil, err
+	}
+
+	helmClient := p.newClient()
+
+	statuses := []release.Status_Code{
+		release.Status_DEPLOYED,
+		release.Status_FAILED,
+		release.Status_PENDING_INSTALL,
+		release.Status_PENDING_UPGRADE,
+		release.Status_PENDING_ROLLBACK,
+	}
+
+	result := []*plugin.Deployment{}
+	offset := ""
+	for {
+		resp, listErr := helmClient.ListReleases(helm.ReleaseListStatuses(statuses), helm.ReleaseListOffset(offset))
+		if listErr != nil {
+			return nil, fmt.Errorf("error while listing Helm releases: %s", listErr)
+		}
+
+		for _, rel := range resp.GetReleases() {
+			result = append(result, &plugin.Deployment{
+				DeployName:   rel.GetName(),
+				TargetSuffix: rel.GetNamespace(),
+			})
+		}
+
+		offset = resp.GetNext()
+		if len(offset) <= 0 {
+			break
+		}
+	}
+
+	return result, nil
 }
 
 // Destroy implements destruction of an existing component instance in the cloud by running "helm delete" on the corresponding helm chart
@@ -216,7 +358,15 @@ func (p *Plugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
 		helm.DeletePurge(true),
 		helm.DeleteTimeout(int64(p.config.Timeout)),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if namespace := invocation.PluginParams[plugin.ParamTargetSuffix]; len(namespace) > 0 {
+		return p.kube.DeleteIngressPolicy(namespace, invocation.DeployName)
+	}
+
+	return nil
 }
 
 // Endpoints returns map from port type to url for all services of the current chart
@@ -290,3 +440,69 @@ func (p *Plugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, er
 
 	return p.kube.ReadinessStatusForManifest(namespace, invocation.DeployName, currRelease.Release.Manifest, invocation.EventLog)
 }
+
+// Drift compares values and chart of the deployed Helm release with the specified params, as well as objects from the
+// release manifest with the live objects in the cluster (e.g. to catch "helm rollback" and "kubectl edit")
+func (p *Plugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	err := p.init(invocation.EventLog)
+	if err != nil {
+		return "", err
+	}
+
+	helmClient := p.newClient()
+
+	namespace := invocation.PluginParams[plugin.ParamTargetSuffix]
+	if len(namespace) <= 0 {
+		return "", fmt.Errorf("namespace is a mandatory parameter")
+	}
+
+	releaseName := getReleaseName(invocation.DeployName)
+	currRelease, err := helmClient.ReleaseContent(releaseName)
+	if err != nil {
+		return "", fmt.Errorf("error while looking for Helm release %s: %s", releaseName, err)
+	}
+
+	return releaseDrift(p.kube, invocation, namespace, currRelease.Release)
+}
+
+// releaseDrift compares chart and values of the release with the specified params, as well as objects from the
+// release manifest with the live objects in the cluster
+func releaseDrift(kube *k8s.Plugin, invocation *plugin.CodePluginInvocationParams, namespace string, currRelease *release.Release) (string, error) {
+	ref, err := getChartRef(invocation.Params)
+	if err != nil {
+		return "", err
+	}
+
+	diffs := []string{}
+
+	// compare chart (charts referenced by path or carried as archives can't be compared, as they are only known by
+	// their content)
+	if metadata := currRelease.GetChart().GetMetadata(); metadata != nil && len(ref.Path) <= 0 && len(ref.Archive) <= 0 {
+		if metadata.Name != ref.Name {
+			diffs = append(diffs, fmt.Sprintf("chart: expected %s, found %s", ref.Name, metadata.Name))
+		}
+		if len(ref.Version) > 0 && metadata.Version != ref.Version {
+			diffs = append(diffs, fmt.Sprintf("chart version: expected %s, found %s", ref.Version, metadata.Version))
+		}
+	}
+
+	// compare values
+	valuesDiff, err := diffValues(invocation.Params, currRelease.GetConfig().GetRaw())
+	if err != nil {
+		return "", fmt.Errorf("error while comparing values of Helm release %s: %s", currRelease.GetName(), err)
+	}
+	if len(valuesDiff) > 0 {
+		diffs = append(diffs, "values:\n"+valuesDiff)
+	}
+
+	// compare live objects
+	objectsDiff, err := kube.DriftForManifest(namespace, invocation.DeployName, currRelease.GetManifest(), invocation.EventLog)
+	if err != nil {
+		return "", err
+	}
+	if len(objectsDiff) > 0 {
+		diffs = append(diffs, objectsDiff)
+	}
+
+	return strings.Join(diffs, "\n"), nil
+}
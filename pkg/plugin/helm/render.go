@@ -0,0 +1,177 @@
+package helm
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"gopkg.in/yaml.v2"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/engine"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/timeconv"
+)
+
+// installOrder is the order in which k8s objects of different kinds get created, the same as Tiller uses. Objects of
+// all other kinds are created after them
+var installOrder = []string{
+	"Namespace",
+	"ResourceQuota",
+	"LimitRange",
+	"PodSecurityPolicy",
+	"Secret",
+	"ConfigMap",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"ServiceAccount",
+	"CustomResourceDefinition",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"Ingress",
+	"APIService",
+}
+
+// hookAnnotation is an annotation, which marks Helm hooks
+const hookAnnotation = "helm.sh/hook"
+
+// renderedObject is a single k8s object rendered from chart templates
+type renderedObject struct {
+	source  string
+	content string
+	Kind    string `yaml:"kind"`
+	Meta    struct {
+		Name        string            `yaml:"name"`
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+// renderChart renders chart templates with the given values on Aptomi side, the same way Tiller renders them, and
+// returns release manifest with all objects sorted in install order
+func renderChart(client kubernetes.Interface, chrt *chart.Chart, values *chart.Config, releaseName, namespace string, revision int, eventLog *event.Log) (string, error) {
+	err := chartutil.ProcessRequirementsEnabled(chrt, values)
+	if err != nil {
+		return "", fmt.Errorf("error while processing requirements of chart %s: %s", chrt.GetMetadata().GetName(), err)
+	}
+	err = chartutil.ProcessRequirementsImportValues(chrt)
+	if err != nil {
+		return "", fmt.Errorf("error while importing values of chart %s requirements: %s", chrt.GetMetadata().GetName(), err)
+	}
+
+	caps, err := clusterCapabilities(client)
+	if err != nil {
+		return "", err
+	}
+
+	options := chartutil.ReleaseOptions{
+		Name:      releaseName,
+		Time:      timeconv.Now(),
+		Namespace: namespace,
+		Revision:  revision,
+		IsInstall: revision <= 1,
+		IsUpgrade: revision > 1,
+	}
+	renderValues, err := chartutil.ToRenderValuesCaps(chrt, values, options, caps)
+	if err != nil {
+		return "", fmt.Errorf("error while preparing values of chart %s: %s", chrt.GetMetadata().GetName(), err)
+	}
+
+	files, err := engine.New().Render(chrt, renderValues)
+	if err != nil {
+		return "", fmt.Errorf("error while rendering chart %s: %s", chrt.GetMetadata().GetName(), err)
+	}
+
+	return buildManifest(files, eventLog)
+}
+
+// clusterCapabilities returns k8s version and API versions supported by the cluster, which are available to templates
+func clusterCapabilities(client kubernetes.Interface) (*chartutil.Capabilities, error) {
+	kubeVersion, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("error while getting k8s version: %s", err)
+	}
+
+	groups, err := client.Discovery().ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("error while getting k8s API versions: %s", err)
+	}
+
+	return &chartutil.Capabilities{
+		APIVersions: chartutil.NewVersionSet(meta.ExtractGroupVersions(groups)...),
+		KubeVersion: kubeVersion,
+	}, nil
+}
+
+// buildManifest builds release manifest from rendered templates. Partials, notes and empty documents are skipped.
+// Hooks are skipped as well, because there is no Tiller to run them
+func buildManifest(files map[string]string, eventLog *event.Log) (string, error) {
+	sources := []string{}
+	for source := range files {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	objects := []*renderedObject{}
+	for _, source := range sources {
+		base := path.Base(source)
+		if strings.HasPrefix(base, "_") || strings.HasSuffix(source, "NOTES.txt") {
+			continue
+		}
+
+		for _, doc := range strings.Split(files[source], "\n---") {
+			doc = strings.TrimSpace(strings.TrimPrefix(doc, "---"))
+			if len(doc) <= 0 {
+				continue
+			}
+
+			obj := &renderedObject{source: source, content: doc}
+			err := yaml.Unmarshal([]byte(doc), obj)
+			if err != nil {
+				return "", fmt.Errorf("error while parsing rendered template %s: %s", source, err)
+			}
+			if len(obj.Kind) <= 0 {
+				// document with comments only
+				continue
+			}
+			if hook, isHook := obj.Meta.Annotations[hookAnnotation]; isHook {
+				eventLog.NewEntry().Warnf("Skipping Helm hook %s/%s (%s) from %s, as hooks are not supported without Tiller", obj.Kind, obj.Meta.Name, hook, source)
+				continue
+			}
+			objects = append(objects, obj)
+		}
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return kindOrder(objects[i].Kind) < kindOrder(objects[j].Kind)
+	})
+
+	result := []string{}
+	for _, obj := range objects {
+		result = append(result, fmt.Sprintf("---\n# Source: %s\n%s\n", obj.source, obj.content))
+	}
+	return strings.Join(result, ""), nil
+}
+
+func kindOrder(kind string) int {
+	for idx, orderedKind := range installOrder {
+		if orderedKind == kind {
+			return idx
+		}
+	}
+	return len(installOrder)
+}
@@ -0,0 +1,66 @@
+package helm
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildManifest(t *testing.T) {
+	files := map[string]string{
+		"chart/templates/_helpers.tpl": `{{- define "chart.name" -}}chart{{- end -}}`,
+		"chart/templates/NOTES.txt":    "Thank you for installing chart",
+		"chart/templates/deployment.yaml": `
+kind: Deployment
+metadata:
+  name: web
+`,
+		"chart/templates/service.yaml": `---
+# only comments in this document
+---
+kind: Service
+metadata:
+  name: web
+`,
+		"chart/templates/job.yaml": `
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install
+`,
+		"chart/templates/custom.yaml": `
+kind: Custom
+metadata:
+  name: custom
+---
+kind: ConfigMap
+metadata:
+  name: config
+`,
+		"chart/templates/empty.yaml": "\n",
+	}
+
+	eventLog := event.NewLog(logrus.WarnLevel, "test-helm-render")
+	manifest, err := buildManifest(files, eventLog)
+	if !assert.NoError(t, err, "Manifest should be built") {
+		t.FailNow()
+	}
+
+	// objects are sorted in install order, objects of unknown kinds go last
+	kinds := []string{}
+	for _, match := range regexp.MustCompile(`(?m)^kind: (\w+)$`).FindAllStringSubmatch(manifest, -1) {
+		kinds = append(kinds, match[1])
+	}
+	assert.Equal(t, []string{"ConfigMap", "Service", "Deployment", "Custom"}, kinds, "Objects should be sorted in install order, hooks should be skipped")
+	assert.Contains(t, manifest, "---\n# Source: chart/templates/service.yaml\nkind: Service\n", "Every object should have its source")
+	assert.NotContains(t, manifest, "_helpers.tpl", "Partials should be skipped")
+	assert.NotContains(t, manifest, "NOTES.txt", "Notes should be skipped")
+	assert.NotContains(t, manifest, "only comments", "Documents with comments only should be skipped")
+
+	_, err = buildManifest(map[string]string{"chart/templates/broken.yaml": "kind: [Service"}, eventLog)
+	assert.Error(t, err, "Invalid template output should be rejected")
+}
@@ -0,0 +1,97 @@
+package helm
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"k8s.io/helm/pkg/proto/hapi/release"
+)
+
+// defaultRollbackTimeout is how long updated release has to become ready before it gets rolled back
+const defaultRollbackTimeout = 5 * time.Minute
+
+// rollbackCheckInterval is how often readiness of the updated release is checked
+var rollbackCheckInterval = 5 * time.Second
+
+// rollbackOptions represents rollback settings of the component, which are taken from code params
+type rollbackOptions struct {
+	// Enabled is true if release should be rolled back to the previous good revision when update fails or updated
+	// release doesn't become ready within Timeout
+	Enabled bool
+
+	// Timeout is how long updated release has to become ready
+	Timeout time.Duration
+}
+
+func getRollbackOptions(params util.NestedParameterMap) (*rollbackOptions, error) {
+	options := &rollbackOptions{Timeout: defaultRollbackTimeout}
+
+	switch enabled := params["rollbackOnFailure"].(type) {
+	case nil:
+	case bool:
+		options.Enabled = enabled
+	case string:
+		value, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("rollbackOnFailure is not a valid bool: %s", enabled)
+		}
+		options.Enabled = value
+	default:
+		return nil, fmt.Errorf("rollbackOnFailure is not a valid bool: %v", enabled)
+	}
+
+	if timeout, ok := params["rollbackTimeout"]; ok {
+		timeoutStr, ok := timeout.(string)
+		if !ok {
+			return nil, fmt.Errorf("rollbackTimeout is not a valid string")
+		}
+		value, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("rollbackTimeout is not a valid duration: %s", err)
+		}
+		options.Timeout = value
+	}
+
+	return options, nil
+}
+
+// lastGoodRelease returns the latest revision of the release, which has been successfully deployed before the given
+// revision, or nil if there is no such revision
+func lastGoodRelease(revisions []*release.Release, before int32) *release.Release {
+	var result *release.Release
+	for _, rel := range revisions {
+		code := rel.GetInfo().GetStatus().GetCode()
+		if rel.GetVersion() >= before || code != release.Status_DEPLOYED && code != release.Status_SUPERSEDED {
+			continue
+		}
+		if result == nil || result.GetVersion() < rel.GetVersion() {
+			result = rel
+		}
+	}
+	return result
+}
+
+// waitForReadiness waits until the updated release becomes ready, the timeout expires or the invocation gets cancelled
+func waitForReadiness(p plugin.CodePlugin, invocation *plugin.CodePluginInvocationParams, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ready, err := p.Status(invocation)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("helm release '%s' didn't become ready within %s", getReleaseName(invocation.DeployName), timeout)
+		}
+		select {
+		case <-invocation.Cancel:
+			return fmt.Errorf("waiting for helm release '%s' to become ready has been cancelled", getReleaseName(invocation.DeployName))
+		case <-time.After(rollbackCheckInterval):
+		}
+	}
+}
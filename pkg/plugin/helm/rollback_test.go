@@ -0,0 +1,42 @@
+package helm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForReadinessCancelled(t *testing.T) {
+	cancel := make(chan struct{})
+	invocation := &plugin.CodePluginInvocationParams{
+		DeployName: "test",
+		EventLog:   event.NewLog(logrus.WarnLevel, "test-helm-rollback"),
+		Cancel:     cancel,
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- waitForReadiness(&notReadyCodePlugin{}, invocation, time.Hour)
+	}()
+	close(cancel)
+
+	select {
+	case err := <-result:
+		assert.Error(t, err, "Waiting for readiness should fail once cancelled")
+	case <-time.After(10 * time.Second):
+		t.Fatal("Waiting for readiness should stop once cancelled")
+	}
+}
+
+// notReadyCodePlugin is a code plugin, which deployments never become ready
+type notReadyCodePlugin struct {
+	plugin.CodePlugin
+}
+
+func (p *notReadyCodePlugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,197 @@
+package helm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/storage"
+	"k8s.io/helm/pkg/storage/driver"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+)
+
+// maxReleaseHistory is how many revisions of every release are kept in the release storage
+const maxReleaseHistory = 10
+
+// releaseStorage keeps revisions of Helm releases in cluster Secrets, using the same format and labels as Tiller with
+// Secrets storage driver does. Releases, which have been created by Tiller with either ConfigMaps or Secrets storage
+// driver, are visible to all read operations as is and get migrated into the release storage only on explicit migrate
+// call before the release gets changed
+type releaseStorage struct {
+	secrets *storage.Storage
+	tiller  []*storage.Storage
+}
+
+func newReleaseStorage(client internalclientset.Interface, releaseNamespace, tillerNamespace string) *releaseStorage {
+	s := &releaseStorage{
+		secrets: storage.Init(driver.NewSecrets(client.Core().Secrets(releaseNamespace))),
+		tiller:  []*storage.Storage{storage.Init(driver.NewConfigMaps(client.Core().ConfigMaps(tillerNamespace)))},
+	}
+	// if Tiller keeps releases in Secrets of the release namespace, they are already in the release storage
+	if tillerNamespace != releaseNamespace {
+		s.tiller = append(s.tiller, storage.Init(driver.NewSecrets(client.Core().Secrets(tillerNamespace))))
+	}
+	return s
+}
+
+// history returns all revisions of the release sorted by version. If release hasn't been migrated from Tiller yet,
+// revisions from Tiller storage are returned
+func (s *releaseStorage) history(name string) ([]*release.Release, error) {
+	revisions, err := historyOf(s.secrets, name)
+	if err != nil || len(revisions) > 0 {
+		return revisions, err
+	}
+
+	_, revisions, err = s.tillerHistory(name)
+	return revisions, err
+}
+
+// current returns the latest revision of the release or nil if release doesn't exist
+func (s *releaseStorage) current(name string) (*release.Release, error) {
+	revisions, err := s.history(name)
+	if err != nil || len(revisions) <= 0 {
+		return nil, err
+	}
+	return revisions[len(revisions)-1], nil
+}
+
+// save stores new revision of the release, marks the previous one as superseded and removes the oldest revisions
+func (s *releaseStorage) save(rel *release.Release, prev *release.Release) error {
+	err := s.secrets.Create(rel)
+	if err != nil {
+		return fmt.Errorf("error while storing Helm release %s revision %d: %s", rel.GetName(), rel.GetVersion(), err)
+	}
+
+	if prev != nil && prev.GetInfo().GetStatus().GetCode() == release.Status_DEPLOYED && rel.GetInfo().GetStatus().GetCode() == release.Status_DEPLOYED {
+		prev.Info.Status.Code = release.Status_SUPERSEDED
+		err = s.secrets.Update(prev)
+		if err != nil {
+			return fmt.Errorf("error while updating Helm release %s revision %d: %s", prev.GetName(), prev.GetVersion(), err)
+		}
+	}
+
+	revisions, err := historyOf(s.secrets, rel.GetName())
+	if err != nil {
+		return err
+	}
+	for len(revisions) > maxReleaseHistory {
+		_, err = s.secrets.Delete(revisions[0].GetName(), revisions[0].GetVersion())
+		if err != nil {
+			return fmt.Errorf("error while deleting Helm release %s revision %d: %s", revisions[0].GetName(), revisions[0].GetVersion(), err)
+		}
+		revisions = revisions[1:]
+	}
+
+	return nil
+}
+
+// delete removes all revisions of the release, including the ones which haven't been migrated from Tiller yet
+func (s *releaseStorage) delete(name string) error {
+	for _, store := range append([]*storage.Storage{s.secrets}, s.tiller...) {
+		revisions, err := historyOf(store, name)
+		if err != nil {
+			return err
+		}
+		for _, rel := range revisions {
+			_, err = store.Delete(rel.GetName(), rel.GetVersion())
+			if err != nil {
+				return fmt.Errorf("error while deleting Helm release %s revision %d: %s", rel.GetName(), rel.GetVersion(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// list returns the latest revisions of all releases, including the ones which haven't been migrated from Tiller yet
+func (s *releaseStorage) list() ([]*release.Release, error) {
+	latest := make(map[string]*release.Release)
+	for _, store := range append(append([]*storage.Storage{}, s.tiller...), s.secrets) {
+		releases, err := store.ListReleases()
+		if err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("error while listing Helm releases: %s", err)
+		}
+		for _, rel := range releases {
+			if prev, exist := latest[rel.GetName()]; !exist || prev.GetVersion() < rel.GetVersion() {
+				latest[rel.GetName()] = rel
+			}
+		}
+	}
+
+	result := []*release.Release{}
+	for _, rel := range latest {
+		if rel.GetInfo().GetStatus().GetCode() != release.Status_DELETED {
+			result = append(result, rel)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result, nil
+}
+
+// migrate moves all revisions of the release created by Tiller into the release storage, unless it's already there.
+// Revisions are removed from Tiller storage after they have been copied, so Tiller doesn't manage the release anymore.
+// It should only be called right before the release gets changed
+func (s *releaseStorage) migrate(name string, eventLog *event.Log) error {
+	migrated, err := historyOf(s.secrets, name)
+	if err != nil || len(migrated) > 0 {
+		return err
+	}
+
+	tiller, revisions, err := s.tillerHistory(name)
+	if err != nil || len(revisions) <= 0 {
+		return err
+	}
+
+	eventLog.NewEntry().Infof("Migrating Helm release '%s' (%d revisions) from Tiller", name, len(revisions))
+
+	for _, rel := range revisions {
+		err = s.secrets.Create(rel)
+		if err != nil && !strings.Contains(err.Error(), "already exists") {
+			return fmt.Errorf("error while migrating Helm release %s revision %d: %s", name, rel.GetVersion(), err)
+		}
+	}
+	for _, rel := range revisions {
+		_, err = tiller.Delete(rel.GetName(), rel.GetVersion())
+		if err != nil {
+			return fmt.Errorf("error while removing migrated Helm release %s revision %d from Tiller: %s", name, rel.GetVersion(), err)
+		}
+	}
+
+	return nil
+}
+
+// tillerHistory returns Tiller storage, which has revisions of the release, and all revisions from it sorted by version
+func (s *releaseStorage) tillerHistory(name string) (*storage.Storage, []*release.Release, error) {
+	for _, tiller := range s.tiller {
+		revisions, err := historyOf(tiller, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(revisions) > 0 {
+			return tiller, revisions, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// historyOf returns all revisions of the release from the given storage sorted by version
+func historyOf(store *storage.Storage, name string) ([]*release.Release, error) {
+	revisions, err := store.History(name)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error while looking for Helm release %s: %s", name, err)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].GetVersion() < revisions[j].GetVersion()
+	})
+	return revisions, nil
+}
+
+func isNotFound(err error) bool {
+	return strings.Contains(err.Error(), "not found")
+}
@@ -0,0 +1,112 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/storage"
+	"k8s.io/helm/pkg/storage/driver"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/fake"
+)
+
+func TestReleaseStorageSave(t *testing.T) {
+	releases := newReleaseStorage(fake.NewSimpleClientset(), "releases", "kube-system")
+
+	var prev *release.Release
+	for version := 1; version <= maxReleaseHistory+2; version++ {
+		rel := makeRelease("test", version, release.Status_DEPLOYED)
+		if !assert.NoError(t, releases.save(rel, prev), "Release revision should be saved") {
+			t.FailNow()
+		}
+		prev = rel
+	}
+
+	revisions, err := releases.history("test")
+	if !assert.NoError(t, err, "Release history should be returned") || !assert.Len(t, revisions, maxReleaseHistory, "Oldest revisions should be pruned") {
+		t.FailNow()
+	}
+	assert.EqualValues(t, 3, revisions[0].GetVersion(), "Oldest revisions should be pruned")
+	for _, rel := range revisions[:len(revisions)-1] {
+		assert.Equal(t, release.Status_SUPERSEDED, rel.GetInfo().GetStatus().GetCode(), "Previous revisions should be superseded")
+	}
+
+	current, err := releases.current("test")
+	if !assert.NoError(t, err, "Current release should be returned") || !assert.NotNil(t, current, "Current release should exist") {
+		t.FailNow()
+	}
+	assert.EqualValues(t, maxReleaseHistory+2, current.GetVersion(), "Latest revision should be current")
+	assert.Equal(t, release.Status_DEPLOYED, current.GetInfo().GetStatus().GetCode(), "Latest revision should be deployed")
+
+	// failed revision doesn't supersede the deployed one
+	failed := makeRelease("test", maxReleaseHistory+3, release.Status_FAILED)
+	assert.NoError(t, releases.save(failed, current), "Failed release revision should be saved")
+	revisions, err = releases.history("test")
+	if !assert.NoError(t, err, "Release history should be returned") {
+		t.FailNow()
+	}
+	assert.Equal(t, release.Status_DEPLOYED, revisions[len(revisions)-2].GetInfo().GetStatus().GetCode(), "Deployed revision should not be superseded by failed one")
+
+	assert.NoError(t, releases.delete("test"), "Release should be deleted")
+	current, err = releases.current("test")
+	assert.NoError(t, err, "Current release should be returned")
+	assert.Nil(t, current, "Deleted release should not exist")
+}
+
+func TestReleaseStorageMigrate(t *testing.T) {
+	eventLog := event.NewLog(logrus.WarnLevel, "test-helm-storage")
+
+	for _, tillerDriver := range []string{driver.ConfigMapsDriverName, driver.SecretsDriverName} {
+		client := fake.NewSimpleClientset()
+		tiller := storage.Init(driver.NewConfigMaps(client.Core().ConfigMaps("kube-system")))
+		if tillerDriver == driver.SecretsDriverName {
+			tiller = storage.Init(driver.NewSecrets(client.Core().Secrets("kube-system")))
+		}
+		for version := 1; version <= 2; version++ {
+			if !assert.NoError(t, tiller.Create(makeRelease("test", version, release.Status_DEPLOYED)), "Tiller release should be created") {
+				t.FailNow()
+			}
+		}
+		releases := newReleaseStorage(client, "releases", "kube-system")
+
+		// release created by Tiller is visible, but isn't moved by reads
+		current, err := releases.current("test")
+		if !assert.NoError(t, err, "Current release should be returned (%s)", tillerDriver) || !assert.NotNil(t, current, "Tiller release should be found (%s)", tillerDriver) {
+			t.FailNow()
+		}
+		assert.EqualValues(t, 2, current.GetVersion(), "Latest Tiller revision should be current (%s)", tillerDriver)
+		list, err := releases.list()
+		assert.NoError(t, err, "Releases should be listed (%s)", tillerDriver)
+		assert.Len(t, list, 1, "Tiller release should be listed (%s)", tillerDriver)
+		tillerRevisions, err := historyOf(tiller, "test")
+		assert.NoError(t, err, "Tiller release history should be returned (%s)", tillerDriver)
+		assert.Len(t, tillerRevisions, 2, "Tiller release should not be touched by reads (%s)", tillerDriver)
+
+		// explicit migration moves all revisions out of Tiller storage
+		assert.NoError(t, releases.migrate("test", eventLog), "Release should be migrated (%s)", tillerDriver)
+		tillerRevisions, err = historyOf(tiller, "test")
+		assert.NoError(t, err, "Tiller release history should be returned (%s)", tillerDriver)
+		assert.Empty(t, tillerRevisions, "Migrated release should be removed from Tiller storage (%s)", tillerDriver)
+		migrated, err := historyOf(releases.secrets, "test")
+		assert.NoError(t, err, "Release history should be returned (%s)", tillerDriver)
+		assert.Len(t, migrated, 2, "All revisions should be migrated (%s)", tillerDriver)
+
+		// migration of already migrated release does nothing
+		assert.NoError(t, releases.migrate("test", eventLog), "Migrated release should not be migrated again (%s)", tillerDriver)
+		assert.NoError(t, releases.delete("test"), "Release should be deleted (%s)", tillerDriver)
+		list, err = releases.list()
+		assert.NoError(t, err, "Releases should be listed (%s)", tillerDriver)
+		assert.Empty(t, list, "Deleted release should not be listed (%s)", tillerDriver)
+	}
+}
+
+func makeRelease(name string, version int, code release.Status_Code) *release.Release {
+	return &release.Release{
+		Name:      name,
+		Namespace: "default",
+		Version:   int32(version),
+		Info:      &release.Info{Status: &release.Status{Code: code}},
+	}
+}
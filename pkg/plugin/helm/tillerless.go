@@ -0,0 +1,552 @@
+package helm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/k8s"
+	"github.com/Aptomi/aptomi/pkg/util/sync"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/kube"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/timeconv"
+)
+
+// TillerlessPlugin represents Helm code plugin for Kubernetes cluster, which doesn't need Tiller. Charts are rendered
+// on Aptomi side, objects are applied directly and releases are kept in cluster Secrets
+type TillerlessPlugin struct {
+	once             sync.Init
+	cluster          *lang.Cluster
+	config           config.Helm
+	kube             *k8s.Plugin
+	releaseNamespace string // namespace for release secrets
+	tillerNamespace  string // namespace with releases created by tiller, which should be migrated
+	charts           *ChartFetcher
+}
+
+var _ plugin.CodePlugin = &TillerlessPlugin{}
+
+// NewTillerless returns new instance of the Tiller-less Helm code plugin for specified Kubernetes cluster plugin and
+// plugins config. Charts are fetched using the given chart fetcher
+func NewTillerless(clusterPlugin plugin.ClusterPlugin, cfg config.Plugins, charts *ChartFetcher) (plugin.CodePlugin, error) {
+	kubePlugin, ok := clusterPlugin.(*k8s.Plugin)
+	if !ok {
+		return nil, fmt.Errorf("k8s cluster plugin expected for helm code plugin creation but received: %T", clusterPlugin)
+	}
+
+	return &TillerlessPlugin{
+		config:  cfg.Helm,
+		kube:    kubePlugin,
+		cluster: kubePlugin.Cluster,
+		charts:  charts,
+	}, nil
+}
+
+func (p *TillerlessPlugin) init() error {
+	return p.once.Do(func() error {
+		err := p.kube.Init()
+		if err != nil {
+			return err
+		}
+
+		clusterConfig, err := parseClusterConfig(p.cluster)
+		if err != nil {
+			return err
+		}
+		p.releaseNamespace = clusterConfig.ReleaseNamespace
+		p.tillerNamespace = clusterConfig.TillerNamespace
+
+		return nil
+	})
+}
+
+func (p *TillerlessPlugin) newStorage() (*releaseStorage, error) {
+	client, err := p.kube.NewInternalClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return newReleaseStorage(client, p.releaseNamespace, p.tillerNamespace), nil
+}
+
+// currentRelease returns the latest revision of the release for the given invocation or an error if it doesn't exist
+func (p *TillerlessPlugin) currentRelease(invocation *plugin.CodePluginInvocationParams) (*release.Release, error) {
+	err := p.init()
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := p.newStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	releaseName := getReleaseName(invocation.DeployName)
+	currRelease, err := releases.current(releaseName)
+	if err != nil {
+		return nil, err
+	}
+	if currRelease == nil {
+		return nil, fmt.Errorf("helm release %s not found", releaseName)
+	}
+
+	return currRelease, nil
+}
+
+// Cleanup implements cleanup phase for the Tiller-less Helm plugin
+func (p *TillerlessPlugin) Cleanup() error {
+	return nil
+}
+
+// Create implements creation of a new component instance in the cloud by rendering a Helm chart and creating objects
+// from it
+func (p *TillerlessPlugin) Create(invocation *plugin.CodePluginInvocationParams) error {
+	return p.createOrUpdate(invocation)
+}
+
+// Update implements update of an existing component instance in the cloud by rendering a Helm chart with new
+// parameters and updating objects from it
+func (p *TillerlessPlugin) Update(invocation *plugin.CodePluginInvocationParams) error {
+	return p.createOrUpdate(invocation)
+}
+
+func (p *TillerlessPlugin) createOrUpdate(invocation *plugin.CodePluginInvocationParams) error {
+	err := p.init()
+	if err != nil {
+		return err
+	}
+
+	kubeClient, err := p.kube.NewClient()
+	if err != nil {
+		return err
+	}
+
+	namespace := invocation.PluginParams[plugin.ParamTargetSuffix]
+	if len(namespace) <= 0 {
+		return fmt.Errorf("namespace is a mandatory parameter")
+	}
+
+	err = p.kube.EnsureNamespace(kubeClient, namespace)
+	if err != nil {
+		return err
+	}
+
+	releaseName := getReleaseName(invocation.DeployName)
+	ref, err := getChartRef(invocation.Params)
+	if err != nil {
+		return err
+	}
+	chartName := ref.String()
+
+	rollback, err := getRollbackOptions(invocation.Params)
+	if err != nil {
+		return err
+	}
+
+	chartPath, err := p.charts.Fetch(ref, invocation.EventLog)
+	if err != nil {
+		return err
+	}
+
+	chrt, err := chartutil.Load(chartPath)
+	if err != nil {
+		return fmt.Errorf("error while loading chart %s: %s", chartName, err)
+	}
+
+	helmParams, err := yaml.Marshal(chartValues(invocation.Params))
+	if err != nil {
+		return err
+	}
+	values := &chart.Config{Raw: string(helmParams)}
+
+	// release created by Tiller gets migrated only now, when it's about to be changed
+	releases, err := p.newStorage()
+	if err != nil {
+		return err
+	}
+	err = releases.migrate(releaseName, invocation.EventLog)
+	if err != nil {
+		return err
+	}
+	currRelease, err := releases.current(releaseName)
+	if err != nil {
+		return err
+	}
+
+	revision := 1
+	if currRelease != nil {
+		if currRelease.GetNamespace() != namespace {
+			return fmt.Errorf("it's not allowed to change namespace of the release %s (was %s, requested %s)", releaseName, currRelease.GetNamespace(), namespace)
+		}
+		revision = int(currRelease.GetVersion()) + 1
+	}
+
+	manifest, err := renderChart(kubeClient, chrt, values, releaseName, namespace, revision, invocation.EventLog)
+	if err != nil {
+		return err
+	}
+
+	// pods get labelled in the release manifest, so they are applied and stored together with the rest of the release
+	manifest, err = k8s.LabelPods(manifest, invocation.PluginParams)
+	if err != nil {
+		return err
+	}
+
+	now := timeconv.Now()
+	newRelease := &release.Release{
+		Name:      releaseName,
+		Namespace: namespace,
+		Chart:     chrt,
+		Config:    values,
+		Manifest:  manifest,
+		Version:   int32(revision),
+		Info: &release.Info{
+			Status:        &release.Status{Code: release.Status_DEPLOYED},
+			FirstDeployed: now,
+			LastDeployed:  now,
+			Description:   "Install complete",
+		},
+	}
+
+	helmKube := p.kube.NewHelmKube(invocation.DeployName, invocation.EventLog)
+	timeout := int64(p.config.Timeout / time.Second)
+
+	if currRelease == nil {
+		// Print parameters on debug level
+		invocation.EventLog.NewEntry().Debugf("Installing Helm release '%s' without Tiller, chart '%s', cluster '%s'. Path = %s, Params = %s", releaseName, chartName, p.cluster.Name, chartPath, string(helmParams))
+
+		// Print installation line on info level
+		invocation.EventLog.NewEntry().Infof("Installing Helm release '%s' without Tiller, chart '%s', cluster: '%s'", releaseName, chartName, p.cluster.Name)
+
+		err = helmKube.Create(namespace, strings.NewReader(manifest), timeout, false)
+	} else {
+		newRelease.Info.FirstDeployed = currRelease.GetInfo().GetFirstDeployed()
+		newRelease.Info.Description = "Upgrade complete"
+
+		// Print parameters on debug level
+		invocation.EventLog.NewEntry().Debugf("Updating Helm release '%s' without Tiller, chart '%s', cluster '%s'. Path = %s, Params = %s", releaseName, chartName, p.cluster.Name, chartPath, string(helmParams))
+
+		// Print update line on info level
+		invocation.EventLog.NewEntry().Infof("Updating Helm release '%s' without Tiller, chart '%s', cluster: '%s'", releaseName, chartName, p.cluster.Name)
+
+		err = helmKube.Update(namespace, strings.NewReader(currRelease.GetManifest()), strings.NewReader(manifest), false, false, timeout, false)
+	}
+
+	if err != nil {
+		// failed revision is stored as well, so it's visible what has been attempted
+		newRelease.Info.Status.Code = release.Status_FAILED
+		newRelease.Info.Description = fmt.Sprintf("Release failed: %s", err)
+		if saveErr := releases.save(newRelease, currRelease); saveErr != nil {
+			invocation.EventLog.NewEntry().Warnf("Failed to store failed revision of Helm release '%s': %s", releaseName, saveErr)
+		}
+		if rollback.Enabled && currRelease != nil {
+			return p.rollback(releases, helmKube, invocation, newRelease, err)
+		}
+		return err
+	}
+
+	err = releases.save(newRelease, currRelease)
+	if err != nil {
+		return err
+	}
+
+	if currRelease != nil {
+		diff, diffErr := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(currRelease.GetManifest()),
+			B:        difflib.SplitLines(manifest),
+			FromFile: "Previous",
+			ToFile:   "Current",
+			Context:  3,
+		})
+		if diffErr == nil && len(diff) > 0 {
+			invocation.EventLog.NewEntry().Debugf("Updated Helm release '%s' with diff: \n\n%s", releaseName, diff)
+		}
+
+		if rollback.Enabled {
+			err = waitForReadiness(p, invocation, rollback.Timeout)
+			if err != nil {
+				return p.rollback(releases, helmKube, invocation, newRelease, err)
+			}
+		}
+	}
+
+	return p.kube.EnsureIngressPolicy(namespace, invocation.DeployName, invocation.PluginParams, invocation.EventLog)
+}
+
+// rollback applies manifest of the latest good revision before the failed one and stores it as a new revision, the
+// same way "helm rollback" does. It returns plugin.RolledBackError with the reason of the rollback, so it gets
+// recorded in the component instance state
+func (p *TillerlessPlugin) rollback(releases *releaseStorage, helmKube *kube.Client, invocation *plugin.CodePluginInvocationParams, failed *release.Release, reason error) error {
+	releaseName := failed.GetName()
+	invocation.EventLog.NewEntry().Warnf("Update of Helm release '%s' failed, rolling it back: %s", releaseName, reason)
+
+	revisions, err := releases.history(releaseName)
+	if err != nil {
+		return fmt.Errorf("update of Helm release %s failed (%s) and it can't be rolled back: %s", releaseName, reason, err)
+	}
+
+	good := lastGoodRelease(revisions, failed.GetVersion())
+	if good == nil {
+		return fmt.Errorf("update of Helm release %s failed (%s) and it can't be rolled back: no previous good revision found", releaseName, reason)
+	}
+
+	timeout := int64(p.config.Timeout / time.Second)
+	err = helmKube.Update(failed.GetNamespace(), strings.NewReader(failed.GetManifest()), strings.NewReader(good.GetManifest()), false, false, timeout, false)
+	if err != nil {
+		return fmt.Errorf("update of Helm release %s failed (%s) and rollback to revision %d failed: %s", releaseName, reason, good.GetVersion(), err)
+	}
+
+	rolledBack := &release.Release{
+		Name:      releaseName,
+		Namespace: failed.GetNamespace(),
+		Chart:     good.GetChart(),
+		Config:    good.GetConfig(),
+		Manifest:  good.GetManifest(),
+		Version:   failed.GetVersion() + 1,
+		Info: &release.Info{
+			Status:        &release.Status{Code: release.Status_DEPLOYED},
+			FirstDeployed: failed.GetInfo().GetFirstDeployed(),
+			LastDeployed:  timeconv.Now(),
+			Description:   fmt.Sprintf("Rollback to %d", good.GetVersion()),
+		},
+	}
+	err = releases.save(rolledBack, failed)
+	if err != nil {
+		return err
+	}
+
+	invocation.EventLog.NewEntry().Infof("Rolled back Helm release '%s' to revision %d", releaseName, good.GetVersion())
+
+	return &plugin.RolledBackError{Reason: reason, Revision: strconv.Itoa(int(good.GetVersion()))}
+}
+
+// Move verifies that the Helm release deployed under the previous deploy name can be adopted by the new component
+// instance. Helm releases can't be renamed and names of the objects in a chart are usually derived from the release
+// name, so the release keeps its name (see MovesByAdoption). Pods get relabelled with the component name of the new
+// component instance and network policy of the release gets updated, as no update follows the move
+func (p *TillerlessPlugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	err := moveByAdoption(p, from, to)
+	if err != nil {
+		return err
+	}
+
+	releases, err := p.newStorage()
+	if err != nil {
+		return err
+	}
+	releaseName := getReleaseName(from.DeployName)
+	err = releases.migrate(releaseName, to.EventLog)
+	if err != nil {
+		return err
+	}
+	currRelease, err := releases.current(releaseName)
+	if err != nil {
+		return err
+	}
+	if currRelease == nil {
+		return fmt.Errorf("helm release %s not found", releaseName)
+	}
+
+	// component label of pods changes together with the key, otherwise network policies would not select them
+	manifest, err := k8s.LabelPods(currRelease.GetManifest(), to.PluginParams)
+	if err != nil {
+		return err
+	}
+	if manifest != currRelease.GetManifest() {
+		to.EventLog.NewEntry().Infof("Relabelling pods of Helm release '%s' moved to '%s'", releaseName, to.DeployName)
+
+		helmKube := p.kube.NewHelmKube(from.DeployName, to.EventLog)
+		timeout := int64(p.config.Timeout / time.Second)
+		err = helmKube.Update(currRelease.GetNamespace(), strings.NewReader(currRelease.GetManifest()), strings.NewReader(manifest), false, false, timeout, false)
+		if err != nil {
+			return err
+		}
+
+		relabelled := &release.Release{
+			Name:      releaseName,
+			Namespace: currRelease.GetNamespace(),
+			Chart:     currRelease.GetChart(),
+			Config:    currRelease.GetConfig(),
+			Manifest:  manifest,
+			Version:   currRelease.GetVersion() + 1,
+			Info: &release.Info{
+				Status:        &release.Status{Code: release.Status_DEPLOYED},
+				FirstDeployed: currRelease.GetInfo().GetFirstDeployed(),
+				LastDeployed:  timeconv.Now(),
+				Description:   fmt.Sprintf("Moved to %s", to.DeployName),
+			},
+		}
+		err = releases.save(relabelled, currRelease)
+		if err != nil {
+			return err
+		}
+	}
+
+	// release stays under the previous deploy name, so does its network policy
+	return p.kube.EnsureIngressPolicy(currRelease.GetNamespace(), from.DeployName, to.PluginParams, to.EventLog)
+}
+
+// MovesByAdoption returns true, as Helm releases stay under the previous deploy name when moved
+func (p *TillerlessPlugin) MovesByAdoption() bool {
+	return true
+}
+
+// Exists returns true if Helm release with the corresponding name exists in the cluster, including the releases
+// created by Tiller
+func (p *TillerlessPlugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	err := p.init()
+	if err != nil {
+		return false, err
+	}
+
+	releases, err := p.newStorage()
+	if err != nil {
+		return false, err
+	}
+
+	currRelease, err := releases.current(getReleaseName(invocation.DeployName))
+	if err != nil {
+		return false, err
+	}
+
+	return currRelease != nil, nil
+}
+
+// Deployments returns all Helm releases in the cluster, which haven't been deleted yet
+func (p *TillerlessPlugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	err := p.init()
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := p.newStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := releases.list()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*plugin.Deployment{}
+	for _, rel := range list {
+		result = append(result, &plugin.Deployment{
+			DeployName:   rel.GetName(),
+			TargetSuffix: rel.GetNamespace(),
+		})
+	}
+
+	return result, nil
+}
+
+// Destroy implements destruction of an existing component instance in the cloud by deleting all objects of the
+// Helm release and all of its revisions
+func (p *TillerlessPlugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
+	err := p.init()
+	if err != nil {
+		return err
+	}
+
+	releases, err := p.newStorage()
+	if err != nil {
+		return err
+	}
+
+	releaseName := getReleaseName(invocation.DeployName)
+	currRelease, err := releases.current(releaseName)
+	if err != nil {
+		return err
+	}
+	if currRelease == nil {
+		return nil
+	}
+
+	invocation.EventLog.NewEntry().Infof("Deleting Helm release '%s' without Tiller", releaseName)
+
+	helmKube := p.kube.NewHelmKube(invocation.DeployName, invocation.EventLog)
+	err = helmKube.Delete(currRelease.GetNamespace(), strings.NewReader(currRelease.GetManifest()))
+	if err != nil {
+		return err
+	}
+
+	err = p.kube.DeleteIngressPolicy(currRelease.GetNamespace(), invocation.DeployName)
+	if err != nil {
+		return err
+	}
+
+	return releases.delete(releaseName)
+}
+
+// Endpoints returns map from port type to url for all services of the current chart
+func (p *TillerlessPlugin) Endpoints(invocation *plugin.CodePluginInvocationParams) (map[string]string, error) {
+	namespace := invocation.PluginParams[plugin.ParamTargetSuffix]
+	if len(namespace) <= 0 {
+		return nil, fmt.Errorf("namespace is a mandatory parameter")
+	}
+
+	currRelease, err := p.currentRelease(invocation)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.kube.EndpointsForManifests(namespace, invocation.DeployName, currRelease.GetManifest(), invocation.EventLog)
+}
+
+// Resources returns list of all resources (like services, config maps, etc.) deployed into the cluster by specified component instance
+func (p *TillerlessPlugin) Resources(invocation *plugin.CodePluginInvocationParams) (plugin.Resources, error) {
+	namespace := invocation.PluginParams[plugin.ParamTargetSuffix]
+	if len(namespace) <= 0 {
+		return nil, fmt.Errorf("namespace is a mandatory parameter")
+	}
+
+	currRelease, err := p.currentRelease(invocation)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.kube.ResourcesForManifest(namespace, invocation.DeployName, currRelease.GetManifest(), invocation.EventLog)
+}
+
+// Status returns readiness of all resources (like services, config maps, etc.) deployed into the cluster by specified component instance
+func (p *TillerlessPlugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	namespace := invocation.PluginParams[plugin.ParamTargetSuffix]
+	if len(namespace) <= 0 {
+		return false, fmt.Errorf("namespace is a mandatory parameter")
+	}
+
+	currRelease, err := p.currentRelease(invocation)
+	if err != nil {
+		return false, err
+	}
+	if currRelease.GetInfo().GetStatus().GetCode() == release.Status_FAILED {
+		return false, nil
+	}
+
+	return p.kube.ReadinessStatusForManifest(namespace, invocation.DeployName, currRelease.GetManifest(), invocation.EventLog)
+}
+
+// Drift compares values and chart of the deployed Helm release with the specified params, as well as objects from the
+// release manifest with the live objects in the cluster
+func (p *TillerlessPlugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	namespace := invocation.PluginParams[plugin.ParamTargetSuffix]
+	if len(namespace) <= 0 {
+		return "", fmt.Errorf("namespace is a mandatory parameter")
+	}
+
+	currRelease, err := p.currentRelease(invocation)
+	if err != nil {
+		return "", err
+	}
+
+	return releaseDrift(p.kube, invocation, namespace, currRelease)
+}
@@ -2,75 +2,114 @@ package helm
 
 import (
 	"fmt"
-	"io/ioutil"
 
+	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
 	"k8s.io/helm/pkg/helm"
-	"k8s.io/helm/pkg/repo"
 )
 
 func (p *Plugin) newClient() *helm.Client {
 	return helm.NewClient(helm.Host(p.tillerHost))
 }
 
-func getHelmReleaseInfo(params util.NestedParameterMap) (repository, name, version string, err error) {
-	var ok bool
-	if repository, ok = params["chartRepo"].(string); !ok {
-		err = fmt.Errorf("chartRepo is a mandatory parameter")
-		return
-	}
+func getReleaseName(deployName string) string {
+	return deployName
+}
 
-	if name, ok = params["chartName"].(string); !ok {
-		err = fmt.Errorf("chartName is a mandatory parameter")
-		return
+// moveByAdoption checks that Helm release deployed under the previous deploy name exists and stays in the same
+// namespace, so it could be adopted by the new component instance as is
+func moveByAdoption(p plugin.CodePlugin, from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	namespace := to.PluginParams[plugin.ParamTargetSuffix]
+	if prevNamespace := from.PluginParams[plugin.ParamTargetSuffix]; prevNamespace != namespace {
+		return fmt.Errorf("helm release '%s' can't be moved from namespace '%s' to '%s'", getReleaseName(from.DeployName), prevNamespace, namespace)
 	}
 
-	if _, ok = params["chartVersion"]; !ok {
-		// version is optional. this will use the latest
-		version = ""
-	} else {
-		if version, ok = params["chartVersion"].(string); !ok {
-			err = fmt.Errorf("chartVersion is not a valid string")
-			return
-		}
+	exists, err := p.Exists(from)
+	if err != nil {
+		return err
 	}
+	if !exists {
+		return fmt.Errorf("helm release '%s' not found", getReleaseName(from.DeployName))
+	}
+
+	to.EventLog.NewEntry().Infof("Helm release '%s' is adopted as is, as it can't be renamed to '%s'", getReleaseName(from.DeployName), getReleaseName(to.DeployName))
 
-	return
+	return nil
 }
 
-func getReleaseName(deployName string) string {
-	return deployName
+// controlParams are code params, which control how the plugin deploys the release (which chart is used and how it gets
+// rolled back) rather than configure the chart, so they are never passed into chart values
+var controlParams = []string{"chartRepo", "chartName", "chartVersion", "chartPath", "chartArchive", "rollbackOnFailure", "rollbackTimeout"}
+
+// chartValues returns code params without control params, i.e. values the chart gets installed with
+func chartValues(params util.NestedParameterMap) util.NestedParameterMap {
+	result := util.NestedParameterMap{}
+	for key, value := range params {
+		if !util.ContainsString(controlParams, key) {
+			result[key] = value
+		}
+	}
+	return result
 }
 
-func (p *Plugin) fetchChart(repository, name, version string) (string, error) {
-	chartURL, err := repo.FindChartInRepoURL(
-		repository, name, version,
-		"", "", "",
-		newGetterProviders(),
-	)
+// diffValues returns unified diff between params and raw values of the deployed release. Both are normalized through
+// yaml, so key order and formatting don't matter. Empty string means that values are the same
+func diffValues(params util.NestedParameterMap, releaseValues string) (string, error) {
+	expected, err := normalizeValues(chartValues(params))
 	if err != nil {
-		return "", fmt.Errorf("error while getting chart url in repo: %s", err)
+		return "", err
 	}
 
-	chartFile, err := ioutil.TempFile("", name)
+	var deployedValues interface{}
+	err = yaml.Unmarshal([]byte(releaseValues), &deployedValues)
 	if err != nil {
-		return "", fmt.Errorf("error while creating temp file for downloading chart: %s", err)
+		return "", err
 	}
-
-	chartGetter, err := newHTTPGetter(chartURL, "", "", "")
+	// releases deployed before control params have been stripped from values still have them
+	if values, ok := deployedValues.(map[interface{}]interface{}); ok {
+		for _, key := range controlParams {
+			delete(values, key)
+		}
+	}
+	deployed, err := normalizeValues(deployedValues)
 	if err != nil {
-		return "", fmt.Errorf("error while creating chart downloader: %s", err)
+		return "", err
+	}
+
+	if expected == deployed {
+		return "", nil
 	}
 
-	resp, err := chartGetter.Get(chartURL)
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(expected),
+		B:        difflib.SplitLines(deployed),
+		FromFile: "Expected",
+		ToFile:   "Deployed",
+		Context:  3,
+	})
+}
+
+func normalizeValues(values interface{}) (string, error) {
+	data, err := yaml.Marshal(values)
 	if err != nil {
-		return "", fmt.Errorf("error while downloading chart: %s", err)
+		return "", err
 	}
 
-	_, err = chartFile.Write(resp.Bytes())
+	// unmarshal and marshal again to get rid of type differences
+	var result interface{}
+	err = yaml.Unmarshal(data, &result)
 	if err != nil {
-		return "", fmt.Errorf("error while writing downloaded chart to the temp file")
+		return "", err
+	}
+	if m, ok := result.(map[interface{}]interface{}); result == nil || ok && len(m) == 0 {
+		return "", nil
 	}
 
-	return chartFile.Name(), nil
+	data, err = yaml.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
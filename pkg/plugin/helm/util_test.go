@@ -0,0 +1,39 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChartValues(t *testing.T) {
+	params := util.NestedParameterMap{
+		"chartName":         "web",
+		"chartArchive":      "H4sIAAAAAAAA",
+		"rollbackOnFailure": true,
+		"replicas":          2,
+		"chartLabels":       util.NestedParameterMap{"team": "platform"},
+	}
+	assert.Equal(t, util.NestedParameterMap{
+		"replicas":    2,
+		"chartLabels": util.NestedParameterMap{"team": "platform"},
+	}, chartValues(params), "Only control params should be stripped from chart values")
+
+	tests := []struct {
+		releaseValues string
+		drift         bool
+	}{
+		// values of releases deployed before control params have been stripped
+		{"chartName: web\nchartArchive: H4sIAAAAAAAA\nrollbackOnFailure: true\nreplicas: 2\nchartLabels:\n  team: platform\n", false},
+		{"replicas: 2\nchartLabels:\n  team: platform\n", false},
+		{"replicas: 3\nchartLabels:\n  team: platform\n", true},
+	}
+	for _, test := range tests {
+		diff, err := diffValues(params, test.releaseValues)
+		if !assert.NoError(t, err, "Values should be compared") {
+			t.FailNow()
+		}
+		assert.Equal(t, test.drift, len(diff) > 0, "Values drift should only be reported when chart values differ: %s", test.releaseValues)
+	}
+}
@@ -11,6 +11,9 @@ import (
 type Registry interface {
 	ForCluster(cluster *lang.Cluster) (ClusterPlugin, error)
 	ForCodeType(cluster *lang.Cluster, codeType string) (CodePlugin, error)
+
+	// CodeTypes returns the list of code types, which are supported for the given cluster
+	CodeTypes(cluster *lang.Cluster) []string
 }
 
 // RegistryFactory returns plugins registry on demand
@@ -43,17 +46,97 @@ type CodePlugin interface {
 	Endpoints(*CodePluginInvocationParams) (map[string]string, error)
 	Resources(*CodePluginInvocationParams) (Resources, error)
 	Status(*CodePluginInvocationParams) (bool, error)
+
+	// Drift compares what is deployed in the cloud with the provided params and returns human-readable description
+	// of the differences. Empty string means that there is no drift
+	Drift(*CodePluginInvocationParams) (string, error)
+
+	// Exists returns true if deployment with the given deploy name already exists in the cloud, even if it hasn't been
+	// created by Aptomi (e.g. it has been deployed manually before). It's used to adopt existing deployments
+	Exists(*CodePluginInvocationParams) (bool, error)
+
+	// Deployments returns the list of deployments in the cluster, which have been created by this plugin, no matter
+	// if they are tracked by Aptomi or not. It's used to find orphaned deployments
+	Deployments(eventLog *event.Log) ([]*Deployment, error)
+
+	// Move makes an existing deployment (from) available under the new deploy name (to) without destroying it, so
+	// stateful data is preserved when component instance key changes (e.g. context got renamed)
+	Move(from *CodePluginInvocationParams, to *CodePluginInvocationParams) error
+}
+
+// MoveByAdoption is an optional interface of code plugins, which can't rename deployments (e.g. Helm releases can't be
+// renamed). Move of such plugins only verifies that the deployment can be taken over, and it stays under the previous
+// deploy name, which gets adopted by the component instance with the new key
+type MoveByAdoption interface {
+	// MovesByAdoption returns true if Move leaves the deployment under its previous deploy name
+	MovesByAdoption() bool
+}
+
+// DataStore is where code plugins keep data of their deployments, which can't be recovered from the cloud (e.g.
+// Terraform state). It's backed by Aptomi store, so the data is persisted together with actual state and doesn't
+// depend on local disk of the server. Every entry is a set of named files
+type DataStore interface {
+	// LoadPluginData returns data saved under the given name or nil if there is no such data
+	LoadPluginData(name string) (map[string]string, error)
+
+	// FindPluginData returns all data, which names start with the given prefix, indexed by name
+	FindPluginData(prefix string) (map[string]map[string]string, error)
+
+	// SavePluginData saves data under the given name, overwriting what has been saved before
+	SavePluginData(name string, data map[string]string) error
+
+	// DeletePluginData deletes data saved under the given name
+	DeletePluginData(name string) error
 }
 
 // ParamTargetSuffix it's a plugin-specific parameter, which is additionally specifies where the code should reside (in case of k8s and Helm, it's a string consisting of k8s namespace)
 const ParamTargetSuffix = "target-suffix"
 
+// ParamComponent is a plugin-specific parameter with the name of the component instance, which stays the same across
+// blue/green updates and moves (in case of k8s and Helm, pods of the component instance get labeled with it when
+// ParamLabelPods is set)
+const ParamComponent = "component"
+
+// ParamAllowIngress is a plugin-specific parameter, which is set to "false" when ingress traffic to the component
+// instance should be blocked, except for the traffic from ParamAllowIngressFrom
+const ParamAllowIngress = "allow-ingress"
+
+// ParamAllowIngressFrom is a plugin-specific parameter with a comma-separated list of "<target suffix>/<component>"
+// entries, which are allowed to send ingress traffic to the component instance when ParamAllowIngress is "false"
+const ParamAllowIngressFrom = "allow-ingress-from"
+
+// ParamLabelPods is a plugin-specific parameter, which is set to "true" when pods of the component instance are
+// selected by network policies (either its own one or the ones of the component instances it sends ingress traffic
+// to), so they have to be labelled with ParamComponent. Pods are left as is otherwise
+const ParamLabelPods = "label-pods"
+
 // CodePluginInvocationParams is a struct that will be passed into CodePlugin when invoking its methods
 type CodePluginInvocationParams struct {
 	DeployName   string
 	Params       util.NestedParameterMap
 	PluginParams map[string]string
 	EventLog     *event.Log
+
+	// Cancel is closed when the apply process gets cancelled, so plugins could stop waiting for long-running
+	// operations (e.g. readiness of the updated deployment). It's nil if invocation can't be cancelled
+	Cancel <-chan struct{}
+}
+
+// Deployment represents a deployment, which has been found in the cloud by code plugin
+type Deployment struct {
+	// DeployName is the name of the deployment
+	DeployName string
+
+	// TargetSuffix is where deployment resides (in case of k8s and Helm, it's a k8s namespace)
+	TargetSuffix string
+
+	// Params are the params deployment has been created with. They are only populated if a plugin needs them in
+	// order to destroy the deployment
+	Params util.NestedParameterMap
+
+	// Error is set if deployment has been found, but plugin can't destroy it safely (e.g. not enough data has been
+	// recorded for it), so it has to be destroyed manually
+	Error string
 }
 
 // CodePluginConstructor represents constructor the the code plugin
@@ -0,0 +1,135 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/kubernetes/pkg/kubectl/resource"
+)
+
+// driftIgnoredFields is a set of top-level object fields, which are not compared with live objects, because
+// they are write-only or get converted by the API server (e.g. stringData of a Secret gets merged into data)
+var driftIgnoredFields = map[string]bool{
+	"status":     true,
+	"stringData": true,
+}
+
+// DriftForManifest compares objects from the specified manifest with the live objects in the cluster and returns
+// human-readable description of the differences. Only fields present in the manifest are compared, so defaults
+// and fields populated by the cluster are not considered a drift. Empty string means that there is no drift
+func (p *Plugin) DriftForManifest(namespace, deployName, targetManifest string, eventLog *event.Log) (string, error) {
+	helmKube := p.NewHelmKube(deployName, eventLog)
+
+	infos, err := helmKube.BuildUnstructured(namespace, strings.NewReader(targetManifest))
+	if err != nil {
+		return "", err
+	}
+
+	diffs := []string{}
+	for _, info := range infos {
+		objDiffs, objErr := driftForObject(info)
+		if objErr != nil {
+			return "", objErr
+		}
+		diffs = append(diffs, objDiffs...)
+	}
+
+	return strings.Join(diffs, "\n"), nil
+}
+
+// driftForObject loads live object for the given info and compares it with the object from the manifest
+func driftForObject(info *resource.Info) ([]string, error) {
+	name := fmt.Sprintf("%s/%s", info.Mapping.GroupVersionKind.Kind, info.Name)
+
+	expected, ok := info.Object.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unstructured object expected for %s, but received: %T", name, info.Object)
+	}
+	expectedObj := expected.Object
+
+	// info.Get replaces info.Object with the live object from the cluster
+	err := info.Get()
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return []string{fmt.Sprintf("%s: not found in the cluster", name)}, nil
+		}
+		return nil, err
+	}
+
+	live, ok := info.Object.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unstructured object expected for live %s, but received: %T", name, info.Object)
+	}
+
+	diffs := []string{}
+	for _, key := range sortedKeys(expectedObj) {
+		if driftIgnoredFields[key] {
+			continue
+		}
+		diffs = append(diffs, driftForValue(name+": "+key, expectedObj[key], live.Object[key])...)
+	}
+
+	return diffs, nil
+}
+
+// driftForValue recursively compares expected value with the live one. Maps in the live object may contain extra keys,
+// while lists must have exactly the same length
+func driftForValue(path string, expected interface{}, live interface{}) []string {
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		liveValue, ok := live.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, found %v", path, live)}
+		}
+		diffs := []string{}
+		for _, key := range sortedKeys(expectedValue) {
+			diffs = append(diffs, driftForValue(path+"."+key, expectedValue[key], liveValue[key])...)
+		}
+		return diffs
+	case []interface{}:
+		liveValue, ok := live.([]interface{})
+		if !ok || len(liveValue) != len(expectedValue) {
+			return []string{fmt.Sprintf("%s: expected list of %d elements, found %v", path, len(expectedValue), live)}
+		}
+		diffs := []string{}
+		for idx := range expectedValue {
+			diffs = append(diffs, driftForValue(fmt.Sprintf("%s[%d]", path, idx), expectedValue[idx], liveValue[idx])...)
+		}
+		return diffs
+	}
+
+	if sameScalar(expected, live) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: expected %v, found %v", path, expected, live)}
+}
+
+// sameScalar compares scalar values, treating numbers of different types and equal resource quantities (e.g. 0.5 and 500m) as equal
+func sameScalar(expected interface{}, live interface{}) bool {
+	if expected == nil || live == nil {
+		return expected == live
+	}
+
+	expectedStr, liveStr := fmt.Sprint(expected), fmt.Sprint(live)
+	if expectedStr == liveStr {
+		return true
+	}
+
+	expectedQuantity, expectedErr := apiresource.ParseQuantity(expectedStr)
+	liveQuantity, liveErr := apiresource.ParseQuantity(liveStr)
+	return expectedErr == nil && liveErr == nil && expectedQuantity.Cmp(liveQuantity) == 0
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -7,12 +7,15 @@ import (
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/util"
 	api "k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/kubernetes/pkg/kubectl/resource"
 )
 
-// EndpointsForManifests returns endpoints for specified manifest
+// EndpointsForManifests returns endpoints for specified manifest. Endpoints are user-facing URLs of services (node
+// ports, load balancers and external names) and ingresses, which are keyed by the kind of the endpoint, e.g.
+// "nodeport:http" or "ingress:example.com/api"
 func (p *Plugin) EndpointsForManifests(namespace, deployName, targetManifest string, eventLog *event.Log) (map[string]string, error) {
 	kubeClient, err := p.NewClient()
 	if err != nil {
@@ -29,12 +32,15 @@ func (p *Plugin) EndpointsForManifests(namespace, deployName, targetManifest str
 	endpoints := make(map[string]string)
 
 	for _, info := range infos {
-		if info.Mapping.GroupVersionKind.Kind == "Service" { // nolint: goconst
-
-			endpointsErr := p.addEndpointsFromService(kubeClient, info, endpoints)
-			if endpointsErr != nil {
-				return nil, endpointsErr
-			}
+		var endpointsErr error
+		switch info.Mapping.GroupVersionKind.Kind {
+		case "Service": // nolint: goconst
+			endpointsErr = p.addEndpointsFromService(kubeClient, info, endpoints)
+		case "Ingress":
+			endpointsErr = p.addEndpointsFromIngress(kubeClient, info, endpoints)
+		}
+		if endpointsErr != nil {
+			return nil, endpointsErr
 		}
 	}
 
@@ -51,7 +57,15 @@ func (p *Plugin) addEndpointsFromService(kubeClient kubernetes.Interface, info *
 	if service.Spec.Type == api.ServiceTypeNodePort {
 		for _, port := range service.Spec.Ports {
 			sURL := fmt.Sprintf("%s:%d", p.ExternalAddress, port.NodePort)
-			addEndpointsForServicePort(port, sURL, endpoints)
+			addEndpointsForServicePort("nodeport", port, sURL, endpoints)
+		}
+	} else if service.Spec.Type == api.ServiceTypeExternalName {
+		if len(service.Spec.Ports) == 0 {
+			endpoints["externalname:"+service.Name] = service.Spec.ExternalName
+		}
+		for _, port := range service.Spec.Ports {
+			sURL := fmt.Sprintf("%s:%d", service.Spec.ExternalName, port.Port)
+			addEndpointsForServicePort("externalname", port, sURL, endpoints)
 		}
 	} else if service.Spec.Type == api.ServiceTypeLoadBalancer {
 		ingress := service.Status.LoadBalancer.Ingress
@@ -60,33 +74,92 @@ func (p *Plugin) addEndpointsFromService(kubeClient kubernetes.Interface, info *
 			return fmt.Errorf("no Ingress for Service type LoadBalancer (%s in %s)", info.Name, info.Namespace)
 		}
 
-		externalAddress := ""
-		for _, entry := range ingress {
-			if entry.Hostname != "" {
-				// handle only first ingress entry for LB
-				externalAddress = entry.Hostname
-				break
-			} else if entry.IP != "" {
-				// handle only first ingress entry for LB
-				externalAddress = entry.IP
-				break
-			}
-		}
-
+		externalAddress := loadBalancerAddress(ingress)
 		if externalAddress == "" {
 			externalAddress = "(unknown)"
 		}
 
 		for _, port := range service.Spec.Ports {
 			sURL := fmt.Sprintf("%s:%d", externalAddress, port.Port)
-			addEndpointsForServicePort(port, sURL, endpoints)
+			addEndpointsForServicePort("loadbalancer", port, sURL, endpoints)
+		}
+	}
+
+	return nil
+}
+
+// addEndpointsFromIngress searches for the URLs exposed by specified ingress and writes them into provided map. Rules
+// without host are exposed on the address of the ingress load balancer (or the external address of the cluster)
+func (p *Plugin) addEndpointsFromIngress(kubeClient kubernetes.Interface, info *resource.Info, endpoints map[string]string) error {
+	ingress, getErr := kubeClient.ExtensionsV1beta1().Ingresses(info.Namespace).Get(info.Name, meta.GetOptions{})
+	if getErr != nil {
+		return getErr
+	}
+
+	defaultHost := loadBalancerAddress(ingress.Status.LoadBalancer.Ingress)
+	if defaultHost == "" {
+		defaultHost = p.ExternalAddress
+	}
+
+	if len(ingress.Spec.Rules) == 0 && ingress.Spec.Backend != nil {
+		endpoints["ingress:"+ingress.Name] = ingressScheme(ingress, "") + defaultHost + "/"
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = defaultHost
+		}
+
+		paths := []string{"/"}
+		if rule.HTTP != nil && len(rule.HTTP.Paths) > 0 {
+			paths = paths[:0]
+			for _, path := range rule.HTTP.Paths {
+				if path.Path == "" {
+					paths = append(paths, "/")
+				} else {
+					paths = append(paths, path.Path)
+				}
+			}
+		}
+
+		for _, path := range paths {
+			endpoints["ingress:"+host+path] = ingressScheme(ingress, rule.Host) + host + path
 		}
 	}
 
 	return nil
 }
 
-func addEndpointsForServicePort(port api.ServicePort, sURL string, endpoints map[string]string) {
+// ingressScheme returns "https://" if TLS is configured in the ingress for specified host and "http://" otherwise.
+// TLS entries without hosts apply to all of them
+func ingressScheme(ingress *extensions.Ingress, host string) string {
+	for _, tls := range ingress.Spec.TLS {
+		if len(tls.Hosts) == 0 {
+			return "https://"
+		}
+		for _, tlsHost := range tls.Hosts {
+			if tlsHost == host {
+				return "https://"
+			}
+		}
+	}
+	return "http://"
+}
+
+// loadBalancerAddress returns hostname or IP of the first load balancer ingress entry, which has one
+func loadBalancerAddress(ingress []api.LoadBalancerIngress) string {
+	for _, entry := range ingress {
+		if entry.Hostname != "" {
+			return entry.Hostname
+		} else if entry.IP != "" {
+			return entry.IP
+		}
+	}
+	return ""
+}
+
+func addEndpointsForServicePort(kind string, port api.ServicePort, sURL string, endpoints map[string]string) {
 	if util.StringContainsAny(port.Name, "https") {
 		sURL = "https://" + sURL
 	} else if util.StringContainsAny(port.Name, "ui", "rest", "http", "grafana", "service") {
@@ -96,5 +169,5 @@ func addEndpointsForServicePort(port api.ServicePort, sURL string, endpoints map
 	if len(name) == 0 {
 		name = port.TargetPort.String()
 	}
-	endpoints[name] = sURL
+	endpoints[kind+":"+name] = sURL
 }
@@ -0,0 +1,174 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	api "k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/kubectl/resource"
+)
+
+func TestAddEndpointsFromService(t *testing.T) {
+	p := &Plugin{ExternalAddress: "10.0.0.1"}
+	client := fake.NewSimpleClientset(
+		&api.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "nodeport", Namespace: "main"},
+			Spec: api.ServiceSpec{
+				Type: api.ServiceTypeNodePort,
+				Ports: []api.ServicePort{
+					{Name: "http", Port: 80, NodePort: 30080},
+					{Port: 9090, NodePort: 30090, TargetPort: intstr.FromInt(8080)},
+				},
+			},
+		},
+		&api.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "loadbalancer", Namespace: "main"},
+			Spec: api.ServiceSpec{
+				Type:  api.ServiceTypeLoadBalancer,
+				Ports: []api.ServicePort{{Name: "https", Port: 443}},
+			},
+			Status: api.ServiceStatus{LoadBalancer: api.LoadBalancerStatus{Ingress: []api.LoadBalancerIngress{{IP: "1.2.3.4"}}}},
+		},
+		&api.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "pending", Namespace: "main"},
+			Spec: api.ServiceSpec{
+				Type:  api.ServiceTypeLoadBalancer,
+				Ports: []api.ServicePort{{Name: "http", Port: 80}},
+			},
+		},
+		&api.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "db", Namespace: "main"},
+			Spec: api.ServiceSpec{
+				Type:         api.ServiceTypeExternalName,
+				ExternalName: "db.example.com",
+			},
+		},
+		&api.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "api", Namespace: "main"},
+			Spec: api.ServiceSpec{
+				Type:         api.ServiceTypeExternalName,
+				ExternalName: "api.example.com",
+				Ports:        []api.ServicePort{{Name: "rest", Port: 8080}},
+			},
+		},
+		&api.Service{
+			ObjectMeta: meta.ObjectMeta{Name: "internal", Namespace: "main"},
+			Spec: api.ServiceSpec{
+				Type:  api.ServiceTypeClusterIP,
+				Ports: []api.ServicePort{{Name: "http", Port: 80}},
+			},
+		},
+	)
+
+	endpoints := make(map[string]string)
+	for _, name := range []string{"nodeport", "loadbalancer", "db", "api", "internal"} {
+		err := p.addEndpointsFromService(client, &resource.Info{Namespace: "main", Name: name}, endpoints)
+		if !assert.NoError(t, err, "Endpoints of service %s should be returned", name) {
+			t.FailNow()
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"nodeport:http":      "http://10.0.0.1:30080",
+		"nodeport:8080":      "10.0.0.1:30090",
+		"loadbalancer:https": "https://1.2.3.4:443",
+		"externalname:db":    "db.example.com",
+		"externalname:rest":  "http://api.example.com:8080",
+	}, endpoints, "Endpoints should be keyed by kind and port")
+
+	err := p.addEndpointsFromService(client, &resource.Info{Namespace: "main", Name: "pending"}, endpoints)
+	assert.Error(t, err, "Load balancer without ingress should be reported")
+
+	err = p.addEndpointsFromService(client, &resource.Info{Namespace: "main", Name: "missing"}, endpoints)
+	assert.Error(t, err, "Missing service should be reported")
+}
+
+func TestAddEndpointsFromIngress(t *testing.T) {
+	p := &Plugin{ExternalAddress: "10.0.0.1"}
+	client := fake.NewSimpleClientset(
+		&extensions.Ingress{
+			ObjectMeta: meta.ObjectMeta{Name: "web", Namespace: "main"},
+			Spec: extensions.IngressSpec{
+				TLS: []extensions.IngressTLS{{Hosts: []string{"secure.example.com"}}},
+				Rules: []extensions.IngressRule{
+					{
+						Host: "secure.example.com",
+						IngressRuleValue: extensions.IngressRuleValue{HTTP: &extensions.HTTPIngressRuleValue{Paths: []extensions.HTTPIngressPath{
+							{Path: "/api"},
+							{},
+						}}},
+					},
+					{Host: "example.com"},
+					{IngressRuleValue: extensions.IngressRuleValue{HTTP: &extensions.HTTPIngressRuleValue{Paths: []extensions.HTTPIngressPath{{Path: "/ui"}}}}},
+				},
+			},
+			Status: extensions.IngressStatus{LoadBalancer: api.LoadBalancerStatus{Ingress: []api.LoadBalancerIngress{{}, {Hostname: "lb.example.com"}}}},
+		},
+		&extensions.Ingress{
+			ObjectMeta: meta.ObjectMeta{Name: "default", Namespace: "main"},
+			Spec: extensions.IngressSpec{
+				Backend: &extensions.IngressBackend{ServiceName: "web", ServicePort: intstr.FromInt(80)},
+				TLS:     []extensions.IngressTLS{{}},
+			},
+		},
+	)
+
+	endpoints := make(map[string]string)
+	for _, name := range []string{"web", "default"} {
+		err := p.addEndpointsFromIngress(client, &resource.Info{Namespace: "main", Name: name}, endpoints)
+		if !assert.NoError(t, err, "Endpoints of ingress %s should be returned", name) {
+			t.FailNow()
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"ingress:secure.example.com/api": "https://secure.example.com/api",
+		"ingress:secure.example.com/":    "https://secure.example.com/",
+		"ingress:example.com/":           "http://example.com/",
+		"ingress:lb.example.com/ui":      "http://lb.example.com/ui",
+		"ingress:default":                "https://10.0.0.1/",
+	}, endpoints, "Ingress rules should be exposed with scheme depending on TLS, rules without host should use load balancer address")
+
+	err := p.addEndpointsFromIngress(client, &resource.Info{Namespace: "main", Name: "missing"}, endpoints)
+	assert.Error(t, err, "Missing ingress should be reported")
+}
+
+func TestIngressScheme(t *testing.T) {
+	tests := []struct {
+		tls      []extensions.IngressTLS
+		host     string
+		expected string
+	}{
+		{nil, "example.com", "http://"},
+		{[]extensions.IngressTLS{{Hosts: []string{"example.com"}}}, "example.com", "https://"},
+		{[]extensions.IngressTLS{{Hosts: []string{"other.com"}}}, "example.com", "http://"},
+		{[]extensions.IngressTLS{{Hosts: []string{"other.com"}}, {Hosts: []string{"example.com"}}}, "example.com", "https://"},
+		{[]extensions.IngressTLS{{}}, "example.com", "https://"},
+		{[]extensions.IngressTLS{{}}, "", "https://"},
+		{[]extensions.IngressTLS{{Hosts: []string{"example.com"}}}, "", "http://"},
+	}
+	for _, test := range tests {
+		ingress := &extensions.Ingress{Spec: extensions.IngressSpec{TLS: test.tls}}
+		assert.Equal(t, test.expected, ingressScheme(ingress, test.host), "Scheme for host '%s' with TLS %v", test.host, test.tls)
+	}
+}
+
+func TestLoadBalancerAddress(t *testing.T) {
+	tests := []struct {
+		ingress  []api.LoadBalancerIngress
+		expected string
+	}{
+		{nil, ""},
+		{[]api.LoadBalancerIngress{{}}, ""},
+		{[]api.LoadBalancerIngress{{IP: "1.2.3.4"}}, "1.2.3.4"},
+		{[]api.LoadBalancerIngress{{IP: "1.2.3.4", Hostname: "lb.example.com"}}, "lb.example.com"},
+		{[]api.LoadBalancerIngress{{}, {IP: "1.2.3.4"}, {Hostname: "lb.example.com"}}, "1.2.3.4"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, loadBalancerAddress(test.ingress), "Load balancer address for %v", test.ingress)
+	}
+}
@@ -0,0 +1,42 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ExistsForManifest returns true if all objects from the specified manifest already exist in the cluster. It returns
+// false if none of them exist and an error if only some of them exist, since such deployment can't be adopted safely
+func (p *Plugin) ExistsForManifest(namespace, deployName, targetManifest string, eventLog *event.Log) (bool, error) {
+	helmKube := p.NewHelmKube(deployName, eventLog)
+
+	infos, err := helmKube.BuildUnstructured(namespace, strings.NewReader(targetManifest))
+	if err != nil {
+		return false, err
+	}
+
+	found, missing := []string{}, []string{}
+	for _, info := range infos {
+		name := fmt.Sprintf("%s/%s", info.Mapping.GroupVersionKind.Kind, info.Name)
+
+		// info.Get replaces info.Object with the live object from the cluster
+		getErr := info.Get()
+		if getErr != nil {
+			if errors.IsNotFound(getErr) {
+				missing = append(missing, name)
+				continue
+			}
+			return false, getErr
+		}
+		found = append(found, name)
+	}
+
+	if len(found) > 0 && len(missing) > 0 {
+		return false, fmt.Errorf("only some of k8s objects exist in namespace '%s' (found: %s, missing: %s)", namespace, strings.Join(found, ", "), strings.Join(missing, ", "))
+	}
+
+	return len(found) > 0, nil
+}
@@ -0,0 +1,226 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/ghodss/yaml"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LabelComponent is a label, which is added to pods of component instances deployed by Aptomi, when network
+	// policies need to select them
+	LabelComponent = "aptomi.io/component"
+
+	// LabelNamespace is a label, which is added to namespaces with component instances selected by network policies,
+	// so network policies could select pods from other namespaces
+	LabelNamespace = "aptomi.io/namespace"
+
+	// ingressPolicyPrefix is a prefix of names of network policies restricting ingress traffic to component instances
+	ingressPolicyPrefix = "aptomi-ingress-"
+)
+
+// EnsureIngressPolicy creates or updates network policy blocking ingress traffic to the component instance if it's not
+// allowed for it, or deletes such policy if it's allowed. Pods of component instances from ParamAllowIngressFrom, as
+// well as pods of the component instance itself, are still allowed to send ingress traffic. Pods get selected by the
+// component label, which has to be added to the manifest with LabelPods before it gets applied. Namespace gets
+// labelled as well, if pods are selected by network policies, so policies from other namespaces could select it
+func (p *Plugin) EnsureIngressPolicy(namespace, deployName string, pluginParams map[string]string, eventLog *event.Log) error {
+	client, err := p.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if pluginParams[plugin.ParamLabelPods] == "true" {
+		err = labelNamespace(client, namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	component := pluginParams[plugin.ParamComponent]
+	if pluginParams[plugin.ParamAllowIngress] != "false" || len(component) <= 0 {
+		return deleteIngressPolicy(client, namespace, deployName)
+	}
+
+	policy := newIngressPolicy(namespace, deployName, component, pluginParams[plugin.ParamAllowIngressFrom])
+	policies := client.NetworkingV1().NetworkPolicies(namespace)
+
+	current, err := policies.Get(policy.Name, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		eventLog.NewEntry().Debugf("Creating network policy %s blocking ingress traffic to component instance %s", policy.Name, deployName)
+		_, err = policies.Create(policy)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	current.Labels = policy.Labels
+	current.Spec = policy.Spec
+	_, err = policies.Update(current)
+	return err
+}
+
+// DeleteIngressPolicy deletes network policy blocking ingress traffic to the component instance, if it exists
+func (p *Plugin) DeleteIngressPolicy(namespace, deployName string) error {
+	client, err := p.NewClient()
+	if err != nil {
+		return err
+	}
+
+	return deleteIngressPolicy(client, namespace, deployName)
+}
+
+func deleteIngressPolicy(client kubernetes.Interface, namespace, deployName string) error {
+	err := client.NetworkingV1().NetworkPolicies(namespace).Delete(ingressPolicyPrefix+deployName, &meta.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// newIngressPolicy creates network policy, which only allows ingress traffic to the component pods from the component
+// itself and from the given comma-separated list of "<namespace>/<component>" entries
+func newIngressPolicy(namespace, deployName, component, allowFrom string) *networking.NetworkPolicy {
+	peers := []networking.NetworkPolicyPeer{
+		{PodSelector: &meta.LabelSelector{MatchLabels: map[string]string{LabelComponent: component}}},
+	}
+
+	for _, entry := range strings.Split(allowFrom, ",") {
+		parts := strings.SplitN(entry, "/", 2)
+		if len(parts) != 2 || len(parts[0]) <= 0 || len(parts[1]) <= 0 {
+			continue
+		}
+		if parts[0] == namespace {
+			peers = append(peers, networking.NetworkPolicyPeer{
+				PodSelector: &meta.LabelSelector{MatchLabels: map[string]string{LabelComponent: parts[1]}},
+			})
+		} else {
+			// pod and namespace selectors can't be combined within the same peer on older k8s versions, so the
+			// whole namespace of the component instance is allowed
+			peers = append(peers, networking.NetworkPolicyPeer{
+				NamespaceSelector: &meta.LabelSelector{MatchLabels: map[string]string{LabelNamespace: parts[0]}},
+			})
+		}
+	}
+
+	return &networking.NetworkPolicy{
+		ObjectMeta: meta.ObjectMeta{
+			Name:      ingressPolicyPrefix + deployName,
+			Namespace: namespace,
+			Labels:    map[string]string{LabelComponent: component},
+		},
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: meta.LabelSelector{MatchLabels: map[string]string{LabelComponent: component}},
+			Ingress:     []networking.NetworkPolicyIngressRule{{From: peers}},
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeIngress},
+		},
+	}
+}
+
+// labelNamespace labels namespace with its own name, so it could be selected by network policies
+func labelNamespace(client kubernetes.Interface, namespace string) error {
+	ns, err := client.CoreV1().Namespaces().Get(namespace, meta.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if ns.Labels[LabelNamespace] == namespace {
+		return nil
+	}
+
+	if ns.Labels == nil {
+		ns.Labels = make(map[string]string)
+	}
+	ns.Labels[LabelNamespace] = namespace
+	_, err = client.CoreV1().Namespaces().Update(ns)
+	return err
+}
+
+// LabelPods adds component label to pod templates of all objects from the manifest, which create pods, if they are
+// selected by network policies (see plugin.ParamLabelPods). Otherwise manifest is returned as is. Jobs are skipped, as
+// their pod templates can't be changed. Documents without pods are kept untouched, including comments
+func LabelPods(manifest string, pluginParams map[string]string) (string, error) {
+	component := pluginParams[plugin.ParamComponent]
+	if pluginParams[plugin.ParamLabelPods] != "true" || len(component) <= 0 {
+		return manifest, nil
+	}
+
+	docs := strings.Split(manifest, "\n---")
+	for idx, doc := range docs {
+		labelled, err := labelPodsInDocument(doc, component)
+		if err != nil {
+			return "", err
+		}
+		docs[idx] = labelled
+	}
+
+	return strings.Join(docs, "\n---"), nil
+}
+
+// labelPodsInDocument adds component label to the pod template of the object from a single manifest document. Leading
+// lines of the document (rest of the separator, comments and empty lines) are preserved
+func labelPodsInDocument(doc string, component string) (string, error) {
+	header := ""
+	body := doc
+	for len(body) > 0 {
+		line := body
+		if pos := strings.Index(body, "\n"); pos >= 0 {
+			line = body[:pos+1]
+		}
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) > 0 && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "---") {
+			break
+		}
+		header += line
+		body = body[len(line):]
+	}
+
+	obj := make(map[string]interface{})
+	err := yaml.Unmarshal([]byte(body), &obj)
+	if err != nil {
+		return "", fmt.Errorf("error while parsing manifest to label pods: %s", err)
+	}
+
+	var path []string
+	switch obj["kind"] {
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController":
+		path = []string{"spec", "template", "metadata", "labels"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "metadata", "labels"}
+	case "Pod":
+		path = []string{"metadata", "labels"}
+	default:
+		return doc, nil
+	}
+
+	labels := obj
+	for _, key := range path {
+		next, ok := labels[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			labels[key] = next
+		}
+		labels = next
+	}
+	if labels[LabelComponent] == component {
+		return doc, nil
+	}
+	labels[LabelComponent] = component
+
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("error while labeling pods of %s: %s", obj["kind"], err)
+	}
+	if !strings.HasSuffix(body, "\n") {
+		data = []byte(strings.TrimSuffix(string(data), "\n"))
+	}
+
+	return header + string(data), nil
+}
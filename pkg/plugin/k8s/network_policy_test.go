@@ -0,0 +1,131 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestLabelPods(t *testing.T) {
+	manifest := `---
+# Source: chart/templates/service.yaml
+kind: Service
+metadata:
+  name: web # service comment
+---
+# Source: chart/templates/deployment.yaml
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: "nginx:1.13"
+---
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          restartPolicy: Never
+---
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+`
+	params := map[string]string{plugin.ParamComponent: "main-web", plugin.ParamLabelPods: "true"}
+
+	labelled, err := LabelPods(manifest, params)
+	if !assert.NoError(t, err, "Pods should be labelled") {
+		t.FailNow()
+	}
+	assert.Contains(t, labelled, "---\n# Source: chart/templates/service.yaml\nkind: Service\nmetadata:\n  name: web # service comment\n---\n", "Documents without pods should be kept untouched")
+	assert.Contains(t, labelled, "---\n# Source: chart/templates/deployment.yaml\nkind: Deployment\n", "Comments of labelled documents should be kept")
+	assert.Contains(t, labelled, "    metadata:\n      labels:\n        app: web\n        aptomi.io/component: main-web\n", "Pod template of deployment should be labelled")
+	assert.Contains(t, labelled, "  replicas: 2\n", "Numbers should be kept")
+	assert.Contains(t, labelled, "schedule: 0 * * * *\n", "Other fields of labelled documents should be kept")
+	assert.Contains(t, labelled, "        metadata:\n          labels:\n            aptomi.io/component: main-web\n", "Pod template of cron job should be labelled")
+	assert.Contains(t, labelled, "kind: Job\nmetadata:\n  name: migrate\nspec:\n  template:\n    spec:\n      restartPolicy: Never\n", "Jobs should be kept untouched")
+
+	again, err := LabelPods(labelled, params)
+	assert.NoError(t, err, "Labelled pods should be labelled again")
+	assert.Equal(t, labelled, again, "Labelled pods should not be changed")
+
+	unchanged, err := LabelPods(manifest, map[string]string{plugin.ParamComponent: "main-web"})
+	assert.NoError(t, err, "Pods should not be labelled if they aren't selected by network policies")
+	assert.Equal(t, manifest, unchanged, "Manifest should be kept untouched if pods aren't selected by network policies")
+
+	_, err = LabelPods("kind: Pod\nmetadata: [", params)
+	assert.Error(t, err, "Invalid manifest should be rejected")
+}
+
+func TestLabelPodsOnMove(t *testing.T) {
+	manifest := `kind: Deployment
+metadata:
+  name: db
+spec:
+  template:
+    metadata:
+      labels:
+        app: db
+    spec:
+      containers:
+      - name: db
+        image: "postgres:10"
+`
+	// component instance with rejected ingress traffic, which is moved when its context gets renamed
+	from := map[string]string{plugin.ParamComponent: "old-db", plugin.ParamLabelPods: "true", plugin.ParamAllowIngress: "false"}
+	to := map[string]string{plugin.ParamComponent: "new-db", plugin.ParamLabelPods: "true", plugin.ParamAllowIngress: "false"}
+
+	deployed, err := LabelPods(manifest, from)
+	if !assert.NoError(t, err, "Pods should be labelled") {
+		t.FailNow()
+	}
+	moved, err := LabelPods(deployed, to)
+	if !assert.NoError(t, err, "Pods should be relabelled") {
+		t.FailNow()
+	}
+
+	podLabels := func(manifest string) labels.Set {
+		object := struct {
+			Spec struct {
+				Template struct {
+					Metadata struct {
+						Labels map[string]string
+					}
+				}
+			}
+		}{}
+		if !assert.NoError(t, yaml.Unmarshal([]byte(manifest), &object), "Manifest should be parsed") {
+			t.FailNow()
+		}
+		return labels.Set(object.Spec.Template.Metadata.Labels)
+	}
+
+	policy := newIngressPolicy("default", "db", to[plugin.ParamComponent], "")
+	selector, err := meta.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+	if !assert.NoError(t, err, "Pod selector of network policy should be valid") {
+		t.FailNow()
+	}
+	assert.False(t, selector.Matches(podLabels(deployed)), "Network policy of moved component instance should not select pods with previous label")
+	assert.True(t, selector.Matches(podLabels(moved)), "Network policy of moved component instance should select relabelled pods")
+	assert.Equal(t, "db", podLabels(moved)["app"], "Other labels of pods should be kept")
+}
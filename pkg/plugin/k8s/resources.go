@@ -4,17 +4,72 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/plugin"
 	"k8s.io/api/apps/v1beta1"
+	"k8s.io/api/apps/v1beta2"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	batch "k8s.io/api/batch/v1"
+	batchbeta "k8s.io/api/batch/v1beta1"
 	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
 )
 
-var resourceRegistry = buildResourceRegistry()
+// ResourceLoader loads k8s object with specified namespace and name from the cluster, so it could be converted into
+// columns by the resource type handler
+type ResourceLoader func(client kubernetes.Interface, namespace, name string) (interface{}, error)
 
-// ResourcesForManifest returns resources for specified manifest
+var (
+	resourceRegistry, resourceLoaders = buildResourceRegistry()
+
+	// resourceLock guards resourceRegistry and resourceLoaders, as resource types could be registered while resources
+	// are being collected
+	resourceLock sync.RWMutex
+)
+
+// RegisterResourceType registers headers and handler for k8s objects of specified kind (e.g. "Certificate"), so they
+// are shown in resources of component instances. Objects are loaded by specified loader or, if it's nil, as
+// *unstructured.Unstructured. Handlers are kept in memory of Aptomi server, so it's only available to code compiled
+// into it (e.g. init() of a package imported by cmd/aptomi). External plugins run in their own processes and return
+// ready resource tables from Resources instead
+func RegisterResourceType(kind string, headers []string, loader ResourceLoader, handler plugin.ResourceTypeHandler) {
+	resourceLock.Lock()
+	defer resourceLock.Unlock()
+
+	resourceRegistry.AddHandler("k8s/"+kind, headers, handler)
+	if loader != nil {
+		resourceLoaders[kind] = loader
+	}
+}
+
+// resourceLoader returns loader for k8s objects of specified kind (nil if they should be loaded as unstructured) and
+// whether they are shown in resources at all
+func resourceLoader(kind string) (ResourceLoader, bool) {
+	resourceLock.RLock()
+	defer resourceLock.RUnlock()
+
+	return resourceLoaders[kind], resourceRegistry.IsSupported("k8s/" + kind)
+}
+
+// resourceColumns returns headers and columns for specified k8s object of specified kind
+func resourceColumns(kind string, obj interface{}) ([]string, []string) {
+	resourceLock.RLock()
+	defer resourceLock.RUnlock()
+
+	return resourceRegistry.Headers("k8s/" + kind), resourceRegistry.Handle("k8s/"+kind, obj)
+}
+
+// ResourcesForManifest returns resources for specified manifest. Objects of kinds without registered handler are
+// shown using generic table with their kind and age
 func (p *Plugin) ResourcesForManifest(namespace, deployName, targetManifest string, eventLog *event.Log) (plugin.Resources, error) {
 	kubeClient, err := p.NewClient()
 	if err != nil {
@@ -30,65 +85,103 @@ func (p *Plugin) ResourcesForManifest(namespace, deployName, targetManifest stri
 
 	resources := make(plugin.Resources)
 	for _, info := range infos {
-		gvk := info.ResourceMapping().GroupVersionKind
-		resourceType := "k8s/" + gvk.Kind
+		kind := info.Mapping.GroupVersionKind.Kind
+		resourceType := "k8s/" + kind
 
-		if !resourceRegistry.IsSupported(resourceType) {
+		loader, supported := resourceLoader(kind)
+		if !supported {
 			continue
 		}
 
-		table, exist := resources[resourceType]
-		if !exist {
-			table = &plugin.ResourceTable{}
-			resources[resourceType] = table
-			table.Headers = resourceRegistry.Headers(resourceType)
-		}
-
 		var getErr error
 		var obj interface{}
 
-		switch kind := info.Mapping.GroupVersionKind.Kind; kind {
-		case "Service": // nolint: goconst
-			obj, getErr = kubeClient.CoreV1().Services(namespace).Get(info.Name, meta.GetOptions{})
-		case "ConfigMap":
-			//obj, getErr = kubeClient.CoreV1().ConfigMaps(p.Namespace).Get(info.Name, meta.GetOptions{})
-		case "Secret":
-			//obj, getErr = kubeClient.CoreV1().Secrets(p.Namespace).Get(info.Name, meta.GetOptions{})
-		case "PersistentVolumeClaim":
-			//obj, getErr = kubeClient.CoreV1().PersistentVolumeClaims(p.Namespace).Get(info.Name, meta.GetOptions{})
-		case "Deployment":
-			obj, getErr = kubeClient.AppsV1beta1().Deployments(namespace).Get(info.Name, meta.GetOptions{})
-		case "StatefulSet":
-			obj, getErr = kubeClient.AppsV1beta1().StatefulSets(namespace).Get(info.Name, meta.GetOptions{})
-		case "Job":
-			//obj, getErr = kubeClient.BatchV1().Jobs(p.Namespace).Get(info.Name, meta.GetOptions{})
+		if loader != nil {
+			obj, getErr = loader(kubeClient, info.Namespace, info.Name)
+		} else {
+			getErr = info.Get()
+			obj = info.Object
 		}
 
+		// object hasn't been created yet
+		if errors.IsNotFound(getErr) {
+			continue
+		}
 		if getErr != nil {
 			return nil, getErr
 		}
 
-		// missing object or don't know how to load it
-		if obj == nil {
-			continue
+		headers, columns := resourceColumns(kind, obj)
+
+		table, exist := resources[resourceType]
+		if !exist {
+			table = &plugin.ResourceTable{}
+			resources[resourceType] = table
+			table.Headers = headers
 		}
 
-		table.Items = append(table.Items, resourceRegistry.Handle(resourceType, obj))
+		table.Items = append(table.Items, columns)
 	}
 
 	return resources, nil
 }
 
-func buildResourceRegistry() *plugin.ResourceRegistry {
+func buildResourceRegistry() (*plugin.ResourceRegistry, map[string]ResourceLoader) {
 	reg := plugin.NewResourceRegistry()
+	loaders := make(map[string]ResourceLoader)
 
-	// todo(slukjanov): support all other resources
-	// k8s/Service handling is temporarily disabled
-	reg.AddHandler("_k8s/Service", serviceResourceHeaders, serviceResourceHandler)
-	reg.AddHandler("k8s/Deployment", deploymentResourceHeaders, deploymentResourceHandler)
-	reg.AddHandler("k8s/StatefulSet", statefulSetResourceHeaders, statefulSetResourceHandler)
+	add := func(kind string, headers []string, loader ResourceLoader, handler plugin.ResourceTypeHandler) {
+		reg.AddHandler("k8s/"+kind, headers, handler)
+		loaders[kind] = loader
+	}
 
-	return reg
+	add("Service", serviceResourceHeaders, serviceResourceLoader, serviceResourceHandler)
+	add("Deployment", deploymentResourceHeaders, deploymentResourceLoader, deploymentResourceHandler)
+	add("StatefulSet", statefulSetResourceHeaders, statefulSetResourceLoader, statefulSetResourceHandler)
+	add("DaemonSet", daemonSetResourceHeaders, daemonSetResourceLoader, daemonSetResourceHandler)
+	add("Job", jobResourceHeaders, jobResourceLoader, jobResourceHandler)
+	add("CronJob", cronJobResourceHeaders, cronJobResourceLoader, cronJobResourceHandler)
+	add("Pod", podResourceHeaders, podResourceLoader, podResourceHandler)
+	add("ConfigMap", configMapResourceHeaders, configMapResourceLoader, configMapResourceHandler)
+	add("Secret", secretResourceHeaders, secretResourceLoader, secretResourceHandler)
+	add("PersistentVolumeClaim", pvcResourceHeaders, pvcResourceLoader, pvcResourceHandler)
+	add("Ingress", ingressResourceHeaders, ingressResourceLoader, ingressResourceHandler)
+	add("HorizontalPodAutoscaler", hpaResourceHeaders, hpaResourceLoader, hpaResourceHandler)
+
+	reg.SetDefaultHandler(genericResourceHeaders, genericResourceHandler)
+
+	return reg, loaders
+}
+
+// generic k8s objects
+
+var genericResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Kind",
+	"Age",
+}
+
+func genericResourceHandler(obj interface{}) []string {
+	runtimeObj, ok := obj.(runtime.Object)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes object: %+v", obj))
+	}
+	accessor, err := apimeta.Accessor(runtimeObj)
+	if err != nil {
+		panic(fmt.Sprintf("object is not a valid kubernetes object: %s", err))
+	}
+
+	kind := runtimeObj.GetObjectKind().GroupVersionKind().Kind
+
+	return []string{accessor.GetNamespace(), accessor.GetName(), kind, age(accessor.GetCreationTimestamp())}
+}
+
+func age(created meta.Time) string {
+	if created.IsZero() {
+		return "<unknown>"
+	}
+	return duration.ShortHumanDuration(time.Since(created.Time))
 }
 
 // k8s/Service
@@ -101,6 +194,10 @@ var serviceResourceHeaders = []string{
 	"Created",
 }
 
+func serviceResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.CoreV1().Services(namespace).Get(name, meta.GetOptions{})
+}
+
 func serviceResourceHandler(obj interface{}) []string {
 	service, ok := obj.(*v1.Service)
 	if !ok {
@@ -136,6 +233,10 @@ var deploymentResourceHeaders = []string{
 	"Created",
 }
 
+func deploymentResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.AppsV1beta1().Deployments(namespace).Get(name, meta.GetOptions{})
+}
+
 func deploymentResourceHandler(obj interface{}) []string {
 	deployment, ok := obj.(*v1beta1.Deployment)
 	if !ok {
@@ -163,6 +264,10 @@ var statefulSetResourceHeaders = []string{
 	"Current",
 }
 
+func statefulSetResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.AppsV1beta1().StatefulSets(namespace).Get(name, meta.GetOptions{})
+}
+
 func statefulSetResourceHandler(obj interface{}) []string {
 	statefulSet, ok := obj.(*v1beta1.StatefulSet)
 	if !ok {
@@ -175,3 +280,300 @@ func statefulSetResourceHandler(obj interface{}) []string {
 
 	return []string{statefulSet.Namespace, statefulSet.Name, ready, desiredReplicas, currentReplicas}
 }
+
+// k8s/DaemonSet
+
+var daemonSetResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Desired",
+	"Current",
+	"Ready",
+	"Up-to-date",
+	"Available",
+	"Created",
+}
+
+func daemonSetResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.AppsV1beta2().DaemonSets(namespace).Get(name, meta.GetOptions{})
+}
+
+func daemonSetResourceHandler(obj interface{}) []string {
+	daemonSet, ok := obj.(*v1beta2.DaemonSet)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes v1beta2.DaemonSet: %+v", obj))
+	}
+
+	status := daemonSet.Status
+	return []string{
+		daemonSet.Namespace,
+		daemonSet.Name,
+		fmt.Sprintf("%d", status.DesiredNumberScheduled),
+		fmt.Sprintf("%d", status.CurrentNumberScheduled),
+		fmt.Sprintf("%d", status.NumberReady),
+		fmt.Sprintf("%d", status.UpdatedNumberScheduled),
+		fmt.Sprintf("%d", status.NumberAvailable),
+		daemonSet.CreationTimestamp.String(),
+	}
+}
+
+// k8s/Job
+
+var jobResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Desired",
+	"Successful",
+	"Failed",
+	"Created",
+}
+
+func jobResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.BatchV1().Jobs(namespace).Get(name, meta.GetOptions{})
+}
+
+func jobResourceHandler(obj interface{}) []string {
+	job, ok := obj.(*batch.Job)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes batch/v1.Job: %+v", obj))
+	}
+
+	desired := "<none>"
+	if job.Spec.Completions != nil {
+		desired = fmt.Sprintf("%d", *job.Spec.Completions)
+	}
+
+	return []string{job.Namespace, job.Name, desired, fmt.Sprintf("%d", job.Status.Succeeded), fmt.Sprintf("%d", job.Status.Failed), job.CreationTimestamp.String()}
+}
+
+// k8s/CronJob
+
+var cronJobResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Schedule",
+	"Suspend",
+	"Active",
+	"Last Schedule",
+	"Created",
+}
+
+func cronJobResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.BatchV1beta1().CronJobs(namespace).Get(name, meta.GetOptions{})
+}
+
+func cronJobResourceHandler(obj interface{}) []string {
+	cronJob, ok := obj.(*batchbeta.CronJob)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes batch/v1beta1.CronJob: %+v", obj))
+	}
+
+	suspend := cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend
+	lastSchedule := "<none>"
+	if cronJob.Status.LastScheduleTime != nil {
+		lastSchedule = age(*cronJob.Status.LastScheduleTime)
+	}
+
+	return []string{cronJob.Namespace, cronJob.Name, cronJob.Spec.Schedule, strconv.FormatBool(suspend), fmt.Sprintf("%d", len(cronJob.Status.Active)), lastSchedule, cronJob.CreationTimestamp.String()}
+}
+
+// k8s/Pod
+
+var podResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Ready",
+	"Status",
+	"Restarts",
+	"Created",
+}
+
+func podResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.CoreV1().Pods(namespace).Get(name, meta.GetOptions{})
+}
+
+func podResourceHandler(obj interface{}) []string {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes v1.Pod: %+v", obj))
+	}
+
+	ready := 0
+	restarts := int32(0)
+	for _, container := range pod.Status.ContainerStatuses {
+		if container.Ready {
+			ready++
+		}
+		restarts += container.RestartCount
+	}
+
+	return []string{pod.Namespace, pod.Name, fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers)), string(pod.Status.Phase), fmt.Sprintf("%d", restarts), pod.CreationTimestamp.String()}
+}
+
+// k8s/ConfigMap
+
+var configMapResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Data",
+	"Created",
+}
+
+func configMapResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.CoreV1().ConfigMaps(namespace).Get(name, meta.GetOptions{})
+}
+
+func configMapResourceHandler(obj interface{}) []string {
+	configMap, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes v1.ConfigMap: %+v", obj))
+	}
+
+	return []string{configMap.Namespace, configMap.Name, fmt.Sprintf("%d", len(configMap.Data)+len(configMap.BinaryData)), configMap.CreationTimestamp.String()}
+}
+
+// k8s/Secret
+
+var secretResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Type",
+	"Created",
+}
+
+func secretResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.CoreV1().Secrets(namespace).Get(name, meta.GetOptions{})
+}
+
+// secretResourceHandler only shows names of secrets, neither their data nor the keys are exposed
+func secretResourceHandler(obj interface{}) []string {
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes v1.Secret: %+v", obj))
+	}
+
+	return []string{secret.Namespace, secret.Name, string(secret.Type), secret.CreationTimestamp.String()}
+}
+
+// k8s/PersistentVolumeClaim
+
+var pvcResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Status",
+	"Volume",
+	"Capacity",
+	"Access Modes",
+	"Storage Class",
+	"Created",
+}
+
+func pvcResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.CoreV1().PersistentVolumeClaims(namespace).Get(name, meta.GetOptions{})
+}
+
+func pvcResourceHandler(obj interface{}) []string {
+	pvc, ok := obj.(*v1.PersistentVolumeClaim)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes v1.PersistentVolumeClaim: %+v", obj))
+	}
+
+	capacity := ""
+	if storage, found := pvc.Status.Capacity[v1.ResourceStorage]; found {
+		capacity = storage.String()
+	}
+
+	modes := make([]string, len(pvc.Status.AccessModes))
+	for idx, mode := range pvc.Status.AccessModes {
+		modes[idx] = string(mode)
+	}
+
+	storageClass := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClass = *pvc.Spec.StorageClassName
+	}
+
+	return []string{pvc.Namespace, pvc.Name, string(pvc.Status.Phase), pvc.Spec.VolumeName, capacity, strings.Join(modes, ","), storageClass, pvc.CreationTimestamp.String()}
+}
+
+// k8s/Ingress
+
+var ingressResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Hosts",
+	"Address",
+	"TLS",
+	"Created",
+}
+
+func ingressResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.ExtensionsV1beta1().Ingresses(namespace).Get(name, meta.GetOptions{})
+}
+
+func ingressResourceHandler(obj interface{}) []string {
+	ingress, ok := obj.(*extensions.Ingress)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes extensions/v1beta1.Ingress: %+v", obj))
+	}
+
+	hosts := []string{}
+	for _, rule := range ingress.Spec.Rules {
+		if len(rule.Host) > 0 {
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	if len(hosts) == 0 {
+		hosts = append(hosts, "*")
+	}
+
+	return []string{ingress.Namespace, ingress.Name, strings.Join(hosts, ","), loadBalancerAddress(ingress.Status.LoadBalancer.Ingress), strconv.FormatBool(len(ingress.Spec.TLS) > 0), ingress.CreationTimestamp.String()}
+}
+
+// k8s/HorizontalPodAutoscaler
+
+var hpaResourceHeaders = []string{
+	"Namespace",
+	"Name",
+	"Reference",
+	"Targets",
+	"Min",
+	"Max",
+	"Replicas",
+	"Created",
+}
+
+func hpaResourceLoader(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+	return client.AutoscalingV1().HorizontalPodAutoscalers(namespace).Get(name, meta.GetOptions{})
+}
+
+func hpaResourceHandler(obj interface{}) []string {
+	hpa, ok := obj.(*autoscaling.HorizontalPodAutoscaler)
+	if !ok {
+		panic(fmt.Sprintf("object is not a valid kubernetes autoscaling/v1.HorizontalPodAutoscaler: %+v", obj))
+	}
+
+	current := "<unknown>"
+	if hpa.Status.CurrentCPUUtilizationPercentage != nil {
+		current = fmt.Sprintf("%d%%", *hpa.Status.CurrentCPUUtilizationPercentage)
+	}
+	target := "<none>"
+	if hpa.Spec.TargetCPUUtilizationPercentage != nil {
+		target = fmt.Sprintf("%d%%", *hpa.Spec.TargetCPUUtilizationPercentage)
+	}
+	minReplicas := "1"
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = fmt.Sprintf("%d", *hpa.Spec.MinReplicas)
+	}
+
+	return []string{
+		hpa.Namespace,
+		hpa.Name,
+		hpa.Spec.ScaleTargetRef.Kind + "/" + hpa.Spec.ScaleTargetRef.Name,
+		current + "/" + target,
+		minReplicas,
+		fmt.Sprintf("%d", hpa.Spec.MaxReplicas),
+		fmt.Sprintf("%d", hpa.Status.CurrentReplicas),
+		hpa.CreationTimestamp.String(),
+	}
+}
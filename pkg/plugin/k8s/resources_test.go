@@ -0,0 +1,201 @@
+package k8s
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/apps/v1beta2"
+	autoscaling "k8s.io/api/autoscaling/v1"
+	batch "k8s.io/api/batch/v1"
+	batchbeta "k8s.io/api/batch/v1beta1"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestResourceHandlers(t *testing.T) {
+	created := meta.NewTime(time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC))
+	objectMeta := meta.ObjectMeta{Namespace: "main", Name: "web", CreationTimestamp: created}
+	int32Ptr := func(value int32) *int32 { return &value }
+	boolPtr := func(value bool) *bool { return &value }
+	stringPtr := func(value string) *string { return &value }
+
+	tests := []struct {
+		kind     string
+		obj      interface{}
+		expected []string
+	}{
+		{
+			kind: "DaemonSet",
+			obj: &v1beta2.DaemonSet{
+				ObjectMeta: objectMeta,
+				Status:     v1beta2.DaemonSetStatus{DesiredNumberScheduled: 3, CurrentNumberScheduled: 3, NumberReady: 2, UpdatedNumberScheduled: 1, NumberAvailable: 2},
+			},
+			expected: []string{"main", "web", "3", "3", "2", "1", "2", created.String()},
+		},
+		{
+			kind: "Job",
+			obj: &batch.Job{
+				ObjectMeta: objectMeta,
+				Spec:       batch.JobSpec{Completions: int32Ptr(5)},
+				Status:     batch.JobStatus{Succeeded: 3, Failed: 1},
+			},
+			expected: []string{"main", "web", "5", "3", "1", created.String()},
+		},
+		{
+			kind:     "Job",
+			obj:      &batch.Job{ObjectMeta: objectMeta},
+			expected: []string{"main", "web", "<none>", "0", "0", created.String()},
+		},
+		{
+			kind: "CronJob",
+			obj: &batchbeta.CronJob{
+				ObjectMeta: objectMeta,
+				Spec:       batchbeta.CronJobSpec{Schedule: "*/5 * * * *", Suspend: boolPtr(true)},
+				Status:     batchbeta.CronJobStatus{Active: []v1.ObjectReference{{Name: "web-1"}, {Name: "web-2"}}},
+			},
+			expected: []string{"main", "web", "*/5 * * * *", "true", "2", "<none>", created.String()},
+		},
+		{
+			kind: "Pod",
+			obj: &v1.Pod{
+				ObjectMeta: objectMeta,
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "web"}, {Name: "sidecar"}}},
+				Status: v1.PodStatus{
+					Phase: v1.PodRunning,
+					ContainerStatuses: []v1.ContainerStatus{
+						{Name: "web", Ready: true, RestartCount: 2},
+						{Name: "sidecar", RestartCount: 1},
+					},
+				},
+			},
+			expected: []string{"main", "web", "1/2", "Running", "3", created.String()},
+		},
+		{
+			kind: "ConfigMap",
+			obj: &v1.ConfigMap{
+				ObjectMeta: objectMeta,
+				Data:       map[string]string{"a": "1", "b": "2"},
+				BinaryData: map[string][]byte{"c": []byte("3")},
+			},
+			expected: []string{"main", "web", "3", created.String()},
+		},
+		{
+			kind: "Secret",
+			obj: &v1.Secret{
+				ObjectMeta: objectMeta,
+				Type:       v1.SecretTypeOpaque,
+				Data:       map[string][]byte{"password": []byte("secret")},
+			},
+			expected: []string{"main", "web", "Opaque", created.String()},
+		},
+		{
+			kind: "PersistentVolumeClaim",
+			obj: &v1.PersistentVolumeClaim{
+				ObjectMeta: objectMeta,
+				Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pv-1", StorageClassName: stringPtr("standard")},
+				Status: v1.PersistentVolumeClaimStatus{
+					Phase:       v1.ClaimBound,
+					Capacity:    v1.ResourceList{v1.ResourceStorage: resource.MustParse("10Gi")},
+					AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce, v1.ReadOnlyMany},
+				},
+			},
+			expected: []string{"main", "web", "Bound", "pv-1", "10Gi", "ReadWriteOnce,ReadOnlyMany", "standard", created.String()},
+		},
+		{
+			kind: "Ingress",
+			obj: &extensions.Ingress{
+				ObjectMeta: objectMeta,
+				Spec: extensions.IngressSpec{
+					Rules: []extensions.IngressRule{{Host: "a.example.com"}, {}, {Host: "b.example.com"}},
+					TLS:   []extensions.IngressTLS{{SecretName: "web-tls"}},
+				},
+				Status: extensions.IngressStatus{LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "1.2.3.4"}}}},
+			},
+			expected: []string{"main", "web", "a.example.com,b.example.com", "1.2.3.4", "true", created.String()},
+		},
+		{
+			kind:     "Ingress",
+			obj:      &extensions.Ingress{ObjectMeta: objectMeta},
+			expected: []string{"main", "web", "*", "", "false", created.String()},
+		},
+		{
+			kind: "HorizontalPodAutoscaler",
+			obj: &autoscaling.HorizontalPodAutoscaler{
+				ObjectMeta: objectMeta,
+				Spec: autoscaling.HorizontalPodAutoscalerSpec{
+					ScaleTargetRef:                 autoscaling.CrossVersionObjectReference{Kind: "Deployment", Name: "web"},
+					MaxReplicas:                    5,
+					TargetCPUUtilizationPercentage: int32Ptr(80),
+				},
+				Status: autoscaling.HorizontalPodAutoscalerStatus{CurrentReplicas: 2, CurrentCPUUtilizationPercentage: int32Ptr(45)},
+			},
+			expected: []string{"main", "web", "Deployment/web", "45%/80%", "1", "5", "2", created.String()},
+		},
+	}
+
+	for _, test := range tests {
+		loader, supported := resourceLoader(test.kind)
+		if !assert.True(t, supported, "Resource type %s should be supported", test.kind) {
+			t.FailNow()
+		}
+		assert.NotNil(t, loader, "Resource type %s should have loader", test.kind)
+
+		headers, columns := resourceColumns(test.kind, test.obj)
+		assert.Equal(t, len(headers), len(columns), "Resource type %s should have a column for every header", test.kind)
+		assert.Equal(t, test.expected, columns, "Resource type %s should be converted into columns", test.kind)
+	}
+}
+
+func TestGenericResourceHandler(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("certmanager.k8s.io/v1alpha1")
+	obj.SetKind("Certificate")
+	obj.SetNamespace("main")
+	obj.SetName("web-tls")
+
+	loader, supported := resourceLoader("Certificate")
+	if !assert.True(t, supported, "Unknown resource type should be supported by generic handler") {
+		t.FailNow()
+	}
+	assert.Nil(t, loader, "Unknown resource type should be loaded as unstructured")
+
+	headers, columns := resourceColumns("Certificate", obj)
+	assert.Equal(t, genericResourceHeaders, headers, "Generic headers should be used for unknown resource type")
+	assert.Equal(t, []string{"main", "web-tls", "Certificate", "<unknown>"}, columns, "Unknown resource type should be converted into generic columns")
+}
+
+func TestRegisterResourceType(t *testing.T) {
+	loader := func(client kubernetes.Interface, namespace, name string) (interface{}, error) {
+		return name, nil
+	}
+	handler := func(obj interface{}) []string {
+		return []string{obj.(string)}
+	}
+
+	// resource types could be registered while resources of other types are being collected
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			resourceLoader("Pod")
+			resourceColumns("Pod", &v1.Pod{})
+		}
+	}()
+	RegisterResourceType("TestIssuer", []string{"Name"}, loader, handler)
+	wg.Wait()
+
+	registered, supported := resourceLoader("TestIssuer")
+	if !assert.True(t, supported, "Registered resource type should be supported") || !assert.NotNil(t, registered, "Registered loader should be used") {
+		t.FailNow()
+	}
+	headers, columns := resourceColumns("TestIssuer", "issuer")
+	assert.Equal(t, []string{"Name"}, headers, "Registered headers should be used")
+	assert.Equal(t, []string{"issuer"}, columns, "Registered handler should be used")
+}
@@ -9,6 +9,7 @@ import (
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/helm/pkg/kube"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
 )
 
 // NewClient returns new instance of the Kubernetes client created from the cached in the plugin cluster config
@@ -21,6 +22,16 @@ func (p *Plugin) NewClient() (kubernetes.Interface, error) {
 	return client, nil
 }
 
+// NewInternalClient returns new instance of the internal Kubernetes client, which is used by Helm release storage
+func (p *Plugin) NewInternalClient() (internalclientset.Interface, error) {
+	client, err := internalclientset.NewForConfig(p.RestConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating internal kubernetes client: %s", err)
+	}
+
+	return client, nil
+}
+
 // NewHelmKube returns new instance of the Helm Kube client
 func (p *Plugin) NewHelmKube(deployName string, eventLog *event.Log) *kube.Client {
 	client := kube.New(p.ClientConfig)
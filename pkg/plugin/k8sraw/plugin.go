@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/plugin/k8s"
@@ -18,19 +19,32 @@ type Plugin struct {
 	config        config.K8sRaw
 	kube          *k8s.Plugin
 	dataNamespace string
+	dataPrefix    string
 }
 
 // New returns new instance of the Kubernetes Raw code (objects) plugin for specified Kubernetes cluster plugin and plugins config
 func New(clusterPlugin plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+	rawPlugin, err := NewWithDataPrefix(clusterPlugin, cfg, "raw")
+	if err != nil {
+		return nil, err
+	}
+	return rawPlugin, nil
+}
+
+// NewWithDataPrefix returns new instance of the Kubernetes Raw code plugin, which keeps manifests of its deployments in
+// the data namespace under the given prefix. It allows other code plugins to deploy manifests they generate using
+// the raw plugin, while keeping their deployments apart from the raw ones
+func NewWithDataPrefix(clusterPlugin plugin.ClusterPlugin, cfg config.Plugins, dataPrefix string) (*Plugin, error) {
 	kubePlugin, ok := clusterPlugin.(*k8s.Plugin)
 	if !ok {
 		return nil, fmt.Errorf("k8s cluster plugin expected for k8sraw code plugin creation but received: %T", clusterPlugin)
 	}
 
 	return &Plugin{
-		cluster: kubePlugin.Cluster,
-		config:  cfg.K8sRaw,
-		kube:    kubePlugin,
+		cluster:    kubePlugin.Cluster,
+		config:     cfg.K8sRaw,
+		kube:       kubePlugin,
+		dataPrefix: dataPrefix,
 	}, nil
 }
 
@@ -82,6 +96,11 @@ func (p *Plugin) Create(invocation *plugin.CodePluginInvocationParams) error {
 		return fmt.Errorf("manifest is a mandatory parameter")
 	}
 
+	targetManifest, err = k8s.LabelPods(targetManifest, invocation.PluginParams)
+	if err != nil {
+		return err
+	}
+
 	client := p.kube.NewHelmKube(invocation.DeployName, invocation.EventLog)
 
 	err = client.Create(namespace, strings.NewReader(targetManifest), 42, false)
@@ -89,7 +108,12 @@ func (p *Plugin) Create(invocation *plugin.CodePluginInvocationParams) error {
 		return err
 	}
 
-	return p.storeManifest(kubeClient, invocation.DeployName, targetManifest)
+	err = p.storeManifest(kubeClient, invocation.DeployName, namespace, targetManifest)
+	if err != nil {
+		return err
+	}
+
+	return p.kube.EnsureIngressPolicy(namespace, invocation.DeployName, invocation.PluginParams, invocation.EventLog)
 }
 
 // Update implements update of an existing component instance in the cloud by updating raw k8s objects
@@ -109,14 +133,24 @@ func (p *Plugin) Update(invocation *plugin.CodePluginInvocationParams) error {
 		return fmt.Errorf("namespace is a mandatory parameter")
 	}
 
-	currentManifest, err := p.loadManifest(kubeClient, invocation.DeployName)
+	targetManifest, ok := invocation.Params["manifest"].(string)
+	if !ok {
+		return fmt.Errorf("manifest is a mandatory parameter")
+	}
+
+	targetManifest, err = k8s.LabelPods(targetManifest, invocation.PluginParams)
 	if err != nil {
 		return err
 	}
 
-	targetManifest, ok := invocation.Params["manifest"].(string)
-	if !ok {
-		return fmt.Errorf("manifest is a mandatory parameter")
+	currentManifest, found, err := p.loadManifestIfExists(kubeClient, invocation.DeployName)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// objects have been deployed outside of Aptomi and adopted, so there is no stored manifest yet. all of them
+		// are in the target manifest, so none of them will be deleted
+		currentManifest = targetManifest
 	}
 
 	client := p.kube.NewHelmKube(invocation.DeployName, invocation.EventLog)
@@ -126,7 +160,121 @@ func (p *Plugin) Update(invocation *plugin.CodePluginInvocationParams) error {
 		return err
 	}
 
-	return p.storeManifest(kubeClient, invocation.DeployName, targetManifest)
+	err = p.storeManifest(kubeClient, invocation.DeployName, namespace, targetManifest)
+	if err != nil {
+		return err
+	}
+
+	return p.kube.EnsureIngressPolicy(namespace, invocation.DeployName, invocation.PluginParams, invocation.EventLog)
+}
+
+// Move adopts raw k8s objects deployed under the previous deploy name by re-storing their manifest under the new deploy
+// name. Objects keep their names, so they can only be moved within the same namespace. Pods get relabelled with the
+// component name of the new component instance, so they are selected by its network policy
+func (p *Plugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	err := p.init()
+	if err != nil {
+		return err
+	}
+
+	kubeClient, err := p.kube.NewClient()
+	if err != nil {
+		return err
+	}
+
+	namespace := to.PluginParams[plugin.ParamTargetSuffix]
+	if len(namespace) <= 0 {
+		return fmt.Errorf("namespace is a mandatory parameter")
+	}
+
+	if prevNamespace := from.PluginParams[plugin.ParamTargetSuffix]; prevNamespace != namespace {
+		return fmt.Errorf("k8s objects can't be moved from namespace '%s' to '%s'", prevNamespace, namespace)
+	}
+
+	currentManifest, err := p.loadManifest(kubeClient, from.DeployName)
+	if err != nil {
+		return err
+	}
+
+	to.EventLog.NewEntry().Infof("Moving k8s objects from '%s' to '%s'", from.DeployName, to.DeployName)
+
+	// component label of pods changes together with the key, otherwise network policies would not select them
+	targetManifest, err := k8s.LabelPods(currentManifest, to.PluginParams)
+	if err != nil {
+		return err
+	}
+	if targetManifest != currentManifest {
+		client := p.kube.NewHelmKube(to.DeployName, to.EventLog)
+		err = client.Update(namespace, strings.NewReader(currentManifest), strings.NewReader(targetManifest), false, false, 42, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.storeManifest(kubeClient, to.DeployName, namespace, targetManifest)
+	if err != nil {
+		return err
+	}
+
+	err = p.deleteManifest(kubeClient, from.DeployName)
+	if err != nil {
+		return err
+	}
+
+	// network policy is named after the deploy name, so it gets re-created under the new one
+	err = p.kube.DeleteIngressPolicy(namespace, from.DeployName)
+	if err != nil {
+		return err
+	}
+
+	return p.kube.EnsureIngressPolicy(namespace, to.DeployName, to.PluginParams, to.EventLog)
+}
+
+// Exists returns true if k8s objects have been deployed by Aptomi under the given deploy name, or if all objects from
+// the manifest already exist in the cluster (e.g. they have been created manually)
+func (p *Plugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	err := p.init()
+	if err != nil {
+		return false, err
+	}
+
+	kubeClient, err := p.kube.NewClient()
+	if err != nil {
+		return false, err
+	}
+
+	namespace := invocation.PluginParams[plugin.ParamTargetSuffix]
+	if len(namespace) <= 0 {
+		return false, fmt.Errorf("namespace is a mandatory parameter")
+	}
+
+	_, found, err := p.loadManifestIfExists(kubeClient, invocation.DeployName)
+	if err != nil || found {
+		return found, err
+	}
+
+	targetManifest, ok := invocation.Params["manifest"].(string)
+	if !ok {
+		return false, fmt.Errorf("manifest is a mandatory parameter")
+	}
+
+	return p.kube.ExistsForManifest(namespace, invocation.DeployName, targetManifest, invocation.EventLog)
+}
+
+// Deployments returns all deployments of raw k8s objects, which have been created by Aptomi in the cluster. They are
+// identified by the manifests stored in the data namespace
+func (p *Plugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	err := p.init()
+	if err != nil {
+		return nil, err
+	}
+
+	kubeClient, err := p.kube.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.listManifests(kubeClient)
 }
 
 // Destroy implements destruction of an existing component instance in the cloud by deleting raw k8s objects
@@ -158,6 +306,11 @@ func (p *Plugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
 		return err
 	}
 
+	err = p.kube.DeleteIngressPolicy(namespace, invocation.DeployName)
+	if err != nil {
+		return err
+	}
+
 	return p.deleteManifest(kubeClient, invocation.DeployName)
 }
 
@@ -220,3 +373,47 @@ func (p *Plugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, er
 
 	return p.kube.ReadinessStatusForManifest(namespace, invocation.DeployName, targetManifest, invocation.EventLog)
 }
+
+// Drift compares manifest stored in the cluster with the specified one, as well as objects from the stored manifest
+// with the live objects in the cluster (e.g. to catch "kubectl edit")
+func (p *Plugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	err := p.init()
+	if err != nil {
+		return "", err
+	}
+
+	kubeClient, err := p.kube.NewClient()
+	if err != nil {
+		return "", err
+	}
+
+	namespace := invocation.PluginParams[plugin.ParamTargetSuffix]
+	if len(namespace) <= 0 {
+		return "", fmt.Errorf("namespace is a mandatory parameter")
+	}
+
+	targetManifest, ok := invocation.Params["manifest"].(string)
+	if !ok {
+		return "", fmt.Errorf("manifest is a mandatory parameter")
+	}
+
+	currentManifest, err := p.loadManifest(kubeClient, invocation.DeployName)
+	if err != nil {
+		return "", err
+	}
+
+	diffs := []string{}
+	if currentManifest != targetManifest {
+		diffs = append(diffs, "stored manifest doesn't match the expected one")
+	}
+
+	objectsDiff, err := p.kube.DriftForManifest(namespace, invocation.DeployName, currentManifest, invocation.EventLog)
+	if err != nil {
+		return "", err
+	}
+	if len(objectsDiff) > 0 {
+		diffs = append(diffs, objectsDiff)
+	}
+
+	return strings.Join(diffs, "\n"), nil
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"gopkg.in/yaml.v2"
 	api "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -15,10 +18,10 @@ var (
 )
 
 func (p *Plugin) getManifestConfigMapName(deployName string) string {
-	return strings.ToLower(configMapNameReplacer.Replace(fmt.Sprintf("aptomi-raw-%s-%s", p.cluster.Name, deployName)))
+	return strings.ToLower(configMapNameReplacer.Replace(fmt.Sprintf("aptomi-%s-%s-%s", p.dataPrefix, p.cluster.Name, deployName)))
 }
 
-func (p *Plugin) storeManifest(client kubernetes.Interface, deployName, manifest string) error {
+func (p *Plugin) storeManifest(client kubernetes.Interface, deployName, namespace, manifest string) error {
 	name := p.getManifestConfigMapName(deployName)
 
 	cm, err := client.CoreV1().ConfigMaps(p.dataNamespace).Get(name, meta.GetOptions{})
@@ -29,7 +32,8 @@ func (p *Plugin) storeManifest(client kubernetes.Interface, deployName, manifest
 					Name: name,
 				},
 				Data: map[string]string{
-					"manifest": manifest,
+					"manifest":  manifest,
+					"namespace": namespace,
 				},
 			}
 
@@ -40,7 +44,8 @@ func (p *Plugin) storeManifest(client kubernetes.Interface, deployName, manifest
 	}
 
 	cm.Data = map[string]string{
-		"manifest": manifest,
+		"manifest":  manifest,
+		"namespace": namespace,
 	}
 
 	_, err = client.CoreV1().ConfigMaps(p.dataNamespace).Update(cm)
@@ -49,22 +54,52 @@ func (p *Plugin) storeManifest(client kubernetes.Interface, deployName, manifest
 }
 
 func (p *Plugin) loadManifest(client kubernetes.Interface, deployName string) (string, error) {
+	manifest, found, err := p.loadManifestIfExists(client, deployName)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("can't find data for deployment %s (should be stored in namespace %s)", deployName, p.dataNamespace)
+	}
+
+	return manifest, nil
+}
+
+// StoredManifest returns the manifest, which has been stored when k8s objects were deployed under the given deploy
+// name, and false if there is no stored manifest for it. Plugins, which render manifests from other params (e.g.
+// kustomize), use it to operate on what has actually been deployed rather than on what would be rendered now
+func (p *Plugin) StoredManifest(deployName string) (string, bool, error) {
+	err := p.init()
+	if err != nil {
+		return "", false, err
+	}
+
+	kubeClient, err := p.kube.NewClient()
+	if err != nil {
+		return "", false, err
+	}
+
+	return p.loadManifestIfExists(kubeClient, deployName)
+}
+
+// loadManifestIfExists works like loadManifest, but doesn't treat missing data for deployment as an error
+func (p *Plugin) loadManifestIfExists(client kubernetes.Interface, deployName string) (string, bool, error) {
 	name := p.getManifestConfigMapName(deployName)
 
 	cm, err := client.CoreV1().ConfigMaps(p.dataNamespace).Get(name, meta.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return "", fmt.Errorf("can't find data for deployment %s (should be stored in namespace %s): %s", deployName, p.dataNamespace, err)
+			return "", false, nil
 		}
-		return "", err
+		return "", false, err
 	}
 
 	manifest := cm.Data["manifest"]
 	if len(manifest) == 0 {
-		return "", fmt.Errorf("no manifest found in data for deployment %s (stored in configmap %s/%s", deployName, p.dataNamespace, name)
+		return "", false, fmt.Errorf("no manifest found in data for deployment %s (stored in configmap %s/%s", deployName, p.dataNamespace, name)
 	}
 
-	return manifest, nil
+	return manifest, true, nil
 }
 
 func (p *Plugin) deleteManifest(client kubernetes.Interface, deployName string) error {
@@ -77,3 +112,64 @@ func (p *Plugin) deleteManifest(client kubernetes.Interface, deployName string)
 
 	return err
 }
+
+// listManifests returns all deployments, for which manifests have been stored for the current cluster. Namespace is
+// only recorded for manifests stored after it has been added to the stored data, for the older ones it's taken from
+// the objects of the manifest. If it can't be determined, deployment is reported with an error instead of falling back
+// to the namespace of the config map, as destroying objects in the wrong namespace is worse than not destroying them
+func (p *Plugin) listManifests(client kubernetes.Interface) ([]*plugin.Deployment, error) {
+	prefix := p.getManifestConfigMapName("")
+
+	cms, err := client.CoreV1().ConfigMaps(p.dataNamespace).List(meta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*plugin.Deployment{}
+	for _, cm := range cms.Items {
+		if !strings.HasPrefix(cm.Name, prefix) || len(cm.Data["manifest"]) <= 0 {
+			continue
+		}
+		deployment := &plugin.Deployment{
+			DeployName:   strings.TrimPrefix(cm.Name, prefix),
+			TargetSuffix: cm.Data["namespace"],
+			Params:       util.NestedParameterMap{"manifest": cm.Data["manifest"]},
+		}
+		if len(deployment.TargetSuffix) <= 0 {
+			deployment.TargetSuffix = manifestNamespace(cm.Data["manifest"])
+		}
+		if len(deployment.TargetSuffix) <= 0 {
+			deployment.Error = fmt.Sprintf("namespace of deployment %s is unknown (stored in configmap %s/%s)", deployment.DeployName, p.dataNamespace, cm.Name)
+		}
+		result = append(result, deployment)
+	}
+
+	return result, nil
+}
+
+// manifestNamespace returns the namespace, which all objects of the manifest explicitly belong to. Empty string is
+// returned if any object doesn't have a namespace or objects belong to different namespaces
+func manifestNamespace(manifest string) string {
+	namespace := ""
+	for _, doc := range strings.Split(manifest, "\n---") {
+		doc = strings.TrimSpace(strings.TrimPrefix(doc, "---"))
+		if len(doc) <= 0 {
+			continue
+		}
+
+		obj := struct {
+			Metadata struct {
+				Namespace string
+			}
+		}{}
+		err := yaml.Unmarshal([]byte(doc), &obj)
+		if err != nil || len(obj.Metadata.Namespace) <= 0 {
+			return ""
+		}
+		if len(namespace) > 0 && namespace != obj.Metadata.Namespace {
+			return ""
+		}
+		namespace = obj.Metadata.Namespace
+	}
+	return namespace
+}
@@ -0,0 +1,4 @@
+// Package kustomize implements support for Kustomize code plugin, which renders k8s objects from a base directory or
+// a set of manifests with kustomize-style overlays (patches, name prefixes, common labels, images) specified in code
+// params, and deploys them into Kubernetes cluster the same way Kubernetes Raw code plugin does.
+package kustomize
@@ -0,0 +1,160 @@
+package kustomize
+
+import (
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/k8sraw"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// Plugin represents Kustomize code plugin, which renders k8s objects from manifests and overlays specified in code
+// params and deploys them the same way Kubernetes Raw code plugin does
+type Plugin struct {
+	raw      *k8sraw.Plugin
+	basesDir string
+}
+
+var _ plugin.CodePlugin = &Plugin{}
+
+// New returns new instance of the Kustomize code plugin for specified Kubernetes cluster plugin and plugins config
+func New(clusterPlugin plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+	rawPlugin, err := k8sraw.NewWithDataPrefix(clusterPlugin, cfg, "kustomize")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Plugin{
+		raw:      rawPlugin,
+		basesDir: cfg.Kustomize.BasesDir,
+	}, nil
+}
+
+// rendered returns invocation params for the raw plugin with the manifest rendered from code params
+func (p *Plugin) rendered(invocation *plugin.CodePluginInvocationParams) (*plugin.CodePluginInvocationParams, error) {
+	manifest, err := Render(invocation.Params, p.basesDir)
+	if err != nil {
+		return nil, err
+	}
+	return withManifest(invocation, manifest), nil
+}
+
+// deployed returns invocation params for the raw plugin with the manifest, which has been stored when k8s objects
+// were deployed, so base dir changed since then doesn't affect the deployment. Manifest is only rendered from code
+// params if nothing has been stored for the deployment yet (e.g. create has failed before objects were stored)
+func (p *Plugin) deployed(invocation *plugin.CodePluginInvocationParams) (*plugin.CodePluginInvocationParams, error) {
+	manifest, found, err := p.raw.StoredManifest(invocation.DeployName)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return p.rendered(invocation)
+	}
+	return withManifest(invocation, manifest), nil
+}
+
+// withManifest returns invocation params for the raw plugin with the given manifest
+func withManifest(invocation *plugin.CodePluginInvocationParams, manifest string) *plugin.CodePluginInvocationParams {
+	return &plugin.CodePluginInvocationParams{
+		DeployName:   invocation.DeployName,
+		Params:       util.NestedParameterMap{"manifest": manifest},
+		PluginParams: invocation.PluginParams,
+		EventLog:     invocation.EventLog,
+		Cancel:       invocation.Cancel,
+	}
+}
+
+// Cleanup implements cleanup phase for the Kustomize plugin
+func (p *Plugin) Cleanup() error {
+	return p.raw.Cleanup()
+}
+
+// Create renders manifest and creates k8s objects from it
+func (p *Plugin) Create(invocation *plugin.CodePluginInvocationParams) error {
+	rawInvocation, err := p.rendered(invocation)
+	if err != nil {
+		return err
+	}
+	return p.raw.Create(rawInvocation)
+}
+
+// Update renders manifest and updates k8s objects, deleting the ones which are not in the manifest anymore
+func (p *Plugin) Update(invocation *plugin.CodePluginInvocationParams) error {
+	rawInvocation, err := p.rendered(invocation)
+	if err != nil {
+		return err
+	}
+	return p.raw.Update(rawInvocation)
+}
+
+// Destroy deletes k8s objects from the stored manifest
+func (p *Plugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
+	rawInvocation, err := p.deployed(invocation)
+	if err != nil {
+		return err
+	}
+	return p.raw.Destroy(rawInvocation)
+}
+
+// Move makes k8s objects deployed under the previous deploy name available under the new one
+func (p *Plugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	rawFrom, err := p.deployed(from)
+	if err != nil {
+		return err
+	}
+	// objects are moved as they are, so the new deploy name gets the same manifest
+	manifest, _ := rawFrom.Params["manifest"].(string)
+	return p.raw.Move(rawFrom, withManifest(to, manifest))
+}
+
+// Endpoints returns map from port type to url for all services from the stored manifest
+func (p *Plugin) Endpoints(invocation *plugin.CodePluginInvocationParams) (map[string]string, error) {
+	rawInvocation, err := p.deployed(invocation)
+	if err != nil {
+		return nil, err
+	}
+	return p.raw.Endpoints(rawInvocation)
+}
+
+// Resources returns all k8s objects from the stored manifest
+func (p *Plugin) Resources(invocation *plugin.CodePluginInvocationParams) (plugin.Resources, error) {
+	rawInvocation, err := p.deployed(invocation)
+	if err != nil {
+		return nil, err
+	}
+	return p.raw.Resources(rawInvocation)
+}
+
+// Status returns readiness of all k8s objects from the stored manifest
+func (p *Plugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	rawInvocation, err := p.deployed(invocation)
+	if err != nil {
+		return false, err
+	}
+	return p.raw.Status(rawInvocation)
+}
+
+// Drift compares stored manifest with the rendered one, as well as k8s objects with the live objects in the cluster
+func (p *Plugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	rawInvocation, err := p.rendered(invocation)
+	if err != nil {
+		return "", err
+	}
+	return p.raw.Drift(rawInvocation)
+}
+
+// Exists returns true if k8s objects have been deployed under the given deploy name or if all objects from the
+// rendered manifest already exist in the cluster
+func (p *Plugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	rawInvocation, err := p.rendered(invocation)
+	if err != nil {
+		return false, err
+	}
+	return p.raw.Exists(rawInvocation)
+}
+
+// Deployments returns all deployments created by the plugin in the cluster. Their params contain rendered manifest
+// as "manifest" param, which is accepted by the plugin as is
+func (p *Plugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	return p.raw.Deployments(eventLog)
+}
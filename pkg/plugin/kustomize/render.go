@@ -0,0 +1,626 @@
+package kustomize
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/util"
+	"gopkg.in/yaml.v2"
+)
+
+// object is a single k8s object from manifests
+type object map[string]interface{}
+
+// Render loads manifests specified in code params, applies overlays to them and returns the result as a single
+// manifest with all objects. Manifests are taken from "base" (directory with YAML/JSON files), "manifests" (list of
+// manifests) and "manifest" (single manifest) params. Overlays are "patches" (list of partial objects merged into
+// objects with the same kind and name), "images" (list of image overrides with name, newName, newTag and digest),
+// "commonLabels", "commonAnnotations", "namePrefix" and "nameSuffix" (references to renamed objects from other objects
+// are renamed too). Base is a path in the given bases dir
+func Render(params util.NestedParameterMap, basesDir string) (string, error) {
+	objects, err := loadObjects(params, basesDir)
+	if err != nil {
+		return "", err
+	}
+	if len(objects) <= 0 {
+		return "", fmt.Errorf("no objects found in manifests, at least one of base, manifests or manifest parameters should be specified")
+	}
+
+	err = applyPatches(objects, params["patches"])
+	if err != nil {
+		return "", err
+	}
+
+	err = applyImages(objects, params["images"])
+	if err != nil {
+		return "", err
+	}
+
+	labels, err := stringMap("commonLabels", params["commonLabels"])
+	if err != nil {
+		return "", err
+	}
+	annotations, err := stringMap("commonAnnotations", params["commonAnnotations"])
+	if err != nil {
+		return "", err
+	}
+	for _, obj := range objects {
+		addCommonLabels(obj, labels)
+		addCommonAnnotations(obj, annotations)
+	}
+
+	prefix, _ := params["namePrefix"].(string)
+	suffix, _ := params["nameSuffix"].(string)
+	if len(prefix) > 0 || len(suffix) > 0 {
+		renameObjects(objects, prefix, suffix)
+	}
+
+	docs := []string{}
+	for _, obj := range objects {
+		data, marshalErr := yaml.Marshal(map[string]interface{}(obj))
+		if marshalErr != nil {
+			return "", fmt.Errorf("error while marshalling %s: %s", obj, marshalErr)
+		}
+		docs = append(docs, string(data))
+	}
+
+	return strings.Join(docs, "---\n"), nil
+}
+
+// loadObjects loads objects from all manifests specified in code params
+func loadObjects(params util.NestedParameterMap, basesDir string) ([]object, error) {
+	manifests := []string{}
+
+	if base, exist := params["base"]; exist {
+		basePath, ok := base.(string)
+		if !ok {
+			return nil, fmt.Errorf("base should be a path to directory, but found: %T", base)
+		}
+		if len(basesDir) <= 0 {
+			return nil, fmt.Errorf("bases dir isn't configured for kustomize plugin, so base %s can't be used", basePath)
+		}
+		// base can't point outside of the bases dir
+		baseDir := filepath.Join(basesDir, filepath.Clean("/"+basePath))
+		files, err := ioutil.ReadDir(baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading base directory %s: %s", basePath, err)
+		}
+		// files are sorted by name, so objects always come in the same order
+		for _, file := range files {
+			ext := filepath.Ext(file.Name())
+			if file.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+				continue
+			}
+			data, readErr := ioutil.ReadFile(filepath.Join(baseDir, file.Name())) // nolint: gas
+			if readErr != nil {
+				return nil, fmt.Errorf("error while reading manifest %s: %s", file.Name(), readErr)
+			}
+			manifests = append(manifests, string(data))
+		}
+	}
+
+	if list, exist := params["manifests"]; exist {
+		items, ok := list.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("manifests should be a list, but found: %T", list)
+		}
+		for _, item := range items {
+			manifest, isString := item.(string)
+			if !isString {
+				return nil, fmt.Errorf("manifests should be a list of strings, but found: %T", item)
+			}
+			manifests = append(manifests, manifest)
+		}
+	}
+
+	if single, exist := params["manifest"]; exist {
+		manifest, ok := single.(string)
+		if !ok {
+			return nil, fmt.Errorf("manifest should be a string, but found: %T", single)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	result := []object{}
+	for _, manifest := range manifests {
+		objects, err := parseManifest(manifest)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, objects...)
+	}
+	return result, nil
+}
+
+// parseManifest parses all objects from multi-document manifest
+func parseManifest(manifest string) ([]object, error) {
+	result := []object{}
+	for _, doc := range splitDocuments(manifest) {
+		var value interface{}
+		err := yaml.Unmarshal([]byte(doc), &value)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing manifest: %s", err)
+		}
+		if value == nil {
+			continue
+		}
+		obj, err := toObject(value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+// splitDocuments splits multi-document YAML into separate documents
+func splitDocuments(manifest string) []string {
+	result := []string{}
+	current := []string{}
+	for _, line := range strings.Split(manifest, "\n") {
+		if strings.TrimRight(line, " \t\r") == "---" {
+			result = append(result, strings.Join(current, "\n"))
+			current = []string{}
+			continue
+		}
+		current = append(current, line)
+	}
+	return append(result, strings.Join(current, "\n"))
+}
+
+// toObject converts parsed YAML or code params into an object and checks that it has kind and name
+func toObject(value interface{}) (object, error) {
+	obj, ok := normalize(value).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("k8s object should be a map, but found: %T", value)
+	}
+	result := object(obj)
+	if len(result.kind()) <= 0 || len(result.name()) <= 0 {
+		return nil, fmt.Errorf("k8s object should have kind and metadata.name set: %v", obj)
+	}
+	return result, nil
+}
+
+// normalize converts all maps in the given value into maps with string keys, so they can be merged and marshalled
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{})
+		for key, item := range v {
+			result[fmt.Sprintf("%v", key)] = normalize(item)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{})
+		for key, item := range v {
+			result[key] = normalize(item)
+		}
+		return result
+	case util.NestedParameterMap:
+		return normalize(map[string]interface{}(v))
+	case []interface{}:
+		result := []interface{}{}
+		for _, item := range v {
+			result = append(result, normalize(item))
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+func (obj object) kind() string {
+	kind, _ := obj["kind"].(string)
+	return kind
+}
+
+func (obj object) metadata() map[string]interface{} {
+	return childMap(obj, "metadata")
+}
+
+func (obj object) name() string {
+	name, _ := obj.metadata()["name"].(string)
+	return name
+}
+
+func (obj object) String() string {
+	return obj.kind() + "/" + obj.name()
+}
+
+// childMap returns child map with the given key, creating it if it doesn't exist
+func childMap(parent map[string]interface{}, key string) map[string]interface{} {
+	child, ok := parent[key].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		parent[key] = child
+	}
+	return child
+}
+
+// applyPatches merges every patch into the object with the same kind and name
+func applyPatches(objects []object, patches interface{}) error {
+	if patches == nil {
+		return nil
+	}
+	list, ok := patches.([]interface{})
+	if !ok {
+		return fmt.Errorf("patches should be a list, but found: %T", patches)
+	}
+
+	for _, item := range list {
+		patchObjects := []object{}
+		if manifest, isString := item.(string); isString {
+			var err error
+			patchObjects, err = parseManifest(manifest)
+			if err != nil {
+				return err
+			}
+		} else {
+			patch, err := toObject(item)
+			if err != nil {
+				return err
+			}
+			patchObjects = append(patchObjects, patch)
+		}
+
+		for _, patch := range patchObjects {
+			found := false
+			for _, obj := range objects {
+				if obj.kind() == patch.kind() && obj.name() == patch.name() {
+					mergeMaps(obj, patch)
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("no object found for patch %s", patch)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeMaps merges patch into dst the way strategic merge patch does it for most objects: maps are merged recursively,
+// lists of maps with names (e.g. containers) are merged by name, all other values are replaced and null values delete
+// keys from dst
+func mergeMaps(dst map[string]interface{}, patch map[string]interface{}) {
+	for key, patchValue := range patch {
+		if patchValue == nil {
+			delete(dst, key)
+			continue
+		}
+
+		switch patchItem := patchValue.(type) {
+		case map[string]interface{}:
+			if dstItem, ok := dst[key].(map[string]interface{}); ok {
+				mergeMaps(dstItem, patchItem)
+				continue
+			}
+		case []interface{}:
+			if dstItem, ok := dst[key].([]interface{}); ok {
+				if merged, isNamed := mergeNamedLists(dstItem, patchItem); isNamed {
+					dst[key] = merged
+					continue
+				}
+			}
+		}
+
+		dst[key] = patchValue
+	}
+}
+
+// mergeNamedLists merges lists of maps by their names. It returns false if any of the items doesn't have a name
+func mergeNamedLists(dst []interface{}, patch []interface{}) ([]interface{}, bool) {
+	for _, item := range append(append([]interface{}{}, dst...), patch...) {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if _, hasName := itemMap["name"].(string); !hasName {
+			return nil, false
+		}
+	}
+
+	result := append([]interface{}{}, dst...)
+	for _, patchItem := range patch {
+		patchMap := patchItem.(map[string]interface{}) // nolint: errcheck
+		found := false
+		for _, dstItem := range result {
+			dstMap := dstItem.(map[string]interface{}) // nolint: errcheck
+			if dstMap["name"] == patchMap["name"] {
+				mergeMaps(dstMap, patchMap)
+				found = true
+			}
+		}
+		if !found {
+			result = append(result, patchMap)
+		}
+	}
+	return result, true
+}
+
+// applyImages overrides images of all containers and init containers, which match image overrides by name
+func applyImages(objects []object, images interface{}) error {
+	if images == nil {
+		return nil
+	}
+	list, ok := images.([]interface{})
+	if !ok {
+		return fmt.Errorf("images should be a list, but found: %T", images)
+	}
+
+	overrides := []map[string]string{}
+	for _, item := range list {
+		override, err := stringMap("image override", item)
+		if err != nil {
+			return err
+		}
+		if len(override["name"]) <= 0 {
+			return fmt.Errorf("image override should have a name: %v", override)
+		}
+		overrides = append(overrides, override)
+	}
+
+	for _, obj := range objects {
+		walkContainers(obj, func(container map[string]interface{}) {
+			image, _ := container["image"].(string)
+			name, ref := splitImage(image)
+			for _, override := range overrides {
+				if override["name"] != name {
+					continue
+				}
+				if len(override["newName"]) > 0 {
+					name = override["newName"]
+				}
+				if len(override["digest"]) > 0 {
+					ref = "@" + override["digest"]
+				} else if len(override["newTag"]) > 0 {
+					ref = ":" + override["newTag"]
+				}
+				container["image"] = name + ref
+			}
+		})
+	}
+	return nil
+}
+
+// walkContainers calls the given function for every container and init container found anywhere in the value
+func walkContainers(value interface{}, fn func(container map[string]interface{})) {
+	switch v := value.(type) {
+	case object:
+		walkContainers(map[string]interface{}(v), fn)
+	case map[string]interface{}:
+		for key, item := range v {
+			if key == "containers" || key == "initContainers" {
+				if containers, ok := item.([]interface{}); ok {
+					for _, container := range containers {
+						if containerMap, isMap := container.(map[string]interface{}); isMap {
+							fn(containerMap)
+						}
+					}
+					continue
+				}
+			}
+			walkContainers(item, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkContainers(item, fn)
+		}
+	}
+}
+
+// splitImage splits image into name and reference (":tag" or "@digest")
+func splitImage(image string) (string, string) {
+	if idx := strings.Index(image, "@"); idx >= 0 {
+		return image[:idx], image[idx:]
+	}
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		return image[:idx], image[idx:]
+	}
+	return image, ""
+}
+
+// workloadKinds are kinds of objects, which have pod template and selector
+var workloadKinds = []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet"}
+
+// addCommonLabels adds labels to the object, as well as to its pod template and selector, so they keep matching
+func addCommonLabels(obj object, labels map[string]string) {
+	if len(labels) <= 0 {
+		return
+	}
+
+	targets := []map[string]interface{}{childMap(obj.metadata(), "labels")}
+	if util.ContainsString(workloadKinds, obj.kind()) {
+		spec := childMap(obj, "spec")
+		targets = append(targets, childMap(childMap(spec, "selector"), "matchLabels"))
+		targets = append(targets, childMap(childMap(childMap(spec, "template"), "metadata"), "labels"))
+	}
+	if obj.kind() == "Service" {
+		targets = append(targets, childMap(childMap(obj, "spec"), "selector"))
+	}
+
+	for _, target := range targets {
+		for key, label := range labels {
+			target[key] = label
+		}
+	}
+}
+
+// addCommonAnnotations adds annotations to the object and to its pod template
+func addCommonAnnotations(obj object, annotations map[string]string) {
+	if len(annotations) <= 0 {
+		return
+	}
+
+	targets := []map[string]interface{}{childMap(obj.metadata(), "annotations")}
+	if util.ContainsString(workloadKinds, obj.kind()) {
+		targets = append(targets, childMap(childMap(childMap(childMap(obj, "spec"), "template"), "metadata"), "annotations"))
+	}
+
+	for _, target := range targets {
+		for key, annotation := range annotations {
+			target[key] = annotation
+		}
+	}
+}
+
+// stringMap converts code param into a map of strings
+func stringMap(name string, value interface{}) (map[string]string, error) {
+	result := make(map[string]string)
+	if value == nil {
+		return result, nil
+	}
+	values, ok := normalize(value).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s should be a map, but found: %T", name, value)
+	}
+	for key, item := range values {
+		result[key] = fmt.Sprintf("%v", item)
+	}
+	return result, nil
+}
+
+// renameObjects adds prefix and suffix to names of all objects and updates references to the renamed objects the way
+// kustomize does it: config maps, secrets, persistent volume claims and service accounts referenced by pod specs,
+// services referenced by stateful sets, services and secrets referenced by ingresses, roles and service accounts
+// referenced by role bindings and objects scaled by horizontal pod autoscalers
+func renameObjects(objects []object, prefix string, suffix string) {
+	// kind -> previous name -> new name
+	renamed := make(map[string]map[string]string)
+	for _, obj := range objects {
+		if renamed[obj.kind()] == nil {
+			renamed[obj.kind()] = make(map[string]string)
+		}
+		name := prefix + obj.name() + suffix
+		renamed[obj.kind()][obj.name()] = name
+		obj.metadata()["name"] = name
+	}
+
+	// ref updates name of the object of the given kind referenced by the given key of the parent map
+	ref := func(kind string, parent map[string]interface{}, key string) {
+		name, ok := parent[key].(string)
+		if !ok {
+			return
+		}
+		if newName, found := renamed[kind][name]; found {
+			parent[key] = newName
+		}
+	}
+
+	for _, obj := range objects {
+		walkPodSpecs(obj, func(spec map[string]interface{}) {
+			ref("ServiceAccount", spec, "serviceAccountName")
+			ref("ServiceAccount", spec, "serviceAccount")
+			for _, secret := range listAt(spec, "imagePullSecrets") {
+				ref("Secret", secret, "name")
+			}
+			for _, volume := range listAt(spec, "volumes") {
+				ref("ConfigMap", mapAt(volume, "configMap"), "name")
+				ref("Secret", mapAt(volume, "secret"), "secretName")
+				ref("PersistentVolumeClaim", mapAt(volume, "persistentVolumeClaim"), "claimName")
+				for _, source := range listAt(mapAt(volume, "projected"), "sources") {
+					ref("ConfigMap", mapAt(source, "configMap"), "name")
+					ref("Secret", mapAt(source, "secret"), "name")
+				}
+			}
+			for _, container := range append(listAt(spec, "containers"), listAt(spec, "initContainers")...) {
+				for _, envFrom := range listAt(container, "envFrom") {
+					ref("ConfigMap", mapAt(envFrom, "configMapRef"), "name")
+					ref("Secret", mapAt(envFrom, "secretRef"), "name")
+				}
+				for _, env := range listAt(container, "env") {
+					ref("ConfigMap", mapAt(env, "valueFrom", "configMapKeyRef"), "name")
+					ref("Secret", mapAt(env, "valueFrom", "secretKeyRef"), "name")
+				}
+			}
+		})
+
+		spec := mapAt(obj, "spec")
+		switch obj.kind() {
+		case "StatefulSet":
+			ref("Service", spec, "serviceName")
+			for _, claim := range listAt(spec, "volumeClaimTemplates") {
+				ref("PersistentVolumeClaim", mapAt(claim, "metadata"), "name")
+			}
+		case "Ingress":
+			backends := []map[string]interface{}{mapAt(spec, "backend"), mapAt(spec, "defaultBackend")}
+			for _, rule := range listAt(spec, "rules") {
+				for _, path := range listAt(mapAt(rule, "http"), "paths") {
+					backends = append(backends, mapAt(path, "backend"))
+				}
+			}
+			for _, backend := range backends {
+				// extensions/v1beta1 and networking.k8s.io/v1 backends
+				ref("Service", backend, "serviceName")
+				ref("Service", mapAt(backend, "service"), "name")
+			}
+			for _, tls := range listAt(spec, "tls") {
+				ref("Secret", tls, "secretName")
+			}
+		case "RoleBinding", "ClusterRoleBinding":
+			roleRef := mapAt(obj, "roleRef")
+			if kind, ok := roleRef["kind"].(string); ok {
+				ref(kind, roleRef, "name")
+			}
+			for _, subject := range listAt(obj, "subjects") {
+				if subject["kind"] == "ServiceAccount" {
+					ref("ServiceAccount", subject, "name")
+				}
+			}
+		case "HorizontalPodAutoscaler":
+			target := mapAt(spec, "scaleTargetRef")
+			if kind, ok := target["kind"].(string); ok {
+				ref(kind, target, "name")
+			}
+		}
+	}
+}
+
+// walkPodSpecs calls the given function for every pod spec (i.e. map with containers) found anywhere in the value
+func walkPodSpecs(value interface{}, fn func(spec map[string]interface{})) {
+	switch v := value.(type) {
+	case object:
+		walkPodSpecs(map[string]interface{}(v), fn)
+	case map[string]interface{}:
+		if _, isList := v["containers"].([]interface{}); isList {
+			fn(v)
+			return
+		}
+		for _, item := range v {
+			walkPodSpecs(item, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkPodSpecs(item, fn)
+		}
+	}
+}
+
+// mapAt returns nested map at the given path or nil if it doesn't exist. Unlike childMap, it never creates maps
+func mapAt(parent map[string]interface{}, path ...string) map[string]interface{} {
+	for _, key := range path {
+		child, ok := parent[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		parent = child
+	}
+	return parent
+}
+
+// listAt returns all maps from the list with the given key or nil if there is no such list
+func listAt(parent map[string]interface{}, key string) []map[string]interface{} {
+	list, ok := parent[key].([]interface{})
+	if !ok {
+		return nil
+	}
+	result := []map[string]interface{}{}
+	for _, item := range list {
+		if itemMap, isMap := item.(map[string]interface{}); isMap {
+			result = append(result, itemMap)
+		}
+	}
+	return result
+}
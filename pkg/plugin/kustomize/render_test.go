@@ -0,0 +1,260 @@
+package kustomize
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+const deploymentManifest = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.13
+      - name: sidecar
+        image: registry.local:5000/sidecar@sha256:abc
+`
+
+const serviceManifest = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  selector:
+    app: web
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+data:
+  key: value
+`
+
+func TestRender(t *testing.T) {
+	basesDir, err := ioutil.TempDir("", "aptomi-kustomize")
+	if !assert.NoError(t, err, "Temp dir should be created") {
+		t.FailNow()
+	}
+	defer os.RemoveAll(basesDir) // nolint: errcheck
+	baseDir := filepath.Join(basesDir, "web")
+	assert.NoError(t, os.MkdirAll(baseDir, 0755), "Base dir should be created")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(baseDir, "deployment.yaml"), []byte(deploymentManifest), 0644), "Manifest should be written")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(baseDir, "README.md"), []byte("not a manifest"), 0644), "Readme should be written")
+
+	params := util.NestedParameterMap{
+		"base":      "web",
+		"manifests": []interface{}{serviceManifest},
+		"patches": []interface{}{
+			util.NestedParameterMap{
+				"kind":     "Deployment",
+				"metadata": util.NestedParameterMap{"name": "web"},
+				"spec": util.NestedParameterMap{
+					"replicas": 3,
+					"template": util.NestedParameterMap{
+						"spec": util.NestedParameterMap{
+							"containers": []interface{}{
+								util.NestedParameterMap{"name": "web", "env": []interface{}{util.NestedParameterMap{"name": "MODE", "value": "prod"}}},
+							},
+						},
+					},
+				},
+			},
+			"kind: ConfigMap\nmetadata:\n  name: web-config\ndata:\n  key: null\n  other: patched\n",
+		},
+		"images": []interface{}{
+			util.NestedParameterMap{"name": "nginx", "newTag": "1.15"},
+			util.NestedParameterMap{"name": "registry.local:5000/sidecar", "newName": "sidecar", "newTag": "2.0"},
+		},
+		"commonLabels":      util.NestedParameterMap{"team": "platform"},
+		"commonAnnotations": util.NestedParameterMap{"owner": "alice"},
+		"namePrefix":        "prod-",
+	}
+
+	manifest, err := Render(params, basesDir)
+	if !assert.NoError(t, err, "Manifest should be rendered") {
+		t.FailNow()
+	}
+	objects, err := parseManifest(manifest)
+	if !assert.NoError(t, err, "Rendered manifest should be parsed") || !assert.Equal(t, 3, len(objects), "All objects should be rendered") {
+		t.FailNow()
+	}
+
+	deployment, service, configMap := objects[0], objects[1], objects[2]
+	assert.Equal(t, "prod-web", deployment.name(), "Name prefix should be added")
+	assert.Equal(t, "prod-web-config", configMap.name(), "Name prefix should be added")
+
+	spec := deployment["spec"].(map[string]interface{})
+	assert.Equal(t, 3, spec["replicas"], "Patch should be applied")
+	containers := spec["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	if !assert.Equal(t, 2, len(containers), "Containers should be merged by name") {
+		t.FailNow()
+	}
+	web := containers[0].(map[string]interface{})
+	assert.Equal(t, "nginx:1.15", web["image"], "Image tag should be overridden")
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "MODE", "value": "prod"}}, web["env"], "Container should be patched")
+	assert.Equal(t, "sidecar:2.0", containers[1].(map[string]interface{})["image"], "Image name and tag should be overridden")
+
+	labels := map[string]interface{}{"app": "web", "team": "platform"}
+	assert.Equal(t, map[string]interface{}{"team": "platform"}, deployment.metadata()["labels"], "Common labels should be added to object")
+	assert.Equal(t, labels, spec["selector"].(map[string]interface{})["matchLabels"], "Common labels should be added to selector")
+	assert.Equal(t, labels, spec["template"].(map[string]interface{})["metadata"].(map[string]interface{})["labels"], "Common labels should be added to pod template")
+	assert.Equal(t, labels, service["spec"].(map[string]interface{})["selector"], "Common labels should be added to service selector")
+	assert.Equal(t, map[string]interface{}{"owner": "alice"}, configMap.metadata()["annotations"], "Common annotations should be added")
+
+	assert.Equal(t, map[string]interface{}{"other": "patched"}, configMap["data"], "Null in patch should delete the key")
+
+	// base can't point outside of the bases dir
+	confined, err := Render(util.NestedParameterMap{"base": "../../web"}, basesDir)
+	assert.NoError(t, err, "Base should be resolved within bases dir")
+	direct, err := Render(util.NestedParameterMap{"base": "web"}, basesDir)
+	assert.NoError(t, err, "Base should be rendered")
+	assert.Equal(t, direct, confined, "Base pointing outside of bases dir should be resolved within it")
+
+	// rendered manifest is rendered the same way again, so stored manifests of deployments could be used as params
+	again, err := Render(util.NestedParameterMap{"manifest": manifest}, "")
+	assert.NoError(t, err, "Rendered manifest should be rendered again")
+	assert.Equal(t, manifest, again, "Rendered manifest should not change when rendered again")
+}
+
+const referencesManifest = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      serviceAccountName: web
+      containers:
+      - name: web
+        image: nginx
+        envFrom:
+        - configMapRef:
+            name: web-config
+        - secretRef:
+            name: external-secret
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: web-secret
+              key: password
+      volumes:
+      - name: config
+        configMap:
+          name: web-config
+      - name: secret
+        secret:
+          secretName: web-secret
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web-secret
+---
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: web
+spec:
+  rules:
+  - http:
+      paths:
+      - path: /
+        backend:
+          serviceName: web
+          servicePort: 80
+  tls:
+  - secretName: web-secret
+`
+
+func TestRenderNameReferences(t *testing.T) {
+	manifest, err := Render(util.NestedParameterMap{
+		"manifests":  []interface{}{serviceManifest, referencesManifest},
+		"namePrefix": "prod-",
+		"nameSuffix": "-v1",
+	}, "")
+	if !assert.NoError(t, err, "Manifest should be rendered") {
+		t.FailNow()
+	}
+	objects, err := parseManifest(manifest)
+	if !assert.NoError(t, err, "Rendered manifest should be parsed") || !assert.Equal(t, 6, len(objects), "All objects should be rendered") {
+		t.FailNow()
+	}
+	deployment, ingress := objects[2], objects[5]
+
+	podSpec := mapAt(deployment, "spec", "template", "spec")
+	container := listAt(podSpec, "containers")[0]
+	volumes := listAt(podSpec, "volumes")
+	backend := mapAt(listAt(mapAt(listAt(mapAt(ingress, "spec"), "rules")[0], "http"), "paths")[0], "backend")
+
+	tests := []struct {
+		actual   interface{}
+		expected string
+		message  string
+	}{
+		{podSpec["serviceAccountName"], "prod-web-v1", "Service account of pods should be renamed"},
+		{mapAt(listAt(container, "envFrom")[0], "configMapRef")["name"], "prod-web-config-v1", "Config map in envFrom should be renamed"},
+		{mapAt(listAt(container, "envFrom")[1], "secretRef")["name"], "external-secret", "Secret, which isn't in manifests, should not be renamed"},
+		{mapAt(listAt(container, "env")[0], "valueFrom", "secretKeyRef")["name"], "prod-web-secret-v1", "Secret in env should be renamed"},
+		{mapAt(volumes[0], "configMap")["name"], "prod-web-config-v1", "Config map volume should be renamed"},
+		{mapAt(volumes[1], "secret")["secretName"], "prod-web-secret-v1", "Secret volume should be renamed"},
+		{backend["serviceName"], "prod-web-v1", "Ingress backend should be renamed"},
+		{listAt(mapAt(ingress, "spec"), "tls")[0]["secretName"], "prod-web-secret-v1", "Ingress TLS secret should be renamed"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.actual, test.message)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	_, err := Render(util.NestedParameterMap{}, "")
+	assert.Error(t, err, "Params without manifests should be rejected")
+
+	_, err = Render(util.NestedParameterMap{"base": "non-existing-dir"}, os.TempDir())
+	assert.Error(t, err, "Non-existing base directory should be rejected")
+
+	_, err = Render(util.NestedParameterMap{"base": os.TempDir()}, "")
+	assert.Error(t, err, "Base should be rejected if bases dir isn't configured")
+
+	_, err = Render(util.NestedParameterMap{"manifest": "kind: Service\nmetadata: {}\n"}, "")
+	assert.Error(t, err, "Object without name should be rejected")
+
+	_, err = Render(util.NestedParameterMap{
+		"manifest": serviceManifest,
+		"patches":  []interface{}{"kind: Service\nmetadata:\n  name: other\n"},
+	}, "")
+	assert.Error(t, err, "Patch without matching object should be rejected")
+
+	_, err = Render(util.NestedParameterMap{
+		"manifest": serviceManifest,
+		"images":   []interface{}{util.NestedParameterMap{"newTag": "1.0"}},
+	}, "")
+	assert.Error(t, err, "Image override without name should be rejected")
+}
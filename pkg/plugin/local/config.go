@@ -0,0 +1,147 @@
+package local
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// ClusterConfig represents local cluster plugin configuration
+type ClusterConfig struct {
+	// WorkDir is a directory where processes get started in, and where their logs and plugin state are kept.
+	// Default is a directory named after the cluster in the system temp dir
+	WorkDir string `yaml:",omitempty"`
+
+	// Host is a host name used in endpoints of processes. Default is 127.0.0.1
+	Host string `yaml:",omitempty"`
+}
+
+func (p *Plugin) parseClusterConfig() error {
+	clusterConfig := &ClusterConfig{}
+	err := p.Cluster.ParseConfigInto(clusterConfig)
+	if err != nil {
+		return fmt.Errorf("error while parsing local specific config of cluster %s: %s", p.Cluster.Name, err)
+	}
+
+	p.WorkDir = filepath.Join(os.TempDir(), "aptomi-local", p.Cluster.Name)
+	if len(clusterConfig.WorkDir) > 0 {
+		p.WorkDir = clusterConfig.WorkDir
+	}
+
+	p.Host = "127.0.0.1"
+	if len(clusterConfig.Host) > 0 {
+		p.Host = clusterConfig.Host
+	}
+
+	return nil
+}
+
+// processParams are code params of a process
+type processParams struct {
+	// command is an executable to run
+	command string
+
+	// args are command line arguments
+	args []string
+
+	// env is a list of additional environment variables in KEY=VALUE form
+	env []string
+
+	// ports is a map from endpoint name to the port process listens on
+	ports map[string]int
+}
+
+// parseProcessParams parses code params of a process. Supported params are "command" (executable to run, mandatory),
+// "args" (list of command line arguments), "env" (map of additional environment variables), "port" (port process
+// listens on, exposed as "http" endpoint) and "ports" (map from endpoint name to the port process listens on)
+func parseProcessParams(params util.NestedParameterMap) (*processParams, error) {
+	result := &processParams{
+		args:  []string{},
+		env:   []string{},
+		ports: make(map[string]int),
+	}
+
+	command, ok := params["command"].(string)
+	if !ok || len(command) <= 0 {
+		return nil, fmt.Errorf("command is a mandatory parameter")
+	}
+	result.command = command
+
+	if args, exist := params["args"]; exist {
+		argsList, isList := args.([]interface{})
+		if !isList {
+			return nil, fmt.Errorf("args should be a list, but found: %T", args)
+		}
+		for _, arg := range argsList {
+			result.args = append(result.args, fmt.Sprintf("%v", arg))
+		}
+	}
+
+	if env, exist := params["env"]; exist {
+		envMap, isMap := env.(util.NestedParameterMap)
+		if !isMap {
+			return nil, fmt.Errorf("env should be a map, but found: %T", env)
+		}
+		for _, key := range util.GetSortedStringKeys(envMap) {
+			result.env = append(result.env, fmt.Sprintf("%s=%v", key, envMap[key]))
+		}
+	}
+
+	if port, exist := params["port"]; exist {
+		portNum, err := parsePort(port)
+		if err != nil {
+			return nil, err
+		}
+		result.ports["http"] = portNum
+	}
+
+	if ports, exist := params["ports"]; exist {
+		portsMap, isMap := ports.(util.NestedParameterMap)
+		if !isMap {
+			return nil, fmt.Errorf("ports should be a map, but found: %T", ports)
+		}
+		for name, port := range portsMap {
+			portNum, err := parsePort(port)
+			if err != nil {
+				return nil, err
+			}
+			result.ports[name] = portNum
+		}
+	}
+
+	return result, nil
+}
+
+func parsePort(port interface{}) (int, error) {
+	var result int
+	switch value := port.(type) {
+	case int:
+		result = value
+	case string:
+		var err error
+		result, err = strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("port should be a number, but found: %s", value)
+		}
+	default:
+		return 0, fmt.Errorf("port should be a number, but found: %T", port)
+	}
+	if result <= 0 || result > 65535 {
+		return 0, fmt.Errorf("port should be in range 1-65535, but found: %d", result)
+	}
+	return result, nil
+}
+
+// portNames returns sorted list of port names
+func (params *processParams) portNames() []string {
+	result := []string{}
+	for name := range params.ports {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
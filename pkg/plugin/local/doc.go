@@ -0,0 +1,3 @@
+// Package local implements support for local cluster plugin and process code plugin, which run components as
+// processes on the same machine Aptomi server runs on. It allows to try policies without a Kubernetes cluster.
+package local
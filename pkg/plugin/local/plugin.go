@@ -0,0 +1,57 @@
+package local
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util/sync"
+)
+
+// Plugin represents local cluster plugin, which represents the machine Aptomi server runs on
+type Plugin struct {
+	once    sync.Init
+	Cluster *lang.Cluster
+	config  config.Local
+	WorkDir string
+	Host    string
+}
+
+var _ plugin.ClusterPlugin = &Plugin{}
+
+// New creates new instance of the local cluster plugin for specified cluster and plugins config
+func New(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+	return &Plugin{
+		Cluster: cluster,
+		config:  cfg.Local,
+	}, nil
+}
+
+// Init parses cluster config and makes sure work dir exists
+func (p *Plugin) Init() error {
+	return p.once.Do(func() error {
+		err := p.parseClusterConfig()
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(p.WorkDir, 0755)
+		if err != nil {
+			return fmt.Errorf("error while creating work dir %s for cluster %s: %s", p.WorkDir, p.Cluster.Name, err)
+		}
+
+		return nil
+	})
+}
+
+// Validate checks that processes can be started in the cluster
+func (p *Plugin) Validate() error {
+	return p.Init()
+}
+
+// Cleanup implements cleanup phase for the local cluster plugin
+func (p *Plugin) Cleanup() error {
+	return nil
+}
@@ -0,0 +1,414 @@
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/Aptomi/aptomi/pkg/util/sync"
+)
+
+// ProcessPlugin represents process code plugin, which runs components as local processes
+type ProcessPlugin struct {
+	once        sync.Init
+	cluster     *Plugin
+	stopTimeout time.Duration
+	store       *processStore
+}
+
+var _ plugin.CodePlugin = &ProcessPlugin{}
+
+// NewProcessPlugin returns new instance of the process code plugin for specified local cluster plugin and plugins config
+func NewProcessPlugin(clusterPlugin plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+	localPlugin, ok := clusterPlugin.(*Plugin)
+	if !ok {
+		return nil, fmt.Errorf("local cluster plugin expected for process code plugin creation but received: %T", clusterPlugin)
+	}
+
+	stopTimeout := cfg.Local.StopTimeout
+	if stopTimeout <= 0 {
+		stopTimeout = 10 * time.Second
+	}
+
+	return &ProcessPlugin{
+		cluster:     localPlugin,
+		stopTimeout: stopTimeout,
+	}, nil
+}
+
+func (p *ProcessPlugin) init() error {
+	return p.once.Do(func() error {
+		err := p.cluster.Init()
+		if err != nil {
+			return err
+		}
+		p.store = newProcessStore(p.cluster.WorkDir)
+		return nil
+	})
+}
+
+// Cleanup implements cleanup phase for the process plugin
+func (p *ProcessPlugin) Cleanup() error {
+	return nil
+}
+
+// Create starts a new process
+func (p *ProcessPlugin) Create(invocation *plugin.CodePluginInvocationParams) error {
+	err := p.init()
+	if err != nil {
+		return err
+	}
+
+	params, err := parseProcessParams(invocation.Params)
+	if err != nil {
+		return err
+	}
+
+	return p.store.update(func(records map[string]*processRecord) error {
+		if record, exist := records[invocation.DeployName]; exist && record.isRunning() {
+			return fmt.Errorf("process %d for %s is already running", record.PID, invocation.DeployName)
+		}
+
+		record, startErr := p.start(invocation, params)
+		if startErr != nil {
+			return startErr
+		}
+		records[invocation.DeployName] = record
+		return nil
+	})
+}
+
+// Update restarts the process if its params have been changed or if it's not running
+func (p *ProcessPlugin) Update(invocation *plugin.CodePluginInvocationParams) error {
+	err := p.init()
+	if err != nil {
+		return err
+	}
+
+	params, err := parseProcessParams(invocation.Params)
+	if err != nil {
+		return err
+	}
+
+	return p.store.update(func(records map[string]*processRecord) error {
+		record, exist := records[invocation.DeployName]
+		if exist && record.isRunning() {
+			if record.Params.DeepEqual(invocation.Params) {
+				return nil
+			}
+			stopErr := p.stop(record, invocation.EventLog)
+			if stopErr != nil {
+				return stopErr
+			}
+		}
+
+		record, startErr := p.start(invocation, params)
+		if startErr != nil {
+			return startErr
+		}
+		records[invocation.DeployName] = record
+		return nil
+	})
+}
+
+// Destroy stops the process. It's not an error if process has already exited
+func (p *ProcessPlugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
+	err := p.init()
+	if err != nil {
+		return err
+	}
+
+	return p.store.update(func(records map[string]*processRecord) error {
+		record, exist := records[invocation.DeployName]
+		if !exist {
+			return nil
+		}
+		stopErr := p.stop(record, invocation.EventLog)
+		if stopErr != nil {
+			return stopErr
+		}
+		delete(records, invocation.DeployName)
+		return nil
+	})
+}
+
+// Move makes the running process available under the new deploy name without restarting it
+func (p *ProcessPlugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	err := p.init()
+	if err != nil {
+		return err
+	}
+
+	return p.store.update(func(records map[string]*processRecord) error {
+		record, exist := records[from.DeployName]
+		if !exist {
+			return fmt.Errorf("no process found for %s", from.DeployName)
+		}
+		delete(records, from.DeployName)
+		records[to.DeployName] = record
+		to.EventLog.NewEntry().Infof("Process %d moved from %s to %s", record.PID, from.DeployName, to.DeployName)
+		return nil
+	})
+}
+
+// Endpoints returns endpoints for all ports declared in process params
+func (p *ProcessPlugin) Endpoints(invocation *plugin.CodePluginInvocationParams) (map[string]string, error) {
+	err := p.init()
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := parseProcessParams(invocation.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make(map[string]string)
+	for name, port := range params.ports {
+		url := fmt.Sprintf("%s:%d", p.cluster.Host, port)
+		if util.StringContainsAny(name, "https") {
+			url = "https://" + url
+		} else if util.StringContainsAny(name, "ui", "rest", "http") {
+			url = "http://" + url
+		}
+		endpoints[name] = url
+	}
+	return endpoints, nil
+}
+
+// Resources returns the process with its PID
+func (p *ProcessPlugin) Resources(invocation *plugin.CodePluginInvocationParams) (plugin.Resources, error) {
+	err := p.init()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := p.store.get()
+	if err != nil {
+		return nil, err
+	}
+
+	table := &plugin.ResourceTable{
+		Headers: []string{"Name", "PID", "Command", "Ports", "Running", "Started"},
+		Items:   []plugin.Resource{},
+	}
+	if record, exist := records[invocation.DeployName]; exist {
+		params, parseErr := parseProcessParams(record.Params)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		ports := []string{}
+		for _, name := range params.portNames() {
+			ports = append(ports, fmt.Sprintf("%s:%d", name, params.ports[name]))
+		}
+		table.Items = append(table.Items, plugin.Resource{
+			invocation.DeployName,
+			strconv.Itoa(record.PID),
+			strings.Join(append([]string{params.command}, params.args...), " "),
+			strings.Join(ports, ","),
+			strconv.FormatBool(record.isRunning()),
+			record.StartedAt.Format(time.RFC3339),
+		})
+	}
+
+	return plugin.Resources{"process": table}, nil
+}
+
+// Status returns true if the process is running
+func (p *ProcessPlugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	err := p.init()
+	if err != nil {
+		return false, err
+	}
+
+	records, err := p.store.get()
+	if err != nil {
+		return false, err
+	}
+	record, exist := records[invocation.DeployName]
+	return exist && record.isRunning(), nil
+}
+
+// Drift returns description of the difference between the process and the given params
+func (p *ProcessPlugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	err := p.init()
+	if err != nil {
+		return "", err
+	}
+
+	records, err := p.store.get()
+	if err != nil {
+		return "", err
+	}
+	record, exist := records[invocation.DeployName]
+	if !exist {
+		return fmt.Sprintf("process for %s not found", invocation.DeployName), nil
+	}
+	if !record.isRunning() {
+		return fmt.Sprintf("process %d for %s is not running", record.PID, invocation.DeployName), nil
+	}
+	if !record.Params.DeepEqual(invocation.Params) {
+		return fmt.Sprintf("process %d for %s has been started with different params: %s", record.PID, invocation.DeployName, record.Params.Diff(invocation.Params)), nil
+	}
+	return "", nil
+}
+
+// Exists returns true if a process has been started for the given deploy name, even if it's not running anymore
+func (p *ProcessPlugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	err := p.init()
+	if err != nil {
+		return false, err
+	}
+
+	records, err := p.store.get()
+	if err != nil {
+		return false, err
+	}
+	_, exist := records[invocation.DeployName]
+	return exist, nil
+}
+
+// Deployments returns all processes started by the plugin in the cluster
+func (p *ProcessPlugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	err := p.init()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := p.store.get()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*plugin.Deployment{}
+	for _, deployName := range util.GetSortedStringKeys(records) {
+		result = append(result, &plugin.Deployment{
+			DeployName: deployName,
+			Params:     records[deployName].Params,
+		})
+	}
+	return result, nil
+}
+
+// start starts a process in its own process group with output redirected into a log file in the work dir
+func (p *ProcessPlugin) start(invocation *plugin.CodePluginInvocationParams, params *processParams) (*processRecord, error) {
+	logPath := filepath.Join(p.cluster.WorkDir, util.EscapeName(invocation.DeployName)+".log")
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening log file %s: %s", logPath, err)
+	}
+
+	cmd := exec.Command(params.command, params.args...) // nolint: gas
+	cmd.Dir = p.cluster.WorkDir
+	cmd.Env = append(os.Environ(), params.env...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err = cmd.Start()
+	if err != nil {
+		logFile.Close() // nolint: errcheck
+		return nil, fmt.Errorf("error while starting process for %s: %s", invocation.DeployName, err)
+	}
+
+	// reap the process once it exits, so it doesn't stay as a zombie and is not considered alive
+	go func() {
+		cmd.Wait()      // nolint: errcheck
+		logFile.Close() // nolint: errcheck
+	}()
+
+	invocation.EventLog.NewEntry().Infof("Started process %d for %s (log: %s)", cmd.Process.Pid, invocation.DeployName, logPath)
+
+	return &processRecord{
+		PID:       cmd.Process.Pid,
+		Identity:  processIdentity(cmd.Process.Pid),
+		Params:    invocation.Params,
+		StartedAt: time.Now(),
+	}, nil
+}
+
+// stop terminates process group of the recorded process and kills it if it doesn't exit in time. Nothing is signalled
+// if the process with the recorded PID is not the one which has been started by the plugin
+func (p *ProcessPlugin) stop(record *processRecord, eventLog *event.Log) error {
+	if !isAlive(record.PID) {
+		return nil
+	}
+	if !record.isRunning() {
+		eventLog.NewEntry().Warnf("Process %d is not the one started by the plugin anymore (PID has been reused), not stopping it", record.PID)
+		return nil
+	}
+
+	pid := record.PID
+	eventLog.NewEntry().Infof("Stopping process %d", pid)
+	err := syscall.Kill(-pid, syscall.SIGTERM)
+	if err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("error while terminating process %d: %s", pid, err)
+	}
+
+	deadline := time.Now().Add(p.stopTimeout)
+	for record.isRunning() {
+		if time.Now().After(deadline) {
+			eventLog.NewEntry().Warnf("Process %d didn't exit in %s, killing it", pid, p.stopTimeout)
+			err = syscall.Kill(-pid, syscall.SIGKILL)
+			if err != nil && err != syscall.ESRCH {
+				return fmt.Errorf("error while killing process %d: %s", pid, err)
+			}
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// isRunning checks whether the recorded process is still running. Process with the recorded PID has to have the same
+// identity, as PID could have been reused. Records without identity (created by earlier versions) can't be verified,
+// so their processes are never considered running
+func (record *processRecord) isRunning() bool {
+	return isAlive(record.PID) && len(record.Identity) > 0 && processIdentity(record.PID) == record.Identity
+}
+
+// isAlive checks whether process with the given PID is running
+func isAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// processIdentity returns identity of the process with the given PID, which is based on its start time. It's taken
+// from /proc where available and from ps otherwise. Empty string is returned if it can't be determined
+func processIdentity(pid int) string {
+	if _, err := os.Stat("/proc/self/stat"); err == nil {
+		data, readErr := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if readErr != nil {
+			return ""
+		}
+
+		// process name may contain spaces and parentheses, so fields are counted after the last closing parenthesis.
+		// start time is the 22nd field, while fields after the name start with the 3rd one
+		fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+		if len(fields) < 20 {
+			return ""
+		}
+		return "starttime:" + fields[19]
+	}
+
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output() // nolint: gas
+	if err != nil || len(strings.TrimSpace(string(out))) <= 0 {
+		return ""
+	}
+	return "lstart:" + strings.TrimSpace(string(out))
+}
@@ -0,0 +1,141 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/external/conformance"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessPluginConformance(t *testing.T) {
+	cluster, cleanup := makeCluster(t)
+	defer cleanup()
+
+	suite := &conformance.Suite{
+		Registry:      makeRegistry(),
+		Cluster:       cluster,
+		CodeType:      "process",
+		Params:        util.NestedParameterMap{"command": "sleep", "args": []interface{}{"1000"}, "port": 8080},
+		UpdatedParams: util.NestedParameterMap{"command": "sleep", "args": []interface{}{"2000"}, "port": 8080},
+	}
+	suite.Run(t)
+}
+
+func TestProcessPlugin(t *testing.T) {
+	cluster, cleanup := makeCluster(t)
+	defer cleanup()
+
+	eventLog := event.NewLog(logrus.WarnLevel, "test-local")
+	invocation := &plugin.CodePluginInvocationParams{
+		DeployName: "test-process",
+		Params: util.NestedParameterMap{
+			"command": "sh",
+			"args":    []interface{}{"-c", "sleep 1000"},
+			"env":     util.NestedParameterMap{"KEY": "value"},
+			"ports":   util.NestedParameterMap{"http": 8080, "admin-https": "8443", "db": 5432},
+		},
+		EventLog: eventLog,
+	}
+
+	codePlugin, err := makeRegistry().ForCodeType(cluster, "process")
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+	if !assert.NoError(t, codePlugin.Create(invocation), "Process should be started") {
+		t.FailNow()
+	}
+	defer codePlugin.Destroy(invocation) // nolint: errcheck
+
+	endpoints, err := codePlugin.Endpoints(invocation)
+	assert.NoError(t, err, "Endpoints should be returned")
+	assert.Equal(t, map[string]string{
+		"http":        "http://127.0.0.1:8080",
+		"admin-https": "https://127.0.0.1:8443",
+		"db":          "127.0.0.1:5432",
+	}, endpoints, "Endpoints should be generated for all ports")
+
+	resources, err := codePlugin.Resources(invocation)
+	if !assert.NoError(t, err, "Resources should be returned") || !assert.Equal(t, 1, len(resources["process"].Items), "Process should be returned") {
+		t.FailNow()
+	}
+	assert.Equal(t, "sh -c sleep 1000", resources["process"].Items[0][2], "Process command should be returned")
+	assert.Equal(t, "true", resources["process"].Items[0][4], "Process should be running")
+
+	// processes are tracked across plugin instances (e.g. after server restart)
+	otherPlugin, err := makeRegistry().ForCodeType(cluster, "process")
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+	ready, err := otherPlugin.Status(invocation)
+	assert.NoError(t, err, "Status should be returned")
+	assert.True(t, ready, "Process should be running")
+
+	// process which has exited is reported as drifted
+	records, err := newProcessStore(cluster.Config.(map[string]string)["workdir"]).get()
+	if !assert.NoError(t, err, "Process records should be loaded") {
+		t.FailNow()
+	}
+	record := records[invocation.DeployName]
+	pid := record.PID
+
+	// process with a different identity (i.e. PID has been reused) is not stopped
+	assert.NoError(t, (&ProcessPlugin{stopTimeout: 0}).stop(&processRecord{PID: pid, Identity: "other"}, eventLog), "Process with reused PID should be skipped")
+	assert.NoError(t, (&ProcessPlugin{stopTimeout: 0}).stop(&processRecord{PID: pid}, eventLog), "Process without identity should be skipped")
+	time.Sleep(200 * time.Millisecond)
+	assert.True(t, record.isRunning(), "Process with reused PID should not be stopped")
+
+	assert.NoError(t, (&ProcessPlugin{stopTimeout: 0}).stop(record, eventLog), "Process should be stopped")
+	for i := 0; i < 50 && isAlive(pid); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	drift, err := otherPlugin.Drift(invocation)
+	assert.NoError(t, err, "Drift should be returned")
+	assert.Contains(t, drift, "is not running", "Stopped process should be reported as drifted")
+
+	// invalid params are rejected
+	invalid := &plugin.CodePluginInvocationParams{
+		DeployName: "test-invalid",
+		Params:     util.NestedParameterMap{"args": []interface{}{"1000"}},
+		EventLog:   eventLog,
+	}
+	assert.Error(t, codePlugin.Create(invalid), "Process without command should be rejected")
+	invalid.Params = util.NestedParameterMap{"command": "sleep", "port": "http"}
+	assert.Error(t, codePlugin.Create(invalid), "Process with invalid port should be rejected")
+}
+
+func makeRegistry() plugin.Registry {
+	clusterTypes := map[string]plugin.ClusterPluginConstructor{"local": New}
+	codeTypes := map[string]map[string]plugin.CodePluginConstructor{"local": {"process": NewProcessPlugin}}
+	return plugin.NewRegistry(config.Plugins{}, clusterTypes, codeTypes)
+}
+
+func makeCluster(t *testing.T) (*lang.Cluster, func()) {
+	t.Helper()
+
+	workDir, err := ioutil.TempDir("", "aptomi-local")
+	if !assert.NoError(t, err, "Temp dir should be created") {
+		t.FailNow()
+	}
+
+	cluster := &lang.Cluster{
+		TypeKind: lang.TypeCluster.GetTypeKind(),
+		Metadata: lang.Metadata{
+			Namespace: "system",
+			Name:      "cluster-local",
+		},
+		Type:   "local",
+		Config: map[string]string{"workdir": workDir},
+	}
+	return cluster, func() {
+		os.RemoveAll(workDir) // nolint: errcheck
+	}
+}
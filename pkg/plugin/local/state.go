@@ -0,0 +1,111 @@
+package local
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/util"
+	"gopkg.in/yaml.v2"
+)
+
+// processRecord is a process, which has been started by the plugin. Identity is recorded along with PID, so that
+// another process, which has got the same PID after the recorded one has exited, isn't mistaken for it
+type processRecord struct {
+	PID       int
+	Identity  string
+	Params    util.NestedParameterMap
+	StartedAt time.Time
+}
+
+// processStore keeps records of started processes in a file in the work dir of the cluster, so they are not lost
+// when Aptomi server gets restarted
+type processStore struct {
+	path string
+	mu   *sync.Mutex
+}
+
+var (
+	storeLocksMu sync.Mutex
+	storeLocks   = make(map[string]*sync.Mutex)
+)
+
+func newProcessStore(workDir string) *processStore {
+	path := filepath.Join(workDir, "processes.yaml")
+
+	// all plugin instances working with the same store share a lock
+	storeLocksMu.Lock()
+	defer storeLocksMu.Unlock()
+	lock, exist := storeLocks[path]
+	if !exist {
+		lock = &sync.Mutex{}
+		storeLocks[path] = lock
+	}
+
+	return &processStore{
+		path: path,
+		mu:   lock,
+	}
+}
+
+// update loads process records, calls the given function to modify them and saves them back
+func (store *processStore) update(fn func(records map[string]*processRecord) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	records, err := store.load()
+	if err != nil {
+		return err
+	}
+	err = fn(records)
+	if err != nil {
+		return err
+	}
+	return store.save(records)
+}
+
+// get returns all process records
+func (store *processStore) get() (map[string]*processRecord, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.load()
+}
+
+func (store *processStore) load() (map[string]*processRecord, error) {
+	records := make(map[string]*processRecord)
+	data, err := ioutil.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading process records from %s: %s", store.path, err)
+	}
+	err = yaml.Unmarshal(data, &records)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshalling process records from %s: %s", store.path, err)
+	}
+	return records, nil
+}
+
+func (store *processStore) save(records map[string]*processRecord) error {
+	data, err := yaml.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("error while marshalling process records: %s", err)
+	}
+
+	// write into temp file first and then rename it, so records don't get corrupted if server crashes
+	tmpPath := store.path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("error while writing process records into %s: %s", tmpPath, err)
+	}
+	err = os.Rename(tmpPath, store.path)
+	if err != nil {
+		return fmt.Errorf("error while renaming %s into %s: %s", tmpPath, store.path, err)
+	}
+	return nil
+}
@@ -29,10 +29,13 @@ func (status Resources) Merge(with Resources) {
 // ResourceTypeHandler represents function that converts object into columns
 type ResourceTypeHandler func(obj interface{}) []string
 
-// ResourceRegistry helps to store and use handlers and headers for resources
+// ResourceRegistry helps to store and use handlers and headers for resources. Resource types without registered
+// handler are handled by the default handler, if it's set
 type ResourceRegistry struct {
-	headers  map[string][]string
-	handlers map[string]ResourceTypeHandler
+	headers        map[string][]string
+	handlers       map[string]ResourceTypeHandler
+	defaultHeaders []string
+	defaultHandler ResourceTypeHandler
 }
 
 // NewResourceRegistry creates new ResourceRegistry
@@ -53,18 +56,31 @@ func (reg *ResourceRegistry) AddHandler(resourceType string, headers []string, h
 	reg.handlers[resourceType] = handler
 }
 
+// SetDefaultHandler sets handler with specified headers, which is used for all resource types without registered
+// handler
+func (reg *ResourceRegistry) SetDefaultHandler(headers []string, handler ResourceTypeHandler) {
+	reg.defaultHeaders = headers
+	reg.defaultHandler = handler
+}
+
 // IsSupported checks if specified resource type supported by registry
 func (reg *ResourceRegistry) IsSupported(resourceType string) bool {
 	_, ok := reg.headers[resourceType]
-	return ok
+	return ok || reg.defaultHandler != nil
 }
 
 // Headers returns headers for specified resource type
 func (reg *ResourceRegistry) Headers(resourceType string) []string {
-	return reg.headers[resourceType]
+	if headers, ok := reg.headers[resourceType]; ok {
+		return headers
+	}
+	return reg.defaultHeaders
 }
 
 // Handle returns columns for specified object with specified resource type
 func (reg *ResourceRegistry) Handle(resourceType string, obj interface{}) []string {
-	return reg.handlers[resourceType](obj)
+	if handler, ok := reg.handlers[resourceType]; ok {
+		return handler(obj)
+	}
+	return reg.defaultHandler(obj)
 }
@@ -0,0 +1,29 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceRegistryDefaultHandler(t *testing.T) {
+	reg := NewResourceRegistry()
+	reg.AddHandler("test/Known", []string{"Name", "Value"}, func(obj interface{}) []string {
+		return []string{"known", obj.(string)}
+	})
+
+	if !assert.False(t, reg.IsSupported("test/Unknown"), "Unknown resource type should not be supported without default handler") {
+		t.FailNow()
+	}
+
+	reg.SetDefaultHandler([]string{"Name"}, func(obj interface{}) []string {
+		return []string{obj.(string)}
+	})
+
+	assert.True(t, reg.IsSupported("test/Known"), "Registered resource type should be supported")
+	assert.True(t, reg.IsSupported("test/Unknown"), "Unknown resource type should be supported by default handler")
+	assert.Equal(t, []string{"Name", "Value"}, reg.Headers("test/Known"), "Registered headers should be returned")
+	assert.Equal(t, []string{"Name"}, reg.Headers("test/Unknown"), "Default headers should be returned for unknown resource type")
+	assert.Equal(t, []string{"known", "x"}, reg.Handle("test/Known", "x"), "Registered handler should be used")
+	assert.Equal(t, []string{"y"}, reg.Handle("test/Unknown", "y"), "Default handler should be used for unknown resource type")
+}
@@ -0,0 +1,18 @@
+package plugin
+
+import "fmt"
+
+// RolledBackError is returned by code plugins from Update, when update has failed (or updated deployment hasn't
+// become ready in time) and deployment has been rolled back to its previous good revision. Deployment keeps running
+// with the previous params in that case
+type RolledBackError struct {
+	// Reason is the error, which has caused rollback
+	Reason error
+
+	// Revision is the revision deployment has been rolled back to
+	Revision string
+}
+
+func (err *RolledBackError) Error() string {
+	return fmt.Sprintf("update failed and has been rolled back to revision %s: %s", err.Revision, err.Reason)
+}
@@ -0,0 +1,99 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/Aptomi/aptomi/pkg/event"
+)
+
+// maxErrorOutput is how many last lines of terraform output are included into errors
+const maxErrorOutput = 20
+
+// silentCommands are terraform commands, which output is never logged, as it contains values of variables and
+// outputs, including sensitive ones
+var silentCommands = map[string]bool{
+	"output": true,
+	"show":   true,
+}
+
+// commandResult is a result of a terraform command
+type commandResult struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+// terraform runs terraform command in the workspace. Non-zero exit code is returned as an error, unless it's listed
+// in allowedExitCodes
+func (p *Plugin) terraform(ws *workspace, eventLog *event.Log, allowedExitCodes []int, args ...string) (*commandResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	args = append(args, "-no-color")
+	cmd := exec.CommandContext(ctx, p.binary, args...) // nolint: gas
+	cmd.Dir = ws.dir
+	cmd.Env = append(os.Environ(), "TF_IN_AUTOMATION=1", "TF_INPUT=0")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	command := "terraform " + strings.Join(args, " ")
+	eventLog.NewEntry().Debugf("Running '%s' in %s", command, ws.dir)
+
+	err := cmd.Run()
+	result := &commandResult{
+		stdout: stdout.String(),
+		stderr: stderr.String(),
+	}
+	if err != nil {
+		exitErr, isExitErr := err.(*exec.ExitError)
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("'%s' didn't finish in %s", command, p.timeout)
+		}
+		if !isExitErr {
+			return nil, fmt.Errorf("error while running '%s': %s", command, err)
+		}
+		result.exitCode = exitErr.Sys().(syscall.WaitStatus).ExitStatus()
+		for _, code := range allowedExitCodes {
+			if code == result.exitCode {
+				return result, nil
+			}
+		}
+		output := result.stderr
+		if !silentCommands[args[0]] {
+			output += result.stdout
+		}
+		return nil, fmt.Errorf("'%s' failed with exit code %d: %s", command, result.exitCode, lastLines(output, maxErrorOutput))
+	}
+
+	if !silentCommands[args[0]] {
+		for _, line := range strings.Split(strings.TrimSpace(result.stdout), "\n") {
+			if len(line) > 0 {
+				eventLog.NewEntry().Debugf("[terraform] %s", line)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// lastLines returns last n non-empty lines of the given text joined into a single line
+func lastLines(text string, n int) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "; ")
+}
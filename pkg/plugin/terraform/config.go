@@ -0,0 +1,144 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// moduleName is a name of the module block, which wraps the module from code params in the generated root module
+const moduleName = "component"
+
+// moduleParams are code params of a Terraform deployment
+type moduleParams struct {
+	// source is a module source in any form supported by Terraform (local path, registry, git, etc)
+	source string
+
+	// version is a module version, only applicable to modules from Terraform registry
+	version string
+
+	// variables are input variables of the module
+	variables map[string]interface{}
+}
+
+// parseModuleParams parses code params of a Terraform deployment. Supported params are "source" (module source,
+// mandatory), "version" (module version for registry modules) and "variables" (map of module input variables)
+func parseModuleParams(params util.NestedParameterMap) (*moduleParams, error) {
+	result := &moduleParams{
+		variables: make(map[string]interface{}),
+	}
+
+	source, ok := params["source"].(string)
+	if !ok || len(source) <= 0 {
+		return nil, fmt.Errorf("source is a mandatory parameter")
+	}
+	result.source = source
+
+	if version, exist := params["version"]; exist {
+		result.version = fmt.Sprintf("%v", version)
+	}
+
+	if variables, exist := params["variables"]; exist {
+		variablesMap, isMap := variables.(util.NestedParameterMap)
+		if !isMap {
+			return nil, fmt.Errorf("variables should be a map, but found: %T", variables)
+		}
+		for name, value := range variablesMap {
+			if name == "source" || name == "version" || name == "providers" || name == "count" || name == "depends_on" {
+				return nil, fmt.Errorf("variable name %s is reserved by Terraform", name)
+			}
+			result.variables[name] = escapeValue(value)
+		}
+	}
+
+	return result, nil
+}
+
+// rootModule generates JSON configuration of the root module, which calls the module from code params and exposes
+// all of its outputs as a single output
+func (params *moduleParams) rootModule() ([]byte, error) {
+	module := map[string]interface{}{
+		"source": params.source,
+	}
+	if len(params.version) > 0 {
+		module["version"] = params.version
+	}
+	for name, value := range params.variables {
+		module[name] = value
+	}
+
+	root := map[string]interface{}{
+		"module": map[string]interface{}{
+			moduleName: module,
+		},
+		"output": map[string]interface{}{
+			moduleName: map[string]interface{}{
+				"value": "${module." + moduleName + "}",
+				// outputs of the module may be sensitive, so the output referring to all of them has to be marked too
+				"sensitive": true,
+			},
+		},
+	}
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error while generating root module: %s", err)
+	}
+	return data, nil
+}
+
+// escapeValue escapes all strings in the given value, so Terraform doesn't treat them as templates
+func escapeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(v)
+	case util.NestedParameterMap:
+		result := make(map[string]interface{})
+		for key, item := range v {
+			result[key] = escapeValue(item)
+		}
+		return result
+	case []interface{}:
+		result := []interface{}{}
+		for _, item := range v {
+			result = append(result, escapeValue(item))
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// sensitiveOutputs returns names of the module outputs, which are marked as sensitive, from JSON representation of
+// the plan (output of terraform show -json)
+func sensitiveOutputs(plan string) ([]string, error) {
+	parsed := struct {
+		Configuration struct {
+			RootModule struct {
+				ModuleCalls map[string]struct {
+					Module struct {
+						Outputs map[string]struct {
+							Sensitive bool `json:"sensitive"`
+						} `json:"outputs"`
+					} `json:"module"`
+				} `json:"module_calls"`
+			} `json:"root_module"`
+		} `json:"configuration"`
+	}{}
+	err := json.Unmarshal([]byte(plan), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing terraform plan: %s", err)
+	}
+
+	result := []string{}
+	for name, output := range parsed.Configuration.RootModule.ModuleCalls[moduleName].Module.Outputs {
+		if output.Sensitive {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
@@ -0,0 +1,4 @@
+// Package terraform implements support for Terraform code plugin, which provisions cloud resources (e.g. buckets or
+// managed databases) next to components running in clusters. Every deployment gets its own Terraform workspace with
+// local state kept by Aptomi, and Terraform outputs are exposed as component endpoints.
+package terraform
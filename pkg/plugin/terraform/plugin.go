@@ -0,0 +1,389 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// planFile is a file in the workspace, where plan gets saved before it's applied
+const planFile = "tfplan"
+
+// Plugin represents Terraform code plugin. Terraform doesn't deploy anything into the cluster itself, cluster is only
+// used to keep deployments from different clusters apart. Terraform state of deployments is kept in Aptomi store
+type Plugin struct {
+	cluster *lang.Cluster
+	store   plugin.DataStore
+	binary  string
+	workDir string
+	timeout time.Duration
+}
+
+var _ plugin.CodePlugin = &Plugin{}
+
+// New returns new instance of the Terraform code plugin for specified cluster and plugins config, which keeps data of
+// deployments in the given store
+func New(cluster *lang.Cluster, cfg config.Plugins, store plugin.DataStore) (plugin.CodePlugin, error) {
+	p := &Plugin{
+		cluster: cluster,
+		store:   store,
+		binary:  cfg.Terraform.Binary,
+		workDir: cfg.Terraform.WorkDir,
+		timeout: cfg.Terraform.Timeout,
+	}
+	if len(p.binary) <= 0 {
+		p.binary = "terraform"
+	}
+	if len(p.workDir) <= 0 {
+		// workspaces only cache modules and providers, so they don't have to survive server restarts
+		p.workDir = filepath.Join(os.TempDir(), "aptomi-terraform")
+	}
+	if p.timeout <= 0 {
+		p.timeout = 30 * time.Minute
+	}
+	return p, nil
+}
+
+// Cleanup implements cleanup phase for the Terraform plugin
+func (p *Plugin) Cleanup() error {
+	return nil
+}
+
+// Create runs plan and apply in a new workspace of the deployment
+func (p *Plugin) Create(invocation *plugin.CodePluginInvocationParams) error {
+	return p.apply(invocation)
+}
+
+// Update runs plan and apply in the workspace of the deployment with updated params
+func (p *Plugin) Update(invocation *plugin.CodePluginInvocationParams) error {
+	return p.apply(invocation)
+}
+
+// Destroy destroys all resources of the deployment and removes its data and workspace
+func (p *Plugin) Destroy(invocation *plugin.CodePluginInvocationParams) error {
+	ws, err := p.workspaceFor(invocation.DeployName)
+	if err != nil {
+		return err
+	}
+	err = ws.checkState()
+	if err != nil {
+		return err
+	}
+	if !ws.hasState() {
+		return ws.remove()
+	}
+
+	err = ws.prepare(nil)
+	if err != nil {
+		return err
+	}
+	_, err = p.terraform(ws, invocation.EventLog, nil, "init", "-input=false")
+	if err != nil {
+		return err
+	}
+	_, err = p.terraform(ws, invocation.EventLog, nil, "destroy", "-auto-approve", "-input=false")
+	if err != nil {
+		return ws.keepState(err)
+	}
+
+	invocation.EventLog.NewEntry().Infof("Terraform resources of %s destroyed", invocation.DeployName)
+
+	return ws.remove()
+}
+
+// Move moves Terraform state of the deployment to the new deploy name, so resources are not re-created
+func (p *Plugin) Move(from *plugin.CodePluginInvocationParams, to *plugin.CodePluginInvocationParams) error {
+	fromWs, err := p.workspaceFor(from.DeployName)
+	if err != nil {
+		return err
+	}
+	toWs, err := p.workspaceFor(to.DeployName)
+	if err != nil {
+		return err
+	}
+
+	record, err := fromWs.record()
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("terraform deployment %s not found", from.DeployName)
+	}
+	if len(toWs.data) > 0 {
+		return fmt.Errorf("terraform deployment %s already exists", to.DeployName)
+	}
+
+	toWs.data = fromWs.data
+	record.DeployName = to.DeployName
+	err = toWs.save(record)
+	if err != nil {
+		return err
+	}
+	err = fromWs.remove()
+	if err != nil {
+		return err
+	}
+
+	to.EventLog.NewEntry().Infof("Terraform state moved from %s to %s", from.DeployName, to.DeployName)
+	return nil
+}
+
+// Endpoints returns Terraform outputs of the module. String outputs are returned as is and all other outputs are
+// returned encoded as JSON. Values of sensitive outputs are masked
+func (p *Plugin) Endpoints(invocation *plugin.CodePluginInvocationParams) (map[string]string, error) {
+	ws, err := p.workspaceFor(invocation.DeployName)
+	if err != nil {
+		return nil, err
+	}
+	err = ws.checkState()
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make(map[string]string)
+	if !ws.hasState() {
+		return endpoints, nil
+	}
+	record, err := ws.record()
+	if err != nil {
+		return nil, err
+	}
+	sensitive := make(map[string]bool)
+	if record != nil {
+		for _, name := range record.SensitiveOutputs {
+			sensitive[name] = true
+		}
+	}
+
+	err = ws.prepare(nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := p.terraform(ws, invocation.EventLog, nil, "output", "-json")
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make(map[string]struct {
+		Value interface{} `json:"value"`
+	})
+	err = json.Unmarshal([]byte(result.stdout), &outputs)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing terraform outputs of %s: %s", invocation.DeployName, err)
+	}
+
+	values, ok := outputs[moduleName].Value.(map[string]interface{})
+	if !ok {
+		return endpoints, nil
+	}
+	for name, value := range values {
+		if sensitive[name] {
+			endpoints[name] = util.MaskedValue
+			continue
+		}
+		if str, isString := value.(string); isString {
+			endpoints[name] = str
+			continue
+		}
+		data, marshalErr := json.Marshal(value)
+		if marshalErr != nil {
+			return nil, fmt.Errorf("error while encoding terraform output %s of %s: %s", name, invocation.DeployName, marshalErr)
+		}
+		endpoints[name] = string(data)
+	}
+	return endpoints, nil
+}
+
+// Resources returns all resources in Terraform state of the deployment
+func (p *Plugin) Resources(invocation *plugin.CodePluginInvocationParams) (plugin.Resources, error) {
+	table := &plugin.ResourceTable{
+		Headers: []string{"Address", "Type", "Name"},
+		Items:   []plugin.Resource{},
+	}
+
+	ws, err := p.workspaceFor(invocation.DeployName)
+	if err != nil {
+		return nil, err
+	}
+	err = ws.checkState()
+	if err != nil {
+		return nil, err
+	}
+	if ws.hasState() {
+		err = ws.prepare(nil)
+		if err != nil {
+			return nil, err
+		}
+		result, err := p.terraform(ws, invocation.EventLog, nil, "state", "list")
+		if err != nil {
+			return nil, err
+		}
+		for _, address := range strings.Split(result.stdout, "\n") {
+			address = strings.TrimSpace(address)
+			if len(address) <= 0 {
+				continue
+			}
+			address = strings.TrimPrefix(address, "module."+moduleName+".")
+			parts := strings.Split(address, ".")
+			if len(parts) < 2 {
+				continue
+			}
+			table.Items = append(table.Items, plugin.Resource{address, parts[len(parts)-2], parts[len(parts)-1]})
+		}
+	}
+
+	return plugin.Resources{"terraform": table}, nil
+}
+
+// Status returns true if the deployment has been successfully applied, as apply waits for all resources to be created
+func (p *Plugin) Status(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	ws, err := p.workspaceFor(invocation.DeployName)
+	if err != nil {
+		return false, err
+	}
+	record, err := ws.record()
+	if err != nil {
+		return false, err
+	}
+	return record != nil, nil
+}
+
+// Drift compares applied params with the given params and checks that Terraform plan has no changes
+func (p *Plugin) Drift(invocation *plugin.CodePluginInvocationParams) (string, error) {
+	ws, err := p.workspaceFor(invocation.DeployName)
+	if err != nil {
+		return "", err
+	}
+	record, err := ws.record()
+	if err != nil {
+		return "", err
+	}
+	if record == nil {
+		return fmt.Sprintf("terraform deployment %s not found", invocation.DeployName), nil
+	}
+	if !record.Params.DeepEqual(invocation.Params) {
+		return fmt.Sprintf("terraform module for %s has been applied with different params: %s", invocation.DeployName, record.Params.Diff(invocation.Params)), nil
+	}
+
+	// workspace may have been re-created since the deployment has been applied, so it has to be initialized again
+	err = ws.prepare(nil)
+	if err != nil {
+		return "", err
+	}
+	_, err = p.terraform(ws, invocation.EventLog, nil, "init", "-input=false")
+	if err != nil {
+		return "", err
+	}
+
+	// exit code 2 means that plan succeeded, but there are changes to apply
+	result, err := p.terraform(ws, invocation.EventLog, []int{2}, "plan", "-input=false", "-detailed-exitcode", "-lock=false")
+	if err != nil {
+		return "", err
+	}
+	if result.exitCode == 2 {
+		summary := "resources have been changed outside of Aptomi"
+		for _, line := range strings.Split(result.stdout, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "Plan:") {
+				summary = strings.TrimSpace(line)
+			}
+		}
+		return fmt.Sprintf("terraform plan for %s is not empty: %s", invocation.DeployName, summary), nil
+	}
+
+	return "", nil
+}
+
+// Exists returns true if the deployment has Terraform state or the deployment has been applied
+func (p *Plugin) Exists(invocation *plugin.CodePluginInvocationParams) (bool, error) {
+	ws, err := p.workspaceFor(invocation.DeployName)
+	if err != nil {
+		return false, err
+	}
+	record, err := ws.record()
+	if err != nil {
+		return false, err
+	}
+	return record != nil || ws.hasState(), nil
+}
+
+// Deployments returns all deployments applied by the plugin in the cluster
+func (p *Plugin) Deployments(eventLog *event.Log) ([]*plugin.Deployment, error) {
+	records, err := p.records()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*plugin.Deployment{}
+	for _, record := range records {
+		result = append(result, &plugin.Deployment{
+			DeployName: record.DeployName,
+			Params:     record.Params,
+		})
+	}
+	return result, nil
+}
+
+// apply generates root module in the workspace of the deployment, initializes it, runs plan and applies it. Terraform
+// state is saved into Aptomi store after apply, even if it has failed
+func (p *Plugin) apply(invocation *plugin.CodePluginInvocationParams) error {
+	params, err := parseModuleParams(invocation.Params)
+	if err != nil {
+		return err
+	}
+
+	// never run apply without the state of already applied deployment, as it would create all resources again
+	ws, err := p.workspaceFor(invocation.DeployName)
+	if err != nil {
+		return err
+	}
+	err = ws.checkState()
+	if err != nil {
+		return err
+	}
+	err = ws.prepare(params)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.terraform(ws, invocation.EventLog, nil, "init", "-input=false")
+	if err != nil {
+		return err
+	}
+	_, err = p.terraform(ws, invocation.EventLog, nil, "plan", "-input=false", "-out="+planFile)
+	if err != nil {
+		return err
+	}
+	plan, err := p.terraform(ws, invocation.EventLog, nil, "show", "-json", planFile)
+	if err != nil {
+		return err
+	}
+	sensitive, err := sensitiveOutputs(plan.stdout)
+	if err != nil {
+		return err
+	}
+	_, err = p.terraform(ws, invocation.EventLog, nil, "apply", "-input=false", planFile)
+	if err != nil {
+		return ws.keepState(err)
+	}
+
+	invocation.EventLog.NewEntry().Infof("Terraform module %s applied for %s", params.source, invocation.DeployName)
+
+	err = ws.collectState()
+	if err != nil {
+		return err
+	}
+	return ws.save(&deploymentRecord{
+		DeployName:       invocation.DeployName,
+		Params:           invocation.Params,
+		AppliedAt:        time.Now(),
+		SensitiveOutputs: sensitive,
+	})
+}
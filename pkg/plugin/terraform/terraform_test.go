@@ -0,0 +1,285 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/plugin/external/conformance"
+	"github.com/Aptomi/aptomi/pkg/plugin/fake"
+	"github.com/Aptomi/aptomi/pkg/plugin/local"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// testModule is a module, which only uses local providers, so it doesn't need any cloud credentials
+const testModule = `
+variable "content" {}
+variable "path" {}
+
+resource "local_file" "file" {
+  content  = var.content
+  filename = var.path
+}
+
+resource "null_resource" "trigger" {
+  triggers = {
+    content = var.content
+  }
+}
+
+output "path" {
+  value = local_file.file.filename
+}
+
+output "content" {
+  value     = var.content
+  sensitive = true
+}
+
+output "triggers" {
+  value = null_resource.trigger.triggers
+}
+`
+
+func TestModuleParams(t *testing.T) {
+	params, err := parseModuleParams(util.NestedParameterMap{
+		"source":  "terraform-aws-modules/s3-bucket/aws",
+		"version": "1.0.0",
+		"variables": util.NestedParameterMap{
+			"bucket": "bucket-${name}",
+			"tags":   util.NestedParameterMap{"owner": "%{user}"},
+		},
+	})
+	if !assert.NoError(t, err, "Params should be parsed") {
+		t.FailNow()
+	}
+
+	data, err := params.rootModule()
+	if !assert.NoError(t, err, "Root module should be generated") {
+		t.FailNow()
+	}
+	root := make(map[string]interface{})
+	if !assert.NoError(t, json.Unmarshal(data, &root), "Root module should be valid JSON") {
+		t.FailNow()
+	}
+	module := root["module"].(map[string]interface{})[moduleName].(map[string]interface{})
+	assert.Equal(t, "terraform-aws-modules/s3-bucket/aws", module["source"], "Module source should be set")
+	assert.Equal(t, "1.0.0", module["version"], "Module version should be set")
+	assert.Equal(t, "bucket-$${name}", module["bucket"], "Template sequences in variables should be escaped")
+	assert.Equal(t, map[string]interface{}{"owner": "%%{user}"}, module["tags"], "Template sequences in nested variables should be escaped")
+	assert.Equal(t, "${module.component}", root["output"].(map[string]interface{})[moduleName].(map[string]interface{})["value"], "Module outputs should be exposed")
+
+	_, err = parseModuleParams(util.NestedParameterMap{"variables": util.NestedParameterMap{}})
+	assert.Error(t, err, "Params without source should be rejected")
+	_, err = parseModuleParams(util.NestedParameterMap{"source": "./module", "variables": "value"})
+	assert.Error(t, err, "Variables which are not a map should be rejected")
+	_, err = parseModuleParams(util.NestedParameterMap{"source": "./module", "variables": util.NestedParameterMap{"count": 2}})
+	assert.Error(t, err, "Reserved variable names should be rejected")
+}
+
+func TestSensitiveOutputs(t *testing.T) {
+	sensitive, err := sensitiveOutputs(`{
+		"configuration": {
+			"root_module": {
+				"outputs": {"component": {"sensitive": true}},
+				"module_calls": {
+					"component": {
+						"module": {
+							"outputs": {
+								"path": {"expression": {"references": ["local_file.file"]}},
+								"password": {"sensitive": true},
+								"key": {"sensitive": true}
+							}
+						}
+					}
+				}
+			}
+		}
+	}`)
+	if !assert.NoError(t, err, "Plan should be parsed") {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"key", "password"}, sensitive, "Only sensitive outputs of the module should be returned")
+
+	_, err = sensitiveOutputs("not a plan")
+	assert.Error(t, err, "Invalid plan should be rejected")
+}
+
+func TestTerraformPluginConformance(t *testing.T) {
+	dir, cleanup := prepareTest(t)
+	defer cleanup()
+
+	suite := &conformance.Suite{
+		Registry:      makeRegistry(dir, fake.NewDataStore()),
+		Cluster:       makeCluster(dir),
+		CodeType:      "terraform",
+		Params:        makeParams(dir, "created"),
+		UpdatedParams: makeParams(dir, "updated"),
+		StatusTimeout: 10 * time.Second,
+	}
+	suite.Run(t)
+}
+
+func TestTerraformPlugin(t *testing.T) {
+	dir, cleanup := prepareTest(t)
+	defer cleanup()
+
+	cluster := makeCluster(dir)
+	store := fake.NewDataStore()
+	codePlugin, err := makeRegistry(dir, store).ForCodeType(cluster, "terraform")
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+
+	invocation := &plugin.CodePluginInvocationParams{
+		DeployName: "test-terraform",
+		Params:     makeParams(dir, "hello"),
+		EventLog:   event.NewLog(logrus.DebugLevel, "test-terraform"),
+	}
+	if !assert.NoError(t, codePlugin.Create(invocation), "Module should be applied") {
+		t.FailNow()
+	}
+	defer codePlugin.Destroy(invocation) // nolint: errcheck
+
+	endpoints, err := codePlugin.Endpoints(invocation)
+	assert.NoError(t, err, "Endpoints should be returned")
+	assert.Equal(t, map[string]string{
+		"path":     filepath.Join(dir, "output.txt"),
+		"content":  util.MaskedValue,
+		"triggers": `{"content":"hello"}`,
+	}, endpoints, "Module outputs should be returned as endpoints with sensitive ones masked")
+	for _, entry := range invocation.EventLog.AsAPIEvents() {
+		assert.NotContains(t, entry.Message, `"sensitive"`, "Output of terraform output and show should not be logged")
+	}
+
+	// state is kept in Aptomi store, so workspace is re-created by another instance of the plugin
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "workspaces")), "Workspaces should be removed")
+	codePlugin, err = makeRegistry(dir, store).ForCodeType(cluster, "terraform")
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+	endpoints, err = codePlugin.Endpoints(invocation)
+	assert.NoError(t, err, "Endpoints should be returned from the restored state")
+	assert.Equal(t, filepath.Join(dir, "output.txt"), endpoints["path"], "Outputs should be returned from the restored state")
+
+	resources, err := codePlugin.Resources(invocation)
+	if !assert.NoError(t, err, "Resources should be returned") || !assert.Equal(t, 2, len(resources["terraform"].Items), "All resources should be returned") {
+		t.FailNow()
+	}
+	assert.Equal(t, plugin.Resource{"local_file.file", "local_file", "file"}, resources["terraform"].Items[0], "Resource should be returned without module prefix")
+
+	// resources changed outside of Aptomi are reported as drift
+	assert.NoError(t, os.Remove(filepath.Join(dir, "output.txt")), "Output file should be removed")
+	drift, err := codePlugin.Drift(invocation)
+	assert.NoError(t, err, "Drift should be returned")
+	assert.Contains(t, drift, "terraform plan for test-terraform is not empty", "Removed file should be reported as drifted")
+}
+
+func TestTerraformPluginMissingState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aptomi-terraform")
+	if !assert.NoError(t, err, "Temp dir should be created") {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	codePlugin, err := New(makeCluster(dir), config.Plugins{Terraform: config.Terraform{WorkDir: dir}}, fake.NewDataStore())
+	if !assert.NoError(t, err, "Code plugin should be created") {
+		t.FailNow()
+	}
+
+	// deployment has been applied, but its state is lost
+	invocation := &plugin.CodePluginInvocationParams{
+		DeployName: "test-terraform",
+		Params:     makeParams(dir, "hello"),
+		EventLog:   event.NewLog(logrus.WarnLevel, "test-terraform"),
+	}
+	ws, err := codePlugin.(*Plugin).workspaceFor(invocation.DeployName)
+	if !assert.NoError(t, err, "Workspace should be loaded") {
+		t.FailNow()
+	}
+	if !assert.NoError(t, ws.save(&deploymentRecord{DeployName: invocation.DeployName, Params: invocation.Params}), "Record should be saved") {
+		t.FailNow()
+	}
+
+	assert.Error(t, codePlugin.Update(invocation), "Deployment without state should not be updated")
+	assert.Error(t, codePlugin.Destroy(invocation), "Deployment without state should not be destroyed")
+	exists, err := codePlugin.Exists(invocation)
+	assert.NoError(t, err, "Exists should succeed")
+	assert.True(t, exists, "Record should be kept if deployment wasn't destroyed")
+	deployments, err := codePlugin.Deployments(invocation.EventLog)
+	assert.NoError(t, err, "Deployments should be returned")
+	assert.Equal(t, []*plugin.Deployment{{DeployName: invocation.DeployName, Params: invocation.Params}}, deployments, "Deployment should be listed from the store")
+}
+
+// prepareTest skips the test if terraform isn't installed and creates a dir with test module in it
+func prepareTest(t *testing.T) (string, func()) {
+	t.Helper()
+
+	if _, err := exec.LookPath("terraform"); err != nil {
+		t.Skip("terraform isn't installed")
+	}
+
+	dir, err := ioutil.TempDir("", "aptomi-terraform")
+	if !assert.NoError(t, err, "Temp dir should be created") {
+		t.FailNow()
+	}
+	moduleDir := filepath.Join(dir, "module")
+	if !assert.NoError(t, os.MkdirAll(moduleDir, 0755), "Module dir should be created") {
+		t.FailNow()
+	}
+	if !assert.NoError(t, ioutil.WriteFile(filepath.Join(moduleDir, "main.tf"), []byte(testModule), 0644), "Module should be written") {
+		t.FailNow()
+	}
+
+	return dir, func() {
+		os.RemoveAll(dir) // nolint: errcheck
+	}
+}
+
+func makeParams(dir string, content string) util.NestedParameterMap {
+	return util.NestedParameterMap{
+		"source": filepath.Join(dir, "module"),
+		"variables": util.NestedParameterMap{
+			"content": content,
+			"path":    filepath.Join(dir, "output.txt"),
+		},
+	}
+}
+
+func makeRegistry(dir string, store plugin.DataStore) plugin.Registry {
+	cfg := config.Plugins{Terraform: config.Terraform{WorkDir: filepath.Join(dir, "workspaces")}}
+	clusterTypes := map[string]plugin.ClusterPluginConstructor{"local": local.New}
+	codeTypes := map[string]map[string]plugin.CodePluginConstructor{"local": {
+		"terraform": func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+			localCluster, ok := cluster.(*local.Plugin)
+			if !ok {
+				return nil, fmt.Errorf("unexpected cluster plugin: %T", cluster)
+			}
+			return New(localCluster.Cluster, cfg, store)
+		},
+	}}
+	return plugin.NewRegistry(cfg, clusterTypes, codeTypes)
+}
+
+func makeCluster(dir string) *lang.Cluster {
+	return &lang.Cluster{
+		TypeKind: lang.TypeCluster.GetTypeKind(),
+		Metadata: lang.Metadata{
+			Namespace: "system",
+			Name:      "cluster-terraform",
+		},
+		Type:   "local",
+		Config: map[string]string{"workdir": filepath.Join(dir, "local")},
+	}
+}
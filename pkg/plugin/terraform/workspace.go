@@ -0,0 +1,215 @@
+package terraform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// recordFile is a file in plugin data, where deployment record is kept
+	recordFile = "aptomi.yaml"
+
+	// rootModuleFile is a file in the workspace, where generated root module is kept
+	rootModuleFile = "main.tf.json"
+
+	// stateFile is a file in the workspace, where Terraform keeps its state (default path of the local backend)
+	stateFile = "terraform.tfstate"
+)
+
+// deploymentRecord is a deployment, which has been successfully applied by the plugin
+type deploymentRecord struct {
+	DeployName string
+	Params     util.NestedParameterMap
+	AppliedAt  time.Time
+
+	// SensitiveOutputs are names of the module outputs, which are marked as sensitive, so they are never exposed
+	SensitiveOutputs []string
+}
+
+// workspace is a directory, where Terraform commands of a single deployment are run. Generated root module,
+// Terraform state and deployment record are kept in Aptomi store, root module and state get written into the
+// workspace before commands are run and state gets saved back after commands which change it. So the directory
+// itself only caches modules and providers downloaded by terraform init
+type workspace struct {
+	dir      string
+	dataName string
+	store    plugin.DataStore
+	data     map[string]string
+}
+
+// workspaceFor returns workspace of the given deployment with its data loaded from Aptomi store
+func (p *Plugin) workspaceFor(deployName string) (*workspace, error) {
+	ws := &workspace{
+		dir:      filepath.Join(p.workDir, util.EscapeName(p.cluster.Name), util.EscapeName(deployName)),
+		dataName: p.dataPrefix() + util.EscapeName(deployName),
+		store:    p.store,
+	}
+
+	data, err := ws.store.LoadPluginData(ws.dataName)
+	if err != nil {
+		return nil, err
+	}
+	ws.data = data
+	if ws.data == nil {
+		ws.data = make(map[string]string)
+	}
+	return ws, nil
+}
+
+// dataPrefix returns prefix of names of plugin data of all deployments in the cluster
+func (p *Plugin) dataPrefix() string {
+	return "terraform." + util.EscapeName(p.cluster.Name) + "."
+}
+
+// records returns records of all deployments applied in the cluster
+func (p *Plugin) records() ([]*deploymentRecord, error) {
+	found, err := p.store.FindPluginData(p.dataPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*deploymentRecord{}
+	for name, data := range found {
+		record, recordErr := parseRecord(name, data)
+		if recordErr != nil {
+			return nil, recordErr
+		}
+		if record != nil {
+			result = append(result, record)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DeployName < result[j].DeployName
+	})
+	return result, nil
+}
+
+// prepare creates workspace dir and writes root module and Terraform state into it. Root module gets generated from
+// the given params, or the stored one is used if params are nil
+func (ws *workspace) prepare(params *moduleParams) error {
+	err := os.MkdirAll(ws.dir, 0755)
+	if err != nil {
+		return fmt.Errorf("error while creating workspace %s: %s", ws.dir, err)
+	}
+
+	if params != nil {
+		data, rootErr := params.rootModule()
+		if rootErr != nil {
+			return rootErr
+		}
+		ws.data[rootModuleFile] = string(data)
+	}
+
+	for _, file := range []string{rootModuleFile, stateFile} {
+		path := filepath.Join(ws.dir, file)
+		content, exist := ws.data[file]
+		if !exist {
+			// workspace dir may be left from a deployment, which has been destroyed since then
+			err = os.RemoveAll(path)
+		} else {
+			err = ioutil.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("error while writing %s into workspace %s: %s", file, ws.dir, err)
+		}
+	}
+	return nil
+}
+
+// hasState returns true if Terraform state of the deployment exists
+func (ws *workspace) hasState() bool {
+	_, exist := ws.data[stateFile]
+	return exist
+}
+
+// checkState returns an error if the deployment has been applied, but its Terraform state is missing
+func (ws *workspace) checkState() error {
+	record, err := ws.record()
+	if err != nil {
+		return err
+	}
+	if record != nil && !ws.hasState() {
+		return fmt.Errorf("terraform state of %s is missing in Aptomi store, it has to be restored before deployment can be changed", record.DeployName)
+	}
+	return nil
+}
+
+// record returns deployment record or nil if deployment hasn't been applied yet
+func (ws *workspace) record() (*deploymentRecord, error) {
+	return parseRecord(ws.dataName, ws.data)
+}
+
+// parseRecord parses deployment record from plugin data or returns nil if there is no record in it
+func parseRecord(name string, data map[string]string) (*deploymentRecord, error) {
+	content, exist := data[recordFile]
+	if !exist {
+		return nil, nil
+	}
+
+	record := &deploymentRecord{}
+	err := yaml.Unmarshal([]byte(content), record)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshalling deployment record from %s: %s", name, err)
+	}
+	return record, nil
+}
+
+// collectState reads Terraform state from the workspace dir after it has been changed by a command
+func (ws *workspace) collectState() error {
+	path := filepath.Join(ws.dir, stateFile)
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error while reading terraform state from %s: %s", path, err)
+	}
+	ws.data[stateFile] = string(content)
+	return nil
+}
+
+// save saves root module, Terraform state and the given deployment record (if it's not nil) into Aptomi store
+func (ws *workspace) save(record *deploymentRecord) error {
+	if record != nil {
+		content, err := yaml.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("error while marshalling deployment record: %s", err)
+		}
+		ws.data[recordFile] = string(content)
+	}
+	return ws.store.SavePluginData(ws.dataName, ws.data)
+}
+
+// keepState saves Terraform state after the command has failed, as some resources might have been changed already,
+// and returns the error of the command
+func (ws *workspace) keepState(cmdErr error) error {
+	err := ws.collectState()
+	if err == nil {
+		err = ws.save(nil)
+	}
+	if err != nil {
+		return fmt.Errorf("%s (terraform state hasn't been saved: %s)", cmdErr, err)
+	}
+	return cmdErr
+}
+
+// remove deletes all data of the deployment from Aptomi store and removes the workspace dir
+func (ws *workspace) remove() error {
+	err := ws.store.DeletePluginData(ws.dataName)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(ws.dir)
+	if err != nil {
+		return fmt.Errorf("error while removing workspace %s: %s", ws.dir, err)
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package registry
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/runtime/store"
@@ -24,3 +26,171 @@ func (reg *defaultRegistry) GetActualState() (*resolve.PolicyResolution, error)
 
 	return actualState, nil
 }
+
+// GetActualStateAt returns actual state as it was at the given point in time. It's reconstructed by replaying changes
+// recorded in the epoch of actual state history the given time belongs to on top of the snapshot the epoch has started
+// with
+func (reg *defaultRegistry) GetActualStateAt(at time.Time) (*resolve.PolicyResolution, error) {
+	history, err := reg.loadActualStateHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(history.Epochs) <= 0 {
+		// nothing has been changed since history has started being recorded
+		actualState, stateErr := reg.GetActualState()
+		if stateErr != nil {
+			return nil, stateErr
+		}
+		result := resolve.NewPolicyResolution()
+		for key, instance := range actualState.ComponentInstanceMap {
+			if !instance.CreatedAt.After(at) {
+				result.ComponentInstanceMap[key] = instance
+			}
+		}
+		return result, nil
+	}
+
+	epoch := history.EpochAt(at)
+	if epoch == nil {
+		return nil, fmt.Errorf("actual state history is only retained since %s", history.Epochs[0].StartedAt.Format(time.RFC3339))
+	}
+
+	var snapshot *engine.ActualStateSnapshot
+	err = reg.store.Find(engine.TypeActualStateSnapshot.Kind, &snapshot, store.WithKey(engine.ActualStateSnapshotKey(epoch.Epoch)))
+	if err != nil {
+		return nil, fmt.Errorf("error while getting actual state snapshot %d: %s", epoch.Epoch, err)
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("actual state snapshot %d not found", epoch.Epoch)
+	}
+
+	changes, err := reg.getActualStateChanges(epoch.Epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.ActualStateAt(snapshot, changes, at), nil
+}
+
+// getActualStateChanges returns all changes of actual state recorded in the given epoch
+func (reg *defaultRegistry) getActualStateChanges(epoch uint64) ([]*engine.ActualStateChange, error) {
+	var changes []*engine.ActualStateChange
+	err := reg.store.Find(engine.TypeActualStateChange.Kind, &changes, store.WithKeyPrefix(actualStateChangesPrefix(epoch)))
+	if err != nil {
+		return nil, fmt.Errorf("error while getting actual state changes of epoch %d: %s", epoch, err)
+	}
+	return changes, nil
+}
+
+func actualStateChangesPrefix(epoch uint64) runtime.Key {
+	return runtime.KeyFromParts(runtime.SystemNS, engine.TypeActualStateChange.Kind, engine.ActualStateEpochPrefix(epoch))
+}
+
+func (reg *defaultRegistry) loadActualStateHistory() (*engine.ActualStateHistory, error) {
+	var history *engine.ActualStateHistory
+	err := reg.store.Find(engine.TypeActualStateHistory.Kind, &history, store.WithKey(engine.ActualStateHistoryKey))
+	if err != nil {
+		return nil, fmt.Errorf("error while getting actual state history: %s", err)
+	}
+	if history == nil {
+		history = engine.NewActualStateHistory()
+	}
+	return history, nil
+}
+
+// recordActualStateChange saves the change into the current epoch of actual state history. Once the epoch reaches
+// the configured number of changes, new epoch is started with a snapshot of actual state and the oldest epochs beyond
+// retention limits are pruned. Change of the component instance itself should already be saved at this point
+func (reg *defaultRegistry) recordActualStateChange(change *engine.ActualStateChange) error {
+	// history is shared by all actual state updaters
+	reg.historyLock.Lock()
+	defer reg.historyLock.Unlock()
+
+	history, err := reg.loadActualStateHistory()
+	if err != nil {
+		return err
+	}
+
+	// the very first epoch starts with a snapshot, which already includes the change
+	epoch := history.Current()
+	if epoch == nil {
+		epoch, err = reg.startActualStateEpoch(history)
+		if err != nil {
+			return err
+		}
+	}
+
+	change.Epoch = epoch.Epoch
+	_, err = reg.store.Save(change)
+	if err != nil {
+		return err
+	}
+	epoch.Changes++
+
+	snapshotEvery := reg.historyCfg.SnapshotEvery
+	if snapshotEvery <= 0 {
+		snapshotEvery = defaultSnapshotEvery
+	}
+	if epoch.Changes >= snapshotEvery {
+		_, err = reg.startActualStateEpoch(history)
+		if err != nil {
+			return err
+		}
+
+		for _, pruned := range history.Prune(reg.historyCfg.MaxAge, reg.historyCfg.MaxChanges, time.Now()) {
+			err = reg.deleteActualStateEpoch(pruned.Epoch)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = reg.store.Save(history)
+	if err != nil {
+		return fmt.Errorf("error while saving actual state history: %s", err)
+	}
+
+	return nil
+}
+
+// defaultSnapshotEvery is a number of changes between snapshots of actual state, if it's not configured
+const defaultSnapshotEvery = 100
+
+// startActualStateEpoch starts a new epoch of actual state history and saves a snapshot of actual state for it
+func (reg *defaultRegistry) startActualStateEpoch(history *engine.ActualStateHistory) (*engine.ActualStateEpoch, error) {
+	actualState, err := reg.GetActualState()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := engine.NewActualStateSnapshot(history.StartEpoch(time.Now()).Epoch, actualState)
+	history.Current().StartedAt = snapshot.TakenAt
+	_, err = reg.store.Save(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("error while saving actual state snapshot %d: %s", snapshot.Epoch, err)
+	}
+
+	return history.Current(), nil
+}
+
+// deleteActualStateEpoch deletes the snapshot and all changes of the given epoch of actual state history
+func (reg *defaultRegistry) deleteActualStateEpoch(epoch uint64) error {
+	changes, err := reg.getActualStateChanges(epoch)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		err = reg.store.Delete(engine.TypeActualStateChange.Kind, runtime.KeyForStorable(change))
+		if err != nil {
+			return fmt.Errorf("error while deleting actual state change %s: %s", change.GetName(), err)
+		}
+	}
+
+	err = reg.store.Delete(engine.TypeActualStateSnapshot.Kind, engine.ActualStateSnapshotKey(epoch))
+	if err != nil {
+		return fmt.Errorf("error while deleting actual state snapshot %d: %s", epoch, err)
+	}
+
+	return nil
+}
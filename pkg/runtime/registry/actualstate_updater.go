@@ -2,9 +2,11 @@ package registry
 
 import (
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
+	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/engine/actual"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/runtime"
@@ -13,12 +15,14 @@ import (
 
 func (reg *defaultRegistry) NewActualStateUpdater(actualState *resolve.PolicyResolution) actual.StateUpdater {
 	return &actualStateUpdater{
+		registry:    reg,
 		store:       reg.store,
 		actualState: actualState,
 	}
 }
 
 type actualStateUpdater struct {
+	registry    *defaultRegistry
 	store       store.Interface
 	mutex       sync.Mutex
 	actualState *resolve.PolicyResolution
@@ -49,6 +53,12 @@ func (updater *actualStateUpdater) CreateComponentInstance(instance *resolve.Com
 		return err
 	}
 
+	// record the change in actual state history
+	err = updater.saveChange(engine.NewActualStateChange(engine.ActualStateChangeCreate, instance.GetKey(), nil, instance))
+	if err != nil {
+		return err
+	}
+
 	// move it over to the actual state
 	updater.actualState.ComponentInstanceMap[instance.GetKey()] = instance
 
@@ -61,11 +71,15 @@ func (updater *actualStateUpdater) UpdateComponentInstance(key string, makeChang
 	updater.mutex.Lock()
 	defer updater.mutex.Unlock()
 
-	// load instance from the registry
+	// load instance from the registry (twice, so there is an unmodified copy to record in actual state history)
 	instance, err := updater.loadComponentInstance(key)
 	if err != nil {
 		return err
 	}
+	previous, err := updater.loadComponentInstance(key)
+	if err != nil {
+		return err
+	}
 
 	// update timestamp
 	instance.UpdatedAt = time.Now()
@@ -79,6 +93,14 @@ func (updater *actualStateUpdater) UpdateComponentInstance(key string, makeChang
 		return err
 	}
 
+	// record the change in actual state history, unless only timestamp has been changed (e.g. by periodic checks)
+	if !isSameExceptUpdatedAt(previous, instance) {
+		err = updater.saveChange(engine.NewActualStateChange(engine.ActualStateChangeUpdate, key, previous, instance))
+		if err != nil {
+			return err
+		}
+	}
+
 	// move it over to the actual state
 	updater.actualState.ComponentInstanceMap[instance.GetKey()] = instance
 
@@ -91,8 +113,20 @@ func (updater *actualStateUpdater) DeleteComponentInstance(key string) error {
 	updater.mutex.Lock()
 	defer updater.mutex.Unlock()
 
+	// load instance from the registry, so it can be recorded in actual state history
+	previous, err := updater.loadComponentInstance(key)
+	if err != nil {
+		return err
+	}
+
 	// delete an existing component from the actual state registry
-	err := updater.delete(storableKeyForComponent(key))
+	err = updater.delete(storableKeyForComponent(key))
+	if err != nil {
+		return err
+	}
+
+	// record the change in actual state history
+	err = updater.saveChange(engine.NewActualStateChange(engine.ActualStateChangeDelete, key, previous, nil))
 	if err != nil {
 		return err
 	}
@@ -135,3 +169,24 @@ func (updater *actualStateUpdater) save(obj runtime.Storable) error {
 func (updater *actualStateUpdater) delete(key string) error {
 	return updater.store.Delete(resolve.TypeComponentInstance.Kind, key)
 }
+
+func (updater *actualStateUpdater) saveChange(change *engine.ActualStateChange) error {
+	err := updater.registry.recordActualStateChange(change)
+	if err != nil {
+		return fmt.Errorf("error while saving actual state change for component instance %s: %s", change.ComponentKey, err)
+	}
+	return nil
+}
+
+// isSameExceptUpdatedAt returns true if component instances differ only in update time
+func isSameExceptUpdatedAt(previous *resolve.ComponentInstance, instance *resolve.ComponentInstance) bool {
+	if previous == nil || instance == nil {
+		return previous == instance
+	}
+	updatedAt := instance.UpdatedAt
+	instance.UpdatedAt = previous.UpdatedAt
+	defer func() {
+		instance.UpdatedAt = updatedAt
+	}()
+	return reflect.DeepEqual(previous, instance)
+}
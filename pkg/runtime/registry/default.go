@@ -3,6 +3,7 @@ package registry
 import (
 	"sync"
 
+	"github.com/Aptomi/aptomi/pkg/config"
 	"github.com/Aptomi/aptomi/pkg/runtime/store"
 )
 
@@ -10,12 +11,15 @@ import (
 // different engine objects into the object registry
 type defaultRegistry struct {
 	policyChangeLock sync.Mutex
+	historyLock      sync.Mutex
 	store            store.Interface
+	historyCfg       config.ActualStateHistory
 }
 
 // New returns default implementation of generic registry
-func New(store store.Interface) Interface {
+func New(store store.Interface, historyCfg config.ActualStateHistory) Interface {
 	return &defaultRegistry{
-		store: store,
+		store:      store,
+		historyCfg: historyCfg,
 	}
 }
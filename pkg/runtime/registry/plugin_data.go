@@ -0,0 +1,51 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+)
+
+func (reg *defaultRegistry) LoadPluginData(name string) (map[string]string, error) {
+	var data *engine.PluginData
+	err := reg.store.Find(engine.TypePluginData.Kind, &data, store.WithKey(engine.PluginDataKey(name)))
+	if err != nil {
+		return nil, fmt.Errorf("error while getting plugin data %s: %s", name, err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	return data.Data, nil
+}
+
+func (reg *defaultRegistry) FindPluginData(prefix string) (map[string]map[string]string, error) {
+	var found []*engine.PluginData
+	err := reg.store.Find(engine.TypePluginData.Kind, &found, store.WithKeyPrefix(runtime.KeyFromParts(runtime.SystemNS, engine.TypePluginData.Kind, prefix)))
+	if err != nil {
+		return nil, fmt.Errorf("error while getting plugin data with prefix %s: %s", prefix, err)
+	}
+
+	result := make(map[string]map[string]string)
+	for _, data := range found {
+		result[data.Name] = data.Data
+	}
+	return result, nil
+}
+
+func (reg *defaultRegistry) SavePluginData(name string, data map[string]string) error {
+	_, err := reg.store.Save(engine.NewPluginData(name, data))
+	if err != nil {
+		return fmt.Errorf("error while saving plugin data %s: %s", name, err)
+	}
+	return nil
+}
+
+func (reg *defaultRegistry) DeletePluginData(name string) error {
+	err := reg.store.Delete(engine.TypePluginData.Kind, engine.PluginDataKey(name))
+	if err != nil {
+		return fmt.Errorf("error while deleting plugin data %s: %s", name, err)
+	}
+	return nil
+}
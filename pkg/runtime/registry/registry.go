@@ -1,6 +1,8 @@
 package registry
 
 import (
+	"time"
+
 	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/engine/actual"
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
@@ -14,6 +16,7 @@ type Interface interface {
 	PolicyRegistry
 	RevisionRegistry
 	ActualStateRegistry
+	PluginDataRegistry
 }
 
 // PolicyRegistry represents database operations for Policy object
@@ -31,7 +34,10 @@ type RevisionRegistry interface {
 	GetDesiredState(*engine.Revision) (*resolve.PolicyResolution, error)
 	GetRevision(gen runtime.Generation) (*engine.Revision, error)
 	UpdateRevision(revision *engine.Revision) error
-	NewRevisionResultUpdater(revision *engine.Revision) action.ApplyResultUpdater
+	NewRevisionResultUpdater(revision *engine.Revision, progress *engine.RevisionProgress) action.ApplyResultUpdater
+	StartRevisionApply(revision *engine.Revision, actualState *resolve.PolicyResolution) (*engine.RevisionProgress, error)
+	GetRevisionApplyState(revision *engine.Revision) (*resolve.PolicyResolution, *engine.RevisionProgress, error)
+	UpdateRevisionProgress(progress *engine.RevisionProgress) error
 	GetFirstUnprocessedRevision() (*engine.Revision, error)
 	GetLastRevisionForPolicy(policyGen runtime.Generation) (*engine.Revision, error)
 	GetAllRevisionsForPolicy(policyGen runtime.Generation) ([]*engine.Revision, error)
@@ -40,5 +46,15 @@ type RevisionRegistry interface {
 // ActualStateRegistry represents database operations for the actual state handling
 type ActualStateRegistry interface {
 	GetActualState() (*resolve.PolicyResolution, error)
+	GetActualStateAt(at time.Time) (*resolve.PolicyResolution, error)
 	NewActualStateUpdater(*resolve.PolicyResolution) actual.StateUpdater
 }
+
+// PluginDataRegistry represents database operations for the data code plugins keep for their deployments (it
+// implements plugin.DataStore)
+type PluginDataRegistry interface {
+	LoadPluginData(name string) (map[string]string, error)
+	FindPluginData(prefix string) (map[string]map[string]string, error)
+	SavePluginData(name string, data map[string]string) error
+	DeletePluginData(name string) error
+}
@@ -116,3 +116,52 @@ func (reg *defaultRegistry) GetDesiredState(revision *engine.Revision) (*resolve
 
 	return &desiredState.Resolution, nil
 }
+
+// StartRevisionApply saves snapshot of the actual state, against which action plan for the revision has been
+// calculated, and resets revision progress. It returns revision progress with no completed nodes
+func (reg *defaultRegistry) StartRevisionApply(revision *engine.Revision, actualState *resolve.PolicyResolution) (*engine.RevisionProgress, error) {
+	_, err := reg.store.Save(engine.NewRevisionActualState(revision, actualState))
+	if err != nil {
+		return nil, fmt.Errorf("error while saving actual state snapshot for revision: %s", err)
+	}
+
+	progress := engine.NewRevisionProgress(revision)
+	err = reg.UpdateRevisionProgress(progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return progress, nil
+}
+
+// GetRevisionApplyState returns snapshot of the actual state, against which action plan for the revision has been
+// calculated, as well as revision progress. It returns nils if apply of the revision has never been started
+func (reg *defaultRegistry) GetRevisionApplyState(revision *engine.Revision) (*resolve.PolicyResolution, *engine.RevisionProgress, error) {
+	var actualState *engine.RevisionActualState
+	err := reg.store.Find(engine.TypeRevisionActualState.Kind, &actualState, store.WithKey(runtime.KeyFromParts(runtime.SystemNS, engine.TypeRevisionActualState.Kind, engine.GetRevisionActualStateName(revision.GetGeneration()))))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var progress *engine.RevisionProgress
+	err = reg.store.Find(engine.TypeRevisionProgress.Kind, &progress, store.WithKey(runtime.KeyFromParts(runtime.SystemNS, engine.TypeRevisionProgress.Kind, engine.GetRevisionProgressName(revision.GetGeneration()))))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if actualState == nil || progress == nil {
+		return nil, nil, nil
+	}
+
+	return &actualState.Resolution, progress, nil
+}
+
+// UpdateRevisionProgress saves progress of applying action plan for the revision
+func (reg *defaultRegistry) UpdateRevisionProgress(progress *engine.RevisionProgress) error {
+	_, err := reg.store.Save(progress)
+	if err != nil {
+		return fmt.Errorf("error while saving revision progress: %s", err)
+	}
+
+	return nil
+}
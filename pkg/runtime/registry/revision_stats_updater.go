@@ -14,15 +14,17 @@ import (
 type RevisionResultUpdaterImpl struct {
 	registry Interface
 	revision *engine.Revision
+	progress *engine.RevisionProgress
 	mutex    sync.Mutex
 }
 
 // NewRevisionResultUpdater creates a new default thread-safe implementation of RevisionResultUpdaterImpl, which also
-// saves revision on every action
-func (reg *defaultRegistry) NewRevisionResultUpdater(revision *engine.Revision) action.ApplyResultUpdater {
+// saves revision on every action and revision progress on every completed node of the action plan
+func (reg *defaultRegistry) NewRevisionResultUpdater(revision *engine.Revision, progress *engine.RevisionProgress) action.ApplyResultUpdater {
 	return &RevisionResultUpdaterImpl{
 		registry: reg,
 		revision: revision,
+		progress: progress,
 	}
 }
 
@@ -51,12 +53,31 @@ func (updater *RevisionResultUpdaterImpl) AddSkipped() {
 	updater.save()
 }
 
-// Done saves the revision when all actions have been processed
-func (updater *RevisionResultUpdaterImpl) Done() *action.ApplyResult {
+// NodeCompleted safely records that action plan node has been completed and saves revision progress
+func (updater *RevisionResultUpdaterImpl) NodeCompleted(key string) {
+	updater.mutex.Lock()
+	defer updater.mutex.Unlock()
+	if updater.progress.CompletedNodes == nil {
+		updater.progress.CompletedNodes = make(map[string]bool)
+	}
+	updater.progress.CompletedNodes[key] = true
+	err := updater.registry.UpdateRevisionProgress(updater.progress)
+	if err != nil {
+		panic(fmt.Sprintf("error while saving progress for revision %s: %s", updater.revision.GetGeneration(), err))
+	}
+}
+
+// Done saves the revision when all actions have been processed. Revision gets marked as cancelled if action plan
+// has been cancelled and as completed otherwise
+func (updater *RevisionResultUpdaterImpl) Done(cancelled bool) *action.ApplyResult {
 	if updater.revision.Result.Success+updater.revision.Result.Failed+updater.revision.Result.Skipped != updater.revision.Result.Total {
 		panic(fmt.Sprintf("error while applying actions: %d (success) + %d (failed) + %d (skipped) != %d (total)", updater.revision.Result.Success, updater.revision.Result.Failed, updater.revision.Result.Skipped, updater.revision.Result.Total))
 	}
-	updater.revision.Status = engine.RevisionStatusCompleted
+	if cancelled {
+		updater.revision.Status = engine.RevisionStatusCancelled
+	} else {
+		updater.revision.Status = engine.RevisionStatusCompleted
+	}
 	updater.revision.AppliedAt = time.Now()
 	updater.save()
 	return updater.revision.Result
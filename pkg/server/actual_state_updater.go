@@ -14,10 +14,20 @@ import (
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
 func (server *Server) actualStateUpdateLoop() error {
+	server.driftedComponentInstances = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "aptomi_drifted_component_instances",
+			Help:        "Number of component instances which have drifted from their params",
+			ConstLabels: prometheus.Labels{"service": prometheusSvcName},
+		},
+	)
+	prometheus.MustRegister(server.driftedComponentInstances)
+
 	for {
 		err := server.actualStateUpdate()
 		if err != nil {
@@ -67,7 +77,22 @@ func (server *Server) actualStateUpdate() error {
 	eventLog := event.NewLog(log.DebugLevel, fmt.Sprintf("update-%d", server.actualStateUpdateIdx)).AddConsoleHook(server.cfg.GetLogLevel())
 
 	// Load endpoints for all components
-	refreshEndpoints(desiredPolicy, actualState, server.registry.NewActualStateUpdater(actualState), server.updaterPluginRegistryFactory(), eventLog, server.cfg.Updater.MaxConcurrentActions, server.cfg.Updater.Noop)
+	actualStateUpdater := server.registry.NewActualStateUpdater(actualState)
+	plugins := server.updaterPluginRegistryFactory()
+	refreshEndpoints(desiredPolicy, actualState, actualStateUpdater, plugins, eventLog, server.cfg.Updater.MaxConcurrentActions, server.cfg.Updater.Noop)
+
+	// Check all components for drift
+	if server.cfg.Updater.DriftCheck && !server.cfg.Updater.Noop {
+		drifted := checkDrift(desiredPolicy, actualState, actualStateUpdater, plugins, eventLog, server.cfg.Updater.MaxConcurrentActions)
+		server.driftedComponentInstances.Set(float64(drifted))
+		if drifted > 0 {
+			log.Warningf("(update-%d) %d component instances have drifted from their params", server.actualStateUpdateIdx, drifted)
+			if server.cfg.Updater.DriftReapply {
+				// trigger enforcement, so drifted component instances get re-applied
+				server.runDesiredStateEnforcement <- true
+			}
+		}
+	}
 
 	log.Infof("(update-%d) Actual state updated", server.actualStateUpdateIdx)
 
@@ -75,11 +100,52 @@ func (server *Server) actualStateUpdate() error {
 }
 
 func refreshEndpoints(desiredPolicy *lang.Policy, actualState *resolve.PolicyResolution, actualStateUpdater actual.StateUpdater, plugins plugin.Registry, eventLog *event.Log, maxConcurrentActions int, noop bool) {
+	// generate the list of actions
+	actions := []action.Interface{}
+	for _, instance := range actualState.ComponentInstanceMap {
+		if instance.IsCode && !instance.EndpointsUpToDate {
+			var act action.Interface
+			if !noop {
+				act = component.NewEndpointsAction(instance.GetKey())
+			} else {
+				act = component.NewEndpointsAction(instance.GetKey())
+			}
+			actions = append(actions, act)
+		}
+	}
+
+	runUpdaterActions(desiredPolicy, actualStateUpdater, plugins, eventLog, maxConcurrentActions, actions)
+}
+
+// checkDrift checks all code component instances in the actual state for drift and returns the number of drifted ones
+func checkDrift(desiredPolicy *lang.Policy, actualState *resolve.PolicyResolution, actualStateUpdater actual.StateUpdater, plugins plugin.Registry, eventLog *event.Log, maxConcurrentActions int) int {
+	// generate the list of actions
+	actions := []action.Interface{}
+	for _, instance := range actualState.ComponentInstanceMap {
+		if instance.IsCode {
+			actions = append(actions, component.NewDriftAction(instance.GetKey()))
+		}
+	}
+
+	runUpdaterActions(desiredPolicy, actualStateUpdater, plugins, eventLog, maxConcurrentActions, actions)
+
+	// count drifted component instances (in case of errors, we will just keep the previous status)
+	drifted := 0
+	for _, instance := range actualStateUpdater.GetUpdatedActualState().ComponentInstanceMap {
+		if instance.Drifted {
+			drifted++
+		}
+	}
+	return drifted
+}
+
+// runUpdaterActions runs the given actions in parallel, but in no more than maxConcurrentActions concurrent go routines
+func runUpdaterActions(desiredPolicy *lang.Policy, actualStateUpdater actual.StateUpdater, plugins plugin.Registry, eventLog *event.Log, maxConcurrentActions int, actions []action.Interface) {
 	context := action.NewContext(
 		desiredPolicy,
-		nil, // not needed for endpoints action
+		nil, // not needed for updater actions
 		actualStateUpdater,
-		nil, // not needed for endpoints action
+		nil, // not needed for updater actions
 		plugins,
 		eventLog,
 	)
@@ -98,20 +164,6 @@ func refreshEndpoints(desiredPolicy *lang.Policy, actualState *resolve.PolicyRes
 		return err
 	})
 
-	// generate the list of actions
-	actions := []action.Interface{}
-	for _, instance := range actualState.ComponentInstanceMap {
-		if instance.IsCode && !instance.EndpointsUpToDate {
-			var act action.Interface
-			if !noop {
-				act = component.NewEndpointsAction(instance.GetKey())
-			} else {
-				act = component.NewEndpointsAction(instance.GetKey())
-			}
-			actions = append(actions, act)
-		}
-	}
-
 	// run actions
 	var wg sync.WaitGroup
 	for _, act := range actions {
@@ -78,18 +78,73 @@ func (server *Server) getRevisionForProcessing() (*engine.Revision, error) {
 		return nil, fmt.Errorf("unable to load latest revision: %s", err)
 	}
 
-	// now, given that we retrieved the last revision, when do we need to retry it? in one of two cases:
+	// now, given that we retrieved the last revision, when do we need to retry it? in one of three cases:
 	// - it's either in error status (something really bad happened)
 	// - it completed, but some actions failed and they need to be retried
+	// - it completed, but some component instances drifted from their params and they need to be re-applied
+	// - it completed, but some retained component instances need to be destroyed (grace period expired or purge requested)
 	if lastRevision != nil && (lastRevision.Status == engine.RevisionStatusError || (lastRevision.Status == engine.RevisionStatusCompleted && lastRevision.Result.Failed > 0)) {
 		log.Infof("(enforce-%d) Found last revision %d which needs to be retried", server.desiredStateEnforcementIdx, lastRevision.GetGeneration())
 		return lastRevision, nil
 	}
+	if lastRevision != nil && lastRevision.Status == engine.RevisionStatusCompleted && server.cfg.Updater.DriftReapply {
+		drifted, err := server.hasDriftedComponentInstances()
+		if err != nil {
+			return nil, err
+		}
+		if drifted {
+			log.Infof("(enforce-%d) Found drifted component instances, last revision %d needs to be re-applied", server.desiredStateEnforcementIdx, lastRevision.GetGeneration())
+			return lastRevision, nil
+		}
+	}
+
+	if lastRevision != nil && lastRevision.Status == engine.RevisionStatusCompleted {
+		expired, err := server.hasExpiredRetainedComponentInstances()
+		if err != nil {
+			return nil, err
+		}
+		if expired {
+			log.Infof("(enforce-%d) Found retained component instances to destroy, last revision %d needs to be re-applied", server.desiredStateEnforcementIdx, lastRevision.GetGeneration())
+			return lastRevision, nil
+		}
+	}
 
 	// nothing to process
 	return nil, nil
 }
 
+// hasExpiredRetainedComponentInstances returns true if there is at least one retained component instance in the actual
+// state, which has to be destroyed
+func (server *Server) hasExpiredRetainedComponentInstances() (bool, error) {
+	actualState, err := server.registry.GetActualState()
+	if err != nil {
+		return false, fmt.Errorf("unable to load actual state: %s", err)
+	}
+
+	now := time.Now()
+	for _, instance := range actualState.ComponentInstanceMap {
+		if instance.IsRetentionExpired(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hasDriftedComponentInstances returns true if there is at least one drifted component instance in the actual state
+func (server *Server) hasDriftedComponentInstances() (bool, error) {
+	actualState, err := server.registry.GetActualState()
+	if err != nil {
+		return false, fmt.Errorf("unable to load actual state: %s", err)
+	}
+
+	for _, instance := range actualState.ComponentInstanceMap {
+		if instance.Drifted {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (server *Server) desiredStateEnforce() error {
 	start := time.Now()
 	server.desiredStateEnforcementIdx++
@@ -113,6 +168,9 @@ func (server *Server) desiredStateEnforce() error {
 		return nil
 	}
 
+	// if revision is still in progress, it means that apply has been interrupted (e.g. server restart) and it could be resumed
+	interrupted := revision.Status == engine.RevisionStatusInProgress
+
 	// reset revision status and result
 	revision.Status = engine.RevisionStatusWaiting
 	revision.Result = &action.ApplyResult{}
@@ -139,14 +197,33 @@ func (server *Server) desiredStateEnforce() error {
 		return fmt.Errorf("error while getting actual state: %s", err)
 	}
 
-	// compare desired against actual
+	// try to resume the same action plan if apply has been interrupted
 	var stateDiff *diff.PolicyResolutionDiff
-	if revision.RecalculateAll {
-		stateDiff = diff.NewPolicyResolutionDiff(desiredState, resolve.NewPolicyResolution())
-	} else {
-		stateDiff = diff.NewPolicyResolutionDiff(desiredState, actualState)
+	var progress *engine.RevisionProgress
+	if interrupted {
+		stateDiff, progress, err = server.resumeRevisionApply(revision, desiredState, actualState)
+		if err != nil {
+			return fmt.Errorf("error while loading progress of interrupted revision: %s", err)
+		}
+	}
+
+	// otherwise compare desired against actual and start from scratch
+	if stateDiff == nil {
+		if revision.RecalculateAll {
+			stateDiff = diff.NewPolicyResolutionDiff(desiredState, resolve.NewPolicyResolution())
+		} else {
+			stateDiff = diff.NewPolicyResolutionDiff(desiredState, actualState)
+		}
+
+		progress, err = server.registry.StartRevisionApply(revision, actualState)
+		if err != nil {
+			return fmt.Errorf("error while starting revision apply: %s", err)
+		}
 	}
 
+	// record field-level changes, so they can be seen in revision details
+	revision.Changes = stateDiff.ActionPlan.ParameterChanges()
+
 	// policy changes while no actions needed to achieve desired state
 	actionCnt := stateDiff.ActionPlan.NumberOfActions()
 	if actionCnt > 0 {
@@ -156,7 +233,9 @@ func (server *Server) desiredStateEnforce() error {
 	}
 
 	// op or noop
-	if server.cfg.Enforcer.Noop {
+	if server.cfg.Enforcer.Simulated {
+		log.Infof("(enforce-%d) Applying actions in simulated mode", server.desiredStateEnforcementIdx)
+	} else if server.cfg.Enforcer.Noop {
 		log.Infof("(enforce-%d) Applying actions in noop mode (sleep per action = %s)", server.desiredStateEnforcementIdx, server.cfg.Enforcer.NoopSleep)
 	} else {
 		log.Infof("(enforce-%d) Applying actions", server.desiredStateEnforcementIdx)
@@ -165,8 +244,13 @@ func (server *Server) desiredStateEnforce() error {
 	// apply
 	pluginRegistry := server.enforcerPluginRegistryFactory()
 	applyLog := event.NewLog(log.DebugLevel, fmt.Sprintf("enforce-%d-apply", server.desiredStateEnforcementIdx)).AddConsoleHook(server.cfg.GetLogLevel())
-	applier := apply.NewEngineApply(policy, desiredState, server.registry.NewActualStateUpdater(actualState), server.externalData, pluginRegistry, stateDiff.ActionPlan, applyLog, server.registry.NewRevisionResultUpdater(revision))
+	applier := apply.NewEngineApply(policy, desiredState, server.registry.NewActualStateUpdater(actualState), server.externalData, pluginRegistry, stateDiff.ActionPlan, applyLog, server.registry.NewRevisionResultUpdater(revision, progress))
+	applier.LimitConcurrency(server.cfg.Enforcer.MaxConcurrentActionsPerCluster, server.cfg.Enforcer.MaxConcurrentActionsPerCodeType)
+	applier.SetBlueGreenReadinessTimeout(server.cfg.Enforcer.BlueGreenReadinessTimeout)
+	applyDone := make(chan struct{})
+	go server.listenForRevisionCancel(revision.GetGeneration(), applier, applyDone)
 	_, _ = applier.Apply(server.cfg.Enforcer.MaxConcurrentActions)
+	close(applyDone)
 
 	// save apply log
 	revision.ApplyLog = applyLog.AsAPIEvents()
@@ -177,6 +261,13 @@ func (server *Server) desiredStateEnforce() error {
 
 	log.Infof("(enforce-%d) Revision %d processed (actions: %d succeeded, %d failed, %d skipped)", server.desiredStateEnforcementIdx, revision.GetGeneration(), revision.Result.Success, revision.Result.Failed, revision.Result.Skipped)
 
+	// cancelled revision should not be retried, but actual state may have changed before it was cancelled
+	if revision.Status == engine.RevisionStatusCancelled {
+		log.Infof("(enforce-%d) Revision %d has been cancelled", server.desiredStateEnforcementIdx, revision.GetGeneration())
+		server.runActualStateUpdate <- true
+		return nil
+	}
+
 	// let's try again immediately until no actions were successfully applied
 	if revision.Result.Success > 0 {
 		// trigger enforcement again
@@ -187,3 +278,52 @@ func (server *Server) desiredStateEnforce() error {
 
 	return nil
 }
+
+// resumeRevisionApply rebuilds action plan of the interrupted revision against the actual state snapshot, which was
+// captured when apply had been started, and marks already completed nodes. It returns nils if there is no saved
+// progress for the revision or if the progress doesn't match the current actual state anymore
+func (server *Server) resumeRevisionApply(revision *engine.Revision, desiredState *resolve.PolicyResolution, actualState *resolve.PolicyResolution) (*diff.PolicyResolutionDiff, *engine.RevisionProgress, error) {
+	initialState, progress, err := server.registry.GetRevisionApplyState(revision)
+	if err != nil {
+		return nil, nil, err
+	}
+	if initialState == nil {
+		return nil, nil, nil
+	}
+
+	// rebuild the same action plan
+	var stateDiff *diff.PolicyResolutionDiff
+	if revision.RecalculateAll {
+		stateDiff = diff.NewPolicyResolutionDiff(desiredState, resolve.NewPolicyResolution())
+	} else {
+		stateDiff = diff.NewPolicyResolutionDiff(desiredState, initialState)
+	}
+
+	// make sure it still matches the actual state
+	err = stateDiff.ValidateProgress(initialState, actualState, progress.CompletedNodes)
+	if err != nil {
+		log.Warnf("(enforce-%d) Can't resume interrupted revision %d, starting it from scratch: %s", server.desiredStateEnforcementIdx, revision.GetGeneration(), err)
+		return nil, nil, nil
+	}
+
+	stateDiff.ActionPlan.MarkCompleted(progress.CompletedNodes)
+	log.Infof("(enforce-%d) Resuming interrupted revision %d (%d nodes already completed)", server.desiredStateEnforcementIdx, revision.GetGeneration(), len(progress.CompletedNodes))
+
+	return stateDiff, progress, nil
+}
+
+// listenForRevisionCancel waits for cancellation requests until apply is done. If cancellation is requested for the
+// revision which is being applied, it cancels the apply. Requests for all other revisions are ignored
+func (server *Server) listenForRevisionCancel(gen runtime.Generation, applier *apply.EngineApply, applyDone <-chan struct{}) {
+	for {
+		select {
+		case cancelGen := <-server.cancelRevision:
+			if cancelGen == gen {
+				log.Infof("(enforce-%d) Cancelling revision %d", server.desiredStateEnforcementIdx, gen)
+				applier.Cancel(server.cfg.Enforcer.CancelDeadline)
+			}
+		case <-applyDone:
+			return
+		}
+	}
+}
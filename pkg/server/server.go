@@ -18,10 +18,14 @@ import (
 	"github.com/Aptomi/aptomi/pkg/external/users"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/plugin"
+	externalplugin "github.com/Aptomi/aptomi/pkg/plugin/external"
 	"github.com/Aptomi/aptomi/pkg/plugin/fake"
 	"github.com/Aptomi/aptomi/pkg/plugin/helm"
 	"github.com/Aptomi/aptomi/pkg/plugin/k8s"
 	"github.com/Aptomi/aptomi/pkg/plugin/k8sraw"
+	"github.com/Aptomi/aptomi/pkg/plugin/kustomize"
+	"github.com/Aptomi/aptomi/pkg/plugin/local"
+	"github.com/Aptomi/aptomi/pkg/plugin/terraform"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/runtime/registry"
 	"github.com/Aptomi/aptomi/pkg/runtime/store"
@@ -48,6 +52,7 @@ type Server struct {
 	httpServer *http.Server
 
 	runDesiredStateEnforcement    chan bool
+	cancelRevision                chan runtime.Generation
 	desiredStateEnforcementIdx    uint
 	enforcerPluginRegistryFactory plugin.RegistryFactory
 
@@ -57,6 +62,7 @@ type Server struct {
 
 	desiredStateEnforcements        prometheus.Counter
 	desiredStateEnforcementDuration prometheus.Histogram
+	driftedComponentInstances       prometheus.Gauge
 }
 
 // NewServer creates a new Aptomi Server
@@ -65,6 +71,7 @@ func NewServer(cfg *config.Server) *Server {
 		cfg:                        cfg,
 		backgroundErrors:           make(chan string),
 		runDesiredStateEnforcement: make(chan bool, 2048),
+		cancelRevision:             make(chan runtime.Generation, 2048),
 		runActualStateUpdate:       make(chan bool, 2048),
 	}
 
@@ -171,44 +178,94 @@ func (server *Server) initRegistry() {
 	if err != nil {
 		panic(fmt.Sprintf("can't create etcd store: %s", err))
 	}
-	server.registry = registry.New(etcdStore)
+	server.registry = registry.New(etcdStore, server.cfg.History)
 }
 
 func (server *Server) initPluginRegistryFactory() {
-	fn := func(noop bool, noopSleep time.Duration) func() plugin.Registry {
-		return func() plugin.Registry {
-			clusterTypes := make(map[string]plugin.ClusterPluginConstructor)
-			codeTypes := make(map[string]map[string]plugin.CodePluginConstructor)
+	externalPlugins, err := externalplugin.Discover(server.cfg.Plugins.External)
+	if err != nil {
+		panic(fmt.Sprintf("can't load external plugins: %s", err))
+	}
 
-			if !noop {
-				clusterTypes["kubernetes"] = func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
-					return k8s.New(cluster, cfg)
-				}
+	// simulation is shared by enforcer and updater, so updater sees components deployed by enforcer
+	var simulation *fake.Simulation
+	if server.cfg.Enforcer.Simulated || server.cfg.Updater.Simulated {
+		simulation, err = fake.NewSimulation(server.cfg.Plugins.Simulated)
+		if err != nil {
+			panic(fmt.Sprintf("can't create plugin simulation: %s", err))
+		}
+	}
 
-				codeTypes["kubernetes"] = make(map[string]plugin.CodePluginConstructor)
-				codeTypes["kubernetes"]["helm"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
-					return helm.New(cluster, cfg)
-				}
-				codeTypes["kubernetes"]["raw"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
-					return k8sraw.New(cluster, cfg)
+	// chart fetcher is shared by all helm plugins, so charts and repo indexes are cached across revisions
+	charts := helm.NewChartFetcher(server.cfg.Plugins.Helm, server.externalData.SecretLoader)
+
+	fn := func(noop bool, simulated bool, noopSleep time.Duration) func() plugin.Registry {
+		clusterTypes := make(map[string]plugin.ClusterPluginConstructor)
+		codeTypes := make(map[string]map[string]plugin.CodePluginConstructor)
+
+		if simulated {
+			for clusterType, clusterCodeTypes := range map[string][]string{"kubernetes": {"helm", "raw", "kustomize", "terraform"}, "local": {"process", "terraform"}} {
+				clusterTypes[clusterType] = simulation.NewClusterPlugin
+				codeTypes[clusterType] = make(map[string]plugin.CodePluginConstructor)
+				for _, codeType := range clusterCodeTypes {
+					codeTypes[clusterType][codeType] = simulation.NewCodePlugin
 				}
-			} else {
-				clusterTypes["kubernetes"] = func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
-					return fake.NewNoOpClusterPlugin(noopSleep), nil
+			}
+		} else if !noop {
+			clusterTypes["kubernetes"] = func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+				return k8s.New(cluster, cfg)
+			}
+
+			codeTypes["kubernetes"] = make(map[string]plugin.CodePluginConstructor)
+			codeTypes["kubernetes"]["helm"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+				return helm.New(cluster, cfg, charts)
+			}
+			codeTypes["kubernetes"]["raw"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+				return k8sraw.New(cluster, cfg)
+			}
+			codeTypes["kubernetes"]["kustomize"] = kustomize.New
+			codeTypes["kubernetes"]["terraform"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+				k8sCluster, ok := cluster.(*k8s.Plugin)
+				if !ok {
+					return nil, fmt.Errorf("k8s cluster plugin expected for terraform code plugin creation but received: %T", cluster)
 				}
+				return terraform.New(k8sCluster.Cluster, cfg, server.registry)
+			}
 
-				codeTypes["kubernetes"] = make(map[string]plugin.CodePluginConstructor)
-				codeTypes["kubernetes"]["helm"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
-					return fake.NewNoOpCodePlugin(noopSleep), nil
+			clusterTypes["local"] = local.New
+			codeTypes["local"] = make(map[string]plugin.CodePluginConstructor)
+			codeTypes["local"]["process"] = local.NewProcessPlugin
+			codeTypes["local"]["terraform"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+				localCluster, ok := cluster.(*local.Plugin)
+				if !ok {
+					return nil, fmt.Errorf("local cluster plugin expected for terraform code plugin creation but received: %T", cluster)
 				}
+				return terraform.New(localCluster.Cluster, cfg, server.registry)
 			}
 
+			registerErr := externalplugin.Register(externalPlugins, clusterTypes, codeTypes)
+			if registerErr != nil {
+				panic(fmt.Sprintf("can't register external plugins: %s", registerErr))
+			}
+		} else {
+			clusterTypes["kubernetes"] = func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+				return fake.NewNoOpClusterPlugin(noopSleep), nil
+			}
+
+			codeTypes["kubernetes"] = make(map[string]plugin.CodePluginConstructor)
+			codeTypes["kubernetes"]["helm"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+				return fake.NewNoOpCodePlugin(noopSleep), nil
+			}
+		}
+
+		// plugin constructors are only read by the registry, so they can be shared by all registries
+		return func() plugin.Registry {
 			return plugin.NewRegistry(server.cfg.Plugins, clusterTypes, codeTypes)
 		}
 	}
 
-	server.enforcerPluginRegistryFactory = fn(server.cfg.Enforcer.Noop, server.cfg.Enforcer.NoopSleep)
-	server.updaterPluginRegistryFactory = fn(server.cfg.Updater.Noop, server.cfg.Updater.NoopSleep)
+	server.enforcerPluginRegistryFactory = fn(server.cfg.Enforcer.Noop, server.cfg.Enforcer.Simulated, server.cfg.Enforcer.NoopSleep)
+	server.updaterPluginRegistryFactory = fn(server.cfg.Updater.Noop, server.cfg.Updater.Simulated, server.cfg.Updater.NoopSleep)
 }
 
 func (server *Server) startHTTPServer() {
@@ -221,7 +278,7 @@ func (server *Server) startHTTPServer() {
 		log.Warnf("The auth.secret not specified in config, using insecure default one")
 	}
 
-	api.Serve(router, server.registry, server.externalData, server.enforcerPluginRegistryFactory, server.cfg.Auth.Secret, server.cfg.GetLogLevel(), server.runDesiredStateEnforcement)
+	api.Serve(router, server.registry, server.externalData, server.enforcerPluginRegistryFactory, server.cfg.Auth.Secret, server.cfg.GetLogLevel(), server.runDesiredStateEnforcement, server.cancelRevision, server.cfg.Resolver)
 	server.serveUI(router)
 
 	var handler http.Handler = router
@@ -0,0 +1,215 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ChangeOpAdd is an operation for a field which has been added
+	ChangeOpAdd = "add"
+
+	// ChangeOpRemove is an operation for a field which has been removed
+	ChangeOpRemove = "remove"
+
+	// ChangeOpReplace is an operation for a field which value has been changed
+	ChangeOpReplace = "replace"
+
+	// MaskedValue is what secret-looking values get replaced with
+	MaskedValue = "******"
+)
+
+// secretKeyMarkers is a list of substrings, which make a field look like it contains a secret
+var secretKeyMarkers = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "privatekey", "private_key", "credential"}
+
+// secretValueMarkers is a list of substrings, which make a value look like a secret
+var secretValueMarkers = []string{"-----BEGIN"}
+
+// ParameterChange is a field-level change between two nested parameter maps, represented similarly to JSON patch
+// operation. Path is a JSON pointer to the changed field, secret-looking values are always masked
+type ParameterChange struct {
+	Op       string
+	Path     string
+	OldValue interface{}
+	Value    interface{}
+}
+
+// Changes returns a list of field-level changes, which turn src into dst. Paths of all changes get prefixed with
+// the given prefix (e.g. "/params"). Changes are sorted by path
+func (src NestedParameterMap) Changes(dst NestedParameterMap, prefix string) []*ParameterChange {
+	result := []*ParameterChange{}
+	collectChanges(src, dst, prefix, &result)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
+// LabelChanges returns a list of changes between two sets of labels, represented as field-level changes
+func LabelChanges(src map[string]string, dst map[string]string, prefix string) []*ParameterChange {
+	srcMap, dstMap := NestedParameterMap{}, NestedParameterMap{}
+	for k, v := range src {
+		srcMap[k] = v
+	}
+	for k, v := range dst {
+		dstMap[k] = v
+	}
+	return srcMap.Changes(dstMap, prefix)
+}
+
+func collectChanges(src NestedParameterMap, dst NestedParameterMap, prefix string, result *[]*ParameterChange) {
+	for key, srcValue := range src {
+		path := prefix + "/" + escapePathElement(key)
+		dstValue, exists := dst[key]
+		if !exists {
+			collectLeaves(srcValue, path, ChangeOpRemove, result)
+			continue
+		}
+
+		srcMap, srcIsMap := srcValue.(NestedParameterMap)
+		dstMap, dstIsMap := dstValue.(NestedParameterMap)
+		if srcIsMap && dstIsMap {
+			collectChanges(srcMap, dstMap, path, result)
+		} else if srcIsMap || dstIsMap {
+			collectLeaves(srcValue, path, ChangeOpRemove, result)
+			collectLeaves(dstValue, path, ChangeOpAdd, result)
+		} else if !reflect.DeepEqual(srcValue, dstValue) {
+			*result = append(*result, newParameterChange(ChangeOpReplace, path, srcValue, dstValue))
+		}
+	}
+
+	for key, dstValue := range dst {
+		if _, exists := src[key]; !exists {
+			collectLeaves(dstValue, prefix+"/"+escapePathElement(key), ChangeOpAdd, result)
+		}
+	}
+}
+
+// collectLeaves records a change for every leaf value of a subtree, which has been added or removed as a whole
+func collectLeaves(value interface{}, path string, op string, result *[]*ParameterChange) {
+	if valueMap, ok := value.(NestedParameterMap); ok {
+		for key, nestedValue := range valueMap {
+			collectLeaves(nestedValue, path+"/"+escapePathElement(key), op, result)
+		}
+		return
+	}
+
+	if op == ChangeOpRemove {
+		*result = append(*result, newParameterChange(op, path, value, nil))
+	} else {
+		*result = append(*result, newParameterChange(op, path, nil, value))
+	}
+}
+
+func newParameterChange(op string, path string, oldValue interface{}, value interface{}) *ParameterChange {
+	if isSecretPath(path) || isSecretValue(oldValue) || isSecretValue(value) {
+		if oldValue != nil {
+			oldValue = MaskedValue
+		}
+		if value != nil {
+			value = MaskedValue
+		}
+	} else {
+		// lists are compared as a whole, so secret-looking elements get masked individually
+		oldValue = maskValue(oldValue, path)
+		value = maskValue(value, path)
+	}
+	return &ParameterChange{
+		Op:       op,
+		Path:     path,
+		OldValue: oldValue,
+		Value:    value,
+	}
+}
+
+// Masked returns a deep copy of parameter map, where all secret-looking values are masked
+func (src NestedParameterMap) Masked() NestedParameterMap {
+	return maskMap(src, "")
+}
+
+func maskMap(src NestedParameterMap, prefix string) NestedParameterMap {
+	if src == nil {
+		return nil
+	}
+	result := NestedParameterMap{}
+	for key, value := range src {
+		result[key] = maskValue(value, prefix+"/"+escapePathElement(key))
+	}
+	return result
+}
+
+// maskValue masks the value if it looks like a secret, descending into maps and lists
+func maskValue(value interface{}, path string) interface{} {
+	switch typedValue := value.(type) {
+	case NestedParameterMap:
+		return maskMap(typedValue, path)
+	case []interface{}:
+		result := make([]interface{}, len(typedValue))
+		for idx, item := range typedValue {
+			result[idx] = maskValue(item, path+"/"+strconv.Itoa(idx))
+		}
+		return result
+	}
+	if value != nil && (isSecretPath(path) || isSecretValue(value)) {
+		return MaskedValue
+	}
+	return value
+}
+
+// escapePathElement escapes a key, so it can be used as an element of JSON pointer
+func escapePathElement(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
+
+func isSecretPath(path string) bool {
+	path = strings.ToLower(path)
+	for _, marker := range secretKeyMarkers {
+		if strings.Contains(path, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSecretValue(value interface{}) bool {
+	str, ok := value.(string)
+	if !ok {
+		return false
+	}
+	for _, marker := range secretValueMarkers {
+		if strings.Contains(str, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// AsMap returns the change represented as NestedParameterMap, so it can be included into action descriptions
+func (change *ParameterChange) AsMap() NestedParameterMap {
+	result := NestedParameterMap{
+		"op":   change.Op,
+		"path": change.Path,
+	}
+	if change.OldValue != nil {
+		result["oldValue"] = change.OldValue
+	}
+	if change.Value != nil {
+		result["value"] = change.Value
+	}
+	return result
+}
+
+// String returns human-readable representation of the change
+func (change *ParameterChange) String() string {
+	switch change.Op {
+	case ChangeOpAdd:
+		return fmt.Sprintf("+ %s: %v", change.Path, change.Value)
+	case ChangeOpRemove:
+		return fmt.Sprintf("- %s: %v", change.Path, change.OldValue)
+	default:
+		return fmt.Sprintf("~ %s: %v -> %v", change.Path, change.OldValue, change.Value)
+	}
+}
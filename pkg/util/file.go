@@ -1,10 +1,14 @@
 package util
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/mattn/go-zglob"
 )
@@ -65,3 +69,68 @@ func FindYamlFiles(filePaths []string) ([]string, error) {
 
 	return allFiles, nil
 }
+
+// archiveFileMode is a mode of all files packed by ReadArchive
+const archiveFileMode = 0644
+
+// ReadArchive returns content of the given gzipped tarball or, if directory is given, packs it into gzipped tarball with
+// all files placed under the directory name (the same way "helm package" packs charts). Modification times and
+// permissions of local files are not packed, so the archive only changes when content of the directory changes
+func ReadArchive(path string) ([]byte, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't find archive to include %s: %s", path, err)
+	}
+	if !stat.IsDir() {
+		data, readErr := ioutil.ReadFile(path)
+		if readErr != nil {
+			return nil, fmt.Errorf("can't read archive to include %s: %s", path, readErr)
+		}
+		return data, nil
+	}
+
+	buf := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	root := filepath.Dir(filepath.Clean(path))
+	err = filepath.Walk(path, func(file string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil || !info.Mode().IsRegular() {
+			return walkErr
+		}
+		name, relErr := filepath.Rel(root, file)
+		if relErr != nil {
+			return relErr
+		}
+		data, readErr := ioutil.ReadFile(file)
+		if readErr != nil {
+			return readErr
+		}
+
+		header := &tar.Header{
+			Name:    filepath.ToSlash(name),
+			Mode:    archiveFileMode,
+			Size:    int64(len(data)),
+			ModTime: time.Unix(0, 0),
+		}
+		if writeErr := tarWriter.WriteHeader(header); writeErr != nil {
+			return writeErr
+		}
+		_, writeErr := tarWriter.Write(data)
+		return writeErr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't pack directory %s into archive: %s", path, err)
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("can't pack directory %s into archive: %s", path, err)
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("can't pack directory %s into archive: %s", path, err)
+	}
+
+	return buf.Bytes(), nil
+}
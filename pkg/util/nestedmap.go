@@ -1,6 +1,7 @@
 package util
 
 import (
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -12,7 +13,7 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// NestedParameterMap is a nested map of parameters, which allows to work with maps [string][string]...[string] -> string, int, bool values
+// NestedParameterMap is a nested map of parameters, which allows to work with maps [string][string]...[string] -> string, int, bool values, as well as lists of them
 type NestedParameterMap map[string]interface{}
 
 // UnmarshalYAML is a custom unmarshal function for NestedParameterMap to deal with interface{} -> string conversions
@@ -44,6 +45,21 @@ func put(src interface{}, dst NestedParameterMap, key string) {
 		return
 	}
 
+	// If it's a list, process its elements recursively (nil elements are kept as is)
+	if pSlice, ok := src.([]interface{}); ok {
+		result := make([]interface{}, len(pSlice))
+		for idx, pValue := range pSlice {
+			if pValue == nil {
+				continue
+			}
+			item := NestedParameterMap{"value": NestedParameterMap{}}
+			put(pValue, item, "value")
+			result[idx] = item["value"]
+		}
+		dst[key] = result
+		return
+	}
+
 	// Otherwise, just put string value into the map
 	if srcString, ok := src.(string); ok {
 		dst[key] = srcString
@@ -58,7 +74,7 @@ func put(src interface{}, dst NestedParameterMap, key string) {
 		return
 	}
 
-	panic("invalid type in NestedParameterMap (expected string, int, or bool)")
+	panic("invalid type in NestedParameterMap (expected string, int, bool, or list)")
 }
 
 // MakeCopy makes a shallow copy of parameter structure
@@ -110,14 +126,31 @@ func (src NestedParameterMap) GetString(key string, defaultValue string) (string
 }
 
 const (
-	includeMacrosPrefix = "@include "
+	includeMacrosPrefix        = "@include "
+	includeArchiveMacrosPrefix = "@includeArchive "
 )
 
-// ProcessIncludeMacros walks through specified NestedParameterMap and resolves @include macros
+// ProcessIncludeMacros walks through specified NestedParameterMap and resolves @include and @includeArchive macros.
+// @include is replaced with the content of given YAML files, while @includeArchive is replaced with the base64 encoded
+// gzipped tarball (either given file as is or given directory packed into it)
 func ProcessIncludeMacros(node NestedParameterMap, baseDir string) error {
 	for key, value := range node {
 		// If it's a string, evaluate macros
-		if str, strOk := value.(string); strOk && strings.HasPrefix(str, includeMacrosPrefix) {
+		if str, strOk := value.(string); strOk && strings.HasPrefix(str, includeArchiveMacrosPrefix) {
+			archivePath := strings.TrimSpace(str[len(includeArchiveMacrosPrefix):])
+			if len(archivePath) == 0 {
+				return fmt.Errorf("@includeArchive macros should have exactly one parameter - path to the file or directory to be included")
+			}
+			if !filepath.IsAbs(archivePath) {
+				archivePath = filepath.Join(baseDir, archivePath)
+			}
+
+			archive, err := ReadArchive(archivePath)
+			if err != nil {
+				return err
+			}
+			node[key] = base64.StdEncoding.EncodeToString(archive)
+		} else if str, strOk := value.(string); strOk && strings.HasPrefix(str, includeMacrosPrefix) {
 			filePathsStr := strings.TrimSpace(str[len(includeMacrosPrefix):])
 			if len(filePathsStr) == 0 {
 				return fmt.Errorf("@include macros should have exactly one parameter - paths to the files to be included")
@@ -248,6 +281,24 @@ func processParameterTreeNode(node interface{}, parameters *template.Parameters,
 		return nil
 	}
 
+	// If it's a list, process its elements recursively (nil elements are kept as is)
+	if paramsList, ok := node.([]interface{}); ok {
+		list := make([]interface{}, len(paramsList))
+		for idx, pValue := range paramsList {
+			if pValue == nil {
+				continue
+			}
+			item := NestedParameterMap{"value": NestedParameterMap{}}
+			err := processParameterTreeNode(pValue, parameters, item, "value", cache, mode)
+			if err != nil {
+				return err
+			}
+			list[idx] = item["value"]
+		}
+		result[key] = list
+		return nil
+	}
+
 	// Unknown type, return an error
-	return fmt.Errorf("invalid type in NestedParameterMap (expected string, int, or bool): %v", node)
+	return fmt.Errorf("invalid type in NestedParameterMap (expected string, int, bool, or list): %v", node)
 }
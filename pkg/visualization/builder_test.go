@@ -3,6 +3,8 @@ package visualization
 import (
 	"testing"
 
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
@@ -70,6 +72,33 @@ func TestVisualizationDiagram(t *testing.T) {
 
 }
 
+func TestVisualizationActionPlan(t *testing.T) {
+	plan := action.NewPlan()
+	first := plan.GetActionGraphNode("first")
+	first.AddAction(component.NewCreateAction("first", util.NestedParameterMap{}, nil), nil, false)
+	second := plan.GetActionGraphNode("second")
+	second.AddAction(component.NewCreateAction("second", util.NestedParameterMap{}, nil), nil, false)
+	second.AddBefore(first)
+	third := plan.GetActionGraphNode("third")
+	third.AddBefore(second)
+
+	graph := NewActionPlanGraph(plan)
+	levels := map[string]interface{}{}
+	for _, node := range graph.nodes {
+		levels[node["id"].(string)] = node["level"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"node-action-plan-first":  0,
+		"node-action-plan-second": 1,
+		"node-action-plan-third":  2,
+	}, levels, "Action plan visualization: node levels")
+	assert.Equal(t, 2, len(graph.edges), "Action plan visualization: edges")
+
+	dot := string(graph.GetDataDOT())
+	assert.Contains(t, dot, `"node-action-plan-first" -> "node-action-plan-second";`, "Action plan visualization: DOT edge")
+	assert.Contains(t, dot, `label="second\n[+] second"`, "Action plan visualization: DOT label")
+}
+
 func debug(t *testing.T, data []byte) {
 	t.Logf("JSON size: %d", len(data))
 }
@@ -0,0 +1,56 @@
+package visualization
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+)
+
+// NewActionPlanGraph produces a graph of the given action plan. Every node of the graph corresponds to a node of the
+// action plan with all its actions, and edges go from the nodes which have to be completed first to the nodes which
+// wait for them. Level of every node is the length of the longest chain of nodes it waits for, so the longest
+// chains (bottlenecks) can be easily spotted
+func NewActionPlanGraph(plan *action.Plan) *Graph {
+	graph := newGraph()
+
+	// process nodes in a stable order
+	keys := make([]string, 0, len(plan.NodeMap))
+	for key := range plan.NodeMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	levels := make(map[string]int)
+	for _, key := range keys {
+		node := plan.NodeMap[key]
+		graph.addNode(actionPlanNode{node: node}, calcActionPlanNodeLevel(node, levels))
+
+		id := idEscape(fmt.Sprintf("node-%s", actionPlanNode{node: node}.getID()))
+		graph.hasObject[id]["title"] = fmt.Sprintf("actions: %d, waits for: %d, blocks: %d", len(node.Actions), len(node.Before), len(node.BeforeRev))
+	}
+
+	for _, key := range keys {
+		node := plan.NodeMap[key]
+		for _, before := range node.Before {
+			graph.addEdge(newEdge(actionPlanNode{node: before}, actionPlanNode{node: node}, ""))
+		}
+	}
+
+	return graph
+}
+
+// calcActionPlanNodeLevel returns the length of the longest chain of nodes, which the given node waits for
+func calcActionPlanNodeLevel(node *action.GraphNode, levels map[string]int) int {
+	if level, ok := levels[node.Key]; ok {
+		return level
+	}
+	level := 0
+	for _, before := range node.Before {
+		if beforeLevel := calcActionPlanNodeLevel(before, levels) + 1; beforeLevel > level {
+			level = beforeLevel
+		}
+	}
+	levels[node.Key] = level
+	return level
+}
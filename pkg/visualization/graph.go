@@ -1,8 +1,11 @@
 package visualization
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"html"
+	"regexp"
 	"sort"
 	"strings"
 )
@@ -63,6 +66,49 @@ func (g *Graph) GetDataJSON() []byte {
 	return result
 }
 
+// GetDataDOT returns the graph in Graphviz DOT format. HTML markup gets removed from the labels
+func (g *Graph) GetDataDOT() []byte {
+	sort.Sort(g.nodes)
+	sort.Sort(g.edges)
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph aptomi {\n")
+	buf.WriteString("  node [shape=box];\n")
+	for _, node := range g.nodes {
+		buf.WriteString(fmt.Sprintf("  %s [label=%s", dotQuote(node["id"].(string)), dotQuote(dotLabel(node["label"]))))
+		if group, ok := node["group"].(string); ok && len(group) > 0 {
+			buf.WriteString(fmt.Sprintf(", group=%s", dotQuote(group)))
+		}
+		if title, ok := node["title"].(string); ok && len(title) > 0 {
+			buf.WriteString(fmt.Sprintf(", tooltip=%s", dotQuote(title)))
+		}
+		buf.WriteString("];\n")
+	}
+	for _, edge := range g.edges {
+		buf.WriteString(fmt.Sprintf("  %s -> %s", dotQuote(edge["from"].(string)), dotQuote(edge["to"].(string))))
+		if label := dotLabel(edge["label"]); len(label) > 0 {
+			buf.WriteString(fmt.Sprintf(" [label=%s]", dotQuote(label)))
+		}
+		buf.WriteString(";\n")
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+var htmlTagRegex = regexp.MustCompile("<[^>]*>")
+
+func dotLabel(label interface{}) string {
+	str, ok := label.(string)
+	if !ok {
+		return ""
+	}
+	return html.UnescapeString(htmlTagRegex.ReplaceAllString(str, ""))
+}
+
+func dotQuote(str string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(str) + "\""
+}
+
 func (g *Graph) addNode(n graphNode, level int) {
 	id := idEscape(fmt.Sprintf("node-%s", n.getID()))
 	if _, ok := g.hasObject[id]; !ok {
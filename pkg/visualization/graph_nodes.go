@@ -3,7 +3,9 @@ package visualization
 import (
 	"fmt"
 	"html"
+	"strings"
 
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
@@ -168,3 +170,34 @@ func (n errorNode) getID() string {
 func (n errorNode) getLabel() string {
 	return fmt.Sprintf("Error: %s", n.err)
 }
+
+/*
+	Action plan node
+*/
+type actionPlanNode struct {
+	node *action.GraphNode
+}
+
+func (n actionPlanNode) getGroup() string {
+	if len(n.node.Actions) > 0 {
+		return "actionPlanNode"
+	}
+	return "actionPlanNodeEmpty"
+}
+
+func (n actionPlanNode) getID() string {
+	return "action-plan-" + n.node.Key
+}
+
+func (n actionPlanNode) getLabel() string {
+	result := fmt.Sprintf("<b>%s</b>", html.EscapeString(n.node.Key))
+	for _, act := range n.node.Actions {
+		pretty, ok := act.DescribeChanges()["pretty"].(string)
+		if !ok {
+			pretty = act.GetKind()
+		}
+		// only the first line, the rest is a detailed description of changes
+		result += "\n" + html.EscapeString(strings.SplitN(pretty, "\n", 2)[0])
+	}
+	return result
+}